@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"os"
 
 	"github.com/RexArseny/loyalty_system/internal/app"
 	"github.com/RexArseny/loyalty_system/internal/app/config"
@@ -29,10 +31,33 @@ func main() {
 		mainLogger.Fatal("Can not init config", zap.Error(err))
 	}
 
+	if cfg.PrintConfig {
+		err = cfg.Print(os.Stdout)
+		if err != nil {
+			mainLogger.Fatal("Can not print config", zap.Error(err))
+		}
+		return
+	}
+
+	if args := flag.Args(); len(args) > 0 && args[0] == migrateCommand {
+		err = runMigrate(ctx, mainLogger.Named("migrator"), cfg, args[1:])
+		if err != nil {
+			mainLogger.Fatal("Can not run migrations", zap.Error(err))
+		}
+		return
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == roleCommand {
+		err = runRole(ctx, mainLogger.Named("role"), cfg, args[1:])
+		if err != nil {
+			mainLogger.Fatal("Can not set role", zap.Error(err))
+		}
+		return
+	}
+
 	dataRepository, err := repository.NewRepository(
 		ctx,
 		mainLogger.Named("repository"),
-		cfg.DatabaseURI,
+		cfg,
 	)
 	if err != nil {
 		mainLogger.Fatal("Can not init repository", zap.Error(err))
@@ -46,6 +71,8 @@ func main() {
 		mainLogger.Fatal("Can not init server", zap.Error(err))
 	}
 
+	go watchReload(ctx, mainLogger.Named("reload"), s)
+
 	err = s.ListenAndServe()
 	if err != nil {
 		mainLogger.Fatal("Can not listen and serve", zap.Error(err))
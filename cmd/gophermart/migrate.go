@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/RexArseny/loyalty_system/internal/app/config"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"go.uber.org/zap"
+)
+
+const migrateCommand = "migrate"
+
+var errMigrateUsage = errors.New("usage: gophermart [flags] migrate up|down [N]|version|force V")
+
+func runMigrate(ctx context.Context, logger *zap.Logger, cfg *config.Config, args []string) error {
+	if cfg.DatabaseURI == "" {
+		return errors.New("database uri is not set")
+	}
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	migrator := repository.NewMigrator(logger, cfg.DatabaseURI)
+
+	switch args[0] {
+	case "up":
+		err := migrator.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("can not migrate up: %w", err)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return errMigrateUsage
+			}
+		}
+		err := migrator.Down(ctx, steps)
+		if err != nil {
+			return fmt.Errorf("can not migrate down: %w", err)
+		}
+	case "force":
+		if len(args) < 2 {
+			return errMigrateUsage
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return errMigrateUsage
+		}
+		err = migrator.Force(ctx, version)
+		if err != nil {
+			return fmt.Errorf("can not force version: %w", err)
+		}
+	case "version":
+	default:
+		return errMigrateUsage
+	}
+
+	version, dirty, err := migrator.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("can not get version: %w", err)
+	}
+	logger.Info("Migration version", zap.Uint("version", version), zap.Bool("dirty", dirty))
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app"
+	"github.com/RexArseny/loyalty_system/internal/app/config"
+	"go.uber.org/zap"
+)
+
+func watchReload(ctx context.Context, logger *zap.Logger, s *app.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	cfg := s.Config()
+	interval := cfg.ConfigWatchInterval
+	modified := modTimes(cfg)
+
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	resetTicker := func() {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		if interval > 0 {
+			ticker = time.NewTicker(interval)
+			tick = ticker.C
+		}
+	}
+	resetTicker()
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			logger.Info("Received SIGHUP, reloading config")
+		case <-tick:
+			current := modTimes(s.Config())
+			if equalModTimes(modified, current) {
+				continue
+			}
+			modified = current
+			logger.Info("Config files changed, reloading config")
+		}
+
+		newCfg, err := config.Reload()
+		if err != nil {
+			logger.Error("Can not reload config, keeping previous", zap.Error(err))
+			continue
+		}
+		err = s.Reload(newCfg)
+		if err != nil {
+			logger.Error("Can not apply config, keeping previous", zap.Error(err))
+			continue
+		}
+
+		cfg = s.Config()
+		modified = modTimes(cfg)
+		if cfg.ConfigWatchInterval != interval {
+			interval = cfg.ConfigWatchInterval
+			resetTicker()
+		}
+	}
+}
+
+func modTimes(cfg *config.Config) map[string]time.Time {
+	times := make(map[string]time.Time)
+	for _, path := range []string{cfg.ConfigPath, cfg.PublicKeyPath, cfg.PrivateKeyPath} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		times[path] = info.ModTime()
+	}
+	return times
+}
+
+func equalModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, modified := range a {
+		if !b[path].Equal(modified) {
+			return false
+		}
+	}
+	return true
+}
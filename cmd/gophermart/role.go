@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/RexArseny/loyalty_system/internal/app/config"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"go.uber.org/zap"
+)
+
+const roleCommand = "role"
+
+var errRoleUsage = errors.New("usage: gophermart [flags] role LOGIN user|support|admin|merchant [MERCHANT_ID]")
+
+func runRole(ctx context.Context, logger *zap.Logger, cfg *config.Config, args []string) error {
+	if cfg.DatabaseURI == "" {
+		return errors.New("database uri is not set")
+	}
+	if len(args) != 2 && len(args) != 3 {
+		return errRoleUsage
+	}
+	login, role := args[0], models.Role(args[1])
+	if !role.Valid() || (role == models.RoleMerchant) != (len(args) == 3) {
+		return errRoleUsage
+	}
+	var merchantID string
+	if len(args) == 3 {
+		merchantID = args[2]
+	}
+
+	dataRepository, err := repository.NewDBRepository(ctx, logger, cfg)
+	if err != nil {
+		return fmt.Errorf("can not init repository: %w", err)
+	}
+	defer dataRepository.Close()
+
+	err = dataRepository.SetUserRole(ctx, login, string(role), merchantID)
+	if err != nil {
+		return fmt.Errorf("can not set role: %w", err)
+	}
+	logger.Info("Role set",
+		zap.String("login", login),
+		zap.String("role", string(role)),
+		zap.String("merchant_id", merchantID))
+
+	return nil
+}
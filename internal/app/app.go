@@ -2,43 +2,277 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"reflect"
+	"sync"
 
 	"github.com/RexArseny/loyalty_system/internal/app/config"
 	"github.com/RexArseny/loyalty_system/internal/app/controllers"
 	"github.com/RexArseny/loyalty_system/internal/app/external"
+	"github.com/RexArseny/loyalty_system/internal/app/grpcapi"
+	"github.com/RexArseny/loyalty_system/internal/app/logger"
 	"github.com/RexArseny/loyalty_system/internal/app/middlewares"
+	"github.com/RexArseny/loyalty_system/internal/app/openapi"
 	"github.com/RexArseny/loyalty_system/internal/app/repository"
 	"github.com/RexArseny/loyalty_system/internal/app/routers"
 	"github.com/RexArseny/loyalty_system/internal/app/usecases"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+type Server struct {
+	*http.Server
+	redirect     *http.Server
+	grpc         *grpc.Server
+	certificates *certificateReloader
+	logger       *zap.Logger
+	middleware   *middlewares.Middleware
+	cfg          *config.Config
+	m            sync.Mutex
+}
+
 func NewServer(
 	ctx context.Context,
-	logger *zap.Logger,
+	log *zap.Logger,
 	cfg *config.Config,
 	dataRepository repository.Repository,
-) (*http.Server, error) {
-	accrualServiceClient := external.NewAccrualServiceClient(logger.Named("accrual"), cfg.AccrualSystemAddress)
-	interactor := usecases.NewInteractor(ctx, logger.Named("interactor"), dataRepository, accrualServiceClient)
-	controller := controllers.NewController(logger.Named("controller"), interactor)
-	middleware, err := middlewares.NewMiddleware(
-		cfg.PublicKeyPath,
-		cfg.PrivateKeyPath,
-		logger.Named("middleware"),
+) (*Server, error) {
+	accrualServiceClient := external.NewAccrualServiceClient(
+		log.Named("accrual"),
+		cfg.AccrualSystemAddress,
+		cfg.AccrualRequestTimeout,
 	)
+	interactor := usecases.NewInteractor(ctx, log.Named("interactor"), cfg, dataRepository, accrualServiceClient)
+	controller := controllers.NewController(log.Named("controller"), interactor)
+	middleware, err := middlewares.NewMiddleware(cfg, log.Named("middleware"))
 	if err != nil {
 		return nil, fmt.Errorf("can not init middleware: %w", err)
 	}
-	router, err := routers.NewRouter(cfg, controller, middleware)
+	var validator *openapi.Validator
+	if cfg.OpenAPIValidateRequests || cfg.OpenAPIValidateResponses {
+		doc, err := openapi.Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("can not load openapi spec: %w", err)
+		}
+		validator, err = openapi.NewValidator(log.Named("openapi"), doc, cfg.OpenAPIValidateResponses)
+		if err != nil {
+			return nil, fmt.Errorf("can not init openapi validator: %w", err)
+		}
+	}
+	router, err := routers.NewRouter(cfg, controller, middleware, validator)
 	if err != nil {
 		return nil, fmt.Errorf("can not init router: %w", err)
 	}
 
-	return &http.Server{
-		Addr:    cfg.RunAddress,
-		Handler: router,
-	}, nil
+	err = logger.SetLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("can not init log level: %w", err)
+	}
+
+	server := &Server{
+		Server: &http.Server{
+			Addr:         cfg.RunAddress,
+			Handler:      router,
+			ReadTimeout:  cfg.ServerReadTimeout,
+			WriteTimeout: cfg.ServerWriteTimeout,
+			IdleTimeout:  cfg.ServerIdleTimeout,
+		},
+		logger:     log,
+		middleware: middleware,
+		cfg:        cfg,
+	}
+
+	if cfg.TLSEnabled() {
+		server.certificates, err = newCertificateReloader(
+			log.Named("tls"),
+			cfg.TLSCertPath,
+			cfg.TLSKeyPath,
+			cfg.TLSCertCheckInterval,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("can not init tls certificate: %w", err)
+		}
+		server.TLSConfig, err = newTLSConfig(cfg, server.certificates)
+		if err != nil {
+			return nil, fmt.Errorf("can not init tls config: %w", err)
+		}
+
+		if cfg.HTTPRedirectAddress != "" {
+			server.redirect = &http.Server{
+				Addr:         cfg.HTTPRedirectAddress,
+				Handler:      redirectHandler(cfg.RunAddress),
+				ReadTimeout:  cfg.ServerReadTimeout,
+				WriteTimeout: cfg.ServerWriteTimeout,
+				IdleTimeout:  cfg.ServerIdleTimeout,
+			}
+		}
+	}
+
+	if cfg.GRPCAddress != "" {
+		var creds credentials.TransportCredentials
+		if server.TLSConfig != nil {
+			creds = credentials.NewTLS(server.TLSConfig)
+		}
+		server.grpc = grpcapi.NewGRPCServer(
+			grpcapi.NewServer(log.Named("grpc"), interactor, middleware, cfg.GRPCOrderWatchInterval),
+			creds,
+		)
+	}
+
+	return server, nil
+}
+
+// ListenAndServe serves HTTPS with HTTP/2 when a TLS certificate is
+// configured and plain HTTP otherwise, along with the optional redirect and
+// gRPC listeners. A failure of any listener stops the others.
+func (s *Server) ListenAndServe() error {
+	errs := make(chan error, 2)
+	if s.redirect != nil {
+		go func() {
+			err := s.redirect.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("can not serve http redirect: %w", err)
+				_ = s.Server.Close()
+			}
+		}()
+	}
+	if s.grpc != nil {
+		go func() {
+			err := s.serveGRPC()
+			if err != nil {
+				errs <- err
+				_ = s.Server.Close()
+			}
+		}()
+	}
+
+	var err error
+	if s.certificates != nil {
+		err = s.Server.ListenAndServeTLS("", "")
+	} else {
+		err = s.Server.ListenAndServe()
+	}
+	if s.redirect != nil {
+		_ = s.redirect.Close()
+	}
+	if s.grpc != nil {
+		s.grpc.Stop()
+	}
+
+	select {
+	case listenerErr := <-errs:
+		return listenerErr
+	default:
+	}
+	return err
+}
+
+func (s *Server) serveGRPC() error {
+	listener, err := net.Listen("tcp", s.Config().GRPCAddress)
+	if err != nil {
+		return fmt.Errorf("can not listen grpc: %w", err)
+	}
+
+	err = s.grpc.Serve(listener)
+	if err != nil {
+		return fmt.Errorf("can not serve grpc: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.grpc != nil {
+		s.grpc.GracefulStop()
+	}
+	if s.redirect != nil {
+		err := s.redirect.Shutdown(ctx)
+		if err != nil {
+			return fmt.Errorf("can not shutdown http redirect: %w", err)
+		}
+	}
+	return s.Server.Shutdown(ctx)
+}
+
+var reloadableFields = map[string]struct{}{
+	"LogLevel":            {},
+	"PublicKeyPath":       {},
+	"PrivateKeyPath":      {},
+	"ConfigWatchInterval": {},
+	"CookieMaxAge":        {},
+	"CookieDomain":        {},
+	"CookiePath":          {},
+	"CookieSecure":        {},
+	"CookieHTTPOnly":      {},
+}
+
+// Reload applies the reloadable part of cfg without restarting the server.
+// Keys and the tls certificate are loaded before anything is changed and the
+// certificate is swapped only after the middleware accepted the new keys, so an
+// invalid reload keeps the previous config entirely.
+func (s *Server) Reload(cfg *config.Config) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	oldValue := reflect.ValueOf(s.cfg).Elem()
+	newValue := reflect.ValueOf(cfg).Elem()
+	var changed, ignored []string
+	for i := range oldValue.NumField() {
+		name := oldValue.Type().Field(i).Name
+		if reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			continue
+		}
+		if _, ok := reloadableFields[name]; ok {
+			changed = append(changed, name)
+		} else {
+			ignored = append(ignored, name)
+		}
+	}
+
+	_, err := zapcore.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("can not reload log level: %w", err)
+	}
+	var certificate loadedCertificate
+	if s.certificates != nil {
+		certificate, err = s.certificates.Load()
+		if err != nil {
+			return fmt.Errorf("can not reload tls certificate: %w", err)
+		}
+	}
+	rotated, err := s.middleware.Reload(cfg)
+	if err != nil {
+		return fmt.Errorf("can not reload middleware: %w", err)
+	}
+	if s.certificates != nil {
+		s.certificates.Store(certificate)
+	}
+	err = logger.SetLevel(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("can not reload log level: %w", err)
+	}
+
+	if len(ignored) != 0 {
+		s.logger.Warn("Config changes require restart", zap.Strings("fields", ignored))
+	}
+	s.logger.Info("Config reloaded", zap.Strings("changed", changed), zap.Bool("keys_rotated", rotated))
+
+	applied := *s.cfg
+	for _, name := range changed {
+		reflect.ValueOf(&applied).Elem().FieldByName(name).Set(newValue.FieldByName(name))
+	}
+	s.cfg = &applied
+
+	return nil
+}
+
+func (s *Server) Config() *config.Config {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.cfg
 }
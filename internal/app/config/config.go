@@ -3,6 +3,10 @@ package config
 import (
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
 
 	env "github.com/caarlos0/env/v11"
 )
@@ -12,31 +16,342 @@ const (
 	DefaultAccrualSystemAddress = "http://localhost:8080"
 	DefaultPublicKeyPath        = "public.pem"
 	DefaultPrivateKeyPath       = "private.pem"
+	DefaultLogLevel             = "info"
+	DefaultConfigWatchInterval  = 0
+
+	DefaultDatabaseRetryAttempts       = 3
+	DefaultDatabaseRetryInitialBackoff = 50 * time.Millisecond
+	DefaultDatabaseRetryMaxBackoff     = time.Second
+
+	DefaultDatabaseReplicaHealthCheckInterval = 5 * time.Second
+	DefaultDatabaseReadYourWrites             = 5 * time.Second
+
+	DefaultDatabaseMaxConns        = 0
+	DefaultDatabaseMinConns        = 0
+	DefaultDatabaseMaxConnLifetime = time.Hour
+	DefaultDatabaseMaxConnIdleTime = 30 * time.Minute
+
+	DefaultStatusCheckInterval   = 100 * time.Millisecond
+	DefaultStatusCheckBatchSize  = 10
+	DefaultAccrualRequestTimeout = 10 * time.Second
+	DefaultOrderBatchMaxSize     = 1000
+	DefaultOrderNumberSchemes    = "luhn"
+
+	DefaultPointsExpirationInterval = time.Hour
+	DefaultHoldTTL                  = 15 * time.Minute
+	DefaultHoldExpirationInterval   = time.Minute
+
+	DefaultLoyaltyTiers          = "silver:0:1,gold:1000:1.1,platinum:5000:1.25"
+	DefaultLoyaltyTierWindowDays = 365
+
+	DefaultReferralDailyLimit = 10
+
+	DefaultServerReadTimeout  = 10 * time.Second
+	DefaultServerWriteTimeout = 10 * time.Second
+	DefaultServerIdleTimeout  = time.Minute
+
+	DefaultGRPCOrderWatchInterval = time.Second
+
+	DefaultTLSMinVersion        = "1.2"
+	DefaultTLSCertCheckInterval = time.Minute
+
+	DefaultCookieMaxAge   = 900 * time.Second
+	DefaultCookiePath     = "/"
+	DefaultCookieSecure   = false
+	DefaultCookieHTTPOnly = false
+
+	configPathEnv = "CONFIG_PATH"
 )
 
+// Config is the effective configuration of gophermart. Every value is taken
+// from the first source that sets it in the following order: command line
+// flags, environment variables, the config file and the defaults.
 type Config struct {
-	RunAddress           string `env:"RUN_ADDRESS"`
-	DatabaseURI          string `env:"DATABASE_URI"`
-	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
-	PublicKeyPath        string `env:"PUBLIC_KEY_PATH"`
-	PrivateKeyPath       string `env:"PRIVATE_KEY_PATH"`
+	ConfigPath  string `env:"CONFIG_PATH" yaml:"-"`
+	PrintConfig bool   `yaml:"-"`
+
+	RunAddress           string `env:"RUN_ADDRESS" yaml:"run_address"`
+	DatabaseURI          string `env:"DATABASE_URI" yaml:"database_uri"`
+	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS" yaml:"accrual_system_address"`
+	PublicKeyPath        string `env:"PUBLIC_KEY_PATH" yaml:"public_key_path"`
+	PrivateKeyPath       string `env:"PRIVATE_KEY_PATH" yaml:"private_key_path"`
+	AutoMigrate          bool   `env:"AUTO_MIGRATE" yaml:"auto_migrate"`
+	LogLevel             string `env:"LOG_LEVEL" yaml:"log_level"`
+
+	ConfigWatchInterval time.Duration `env:"CONFIG_WATCH_INTERVAL" yaml:"config_watch_interval"`
+
+	DatabaseRetryAttempts       int           `env:"DATABASE_RETRY_ATTEMPTS" yaml:"database_retry_attempts"`
+	DatabaseRetryInitialBackoff time.Duration `env:"DATABASE_RETRY_INITIAL_BACKOFF" yaml:"database_retry_initial_backoff"`
+	DatabaseRetryMaxBackoff     time.Duration `env:"DATABASE_RETRY_MAX_BACKOFF" yaml:"database_retry_max_backoff"`
+
+	DatabaseReplicaURIs                []string      `env:"DATABASE_REPLICA_URIS" envSeparator:"," yaml:"database_replica_uris"`
+	DatabaseReplicaHealthCheckInterval time.Duration `env:"DATABASE_REPLICA_HEALTH_CHECK_INTERVAL" yaml:"database_replica_health_check_interval"`
+	DatabaseReadYourWrites             time.Duration `env:"DATABASE_READ_YOUR_WRITES" yaml:"database_read_your_writes"`
+
+	DatabaseMaxConns        int           `env:"DATABASE_MAX_CONNS" yaml:"database_max_conns"`
+	DatabaseMinConns        int           `env:"DATABASE_MIN_CONNS" yaml:"database_min_conns"`
+	DatabaseMaxConnLifetime time.Duration `env:"DATABASE_MAX_CONN_LIFETIME" yaml:"database_max_conn_lifetime"`
+	DatabaseMaxConnIdleTime time.Duration `env:"DATABASE_MAX_CONN_IDLE_TIME" yaml:"database_max_conn_idle_time"`
+
+	StatusCheckInterval   time.Duration `env:"STATUS_CHECK_INTERVAL" yaml:"status_check_interval"`
+	StatusCheckBatchSize  int           `env:"STATUS_CHECK_BATCH_SIZE" yaml:"status_check_batch_size"`
+	AccrualRequestTimeout time.Duration `env:"ACCRUAL_REQUEST_TIMEOUT" yaml:"accrual_request_timeout"`
+	AccrualRateLimit      float64       `env:"ACCRUAL_RATE_LIMIT" yaml:"accrual_rate_limit"`
+	OrderBatchMaxSize     int           `env:"ORDER_BATCH_MAX_SIZE" yaml:"order_batch_max_size"`
+
+	OrderNumberSchemes       []string `env:"ORDER_NUMBER_SCHEMES" envSeparator:"," yaml:"order_number_schemes"`
+	OrderNumberPrefixSchemes []string `env:"ORDER_NUMBER_PREFIX_SCHEMES" envSeparator:"," yaml:"order_number_prefix_schemes"`
+
+	PointsExpiryDays         int           `env:"POINTS_EXPIRY_DAYS" yaml:"points_expiry_days"`
+	PointsExpirationInterval time.Duration `env:"POINTS_EXPIRATION_INTERVAL" yaml:"points_expiration_interval"`
+
+	TransferMaxSum     float64 `env:"TRANSFER_MAX_SUM" yaml:"transfer_max_sum"`
+	TransferDailyLimit float64 `env:"TRANSFER_DAILY_LIMIT" yaml:"transfer_daily_limit"`
+
+	HoldTTL                time.Duration `env:"HOLD_TTL" yaml:"hold_ttl"`
+	HoldExpirationInterval time.Duration `env:"HOLD_EXPIRATION_INTERVAL" yaml:"hold_expiration_interval"`
+
+	LoyaltyTiers          []string `env:"LOYALTY_TIERS" envSeparator:"," yaml:"loyalty_tiers"`
+	LoyaltyTierWindowDays int      `env:"LOYALTY_TIER_WINDOW_DAYS" yaml:"loyalty_tier_window_days"`
+
+	ReferralBonus      float64 `env:"REFERRAL_BONUS" yaml:"referral_bonus"`
+	ReferralDailyLimit int     `env:"REFERRAL_DAILY_LIMIT" yaml:"referral_daily_limit"`
+	ReferralMaxRewards int     `env:"REFERRAL_MAX_REWARDS" yaml:"referral_max_rewards"`
+
+	ServerReadTimeout  time.Duration `env:"SERVER_READ_TIMEOUT" yaml:"server_read_timeout"`
+	ServerWriteTimeout time.Duration `env:"SERVER_WRITE_TIMEOUT" yaml:"server_write_timeout"`
+	ServerIdleTimeout  time.Duration `env:"SERVER_IDLE_TIMEOUT" yaml:"server_idle_timeout"`
+
+	OpenAPIValidateRequests  bool `env:"OPENAPI_VALIDATE_REQUESTS" yaml:"openapi_validate_requests"`
+	OpenAPIValidateResponses bool `env:"OPENAPI_VALIDATE_RESPONSES" yaml:"openapi_validate_responses"`
+
+	GRPCAddress            string        `env:"GRPC_ADDRESS" yaml:"grpc_address"`
+	GRPCOrderWatchInterval time.Duration `env:"GRPC_ORDER_WATCH_INTERVAL" yaml:"grpc_order_watch_interval"`
+
+	TLSCertPath          string        `env:"TLS_CERT_PATH" yaml:"tls_cert_path"`
+	TLSKeyPath           string        `env:"TLS_KEY_PATH" yaml:"tls_key_path"`
+	TLSMinVersion        string        `env:"TLS_MIN_VERSION" yaml:"tls_min_version"`
+	TLSCipherSuites      []string      `env:"TLS_CIPHER_SUITES" envSeparator:"," yaml:"tls_cipher_suites"`
+	TLSCertCheckInterval time.Duration `env:"TLS_CERT_CHECK_INTERVAL" yaml:"tls_cert_check_interval"`
+	HTTPRedirectAddress  string        `env:"HTTP_REDIRECT_ADDRESS" yaml:"http_redirect_address"`
+
+	CookieMaxAge   time.Duration `env:"COOKIE_MAX_AGE" yaml:"cookie_max_age"`
+	CookieDomain   string        `env:"COOKIE_DOMAIN" yaml:"cookie_domain"`
+	CookiePath     string        `env:"COOKIE_PATH" yaml:"cookie_path"`
+	CookieSecure   bool          `env:"COOKIE_SECURE" yaml:"cookie_secure"`
+	CookieHTTPOnly bool          `env:"COOKIE_HTTP_ONLY" yaml:"cookie_http_only"`
 }
 
 func Init() (*Config, error) {
-	var cfg Config
+	var flags Config
+	flag.CommandLine = newFlagSet(os.Args[0], &flags)
+	flag.CommandLine.SetOutput(os.Stderr)
+	flag.Parse()
 
-	flag.StringVar(&cfg.RunAddress, "a", DefaultRunAddress, "run address")
-	flag.StringVar(&cfg.DatabaseURI, "d", "", "database uri")
-	flag.StringVar(&cfg.AccrualSystemAddress, "r", DefaultAccrualSystemAddress, "accrual system address")
-	flag.StringVar(&cfg.PublicKeyPath, "p", DefaultPublicKeyPath, "public key path")
-	flag.StringVar(&cfg.PrivateKeyPath, "s", DefaultPrivateKeyPath, "private key path")
+	cfg, err := load(flag.CommandLine)
+	if err != nil {
+		return nil, err
+	}
 
-	flag.Parse()
+	err = cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Reload reads the config file and the environment again while keeping the
+// command line flags given on startup.
+func Reload() (*Config, error) {
+	cfg, err := load(flag.CommandLine)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func load(parsed *flag.FlagSet) (*Config, error) {
+	var cfg Config
+	effective := newFlagSet("effective", &cfg)
+
+	configPath := os.Getenv(configPathEnv)
+	if isSet(parsed, "c") {
+		configPath = parsed.Lookup("c").Value.String()
+	}
+	if configPath != "" {
+		err := loadFile(configPath, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("can not load config file: %w", err)
+		}
+	}
 
 	err := env.Parse(&cfg)
 	if err != nil {
 		return nil, fmt.Errorf("can not parse env: %w", err)
 	}
 
+	var errs []error
+	parsed.Visit(func(f *flag.Flag) {
+		err := effective.Set(f.Name, f.Value.String())
+		if err != nil {
+			errs = append(errs, err)
+		}
+	})
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("can not apply flags: %v", errs)
+	}
+	cfg.ConfigPath = configPath
+
 	return &cfg, nil
 }
+
+func newFlagSet(name string, cfg *Config) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.SetOutput(io.Discard)
+
+	flags.StringVar(&cfg.ConfigPath, "c", "", "config file path (YAML or JSON)")
+	flags.BoolVar(&cfg.PrintConfig, "print-config", false, "print effective config with secrets redacted and exit")
+
+	flags.StringVar(&cfg.RunAddress, "a", DefaultRunAddress, "run address")
+	flags.StringVar(&cfg.DatabaseURI, "d", "", "database uri")
+	flags.StringVar(&cfg.AccrualSystemAddress, "r", DefaultAccrualSystemAddress, "accrual system address")
+	flags.StringVar(&cfg.PublicKeyPath, "p", DefaultPublicKeyPath, "public key path")
+	flags.StringVar(&cfg.PrivateKeyPath, "s", DefaultPrivateKeyPath, "private key path")
+	flags.BoolVar(&cfg.AutoMigrate, "auto-migrate", true, "apply database migrations on startup")
+	flags.StringVar(&cfg.LogLevel, "log-level", DefaultLogLevel, "log level")
+
+	flags.DurationVar(&cfg.ConfigWatchInterval, "config-watch-interval", DefaultConfigWatchInterval,
+		"interval between checks of config and key files for changes, 0 disables")
+
+	flags.IntVar(&cfg.DatabaseRetryAttempts, "db-retry-attempts", DefaultDatabaseRetryAttempts,
+		"max attempts of a retryable database operation")
+	flags.DurationVar(&cfg.DatabaseRetryInitialBackoff, "db-retry-initial-backoff", DefaultDatabaseRetryInitialBackoff,
+		"initial backoff between database retries")
+	flags.DurationVar(&cfg.DatabaseRetryMaxBackoff, "db-retry-max-backoff", DefaultDatabaseRetryMaxBackoff,
+		"max backoff between database retries")
+
+	flags.Var((*listValue)(&cfg.DatabaseReplicaURIs), "db-replicas", "comma separated read replica database uris")
+	flags.DurationVar(&cfg.DatabaseReplicaHealthCheckInterval, "db-replica-health-check-interval",
+		DefaultDatabaseReplicaHealthCheckInterval, "interval between read replica health checks")
+	flags.DurationVar(&cfg.DatabaseReadYourWrites, "db-read-your-writes", DefaultDatabaseReadYourWrites,
+		"how long reads of a user go to the primary after their write, 0 disables")
+
+	flags.IntVar(&cfg.DatabaseMaxConns, "db-max-conns", DefaultDatabaseMaxConns,
+		"max database connections per pool, 0 uses the driver default")
+	flags.IntVar(&cfg.DatabaseMinConns, "db-min-conns", DefaultDatabaseMinConns, "min database connections per pool")
+	flags.DurationVar(&cfg.DatabaseMaxConnLifetime, "db-max-conn-lifetime", DefaultDatabaseMaxConnLifetime,
+		"max lifetime of a database connection")
+	flags.DurationVar(&cfg.DatabaseMaxConnIdleTime, "db-max-conn-idle-time", DefaultDatabaseMaxConnIdleTime,
+		"max idle time of a database connection")
+
+	flags.DurationVar(&cfg.StatusCheckInterval, "status-check-interval", DefaultStatusCheckInterval,
+		"interval between order status checks")
+	flags.IntVar(&cfg.StatusCheckBatchSize, "status-check-batch-size", DefaultStatusCheckBatchSize,
+		"max orders checked at once")
+	flags.DurationVar(&cfg.AccrualRequestTimeout, "accrual-request-timeout", DefaultAccrualRequestTimeout,
+		"accrual system request timeout")
+	flags.Float64Var(&cfg.AccrualRateLimit, "accrual-rate-limit", 0,
+		"max requests per second to the accrual system, 0 disables the limit")
+	flags.IntVar(&cfg.OrderBatchMaxSize, "order-batch-max-size", DefaultOrderBatchMaxSize,
+		"max orders in one batch upload")
+
+	cfg.OrderNumberSchemes = strings.Split(DefaultOrderNumberSchemes, ",")
+	flags.Var((*listValue)(&cfg.OrderNumberSchemes), "order-number-schemes",
+		"comma separated check digit schemes of order numbers: luhn, verhoeff, damm or mod11")
+	flags.Var((*listValue)(&cfg.OrderNumberPrefixSchemes), "order-number-prefix-schemes",
+		"comma separated schemes of order numbers by prefix as prefix:scheme|scheme or from-to:scheme|scheme")
+
+	flags.IntVar(&cfg.PointsExpiryDays, "points-expiry-days", 0,
+		"days after accrual when points expire, 0 disables expiration")
+	flags.DurationVar(&cfg.PointsExpirationInterval, "points-expiration-interval", DefaultPointsExpirationInterval,
+		"interval between runs of the points expiration job")
+
+	flags.Float64Var(&cfg.TransferMaxSum, "transfer-max-sum", 0, "max points in one transfer, 0 disables the limit")
+	flags.Float64Var(&cfg.TransferDailyLimit, "transfer-daily-limit", 0,
+		"max points a user sends in 24 hours, 0 disables the limit")
+
+	flags.DurationVar(&cfg.HoldTTL, "hold-ttl", DefaultHoldTTL, "time after which an uncaptured hold is released")
+	flags.DurationVar(&cfg.HoldExpirationInterval, "hold-expiration-interval", DefaultHoldExpirationInterval,
+		"interval between runs of the hold expiration job")
+
+	cfg.LoyaltyTiers = strings.Split(DefaultLoyaltyTiers, ",")
+	flags.Var((*listValue)(&cfg.LoyaltyTiers), "loyalty-tiers",
+		"comma separated loyalty tiers as name:threshold:multiplier, empty disables tiers")
+	flags.IntVar(&cfg.LoyaltyTierWindowDays, "loyalty-tier-window-days", DefaultLoyaltyTierWindowDays,
+		"days of accruals counted towards a loyalty tier, 0 counts all accruals")
+
+	flags.Float64Var(&cfg.ReferralBonus, "referral-bonus", 0,
+		"points credited to the referrer and the referred user after the first processed order")
+	flags.IntVar(&cfg.ReferralDailyLimit, "referral-daily-limit", DefaultReferralDailyLimit,
+		"max users registered with one referral code in 24 hours, 0 disables the limit")
+	flags.IntVar(&cfg.ReferralMaxRewards, "referral-max-rewards", 0,
+		"max referrals a referrer gets a bonus for, 0 disables the limit")
+
+	flags.DurationVar(&cfg.ServerReadTimeout, "server-read-timeout", DefaultServerReadTimeout, "server read timeout")
+	flags.DurationVar(&cfg.ServerWriteTimeout, "server-write-timeout", DefaultServerWriteTimeout,
+		"server write timeout")
+	flags.DurationVar(&cfg.ServerIdleTimeout, "server-idle-timeout", DefaultServerIdleTimeout, "server idle timeout")
+
+	flags.BoolVar(&cfg.OpenAPIValidateRequests, "openapi-validate-requests", false,
+		"reject requests not matching the openapi spec with 400")
+	flags.BoolVar(&cfg.OpenAPIValidateResponses, "openapi-validate-responses", false,
+		"replace responses not matching the openapi spec with 500, for tests only")
+
+	flags.StringVar(&cfg.GRPCAddress, "g", "", "grpc run address, empty disables grpc")
+	flags.DurationVar(&cfg.GRPCOrderWatchInterval, "grpc-order-watch-interval", DefaultGRPCOrderWatchInterval,
+		"interval between order status checks of a grpc order watch stream")
+
+	flags.StringVar(&cfg.TLSCertPath, "tls-cert", "", "tls certificate path, enables https")
+	flags.StringVar(&cfg.TLSKeyPath, "tls-key", "", "tls private key path")
+	flags.StringVar(&cfg.TLSMinVersion, "tls-min-version", DefaultTLSMinVersion, "minimum tls version: 1.2 or 1.3")
+	flags.Var((*listValue)(&cfg.TLSCipherSuites), "tls-cipher-suites",
+		"comma separated tls 1.2 cipher suites, empty uses the go defaults")
+	flags.DurationVar(&cfg.TLSCertCheckInterval, "tls-cert-check-interval", DefaultTLSCertCheckInterval,
+		"interval between checks of the tls certificate files for renewal, 0 disables")
+	flags.StringVar(&cfg.HTTPRedirectAddress, "http-redirect-address", "",
+		"address of a plain http listener redirecting to https, empty disables")
+
+	flags.DurationVar(&cfg.CookieMaxAge, "cookie-max-age", DefaultCookieMaxAge, "authorization cookie max age")
+	flags.StringVar(&cfg.CookieDomain, "cookie-domain", "", "authorization cookie domain")
+	flags.StringVar(&cfg.CookiePath, "cookie-path", DefaultCookiePath, "authorization cookie path")
+	flags.BoolVar(&cfg.CookieSecure, "cookie-secure", DefaultCookieSecure, "set secure attribute on cookies")
+	flags.BoolVar(&cfg.CookieHTTPOnly, "cookie-http-only", DefaultCookieHTTPOnly, "set http only attribute on cookies")
+
+	return flags
+}
+
+func isSet(flags *flag.FlagSet, name string) bool {
+	var set bool
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+type listValue []string
+
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
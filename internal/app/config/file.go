@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "xxxxx"
+
+var passwordPattern = regexp.MustCompile(`(password=)\S+|(://[^:/@]*:)[^@]*(@)`)
+
+func loadFile(path string, cfg *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can not open config file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	err = decoder.Decode(cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("can not parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (c *Config) Print(w io.Writer) error {
+	cfg := *c
+	cfg.DatabaseURI = redact(cfg.DatabaseURI)
+	cfg.DatabaseReplicaURIs = make([]string, 0, len(c.DatabaseReplicaURIs))
+	for _, uri := range c.DatabaseReplicaURIs {
+		cfg.DatabaseReplicaURIs = append(cfg.DatabaseReplicaURIs, redact(uri))
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	err := encoder.Encode(&cfg)
+	if err != nil {
+		return fmt.Errorf("can not encode config: %w", err)
+	}
+	err = encoder.Close()
+	if err != nil {
+		return fmt.Errorf("can not encode config: %w", err)
+	}
+
+	return nil
+}
+
+func redact(uri string) string {
+	return passwordPattern.ReplaceAllString(uri, "${1}${2}"+redacted+"${3}")
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/RexArseny/loyalty_system/internal/app/ordernumber"
+)
+
+// ParseOrderNumberPolicy builds the order number policy from the names of the
+// default schemes and prefix rules written as prefix:scheme|scheme or
+// from-to:scheme|scheme for a range of prefixes of the same length.
+func ParseOrderNumberPolicy(schemes []string, prefixSchemes []string) (*ordernumber.Policy, error) {
+	if len(schemes) == 0 && len(prefixSchemes) == 0 {
+		return nil, errors.New("no order number schemes, every order number would be rejected")
+	}
+
+	validators, err := parseOrderNumberSchemes(schemes)
+	if err != nil {
+		return nil, err
+	}
+	policy := &ordernumber.Policy{Default: validators}
+
+	for _, value := range prefixSchemes {
+		prefix, names, ok := strings.Cut(value, ":")
+		if !ok || prefix == "" || names == "" {
+			return nil, fmt.Errorf("invalid order number prefix scheme %q, want prefix:scheme|scheme", value)
+		}
+		from, to, ok := strings.Cut(prefix, "-")
+		if !ok {
+			to = from
+		}
+		if !digitsOnly(from) || !digitsOnly(to) || len(from) != len(to) || from > to {
+			return nil, fmt.Errorf("invalid prefix of order number prefix scheme %q", value)
+		}
+		validators, err := parseOrderNumberSchemes(strings.Split(names, "|"))
+		if err != nil {
+			return nil, err
+		}
+		policy.Rules = append(policy.Rules, ordernumber.Rule{
+			From:       from,
+			To:         to,
+			Validators: validators,
+		})
+	}
+	return policy, nil
+}
+
+func parseOrderNumberSchemes(names []string) ([]ordernumber.Validator, error) {
+	validators := make([]ordernumber.Validator, 0, len(names))
+	for _, name := range names {
+		validator, ok := ordernumber.Lookup(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown order number scheme %q, want one of %s",
+				name, strings.Join(ordernumber.Names(), ", "))
+		}
+		validators = append(validators, validator)
+	}
+	return validators, nil
+}
+
+func digitsOnly(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, char := range value {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
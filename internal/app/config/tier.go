@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+)
+
+// ParseLoyaltyTiers parses tiers written as name:threshold:multiplier. The
+// tiers must be sorted by threshold and the first one must start at zero.
+func ParseLoyaltyTiers(values []string) (models.LoyaltyTiers, error) {
+	tiers := make(models.LoyaltyTiers, 0, len(values))
+	for _, value := range values {
+		parts := strings.Split(value, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid loyalty tier %q, want name:threshold:multiplier", value)
+		}
+		threshold, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || threshold < 0 || math.IsInf(threshold, 0) || math.IsNaN(threshold) {
+			return nil, fmt.Errorf("invalid threshold of loyalty tier %q", value)
+		}
+		multiplier, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || multiplier <= 0 || math.IsInf(multiplier, 0) || math.IsNaN(multiplier) {
+			return nil, fmt.Errorf("invalid multiplier of loyalty tier %q", value)
+		}
+		if tiers.Index(parts[0]) >= 0 {
+			return nil, fmt.Errorf("duplicate loyalty tier %q", parts[0])
+		}
+		if len(tiers) == 0 && threshold != 0 {
+			return nil, fmt.Errorf("first loyalty tier %q must have threshold 0", parts[0])
+		}
+		if len(tiers) > 0 && threshold <= tiers[len(tiers)-1].Threshold {
+			return nil, fmt.Errorf("loyalty tier %q must have a higher threshold than %q",
+				parts[0], tiers[len(tiers)-1].Name)
+		}
+		tiers = append(tiers, models.LoyaltyTier{
+			Name:       parts[0],
+			Threshold:  threshold,
+			Multiplier: multiplier,
+		})
+	}
+	return tiers, nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func ParseTLSVersion(version string) (uint16, error) {
+	value, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unsupported tls version %q", version)
+	}
+	return value, nil
+}
+
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	suites := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := suites[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertPath != ""
+}
+
+func (c *Config) validateTLS() []error {
+	var errs []error
+
+	if (c.TLSCertPath == "") != (c.TLSKeyPath == "") {
+		errs = append(errs, errors.New("tls cert path and tls key path must be set together"))
+	}
+	if c.TLSCertPath != "" {
+		errs = append(errs, validateFile("tls cert path", c.TLSCertPath))
+	}
+	if c.TLSKeyPath != "" {
+		errs = append(errs, validateFile("tls key path", c.TLSKeyPath))
+	}
+
+	_, err := ParseTLSVersion(c.TLSMinVersion)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	_, err = ParseCipherSuites(c.TLSCipherSuites)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, validateDuration("tls cert check interval", c.TLSCertCheckInterval, false))
+
+	if c.HTTPRedirectAddress != "" {
+		if !c.TLSEnabled() {
+			errs = append(errs, errors.New("http redirect address requires tls"))
+		}
+		errs = append(errs, validateAddress("http redirect address", c.HTTPRedirectAddress))
+	}
+
+	return errs
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func (c *Config) Validate() error {
+	var errs []error
+
+	errs = append(errs, validateAddress("run address", c.RunAddress))
+	errs = append(errs, validateURL("accrual system address", c.AccrualSystemAddress))
+	errs = append(errs, validateFile("public key path", c.PublicKeyPath))
+	errs = append(errs, validateFile("private key path", c.PrivateKeyPath))
+	_, err := zapcore.ParseLevel(c.LogLevel)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid log level %q: %w", c.LogLevel, err))
+	}
+	errs = append(errs, validateDuration("config watch interval", c.ConfigWatchInterval, false))
+
+	if c.DatabaseURI == "" && len(c.DatabaseReplicaURIs) != 0 {
+		errs = append(errs, errors.New("database replica uris require database uri"))
+	}
+	if c.DatabaseRetryAttempts < 1 {
+		errs = append(errs, fmt.Errorf("database retry attempts must be positive, got %d", c.DatabaseRetryAttempts))
+	}
+	errs = append(errs, validateDuration("database retry initial backoff", c.DatabaseRetryInitialBackoff, false))
+	errs = append(errs, validateDuration("database retry max backoff", c.DatabaseRetryMaxBackoff, false))
+	if c.DatabaseRetryInitialBackoff > c.DatabaseRetryMaxBackoff {
+		errs = append(errs, fmt.Errorf("database retry initial backoff %s is greater than max backoff %s",
+			c.DatabaseRetryInitialBackoff, c.DatabaseRetryMaxBackoff))
+	}
+	errs = append(errs, validateDuration("database replica health check interval",
+		c.DatabaseReplicaHealthCheckInterval, true))
+	errs = append(errs, validateDuration("database read your writes", c.DatabaseReadYourWrites, false))
+
+	if c.DatabaseMaxConns < 0 {
+		errs = append(errs, fmt.Errorf("database max conns must not be negative, got %d", c.DatabaseMaxConns))
+	}
+	if c.DatabaseMinConns < 0 {
+		errs = append(errs, fmt.Errorf("database min conns must not be negative, got %d", c.DatabaseMinConns))
+	}
+	if c.DatabaseMaxConns > 0 && c.DatabaseMinConns > c.DatabaseMaxConns {
+		errs = append(errs, fmt.Errorf("database min conns %d is greater than max conns %d",
+			c.DatabaseMinConns, c.DatabaseMaxConns))
+	}
+	errs = append(errs, validateDuration("database max conn lifetime", c.DatabaseMaxConnLifetime, false))
+	errs = append(errs, validateDuration("database max conn idle time", c.DatabaseMaxConnIdleTime, false))
+
+	errs = append(errs, validateDuration("status check interval", c.StatusCheckInterval, true))
+	if c.StatusCheckBatchSize < 1 {
+		errs = append(errs, fmt.Errorf("status check batch size must be positive, got %d", c.StatusCheckBatchSize))
+	}
+	errs = append(errs, validateDuration("accrual request timeout", c.AccrualRequestTimeout, false))
+	if c.AccrualRateLimit < 0 || math.IsNaN(c.AccrualRateLimit) || math.IsInf(c.AccrualRateLimit, 0) {
+		errs = append(errs, fmt.Errorf("accrual rate limit must not be negative, got %v", c.AccrualRateLimit))
+	}
+	if c.OrderBatchMaxSize < 1 {
+		errs = append(errs, fmt.Errorf("order batch max size must be positive, got %d", c.OrderBatchMaxSize))
+	}
+	_, err = ParseOrderNumberPolicy(c.OrderNumberSchemes, c.OrderNumberPrefixSchemes)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.PointsExpiryDays < 0 {
+		errs = append(errs, fmt.Errorf("points expiry days must not be negative, got %d", c.PointsExpiryDays))
+	}
+	errs = append(errs, validateDuration("points expiration interval", c.PointsExpirationInterval, true))
+
+	if c.TransferMaxSum < 0 || math.IsNaN(c.TransferMaxSum) {
+		errs = append(errs, fmt.Errorf("transfer max sum must not be negative, got %v", c.TransferMaxSum))
+	}
+	if c.TransferDailyLimit < 0 || math.IsNaN(c.TransferDailyLimit) {
+		errs = append(errs, fmt.Errorf("transfer daily limit must not be negative, got %v", c.TransferDailyLimit))
+	}
+
+	errs = append(errs, validateDuration("hold ttl", c.HoldTTL, true))
+	errs = append(errs, validateDuration("hold expiration interval", c.HoldExpirationInterval, true))
+
+	_, err = ParseLoyaltyTiers(c.LoyaltyTiers)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if c.LoyaltyTierWindowDays < 0 {
+		errs = append(errs, fmt.Errorf("loyalty tier window days must not be negative, got %d",
+			c.LoyaltyTierWindowDays))
+	}
+
+	if c.ReferralBonus < 0 || math.IsNaN(c.ReferralBonus) || math.IsInf(c.ReferralBonus, 0) {
+		errs = append(errs, fmt.Errorf("referral bonus must not be negative, got %v", c.ReferralBonus))
+	}
+	if c.ReferralDailyLimit < 0 {
+		errs = append(errs, fmt.Errorf("referral daily limit must not be negative, got %d", c.ReferralDailyLimit))
+	}
+	if c.ReferralMaxRewards < 0 {
+		errs = append(errs, fmt.Errorf("referral max rewards must not be negative, got %d", c.ReferralMaxRewards))
+	}
+
+	errs = append(errs, validateDuration("server read timeout", c.ServerReadTimeout, false))
+	errs = append(errs, validateDuration("server write timeout", c.ServerWriteTimeout, false))
+	errs = append(errs, validateDuration("server idle timeout", c.ServerIdleTimeout, false))
+
+	if c.GRPCAddress != "" {
+		errs = append(errs, validateAddress("grpc address", c.GRPCAddress))
+	}
+	errs = append(errs, validateDuration("grpc order watch interval", c.GRPCOrderWatchInterval, true))
+
+	errs = append(errs, c.validateTLS()...)
+
+	errs = append(errs, validateDuration("cookie max age", c.CookieMaxAge, true))
+	if c.CookieMaxAge%time.Second != 0 {
+		errs = append(errs, fmt.Errorf("cookie max age must be a whole number of seconds, got %s", c.CookieMaxAge))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateAddress(name string, address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, address, err)
+	}
+	value, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: bad port", name, address)
+	}
+	if value == 0 && port != "0" {
+		return fmt.Errorf("invalid %s %q: bad port", name, address)
+	}
+	return nil
+}
+
+func validateURL(name string, address string) error {
+	value, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, address, err)
+	}
+	if value.Scheme != "http" && value.Scheme != "https" {
+		return fmt.Errorf("invalid %s %q: scheme must be http or https", name, address)
+	}
+	if value.Host == "" {
+		return fmt.Errorf("invalid %s %q: missing host", name, address)
+	}
+	return nil
+}
+
+func validateFile(name string, path string) error {
+	if path == "" {
+		return fmt.Errorf("%s is not set", name)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("invalid %s: %s is a directory", name, path)
+	}
+	return nil
+}
+
+func validateDuration(name string, value time.Duration, positive bool) error {
+	if positive && value <= 0 {
+		return fmt.Errorf("%s must be positive, got %s", name, value)
+	}
+	if value < 0 {
+		return fmt.Errorf("%s must not be negative, got %s", name, value)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/RexArseny/loyalty_system/internal/app/external"
+	"github.com/RexArseny/loyalty_system/internal/app/middlewares"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const userIDParam = "user_id"
+
+// ActiveUser must follow GetJWT and rejects tokens of disabled or deleted
+// users, which stay valid until they expire otherwise.
+func (c *Controller) ActiveUser(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		ctx.Abort()
+		return
+	}
+
+	role, err := c.interactor.CheckUserActive(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserDisabled) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": http.StatusText(http.StatusForbidden)})
+			ctx.Abort()
+			return
+		}
+		if errors.Is(err, repository.ErrUserNotFound) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+			ctx.Abort()
+			return
+		}
+		c.logger.Error("Can not check user", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+		ctx.Abort()
+		return
+	}
+	token.Role = role
+
+	ctx.Next()
+}
+
+func (c *Controller) AdminSearchUsers(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	result, err := c.interactor.SearchUsers(ctx, token.UserID, strings.TrimSpace(ctx.Query("login")))
+	if err != nil {
+		c.adminError(ctx, "Can not search users", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) AdminGetUser(ctx *gin.Context) {
+	token, userID, ok := adminRequest(ctx)
+	if !ok {
+		return
+	}
+
+	result, err := c.interactor.GetUser(ctx, token.UserID, userID)
+	if err != nil {
+		c.adminError(ctx, "Can not get user", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) AdminGetOrders(ctx *gin.Context) {
+	token, userID, ok := adminRequest(ctx)
+	if !ok {
+		return
+	}
+
+	result, err := c.interactor.GetUserOrders(ctx, token.UserID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoOrders) {
+			ctx.JSON(http.StatusNoContent, gin.H{"error": http.StatusText(http.StatusNoContent)})
+			return
+		}
+		c.adminError(ctx, "Can not get orders", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) AdminGetWithdrawals(ctx *gin.Context) {
+	token, userID, ok := adminRequest(ctx)
+	if !ok {
+		return
+	}
+
+	result, err := c.interactor.GetUserWithdrawals(ctx, token.UserID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoWithdrawals) {
+			ctx.JSON(http.StatusNoContent, gin.H{"error": http.StatusText(http.StatusNoContent)})
+			return
+		}
+		c.adminError(ctx, "Can not get withdrawals", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) AdminGetBalance(ctx *gin.Context) {
+	token, userID, ok := adminRequest(ctx)
+	if !ok {
+		return
+	}
+
+	result, err := c.interactor.GetUserBalance(ctx, token.UserID, userID)
+	if err != nil {
+		c.adminError(ctx, "Can not get balance", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) AdminAdjustBalance(ctx *gin.Context) {
+	token, userID, ok := adminRequest(ctx)
+	if !ok {
+		return
+	}
+
+	var request models.AdjustmentRequest
+	if !readJSON(ctx, &request) {
+		return
+	}
+
+	err := c.interactor.AdjustBalance(ctx, token.UserID, userID, request)
+	if err != nil {
+		c.adminError(ctx, "Can not adjust balance", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusText(http.StatusOK)})
+}
+
+func (c *Controller) AdminDisableUser(ctx *gin.Context) {
+	c.adminSetUserDisabled(ctx, true)
+}
+
+func (c *Controller) AdminEnableUser(ctx *gin.Context) {
+	c.adminSetUserDisabled(ctx, false)
+}
+
+func (c *Controller) AdminRecheckOrder(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	result, err := c.interactor.RecheckOrder(ctx, token.UserID, ctx.Param("number"))
+	if err != nil {
+		c.adminError(ctx, "Can not recheck order", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) AdminGetActions(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	var userID *uuid.UUID
+	if value := ctx.Query(userIDParam); value != "" {
+		parsed, err := uuid.Parse(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+			return
+		}
+		userID = &parsed
+	}
+
+	result, err := c.interactor.GetAdminActions(ctx, token.UserID, userID)
+	if err != nil {
+		c.adminError(ctx, "Can not get admin actions", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) adminSetUserDisabled(ctx *gin.Context, disabled bool) {
+	token, userID, ok := adminRequest(ctx)
+	if !ok {
+		return
+	}
+
+	var request models.UserStatusRequest
+	if !readJSON(ctx, &request) {
+		return
+	}
+
+	err := c.interactor.SetUserDisabled(ctx, token.UserID, userID, request, disabled)
+	if err != nil {
+		c.adminError(ctx, "Can not set user status", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusText(http.StatusOK)})
+}
+
+func (c *Controller) adminError(ctx *gin.Context, message string, err error) {
+	var errInvalidReason *repository.ErrInvalidReason
+	var errTooManyRequests *external.ErrTooManyRequests
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound), errors.Is(err, repository.ErrOrderNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": http.StatusText(http.StatusNotFound)})
+	case errors.Is(err, repository.ErrOrderProcessed):
+		ctx.JSON(http.StatusConflict, gin.H{"error": http.StatusText(http.StatusConflict)})
+	case errors.Is(err, repository.ErrNotEnoughBalance):
+		ctx.JSON(http.StatusPaymentRequired, gin.H{"error": http.StatusText(http.StatusPaymentRequired)})
+	case errors.Is(err, repository.ErrInvalidSum), errors.As(err, &errInvalidReason):
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": http.StatusText(http.StatusUnprocessableEntity)})
+	case errors.As(err, &errTooManyRequests):
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": http.StatusText(http.StatusTooManyRequests)})
+	default:
+		c.logger.Error(message, zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+	}
+}
+
+func authToken(ctx *gin.Context) (*middlewares.JWT, bool) {
+	tokenValue, ok := ctx.Get(middlewares.Authorization)
+	if !ok {
+		return nil, false
+	}
+	token, ok := tokenValue.(*middlewares.JWT)
+	return token, ok
+}
+
+func adminRequest(ctx *gin.Context) (*middlewares.JWT, uuid.UUID, bool) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return nil, uuid.Nil, false
+	}
+
+	userID, err := uuid.Parse(ctx.Param(userIDParam))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		return nil, uuid.Nil, false
+	}
+
+	return token, userID, true
+}
+
+func readJSON(ctx *gin.Context, request any) bool {
+	data, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		return false
+	}
+
+	err = json.Unmarshal(data, request)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		return false
+	}
+
+	return true
+}
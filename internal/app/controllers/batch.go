@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var orderUploadStatuses = map[models.OrderUploadResult]int{
+	models.OrderUploadAccepted:     http.StatusAccepted,
+	models.OrderUploadAlreadyAdded: http.StatusOK,
+	models.OrderUploadConflict:     http.StatusConflict,
+	models.OrderUploadInvalid:      http.StatusUnprocessableEntity,
+}
+
+// AddOrders accepts a JSON array of order numbers or a text/plain body with
+// one order number per line and reports the result of every order.
+func (c *Controller) AddOrders(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	data, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		return
+	}
+
+	orderNumbers, ok := parseOrderBatch(ctx.ContentType(), data)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		return
+	}
+
+	result, err := c.interactor.AddOrders(ctx, orderNumbers, ctx.Query("merchant_id"), token.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEmptyBatch):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		case errors.Is(err, repository.ErrBatchTooLarge):
+			ctx.JSON(http.StatusRequestEntityTooLarge,
+				gin.H{"error": http.StatusText(http.StatusRequestEntityTooLarge)})
+		case errors.Is(err, repository.ErrMerchantNotFound):
+			ctx.JSON(http.StatusUnprocessableEntity,
+				gin.H{"error": http.StatusText(http.StatusUnprocessableEntity)})
+		case errors.Is(err, repository.ErrUserNotFound):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		default:
+			c.logger.Error("Can not add orders", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+		}
+		return
+	}
+
+	for index := range result {
+		result[index].Status = orderUploadStatuses[result[index].Result]
+	}
+
+	ctx.JSON(http.StatusMultiStatus, result)
+}
+
+func parseOrderBatch(contentType string, data []byte) ([]string, bool) {
+	if contentType == "text/plain" {
+		var orderNumbers []string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" {
+				orderNumbers = append(orderNumbers, line)
+			}
+		}
+		return orderNumbers, true
+	}
+
+	var values []json.RawMessage
+	err := json.Unmarshal(data, &values)
+	if err != nil {
+		return nil, false
+	}
+
+	orderNumbers := make([]string, 0, len(values))
+	for _, value := range values {
+		orderNumber, ok := orderNumberFromJSON(value)
+		if !ok {
+			return nil, false
+		}
+		orderNumbers = append(orderNumbers, orderNumber)
+	}
+
+	return orderNumbers, true
+}
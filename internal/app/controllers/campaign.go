@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func (c *Controller) AdminCreateCampaign(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	var request models.CampaignRequest
+	if !readJSON(ctx, &request) {
+		return
+	}
+
+	result, err := c.interactor.CreateCampaign(ctx, token.UserID, request)
+	if err != nil {
+		c.campaignError(ctx, "Can not create campaign", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) AdminEndCampaign(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	campaignID, err := uuid.Parse(ctx.Param("campaign_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		return
+	}
+
+	result, err := c.interactor.EndCampaign(ctx, token.UserID, campaignID)
+	if err != nil {
+		c.campaignError(ctx, "Can not end campaign", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) AdminGetCampaigns(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	result, err := c.interactor.GetCampaigns(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoCampaigns) {
+			ctx.JSON(http.StatusNoContent, gin.H{"error": http.StatusText(http.StatusNoContent)})
+			return
+		}
+		c.campaignError(ctx, "Can not get campaigns", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) campaignError(ctx *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrInvalidCampaign):
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": http.StatusText(http.StatusUnprocessableEntity)})
+	case errors.Is(err, repository.ErrCampaignNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": http.StatusText(http.StatusNotFound)})
+	case errors.Is(err, repository.ErrCampaignEnded):
+		ctx.JSON(http.StatusConflict, gin.H{"error": http.StatusText(http.StatusConflict)})
+	default:
+		c.logger.Error(message, zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+	}
+}
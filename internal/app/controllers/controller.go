@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/RexArseny/loyalty_system/internal/app/middlewares"
 	"github.com/RexArseny/loyalty_system/internal/app/models"
@@ -47,12 +48,16 @@ func (c *Controller) Registration(ctx *gin.Context) {
 			ctx.JSON(http.StatusConflict, gin.H{"error": http.StatusText(http.StatusConflict)})
 			return
 		}
+		if errors.Is(err, repository.ErrReferralCode) || errors.Is(err, repository.ErrReferralLimit) {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": http.StatusText(http.StatusUnprocessableEntity)})
+			return
+		}
 		c.logger.Error("Can not register user", zap.Error(err))
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
 		return
 	}
 
-	ctx.Set(middlewares.UserID, result)
+	ctx.Set(middlewares.User, result)
 }
 
 func (c *Controller) Login(ctx *gin.Context) {
@@ -76,12 +81,16 @@ func (c *Controller) Login(ctx *gin.Context) {
 			ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
 			return
 		}
+		if errors.Is(err, repository.ErrUserDisabled) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": http.StatusText(http.StatusForbidden)})
+			return
+		}
 		c.logger.Error("Can not login user", zap.Error(err))
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
 		return
 	}
 
-	ctx.Set(middlewares.UserID, result)
+	ctx.Set(middlewares.User, result)
 }
 
 func (c *Controller) AddOrder(ctx *gin.Context) {
@@ -102,14 +111,17 @@ func (c *Controller) AddOrder(ctx *gin.Context) {
 		return
 	}
 
-	var request int
-	err = json.Unmarshal(data, &request)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
-		return
+	request := strings.TrimSpace(string(data))
+	if ctx.ContentType() != "text/plain" {
+		var ok bool
+		request, ok = orderNumberFromJSON(data)
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+			return
+		}
 	}
 
-	err = c.interactor.AddOrder(ctx, request, token.UserID)
+	err = c.interactor.AddOrder(ctx, request, ctx.Query("merchant_id"), token.UserID)
 	if err != nil {
 		var errAlreadyAdded *repository.ErrAlreadyAdded
 		if errors.As(err, &errAlreadyAdded) {
@@ -122,10 +134,14 @@ func (c *Controller) AddOrder(ctx *gin.Context) {
 			return
 		}
 		var errInvalidOrderNumber *repository.ErrInvalidOrderNumber
-		if errors.As(err, &errInvalidOrderNumber) {
+		if errors.As(err, &errInvalidOrderNumber) || errors.Is(err, repository.ErrMerchantNotFound) {
 			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": http.StatusText(http.StatusUnprocessableEntity)})
 			return
 		}
+		if errors.Is(err, repository.ErrUserNotFound) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+			return
+		}
 		c.logger.Error("Can not add order", zap.Error(err))
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
 		return
@@ -134,6 +150,23 @@ func (c *Controller) AddOrder(ctx *gin.Context) {
 	ctx.JSON(http.StatusAccepted, gin.H{"status": http.StatusText(http.StatusAccepted)})
 }
 
+// orderNumberFromJSON reads an order number sent as a JSON string or number.
+// Numbers are taken as written and never converted to integers.
+func orderNumberFromJSON(data []byte) (string, bool) {
+	var orderNumber string
+	err := json.Unmarshal(data, &orderNumber)
+	if err == nil {
+		return strings.TrimSpace(orderNumber), true
+	}
+
+	var number json.Number
+	err = json.Unmarshal(data, &number)
+	if err != nil {
+		return "", false
+	}
+	return number.String(), true
+}
+
 func (c *Controller) GetOrders(ctx *gin.Context) {
 	tokenValue, ok := ctx.Get(middlewares.Authorization)
 	if !ok {
@@ -214,10 +247,19 @@ func (c *Controller) Withdraw(ctx *gin.Context) {
 			return
 		}
 		var errInvalidOrderNumber *repository.ErrInvalidOrderNumber
-		if errors.As(err, &errInvalidOrderNumber) {
+		if errors.As(err, &errInvalidOrderNumber) || errors.Is(err, repository.ErrInvalidSum) {
 			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": http.StatusText(http.StatusUnprocessableEntity)})
 			return
 		}
+		var errWithdrawalAlreadyExists *repository.ErrWithdrawalAlreadyExists
+		if errors.As(err, &errWithdrawalAlreadyExists) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": http.StatusText(http.StatusConflict)})
+			return
+		}
+		if errors.Is(err, repository.ErrUserNotFound) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+			return
+		}
 		c.logger.Error("Can not withdraw", zap.Error(err))
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
 		return
@@ -251,3 +293,79 @@ func (c *Controller) GetWithdrawals(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, result)
 }
+
+func (c *Controller) Transfer(ctx *gin.Context) {
+	tokenValue, ok := ctx.Get(middlewares.Authorization)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+	token, ok := tokenValue.(*middlewares.JWT)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	data, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		return
+	}
+
+	var request models.TransferRequest
+	err = json.Unmarshal(data, &request)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		return
+	}
+
+	err = c.interactor.Transfer(ctx, request, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotEnoughBalance) {
+			ctx.JSON(http.StatusPaymentRequired, gin.H{"error": http.StatusText(http.StatusPaymentRequired)})
+			return
+		}
+		if errors.Is(err, repository.ErrUserNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": http.StatusText(http.StatusNotFound)})
+			return
+		}
+		if errors.Is(err, repository.ErrInvalidSum) ||
+			errors.Is(err, repository.ErrSelfTransfer) ||
+			errors.Is(err, repository.ErrUserDisabled) ||
+			errors.Is(err, repository.ErrTransferLimit) {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": http.StatusText(http.StatusUnprocessableEntity)})
+			return
+		}
+		c.logger.Error("Can not transfer", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusText(http.StatusOK)})
+}
+
+func (c *Controller) GetTransfers(ctx *gin.Context) {
+	tokenValue, ok := ctx.Get(middlewares.Authorization)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+	token, ok := tokenValue.(*middlewares.JWT)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	result, err := c.interactor.GetTransfers(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoTransfers) {
+			ctx.JSON(http.StatusNoContent, gin.H{"error": http.StatusText(http.StatusNoContent)})
+			return
+		}
+		c.logger.Error("Can not get transfers", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/RexArseny/loyalty_system/internal/app/config"
 	"github.com/RexArseny/loyalty_system/internal/app/external"
 	"github.com/RexArseny/loyalty_system/internal/app/logger"
 	"github.com/RexArseny/loyalty_system/internal/app/middlewares"
@@ -30,6 +31,15 @@ const (
 
 var testSalt = []byte{43, 231, 169, 87, 185, 49, 182, 175, 187, 90, 239, 236, 134, 139, 165, 33}
 
+var testConfig = &config.Config{
+	PublicKeyPath:        "../../../public.pem",
+	PrivateKeyPath:       "../../../private.pem",
+	StatusCheckInterval:  config.DefaultStatusCheckInterval,
+	StatusCheckBatchSize: config.DefaultStatusCheckBatchSize,
+	CookieMaxAge:         config.DefaultCookieMaxAge,
+	CookiePath:           config.DefaultCookiePath,
+}
+
 type testRepository struct {
 }
 
@@ -43,6 +53,8 @@ func (d *testRepository) Registration(
 	_ string,
 	_ string,
 	_ uuid.UUID,
+	_ string,
+	_ *repository.ReferralPolicy,
 ) error {
 	return nil
 }
@@ -64,7 +76,11 @@ func (d *testRepository) GetUser(_ context.Context, login string) (*repository.U
 	return nil, repository.NewErrInvalidAuthData(login)
 }
 
-func (d *testRepository) AddOrder(_ context.Context, _ string, _ uuid.UUID) error {
+func (d *testRepository) SetUserRole(_ context.Context, _ string, _ string, _ string) error {
+	return nil
+}
+
+func (d *testRepository) AddOrder(_ context.Context, _ string, _ string, _ uuid.UUID) error {
 	return nil
 }
 
@@ -109,7 +125,7 @@ func (d *testRepository) GetWithdrawals(_ context.Context, _ uuid.UUID) ([]repos
 	}, nil
 }
 
-func (d *testRepository) GetOrdersForUpdate(_ context.Context) ([]repository.Order, error) {
+func (d *testRepository) GetOrdersForUpdate(_ context.Context, _ string, _ int) ([]repository.Order, error) {
 	return []repository.Order{}, nil
 }
 
@@ -119,6 +135,8 @@ func (d *testRepository) UpdateOrder(
 	_ string,
 	_ *float64,
 	_ uuid.UUID,
+	_ *time.Time,
+	_ *repository.TierPolicy,
 ) error {
 	return nil
 }
@@ -126,6 +144,34 @@ func (d *testRepository) UpdateOrder(
 func (d *testRepository) Close() {
 }
 
+func (d *testRepository) SearchUsers(_ context.Context, _ string, _ int) ([]repository.User, error) {
+	return nil, nil
+}
+
+func (d *testRepository) GetUserByID(_ context.Context, _ uuid.UUID) (*repository.User, error) {
+	return nil, repository.ErrUserNotFound
+}
+
+func (d *testRepository) GetOrder(_ context.Context, _ string) (*repository.Order, error) {
+	return nil, repository.ErrOrderNotFound
+}
+
+func (d *testRepository) AdjustBalance(_ context.Context, _ repository.AdminAction, _ *time.Time) error {
+	return nil
+}
+
+func (d *testRepository) SetUserDisabled(_ context.Context, _ repository.AdminAction, _ bool) error {
+	return nil
+}
+
+func (d *testRepository) AddAdminAction(_ context.Context, _ repository.AdminAction) error {
+	return nil
+}
+
+func (d *testRepository) GetAdminActions(_ context.Context, _ *uuid.UUID, _ int) ([]repository.AdminAction, error) {
+	return nil, nil
+}
+
 func TestRegistration(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -146,15 +192,12 @@ func TestRegistration(t *testing.T) {
 			interactor := usecases.NewInteractor(
 				context.Background(),
 				testLogger.Named("interactor"),
+				testConfig,
 				dataRepository,
-				external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				external.NewAccrualServiceClient(testLogger.Named("accrual"), "", 0),
 			)
 			conntroller := NewController(testLogger.Named("controller"), interactor)
-			middleware, err := middlewares.NewMiddleware(
-				"../../../public.pem",
-				"../../../private.pem",
-				testLogger.Named("middleware"),
-			)
+			middleware, err := middlewares.NewMiddleware(testConfig, testLogger.Named("middleware"))
 			assert.NoError(t, err)
 
 			w := httptest.NewRecorder()
@@ -195,15 +238,12 @@ func TestLogin(t *testing.T) {
 			interactor := usecases.NewInteractor(
 				context.Background(),
 				testLogger.Named("interactor"),
+				testConfig,
 				dataRepository,
-				external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				external.NewAccrualServiceClient(testLogger.Named("accrual"), "", 0),
 			)
 			conntroller := NewController(testLogger.Named("controller"), interactor)
-			middleware, err := middlewares.NewMiddleware(
-				"../../../public.pem",
-				"../../../private.pem",
-				testLogger.Named("middleware"),
-			)
+			middleware, err := middlewares.NewMiddleware(testConfig, testLogger.Named("middleware"))
 			assert.NoError(t, err)
 
 			w := httptest.NewRecorder()
@@ -228,6 +268,7 @@ func TestAddOrder(t *testing.T) {
 	tests := []struct {
 		name         string
 		loginRequest string
+		contentType  string
 		request      string
 		stastusCode  int
 	}{
@@ -237,6 +278,34 @@ func TestAddOrder(t *testing.T) {
 			request:      testOrderNumber,
 			stastusCode:  http.StatusAccepted,
 		},
+		{
+			name:         "json string",
+			loginRequest: `{"login":"testlogin", "password":"testpassword"}`,
+			contentType:  "application/json",
+			request:      `"` + testOrderNumber + `"`,
+			stastusCode:  http.StatusAccepted,
+		},
+		{
+			name:         "plain text longer than int64",
+			loginRequest: `{"login":"testlogin", "password":"testpassword"}`,
+			contentType:  "text/plain",
+			request:      "12345678901234567890123459\n",
+			stastusCode:  http.StatusAccepted,
+		},
+		{
+			name:         "invalid checksum",
+			loginRequest: `{"login":"testlogin", "password":"testpassword"}`,
+			contentType:  "text/plain",
+			request:      "12345678902",
+			stastusCode:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "invalid json",
+			loginRequest: `{"login":"testlogin", "password":"testpassword"}`,
+			contentType:  "application/json",
+			request:      `{"order":1}`,
+			stastusCode:  http.StatusBadRequest,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -246,15 +315,12 @@ func TestAddOrder(t *testing.T) {
 			interactor := usecases.NewInteractor(
 				context.Background(),
 				testLogger.Named("interactor"),
+				testConfig,
 				dataRepository,
-				external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				external.NewAccrualServiceClient(testLogger.Named("accrual"), "", 0),
 			)
 			conntroller := NewController(testLogger.Named("controller"), interactor)
-			middleware, err := middlewares.NewMiddleware(
-				"../../../public.pem",
-				"../../../private.pem",
-				testLogger.Named("middleware"),
-			)
+			middleware, err := middlewares.NewMiddleware(testConfig, testLogger.Named("middleware"))
 			assert.NoError(t, err)
 
 			wLogin := httptest.NewRecorder()
@@ -271,6 +337,9 @@ func TestAddOrder(t *testing.T) {
 			w := httptest.NewRecorder()
 			ctx, _ := gin.CreateTestContext(w)
 			ctx.Request = httptest.NewRequest(http.MethodPost, "/api/user/orders", strings.NewReader(tt.request))
+			if tt.contentType != "" {
+				ctx.Request.Header.Set("Content-Type", tt.contentType)
+			}
 			for _, cookie := range resultLogin.Cookies() {
 				if cookie != nil && cookie.Name == middlewares.Authorization {
 					ctx.Request.AddCookie(&http.Cookie{
@@ -315,15 +384,12 @@ func TestGetOrders(t *testing.T) {
 			interactor := usecases.NewInteractor(
 				context.Background(),
 				testLogger.Named("interactor"),
+				testConfig,
 				dataRepository,
-				external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				external.NewAccrualServiceClient(testLogger.Named("accrual"), "", 0),
 			)
 			conntroller := NewController(testLogger.Named("controller"), interactor)
-			middleware, err := middlewares.NewMiddleware(
-				"../../../public.pem",
-				"../../../private.pem",
-				testLogger.Named("middleware"),
-			)
+			middleware, err := middlewares.NewMiddleware(testConfig, testLogger.Named("middleware"))
 			assert.NoError(t, err)
 
 			wLogin := httptest.NewRecorder()
@@ -384,15 +450,12 @@ func TestGetBalance(t *testing.T) {
 			interactor := usecases.NewInteractor(
 				context.Background(),
 				testLogger.Named("interactor"),
+				testConfig,
 				dataRepository,
-				external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				external.NewAccrualServiceClient(testLogger.Named("accrual"), "", 0),
 			)
 			conntroller := NewController(testLogger.Named("controller"), interactor)
-			middleware, err := middlewares.NewMiddleware(
-				"../../../public.pem",
-				"../../../private.pem",
-				testLogger.Named("middleware"),
-			)
+			middleware, err := middlewares.NewMiddleware(testConfig, testLogger.Named("middleware"))
 			assert.NoError(t, err)
 
 			wLogin := httptest.NewRecorder()
@@ -455,15 +518,12 @@ func TestWithdraw(t *testing.T) {
 			interactor := usecases.NewInteractor(
 				context.Background(),
 				testLogger.Named("interactor"),
+				testConfig,
 				dataRepository,
-				external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				external.NewAccrualServiceClient(testLogger.Named("accrual"), "", 0),
 			)
 			conntroller := NewController(testLogger.Named("controller"), interactor)
-			middleware, err := middlewares.NewMiddleware(
-				"../../../public.pem",
-				"../../../private.pem",
-				testLogger.Named("middleware"),
-			)
+			middleware, err := middlewares.NewMiddleware(testConfig, testLogger.Named("middleware"))
 			assert.NoError(t, err)
 
 			wLogin := httptest.NewRecorder()
@@ -524,15 +584,12 @@ func TestGetWithdrawals(t *testing.T) {
 			interactor := usecases.NewInteractor(
 				context.Background(),
 				testLogger.Named("interactor"),
+				testConfig,
 				dataRepository,
-				external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				external.NewAccrualServiceClient(testLogger.Named("accrual"), "", 0),
 			)
 			conntroller := NewController(testLogger.Named("controller"), interactor)
-			middleware, err := middlewares.NewMiddleware(
-				"../../../public.pem",
-				"../../../private.pem",
-				testLogger.Named("middleware"),
-			)
+			middleware, err := middlewares.NewMiddleware(testConfig, testLogger.Named("middleware"))
 			assert.NoError(t, err)
 
 			wLogin := httptest.NewRecorder()
@@ -572,3 +629,122 @@ func TestGetWithdrawals(t *testing.T) {
 		})
 	}
 }
+
+func (d *testRepository) GetExpiringPoints(_ context.Context, _ uuid.UUID, _ time.Time) ([]repository.PointLot, error) {
+	return nil, nil
+}
+
+func (d *testRepository) ExpirePoints(_ context.Context, _ time.Time, _ int) ([]repository.PointExpiration, error) {
+	return nil, nil
+}
+
+func (d *testRepository) Transfer(
+	_ context.Context,
+	_ uuid.UUID,
+	_ string,
+	_ float64,
+	_ float64,
+) error {
+	return nil
+}
+
+func (d *testRepository) GetTransfers(_ context.Context, _ uuid.UUID) ([]repository.Transfer, error) {
+	return nil, repository.ErrNoTransfers
+}
+
+func (d *testRepository) ReverseWithdrawal(
+	_ context.Context,
+	_ string,
+	_ string,
+	_ *float64,
+	_ uuid.UUID,
+	_ string,
+	_ *time.Time,
+) (*repository.Reversal, error) {
+	return nil, repository.ErrNoWithdrawal
+}
+
+func (d *testRepository) AuthorizeHold(_ context.Context, _ repository.Hold) error {
+	return nil
+}
+
+func (d *testRepository) CaptureHold(
+	_ context.Context,
+	_ uuid.UUID,
+	_ uuid.UUID,
+	_ time.Time,
+) (*repository.Hold, error) {
+	return nil, repository.ErrHoldNotFound
+}
+
+func (d *testRepository) VoidHold(
+	_ context.Context,
+	_ uuid.UUID,
+	_ uuid.UUID,
+	_ time.Time,
+) (*repository.Hold, error) {
+	return nil, repository.ErrHoldNotFound
+}
+
+func (d *testRepository) GetHolds(_ context.Context, _ uuid.UUID) ([]repository.Hold, error) {
+	return nil, repository.ErrNoHolds
+}
+
+func (d *testRepository) ExpireHolds(_ context.Context, _ time.Time, _ int) ([]repository.Hold, error) {
+	return nil, nil
+}
+
+func (d *testRepository) GetLoyaltyStatus(
+	_ context.Context,
+	_ uuid.UUID,
+	_ time.Time,
+) (*repository.LoyaltyStatus, error) {
+	return &repository.LoyaltyStatus{}, nil
+}
+
+func (d *testRepository) AddCampaign(_ context.Context, _ repository.Campaign) error {
+	return nil
+}
+
+func (d *testRepository) EndCampaign(_ context.Context, _ uuid.UUID, _ time.Time) (*repository.Campaign, error) {
+	return &repository.Campaign{}, nil
+}
+
+func (d *testRepository) GetCampaigns(_ context.Context) ([]repository.Campaign, error) {
+	return nil, repository.ErrNoCampaigns
+}
+
+func (d *testRepository) GetCampaignBonuses(_ context.Context, _ uuid.UUID) ([]repository.CampaignBonus, error) {
+	return nil, nil
+}
+
+func (d *testRepository) GetReferrals(_ context.Context, _ uuid.UUID) (*repository.Referrals, error) {
+	return &repository.Referrals{}, nil
+}
+
+func (d *testRepository) AddOrders(
+	_ context.Context,
+	orderNumbers []string,
+	_ string,
+	_ uuid.UUID,
+) ([]error, error) {
+	return make([]error, len(orderNumbers)), nil
+}
+
+func (d *testRepository) AddMerchant(_ context.Context, _ repository.Merchant) error {
+	return nil
+}
+
+func (d *testRepository) GetMerchants(_ context.Context) ([]repository.Merchant, error) {
+	return nil, repository.ErrNoMerchants
+}
+
+func (d *testRepository) GetStatement(
+	_ context.Context,
+	_ uuid.UUID,
+	_ *time.Time,
+	_ *time.Time,
+	_ func(entry repository.StatementEntry) error,
+) error {
+	return nil
+}
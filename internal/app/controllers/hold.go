@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func (c *Controller) AuthorizeHold(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	var request models.HoldRequest
+	if !readJSON(ctx, &request) {
+		return
+	}
+
+	result, err := c.interactor.AuthorizeHold(ctx, request, token.UserID)
+	if err != nil {
+		c.holdError(ctx, "Can not authorize hold", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) CaptureHold(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	holdID, err := uuid.Parse(ctx.Param("hold_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		return
+	}
+
+	result, err := c.interactor.CaptureHold(ctx, holdID, token.UserID)
+	if err != nil {
+		c.holdError(ctx, "Can not capture hold", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) VoidHold(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	holdID, err := uuid.Parse(ctx.Param("hold_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		return
+	}
+
+	result, err := c.interactor.VoidHold(ctx, holdID, token.UserID)
+	if err != nil {
+		c.holdError(ctx, "Can not void hold", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) GetHolds(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	result, err := c.interactor.GetHolds(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoHolds) {
+			ctx.JSON(http.StatusNoContent, gin.H{"error": http.StatusText(http.StatusNoContent)})
+			return
+		}
+		c.logger.Error("Can not get holds", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) holdError(ctx *gin.Context, message string, err error) {
+	var errInvalidOrderNumber *repository.ErrInvalidOrderNumber
+	var errWithdrawalAlreadyExists *repository.ErrWithdrawalAlreadyExists
+	switch {
+	case errors.Is(err, repository.ErrNotEnoughBalance):
+		ctx.JSON(http.StatusPaymentRequired, gin.H{"error": http.StatusText(http.StatusPaymentRequired)})
+	case errors.Is(err, repository.ErrHoldNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": http.StatusText(http.StatusNotFound)})
+	case errors.Is(err, repository.ErrHoldExists),
+		errors.Is(err, repository.ErrHoldFinished),
+		errors.Is(err, repository.ErrHoldExpired),
+		errors.As(err, &errWithdrawalAlreadyExists):
+		ctx.JSON(http.StatusConflict, gin.H{"error": http.StatusText(http.StatusConflict)})
+	case errors.As(err, &errInvalidOrderNumber), errors.Is(err, repository.ErrInvalidSum):
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": http.StatusText(http.StatusUnprocessableEntity)})
+	case errors.Is(err, repository.ErrUserNotFound):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+	default:
+		c.logger.Error(message, zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+	}
+}
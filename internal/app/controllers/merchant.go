@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (c *Controller) AdminCreateMerchant(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	var request models.MerchantRequest
+	if !readJSON(ctx, &request) {
+		return
+	}
+
+	result, err := c.interactor.CreateMerchant(ctx, token.UserID, request)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrInvalidMerchant):
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": http.StatusText(http.StatusUnprocessableEntity)})
+		case errors.Is(err, repository.ErrMerchantExists):
+			ctx.JSON(http.StatusConflict, gin.H{"error": http.StatusText(http.StatusConflict)})
+		default:
+			c.logger.Error("Can not create merchant", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *Controller) AdminGetMerchants(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	result, err := c.interactor.GetMerchants(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoMerchants) {
+			ctx.JSON(http.StatusNoContent, gin.H{"error": http.StatusText(http.StatusNoContent)})
+			return
+		}
+		c.logger.Error("Can not get merchants", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
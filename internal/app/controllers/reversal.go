@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (c *Controller) ReverseWithdrawal(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	var request models.ReversalRequest
+	if !readJSON(ctx, &request) {
+		return
+	}
+
+	result, err := c.interactor.ReverseWithdrawal(ctx, token.UserID, ctx.Param("number"), request)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNoWithdrawal):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": http.StatusText(http.StatusNotFound)})
+		case errors.Is(err, repository.ErrReversed), errors.Is(err, repository.ErrReversalConflict):
+			ctx.JSON(http.StatusConflict, gin.H{"error": http.StatusText(http.StatusConflict)})
+		case errors.Is(err, repository.ErrInvalidSum), errors.Is(err, repository.ErrInvalidReversal):
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": http.StatusText(http.StatusUnprocessableEntity)})
+		default:
+			c.logger.Error("Can not reverse withdrawal", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/middlewares"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var statementContentTypes = map[models.StatementFormat]string{
+	models.StatementCSV:    "text/csv; charset=utf-8",
+	models.StatementNDJSON: "application/x-ndjson",
+}
+
+func (c *Controller) GetStatement(ctx *gin.Context) {
+	token, ok := authToken(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	request, ok := statementRequest(ctx)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+		return
+	}
+
+	ctx.Header("Content-Type", statementContentTypes[request.Format])
+	ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": statementFilename(request),
+	}))
+	ctx.Status(http.StatusOK)
+
+	err := c.interactor.WriteStatement(ctx, token.UserID, request, ctx.Writer)
+	if err == nil {
+		return
+	}
+	c.logger.Error("Can not write statement", zap.Error(err))
+	if !ctx.Writer.Written() {
+		ctx.Writer.Header().Del("Content-Type")
+		ctx.Writer.Header().Del("Content-Disposition")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+		return
+	}
+	// A part of the statement is already sent. Breaking the response makes
+	// the client see a broken download instead of a complete looking one.
+	ctx.Set(middlewares.AbortResponse, true)
+	ctx.Abort()
+}
+
+func statementRequest(ctx *gin.Context) (models.StatementRequest, bool) {
+	request := models.StatementRequest{
+		Format: models.StatementFormat(ctx.DefaultQuery("format", string(models.StatementCSV))),
+	}
+	if _, ok := statementContentTypes[request.Format]; !ok {
+		return request, false
+	}
+
+	var ok bool
+	request.From, ok = statementTime(ctx.Query("from"))
+	if !ok {
+		return request, false
+	}
+	request.To, ok = statementTime(ctx.Query("to"))
+	if !ok {
+		return request, false
+	}
+	if request.From != nil && request.To != nil && !request.From.Before(*request.To) {
+		return request, false
+	}
+
+	return request, true
+}
+
+// statementTime parses a bound of a statement given as a date-time or as a
+// date meaning its midnight in UTC.
+func statementTime(value string) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		parsed, err := time.Parse(layout, value)
+		if err == nil {
+			return &parsed, true
+		}
+	}
+	return nil, false
+}
+
+func statementFilename(request models.StatementRequest) string {
+	parts := []string{"statement"}
+	bounds := []struct {
+		name  string
+		value *time.Time
+	}{
+		{name: "from", value: request.From},
+		{name: "to", value: request.To},
+	}
+	for _, bound := range bounds {
+		if bound.value == nil {
+			continue
+		}
+		value := bound.value.UTC()
+		layout := "20060102T150405Z"
+		if value.Equal(value.Truncate(24 * time.Hour)) {
+			layout = "20060102"
+		}
+		parts = append(parts, bound.name, value.Format(layout))
+	}
+	return strings.Join(parts, "_") + "." + string(request.Format)
+}
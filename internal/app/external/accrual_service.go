@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -17,9 +18,11 @@ type AccrualServiceClient struct {
 	address string
 }
 
-func NewAccrualServiceClient(logger *zap.Logger, address string) AccrualServiceClient {
+func NewAccrualServiceClient(logger *zap.Logger, address string, timeout time.Duration) AccrualServiceClient {
 	return AccrualServiceClient{
-		client:  http.DefaultClient,
+		client: &http.Client{
+			Timeout: timeout,
+		},
 		address: address,
 		logger:  logger,
 	}
@@ -0,0 +1,116 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/RexArseny/loyalty_system/internal/app/middlewares"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const bearerPrefix = "Bearer "
+
+type tokenKey struct{}
+
+var publicMethods = map[string]struct{}{
+	"/gophermart.v1.Gophermart/Register": {},
+	"/gophermart.v1.Gophermart/Login":    {},
+	"/grpc.health.v1.Health/Check":       {},
+	"/grpc.health.v1.Health/List":        {},
+	"/grpc.health.v1.Health/Watch":       {},
+}
+
+type userChecker interface {
+	CheckUserActive(ctx context.Context, userID uuid.UUID) (models.Role, error)
+}
+
+type Authenticator struct {
+	middleware *middlewares.Middleware
+	users      userChecker
+}
+
+func NewAuthenticator(middleware *middlewares.Middleware, users userChecker) *Authenticator {
+	return &Authenticator{
+		middleware: middleware,
+		users:      users,
+	}
+}
+
+func (a *Authenticator) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authenticator) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+func (a *Authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if _, ok := publicMethods[method]; ok {
+		return ctx, nil
+	}
+
+	values := metadata.ValueFromIncomingContext(ctx, strings.ToLower(middlewares.Authorization))
+	if len(values) == 0 || !strings.HasPrefix(values[0], bearerPrefix) {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	token, err := a.middleware.ParseToken(strings.TrimPrefix(values[0], bearerPrefix))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	role, err := a.users.CheckUserActive(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "user disabled")
+		}
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return nil, status.Error(codes.Internal, "can not check user")
+	}
+	token.Role = role
+
+	return context.WithValue(ctx, tokenKey{}, token), nil
+}
+
+func tokenFromContext(ctx context.Context) (*middlewares.JWT, error) {
+	token, ok := ctx.Value(tokenKey{}).(*middlewares.JWT)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	return token, nil
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,319 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/grpcapi/pb"
+	"github.com/RexArseny/loyalty_system/internal/app/middlewares"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/RexArseny/loyalty_system/internal/app/usecases"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type Server struct {
+	pb.UnimplementedGophermartServer
+	logger        *zap.Logger
+	interactor    usecases.Interactor
+	middleware    *middlewares.Middleware
+	watchInterval time.Duration
+}
+
+func NewServer(
+	logger *zap.Logger,
+	interactor usecases.Interactor,
+	middleware *middlewares.Middleware,
+	watchInterval time.Duration,
+) *Server {
+	return &Server{
+		logger:        logger,
+		interactor:    interactor,
+		middleware:    middleware,
+		watchInterval: watchInterval,
+	}
+}
+
+// NewGRPCServer registers the gophermart and health services. creds may be
+// nil to serve without TLS.
+func NewGRPCServer(server *Server, creds credentials.TransportCredentials) *grpc.Server {
+	authenticator := NewAuthenticator(server.middleware, &server.interactor)
+
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(authenticator.Unary()),
+		grpc.ChainStreamInterceptor(authenticator.Stream()),
+	}
+	if creds != nil {
+		options = append(options, grpc.Creds(creds))
+	}
+
+	grpcServer := grpc.NewServer(options...)
+	pb.RegisterGophermartServer(grpcServer, server)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(pb.Gophermart_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	return grpcServer
+}
+
+func (s *Server) Register(ctx context.Context, request *pb.AuthRequest) (*pb.AuthResponse, error) {
+	user, err := s.interactor.Registration(ctx, models.AuthRequest{
+		Login:        request.GetLogin(),
+		Password:     request.GetPassword(),
+		ReferralCode: request.GetReferralCode(),
+	})
+	if err != nil {
+		var errOriginalLoginUniqueViolation *repository.ErrOriginalLoginUniqueViolation
+		if errors.As(err, &errOriginalLoginUniqueViolation) {
+			return nil, status.Error(codes.AlreadyExists, "login already exists")
+		}
+		if errors.Is(err, repository.ErrReferralCode) {
+			return nil, status.Error(codes.InvalidArgument, "unknown referral code")
+		}
+		if errors.Is(err, repository.ErrReferralLimit) {
+			return nil, status.Error(codes.ResourceExhausted, "referral limit reached")
+		}
+		s.logger.Error("Can not register user", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can not register user")
+	}
+
+	return s.authResponse(*user)
+}
+
+func (s *Server) Login(ctx context.Context, request *pb.AuthRequest) (*pb.AuthResponse, error) {
+	user, err := s.interactor.Login(ctx, models.AuthRequest{
+		Login:    request.GetLogin(),
+		Password: request.GetPassword(),
+	})
+	if err != nil {
+		var errInvalidAuthData *repository.ErrInvalidAuthData
+		if errors.As(err, &errInvalidAuthData) {
+			return nil, status.Error(codes.Unauthenticated, "invalid login or password")
+		}
+		if errors.Is(err, repository.ErrUserDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "user disabled")
+		}
+		s.logger.Error("Can not login user", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can not login user")
+	}
+
+	return s.authResponse(*user)
+}
+
+func (s *Server) AddOrder(ctx context.Context, request *pb.AddOrderRequest) (*pb.AddOrderResponse, error) {
+	token, err := tokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.interactor.AddOrder(ctx, request.GetNumber(), request.GetMerchantId(), token.UserID)
+	if err != nil {
+		var errAlreadyAdded *repository.ErrAlreadyAdded
+		if errors.As(err, &errAlreadyAdded) {
+			return &pb.AddOrderResponse{AlreadyAdded: true}, nil
+		}
+		var errAlreadyAddedByAnotherUser *repository.ErrAlreadyAddedByAnotherUser
+		if errors.As(err, &errAlreadyAddedByAnotherUser) {
+			return nil, status.Error(codes.AlreadyExists, "order added by another user")
+		}
+		var errInvalidOrderNumber *repository.ErrInvalidOrderNumber
+		if errors.As(err, &errInvalidOrderNumber) {
+			return nil, status.Error(codes.InvalidArgument, "invalid order number")
+		}
+		if errors.Is(err, repository.ErrMerchantNotFound) {
+			return nil, status.Error(codes.InvalidArgument, "merchant not found")
+		}
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "user not found")
+		}
+		s.logger.Error("Can not add order", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can not add order")
+	}
+
+	return &pb.AddOrderResponse{}, nil
+}
+
+func (s *Server) ListOrders(ctx context.Context, _ *pb.ListOrdersRequest) (*pb.ListOrdersResponse, error) {
+	token, err := tokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := s.orders(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ListOrdersResponse{Orders: orders}, nil
+}
+
+// WatchOrders sends all orders of the user and then every order whose status
+// or accrual changes until the client cancels the stream.
+func (s *Server) WatchOrders(_ *pb.WatchOrdersRequest, stream grpc.ServerStreamingServer[pb.Order]) error {
+	ctx := stream.Context()
+	token, err := tokenFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+
+	sent := make(map[string]*pb.Order)
+	for {
+		orders, err := s.orders(ctx, token)
+		if err != nil {
+			return err
+		}
+		for _, order := range orders {
+			if previous, ok := sent[order.GetNumber()]; ok && proto.Equal(previous, order) {
+				continue
+			}
+			err = stream.Send(order)
+			if err != nil {
+				return err
+			}
+			sent[order.GetNumber()] = order
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) GetBalance(ctx context.Context, _ *pb.GetBalanceRequest) (*pb.Balance, error) {
+	token, err := tokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := s.interactor.GetBalance(ctx, token.UserID)
+	if err != nil {
+		s.logger.Error("Can not get balance", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can not get balance")
+	}
+
+	response := &pb.Balance{
+		Current:   balance.Current,
+		Withdrawn: balance.Withdrawn,
+		Held:      balance.Held,
+	}
+	for _, expiring := range balance.Expiring {
+		response.Expiring = append(response.Expiring, &pb.ExpiringPoints{
+			Order:     expiring.Order,
+			Sum:       expiring.Sum,
+			ExpiresAt: expiring.ExpiresAt,
+		})
+	}
+
+	return response, nil
+}
+
+func (s *Server) Withdraw(ctx context.Context, request *pb.WithdrawRequest) (*pb.WithdrawResponse, error) {
+	token, err := tokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.interactor.Withdraw(ctx, models.WithdrawRequest{
+		Order: request.GetOrder(),
+		Sum:   request.GetSum(),
+	}, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotEnoughBalance) {
+			return nil, status.Error(codes.FailedPrecondition, "not enough balance")
+		}
+		var errInvalidOrderNumber *repository.ErrInvalidOrderNumber
+		if errors.As(err, &errInvalidOrderNumber) {
+			return nil, status.Error(codes.InvalidArgument, "invalid order number")
+		}
+		if errors.Is(err, repository.ErrInvalidSum) {
+			return nil, status.Error(codes.InvalidArgument, "invalid sum")
+		}
+		var errWithdrawalAlreadyExists *repository.ErrWithdrawalAlreadyExists
+		if errors.As(err, &errWithdrawalAlreadyExists) {
+			return nil, status.Error(codes.AlreadyExists, "withdrawal already exists")
+		}
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "user not found")
+		}
+		s.logger.Error("Can not withdraw", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can not withdraw")
+	}
+
+	return &pb.WithdrawResponse{}, nil
+}
+
+func (s *Server) ListWithdrawals(
+	ctx context.Context,
+	_ *pb.ListWithdrawalsRequest,
+) (*pb.ListWithdrawalsResponse, error) {
+	token, err := tokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	withdrawals, err := s.interactor.GetWithdrawals(ctx, token.UserID)
+	if err != nil && !errors.Is(err, repository.ErrNoWithdrawals) {
+		s.logger.Error("Can not get withdrawals", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can not get withdrawals")
+	}
+
+	response := &pb.ListWithdrawalsResponse{
+		Withdrawals: make([]*pb.Withdrawal, 0, len(withdrawals)),
+	}
+	for _, withdrawal := range withdrawals {
+		response.Withdrawals = append(response.Withdrawals, &pb.Withdrawal{
+			Order:       withdrawal.Order,
+			Sum:         withdrawal.Sum,
+			ProcessedAt: withdrawal.ProcessedAt,
+			Reversed:    withdrawal.Reversed,
+		})
+	}
+
+	return response, nil
+}
+
+func (s *Server) orders(ctx context.Context, token *middlewares.JWT) ([]*pb.Order, error) {
+	orders, err := s.interactor.GetOrders(ctx, token.UserID)
+	if err != nil && !errors.Is(err, repository.ErrNoOrders) {
+		s.logger.Error("Can not get orders", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can not get orders")
+	}
+
+	response := make([]*pb.Order, 0, len(orders))
+	for _, order := range orders {
+		response = append(response, &pb.Order{
+			Number:     order.Number,
+			Status:     order.Status,
+			Accrual:    order.Accrual,
+			UploadedAt: order.UploadedAt,
+			MerchantId: order.MerchantID,
+		})
+	}
+
+	return response, nil
+}
+
+func (s *Server) authResponse(user models.User) (*pb.AuthResponse, error) {
+	token, err := s.middleware.NewToken(user)
+	if err != nil {
+		s.logger.Error("Can not sign token", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can not sign token")
+	}
+
+	return &pb.AuthResponse{Token: token}, nil
+}
@@ -0,0 +1,128 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/config"
+	"github.com/RexArseny/loyalty_system/internal/app/external"
+	"github.com/RexArseny/loyalty_system/internal/app/grpcapi/pb"
+	"github.com/RexArseny/loyalty_system/internal/app/logger"
+	"github.com/RexArseny/loyalty_system/internal/app/middlewares"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/RexArseny/loyalty_system/internal/app/usecases"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var testConfig = &config.Config{
+	PublicKeyPath:        "../../../public.pem",
+	PrivateKeyPath:       "../../../private.pem",
+	StatusCheckInterval:  time.Hour,
+	StatusCheckBatchSize: config.DefaultStatusCheckBatchSize,
+	CookieMaxAge:         config.DefaultCookieMaxAge,
+}
+
+func newTestClient(t *testing.T) *grpc.ClientConn {
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	interactor := usecases.NewInteractor(
+		ctx,
+		testLogger.Named("interactor"),
+		testConfig,
+		repository.NewMemoryRepository(testLogger.Named("repository")),
+		external.NewAccrualServiceClient(testLogger.Named("accrual"), "", 0),
+	)
+	middleware, err := middlewares.NewMiddleware(testConfig, testLogger.Named("middleware"))
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := NewGRPCServer(NewServer(testLogger.Named("grpc"), interactor, middleware, time.Millisecond), nil)
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return conn
+}
+
+func TestServer(t *testing.T) {
+	conn := newTestClient(t)
+	client := pb.NewGophermartClient(conn)
+	ctx := context.Background()
+
+	health, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, health.GetStatus())
+
+	_, err = client.ListOrders(ctx, &pb.ListOrdersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	auth, err := client.Register(ctx, &pb.AuthRequest{Login: "login", Password: "password"})
+	require.NoError(t, err)
+	_, err = client.Register(ctx, &pb.AuthRequest{Login: "login", Password: "password"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = client.Login(ctx, &pb.AuthRequest{Login: "login", Password: "wrong"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+auth.GetToken())
+
+	_, err = client.AddOrder(ctx, &pb.AddOrderRequest{Number: "12345678902"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	added, err := client.AddOrder(ctx, &pb.AddOrderRequest{Number: "12345678903"})
+	require.NoError(t, err)
+	assert.False(t, added.GetAlreadyAdded())
+	added, err = client.AddOrder(ctx, &pb.AddOrderRequest{Number: "12345678903"})
+	require.NoError(t, err)
+	assert.True(t, added.GetAlreadyAdded())
+
+	orders, err := client.ListOrders(ctx, &pb.ListOrdersRequest{})
+	require.NoError(t, err)
+	require.Len(t, orders.GetOrders(), 1)
+	assert.Equal(t, "12345678903", orders.GetOrders()[0].GetNumber())
+	assert.Equal(t, "NEW", orders.GetOrders()[0].GetStatus())
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.WatchOrders(watchCtx, &pb.WatchOrdersRequest{})
+	require.NoError(t, err)
+	order, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "12345678903", order.GetNumber())
+
+	balance, err := client.GetBalance(ctx, &pb.GetBalanceRequest{})
+	require.NoError(t, err)
+	assert.Zero(t, balance.GetCurrent())
+
+	_, err = client.Withdraw(ctx, &pb.WithdrawRequest{Order: "2377225624", Sum: 10})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	withdrawals, err := client.ListWithdrawals(ctx, &pb.ListWithdrawalsRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, withdrawals.GetWithdrawals())
+}
@@ -8,9 +8,12 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+var level = zap.NewAtomicLevelAt(zap.InfoLevel)
+
 func InitLogger() (*zap.Logger, error) {
 	config := zap.NewProductionConfig()
 
+	config.Level = level
 	config.EncoderConfig.TimeKey = "time"
 	config.EncoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout(time.RFC3339)
 
@@ -20,3 +23,11 @@ func InitLogger() (*zap.Logger, error) {
 	}
 	return log, nil
 }
+
+func SetLevel(text string) error {
+	err := level.UnmarshalText([]byte(text))
+	if err != nil {
+		return fmt.Errorf("can not set log level: %w", err)
+	}
+	return nil
+}
@@ -1,13 +1,18 @@
 package middlewares
 
 import (
+	"bytes"
 	"crypto"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"slices"
+	"sync/atomic"
 	"time"
 
+	"github.com/RexArseny/loyalty_system/internal/app/config"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -16,18 +21,63 @@ import (
 
 const (
 	Authorization = "Authorization"
-	UserID        = "UserID"
-	maxAge        = 900
+	User          = "User"
+	AbortResponse = "AbortResponse"
 )
 
 type Middleware struct {
-	publicKey  crypto.PublicKey
-	privateKey crypto.PrivateKey
-	logger     *zap.Logger
+	logger *zap.Logger
+	state  atomic.Pointer[state]
 }
 
-func NewMiddleware(publicKeyPath string, privateKeyPath string, logger *zap.Logger) (*Middleware, error) {
-	publicKeyFile, err := os.ReadFile(publicKeyPath)
+type state struct {
+	publicKey         crypto.PublicKey
+	previousPublicKey crypto.PublicKey
+	privateKey        crypto.PrivateKey
+	publicKeyFile     []byte
+	privateKeyFile    []byte
+	cookieDomain      string
+	cookiePath        string
+	cookieMaxAge      time.Duration
+	cookieSecure      bool
+	cookieHTTPOnly    bool
+}
+
+func NewMiddleware(cfg *config.Config, logger *zap.Logger) (*Middleware, error) {
+	newState, err := loadState(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	middleware := &Middleware{
+		logger: logger,
+	}
+	middleware.state.Store(newState)
+
+	return middleware, nil
+}
+
+func (m *Middleware) Reload(cfg *config.Config) (bool, error) {
+	newState, err := loadState(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	oldState := m.state.Load()
+	rotated := !bytes.Equal(oldState.publicKeyFile, newState.publicKeyFile) ||
+		!bytes.Equal(oldState.privateKeyFile, newState.privateKeyFile)
+	if rotated {
+		newState.previousPublicKey = oldState.publicKey
+	} else {
+		newState.previousPublicKey = oldState.previousPublicKey
+	}
+	m.state.Store(newState)
+
+	return rotated, nil
+}
+
+func loadState(cfg *config.Config) (*state, error) {
+	publicKeyFile, err := os.ReadFile(cfg.PublicKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("can not open public.pem file: %w", err)
 	}
@@ -36,7 +86,7 @@ func NewMiddleware(publicKeyPath string, privateKeyPath string, logger *zap.Logg
 		return nil, fmt.Errorf("can not parse public key: %w", err)
 	}
 
-	privateKeyFile, err := os.ReadFile(privateKeyPath)
+	privateKeyFile, err := os.ReadFile(cfg.PrivateKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("can not open private.pem file: %w", err)
 	}
@@ -45,10 +95,25 @@ func NewMiddleware(publicKeyPath string, privateKeyPath string, logger *zap.Logg
 		return nil, fmt.Errorf("can not parse private key: %w", err)
 	}
 
-	return &Middleware{
-		publicKey:  publicKey,
-		privateKey: privateKey,
-		logger:     logger,
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key can not sign")
+	}
+	keyPair, ok := signer.Public().(interface{ Equal(x crypto.PublicKey) bool })
+	if !ok || !keyPair.Equal(publicKey) {
+		return nil, errors.New("public key does not match private key")
+	}
+
+	return &state{
+		publicKey:      publicKey,
+		privateKey:     privateKey,
+		publicKeyFile:  publicKeyFile,
+		privateKeyFile: privateKeyFile,
+		cookieDomain:   cfg.CookieDomain,
+		cookiePath:     cfg.CookiePath,
+		cookieMaxAge:   cfg.CookieMaxAge,
+		cookieSecure:   cfg.CookieSecure,
+		cookieHTTPOnly: cfg.CookieHTTPOnly,
 	}, nil
 }
 
@@ -73,40 +138,46 @@ func (m *Middleware) Logger() gin.HandlerFunc {
 	}
 }
 
+// ResponseAborter breaks the connection, or the HTTP/2 stream, of requests
+// whose handler set AbortResponse after a part of the response was sent, so
+// that clients do not take it for a complete one. It must run before
+// gin.Recovery, which would swallow the panic that aborts the response.
+func (m *Middleware) ResponseAborter() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		if ctx.GetBool(AbortResponse) {
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
 type JWT struct {
 	jwt.RegisteredClaims
-	UserID uuid.UUID `json:"user_id"`
+	UserID uuid.UUID   `json:"user_id"`
+	Role   models.Role `json:"role"`
+}
+
+func (j *JWT) HasRole(roles ...models.Role) bool {
+	return slices.Contains(roles, j.Role)
 }
 
 func (m *Middleware) SetJWT() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ctx.Next()
 
-		userIDValue, ok := ctx.Get(UserID)
+		userValue, ok := ctx.Get(User)
 		if !ok {
 			return
 		}
-		userID, ok := userIDValue.(*uuid.UUID)
-		if !ok || userID == nil {
+		user, ok := userValue.(*models.User)
+		if !ok || user == nil {
 			return
 		}
 
-		claims := &JWT{
-			RegisteredClaims: jwt.RegisteredClaims{
-				Issuer:    "loyalty_system",
-				Subject:   userID.String(),
-				Audience:  jwt.ClaimStrings{},
-				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Second * maxAge)),
-				NotBefore: jwt.NewNumericDate(time.Now()),
-				IssuedAt:  jwt.NewNumericDate(time.Now()),
-				ID:        uuid.New().String(),
-			},
-			UserID: *userID,
-		}
-
-		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		current := m.state.Load()
 
-		tokenString, err := token.SignedString(m.privateKey)
+		tokenString, err := current.newToken(*user)
 		if err != nil {
 			m.logger.Error("Can not sign token", zap.Error(err))
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
@@ -117,11 +188,11 @@ func (m *Middleware) SetJWT() gin.HandlerFunc {
 		ctx.SetCookie(
 			Authorization,
 			tokenString,
-			maxAge,
-			"/",
-			"",
-			false,
-			false,
+			int(current.cookieMaxAge.Seconds()),
+			current.cookiePath,
+			current.cookieDomain,
+			current.cookieSecure,
+			current.cookieHTTPOnly,
 		)
 
 		ctx.JSON(http.StatusOK, gin.H{"status": http.StatusText(http.StatusOK)})
@@ -137,31 +208,111 @@ func (m *Middleware) GetJWT() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(
-			tokenString,
-			&JWT{},
-			func(token *jwt.Token) (interface{}, error) {
-				if token.Method != jwt.SigningMethodEdDSA {
-					return nil, errors.New("jwt signature mismatch")
-				}
-				return m.publicKey, nil
-			},
-		)
+		claims, err := m.ParseToken(tokenString)
 		if err != nil {
 			ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
 			ctx.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(*JWT)
+		ctx.Set(Authorization, claims)
+
+		ctx.Next()
+	}
+}
+
+// RequireRoles must follow GetJWT and responds 403 to users having none of
+// the roles.
+func (m *Middleware) RequireRoles(roles ...models.Role) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tokenValue, ok := ctx.Get(Authorization)
+		if !ok {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+			ctx.Abort()
+			return
+		}
+		token, ok := tokenValue.(*JWT)
 		if !ok {
 			ctx.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
 			ctx.Abort()
 			return
 		}
 
-		ctx.Set(Authorization, claims)
+		if !token.HasRole(roles...) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": http.StatusText(http.StatusForbidden)})
+			ctx.Abort()
+			return
+		}
 
 		ctx.Next()
 	}
 }
+
+func (m *Middleware) NewToken(user models.User) (string, error) {
+	return m.state.Load().newToken(user)
+}
+
+func (s *state) newToken(user models.User) (string, error) {
+	claims := &JWT{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "loyalty_system",
+			Subject:   user.UserID.String(),
+			Audience:  jwt.ClaimStrings{},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.cookieMaxAge)),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.New().String(),
+		},
+		UserID: user.UserID,
+		Role:   user.Role,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+
+	tokenString, err := token.SignedString(s.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("can not sign token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+func (m *Middleware) ParseToken(tokenString string) (*JWT, error) {
+	current := m.state.Load()
+
+	claims, err := parseToken(tokenString, current.publicKey)
+	if err != nil && current.previousPublicKey != nil && errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		claims, err = parseToken(tokenString, current.previousPublicKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func parseToken(tokenString string, publicKey crypto.PublicKey) (*JWT, error) {
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		&JWT{},
+		func(token *jwt.Token) (interface{}, error) {
+			if token.Method != jwt.SigningMethodEdDSA {
+				return nil, errors.New("jwt signature mismatch")
+			}
+			return publicKey, nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*JWT)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	if claims.Role == "" {
+		claims.Role = models.RoleUser
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,136 @@
+package middlewares
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RexArseny/loyalty_system/internal/app/config"
+	"github.com/RexArseny/loyalty_system/internal/app/logger"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestKeys(t *testing.T, cfg *config.Config) ed25519.PrivateKey {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	err = os.WriteFile(cfg.PublicKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(cfg.PrivateKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0o600)
+	require.NoError(t, err)
+
+	return privateKey
+}
+
+func signTestToken(t *testing.T, privateKey ed25519.PrivateKey) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &JWT{UserID: uuid.New()}).SignedString(privateKey)
+	require.NoError(t, err)
+	return token
+}
+
+func TestMiddlewareReload(t *testing.T) {
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	cfg := &config.Config{
+		PublicKeyPath:  filepath.Join(dir, "public.pem"),
+		PrivateKeyPath: filepath.Join(dir, "private.pem"),
+		CookieMaxAge:   config.DefaultCookieMaxAge,
+	}
+	firstKey := writeTestKeys(t, cfg)
+
+	middleware, err := NewMiddleware(cfg, testLogger.Named("middleware"))
+	require.NoError(t, err)
+
+	rotated, err := middleware.Reload(cfg)
+	require.NoError(t, err)
+	assert.False(t, rotated)
+
+	secondKey := writeTestKeys(t, cfg)
+	rotated, err = middleware.Reload(cfg)
+	require.NoError(t, err)
+	assert.True(t, rotated)
+
+	_, err = middleware.ParseToken(signTestToken(t, firstKey))
+	assert.NoError(t, err)
+	_, err = middleware.ParseToken(signTestToken(t, secondKey))
+	assert.NoError(t, err)
+
+	writeTestKeys(t, cfg)
+	err = os.WriteFile(cfg.PrivateKeyPath, []byte("invalid"), 0o600)
+	require.NoError(t, err)
+	_, err = middleware.Reload(cfg)
+	assert.Error(t, err)
+
+	_, err = middleware.ParseToken(signTestToken(t, secondKey))
+	assert.NoError(t, err)
+}
+
+func TestMiddlewareRequireRoles(t *testing.T) {
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+	middleware, err := NewMiddleware(&config.Config{
+		PublicKeyPath:  "../../../public.pem",
+		PrivateKeyPath: "../../../private.pem",
+		CookieMaxAge:   config.DefaultCookieMaxAge,
+	}, testLogger.Named("middleware"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		role       models.Role
+		statusCode int
+	}{
+		{
+			name:       "allowed role",
+			role:       models.RoleAdmin,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "another allowed role",
+			role:       models.RoleSupport,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "forbidden role",
+			role:       models.RoleUser,
+			statusCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", middleware.GetJWT(), middleware.RequireRoles(models.RoleAdmin, models.RoleSupport),
+				func(ctx *gin.Context) {
+					ctx.JSON(http.StatusOK, gin.H{"status": http.StatusText(http.StatusOK)})
+				})
+
+			token, err := middleware.NewToken(models.User{UserID: uuid.New(), Role: tt.role})
+			require.NoError(t, err)
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.AddCookie(&http.Cookie{Name: Authorization, Value: token})
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, request)
+
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
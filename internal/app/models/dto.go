@@ -1,5 +1,11 @@
 package models
 
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
 const (
 	StatusNew        Status = "NEW"
 	StatusProcessing Status = "PROCESSING"
@@ -9,21 +15,127 @@ const (
 
 type Status string
 
+const (
+	RoleUser     Role = "user"
+	RoleSupport  Role = "support"
+	RoleAdmin    Role = "admin"
+	RoleMerchant Role = "merchant"
+)
+
+type Role string
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleUser, RoleSupport, RoleAdmin, RoleMerchant:
+		return true
+	default:
+		return false
+	}
+}
+
+type User struct {
+	UserID uuid.UUID
+	Role   Role
+}
+
 type AuthRequest struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Login        string `json:"login"`
+	Password     string `json:"password"`
+	ReferralCode string `json:"referral_code,omitempty"`
 }
 
 type OrderResponse struct {
-	Number     string   `json:"number"`
-	Status     string   `json:"status"`
-	Accrual    *float64 `json:"accrual,omitempty"`
-	UploadedAt string   `json:"uploaded_at"`
+	Number     string               `json:"number"`
+	Status     string               `json:"status"`
+	Accrual    *float64             `json:"accrual,omitempty"`
+	Bonuses    []OrderBonusResponse `json:"bonuses,omitempty"`
+	MerchantID string               `json:"merchant_id,omitempty"`
+	UploadedAt string               `json:"uploaded_at"`
+}
+
+type OrderUploadResult string
+
+const (
+	OrderUploadAccepted     OrderUploadResult = "accepted"
+	OrderUploadAlreadyAdded OrderUploadResult = "already_added"
+	OrderUploadConflict     OrderUploadResult = "conflict"
+	OrderUploadInvalid      OrderUploadResult = "invalid"
+)
+
+type OrderUploadResponse struct {
+	Number string            `json:"number"`
+	Result OrderUploadResult `json:"result"`
+	Status int               `json:"status"`
+}
+
+type OrderBonusResponse struct {
+	Campaign string  `json:"campaign"`
+	Sum      float64 `json:"sum"`
 }
 
 type BalanceResponse struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Expiring  []ExpiringPointsResponse `json:"expiring,omitempty"`
+	Current   float64                  `json:"current"`
+	Held      float64                  `json:"held"`
+	Withdrawn float64                  `json:"withdrawn"`
+}
+
+type ExpiringPointsResponse struct {
+	Order     string  `json:"order,omitempty"`
+	ExpiresAt string  `json:"expires_at"`
+	Sum       float64 `json:"sum"`
+}
+
+type LoyaltyTierResponse struct {
+	Tier              string  `json:"tier"`
+	Multiplier        float64 `json:"multiplier"`
+	Accrued           float64 `json:"accrued"`
+	NextTier          string  `json:"next_tier,omitempty"`
+	NextTierThreshold float64 `json:"next_tier_threshold,omitempty"`
+	Remaining         float64 `json:"remaining,omitempty"`
+}
+
+type HoldStatus string
+
+const (
+	HoldActive   HoldStatus = "active"
+	HoldCaptured HoldStatus = "captured"
+	HoldVoided   HoldStatus = "voided"
+	HoldExpired  HoldStatus = "expired"
+)
+
+type HoldRequest struct {
+	Order string  `json:"order"`
+	Sum   float64 `json:"sum"`
+}
+
+type HoldResponse struct {
+	HoldID     string     `json:"hold_id"`
+	Order      string     `json:"order"`
+	Status     HoldStatus `json:"status"`
+	CreatedAt  string     `json:"created_at"`
+	ExpiresAt  string     `json:"expires_at"`
+	FinishedAt string     `json:"finished_at,omitempty"`
+	Sum        float64    `json:"sum"`
+}
+
+type TransferDirection string
+
+const (
+	TransferIncoming TransferDirection = "incoming"
+	TransferOutgoing TransferDirection = "outgoing"
+)
+
+type TransferRequest struct {
+	Login string  `json:"login"`
+	Sum   float64 `json:"sum"`
+}
+
+type TransferResponse struct {
+	Login       string            `json:"login"`
+	Direction   TransferDirection `json:"direction"`
+	ProcessedAt string            `json:"processed_at"`
+	Sum         float64           `json:"sum"`
 }
 
 type WithdrawRequest struct {
@@ -35,4 +147,187 @@ type WithdrawResponse struct {
 	Order       string  `json:"order"`
 	ProcessedAt string  `json:"processed_at"`
 	Sum         float64 `json:"sum"`
+	Reversed    float64 `json:"reversed,omitempty"`
+}
+
+type ReversalRequest struct {
+	Sum        *float64 `json:"sum,omitempty"`
+	ReversalID string   `json:"reversal_id"`
+}
+
+type ReversalResponse struct {
+	ReversalID string  `json:"reversal_id"`
+	Order      string  `json:"order"`
+	CreatedAt  string  `json:"created_at"`
+	Sum        float64 `json:"sum"`
+}
+
+const (
+	AdminActionSearchUsers       AdminAction = "search_users"
+	AdminActionViewUser          AdminAction = "view_user"
+	AdminActionViewOrders        AdminAction = "view_orders"
+	AdminActionViewWithdrawals   AdminAction = "view_withdrawals"
+	AdminActionViewBalance       AdminAction = "view_balance"
+	AdminActionViewActions       AdminAction = "view_actions"
+	AdminActionAdjustBalance     AdminAction = "adjust_balance"
+	AdminActionRecheckOrder      AdminAction = "recheck_order"
+	AdminActionDisableUser       AdminAction = "disable_user"
+	AdminActionEnableUser        AdminAction = "enable_user"
+	AdminActionCreateCampaign    AdminAction = "create_campaign"
+	AdminActionEndCampaign       AdminAction = "end_campaign"
+	AdminActionViewCampaigns     AdminAction = "view_campaigns"
+	AdminActionCreateMerchant    AdminAction = "create_merchant"
+	AdminActionViewMerchants     AdminAction = "view_merchants"
+	AdminActionReverseWithdrawal AdminAction = "reverse_withdrawal"
+)
+
+type AdminAction string
+
+const (
+	ReasonGoodwill     Reason = "goodwill"
+	ReasonCorrection   Reason = "correction"
+	ReasonCompensation Reason = "compensation"
+	ReasonFraud        Reason = "fraud"
+)
+
+type Reason string
+
+func (r Reason) Valid() bool {
+	switch r {
+	case ReasonGoodwill, ReasonCorrection, ReasonCompensation, ReasonFraud:
+		return true
+	default:
+		return false
+	}
+}
+
+type AdminUserResponse struct {
+	UserID   string `json:"user_id"`
+	Login    string `json:"login"`
+	Role     Role   `json:"role"`
+	Disabled bool   `json:"disabled"`
+}
+
+type AdjustmentRequest struct {
+	Reason  Reason  `json:"reason"`
+	Comment string  `json:"comment"`
+	Amount  float64 `json:"amount"`
+}
+
+type UserStatusRequest struct {
+	Reason  Reason `json:"reason"`
+	Comment string `json:"comment"`
+}
+
+type AdminActionResponse struct {
+	Amount      *float64    `json:"amount,omitempty"`
+	AdminID     string      `json:"admin_id"`
+	UserID      string      `json:"user_id,omitempty"`
+	Action      AdminAction `json:"action"`
+	OrderNumber string      `json:"order,omitempty"`
+	Reason      Reason      `json:"reason,omitempty"`
+	Comment     string      `json:"comment,omitempty"`
+	CreatedAt   string      `json:"created_at"`
+}
+
+type CampaignRequest struct {
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	Multiplier *float64  `json:"multiplier"`
+	Bonus      *float64  `json:"bonus"`
+	Budget     *float64  `json:"budget"`
+	Name       string    `json:"name"`
+	Tiers      []string  `json:"tiers"`
+	UserIDs    []string  `json:"user_ids"`
+}
+
+type CampaignResponse struct {
+	CampaignID string   `json:"campaign_id"`
+	Name       string   `json:"name"`
+	StartsAt   string   `json:"starts_at"`
+	EndsAt     string   `json:"ends_at"`
+	Tiers      []string `json:"tiers,omitempty"`
+	UserIDs    []string `json:"user_ids,omitempty"`
+	Multiplier *float64 `json:"multiplier,omitempty"`
+	Bonus      *float64 `json:"bonus,omitempty"`
+	Budget     *float64 `json:"budget,omitempty"`
+	Spent      float64  `json:"spent"`
+	CreatedBy  string   `json:"created_by"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+type MerchantRequest struct {
+	OrderPrefix    *string `json:"order_prefix"`
+	MerchantID     string  `json:"merchant_id"`
+	Name           string  `json:"name"`
+	AccrualAddress string  `json:"accrual_address"`
+	RateLimit      float64 `json:"rate_limit"`
+}
+
+type MerchantResponse struct {
+	MerchantID     string  `json:"merchant_id"`
+	Name           string  `json:"name"`
+	OrderPrefix    *string `json:"order_prefix,omitempty"`
+	AccrualAddress string  `json:"accrual_address"`
+	RateLimit      float64 `json:"rate_limit"`
+	CreatedAt      string  `json:"created_at"`
+}
+
+type ReferralStatus string
+
+const (
+	ReferralPending  ReferralStatus = "pending"
+	ReferralRewarded ReferralStatus = "rewarded"
+)
+
+type ReferralsResponse struct {
+	Code       string             `json:"code"`
+	ReferredBy *ReferralResponse  `json:"referred_by,omitempty"`
+	Referrals  []ReferralResponse `json:"referrals,omitempty"`
+	Earned     float64            `json:"earned"`
+}
+
+type ReferralResponse struct {
+	Login      string         `json:"login"`
+	Status     ReferralStatus `json:"status"`
+	Bonus      float64        `json:"bonus"`
+	CreatedAt  string         `json:"created_at"`
+	RewardedAt string         `json:"rewarded_at,omitempty"`
+}
+
+type StatementFormat string
+
+const (
+	StatementCSV    StatementFormat = "csv"
+	StatementNDJSON StatementFormat = "ndjson"
+)
+
+type StatementEntryType string
+
+const (
+	StatementAccrual       StatementEntryType = "accrual"
+	StatementCampaignBonus StatementEntryType = "campaign_bonus"
+	StatementReferralBonus StatementEntryType = "referral_bonus"
+	StatementAdjustment    StatementEntryType = "adjustment"
+	StatementTransferIn    StatementEntryType = "transfer_in"
+	StatementTransferOut   StatementEntryType = "transfer_out"
+	StatementWithdrawal    StatementEntryType = "withdrawal"
+	StatementReversal      StatementEntryType = "reversal"
+	StatementExpiration    StatementEntryType = "expiration"
+	StatementHold          StatementEntryType = "hold"
+	StatementHoldRelease   StatementEntryType = "hold_release"
+)
+
+type StatementRequest struct {
+	From   *time.Time
+	To     *time.Time
+	Format StatementFormat
+}
+
+type StatementEntryResponse struct {
+	CreatedAt string             `json:"created_at"`
+	Type      StatementEntryType `json:"type"`
+	Order     string             `json:"order,omitempty"`
+	Amount    float64            `json:"amount"`
+	Balance   float64            `json:"balance"`
 }
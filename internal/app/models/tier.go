@@ -0,0 +1,32 @@
+package models
+
+type LoyaltyTier struct {
+	Name       string
+	Threshold  float64
+	Multiplier float64
+}
+
+// LoyaltyTiers are sorted by threshold, the first tier starts at zero.
+type LoyaltyTiers []LoyaltyTier
+
+// ForAccrual returns the index of the highest tier reached with the accrued
+// points.
+func (t LoyaltyTiers) ForAccrual(accrued float64) int {
+	var index int
+	for i, tier := range t {
+		if accrued >= tier.Threshold {
+			index = i
+		}
+	}
+	return index
+}
+
+// Index returns the index of the tier with the name or -1.
+func (t LoyaltyTiers) Index(name string) int {
+	for i, tier := range t {
+		if tier.Name == name {
+			return i
+		}
+	}
+	return -1
+}
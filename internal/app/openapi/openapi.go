@@ -0,0 +1,201 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	SpecPath = "/api/openapi.json"
+	DocsPath = "/api/docs"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+//go:embed docs.html
+var docs []byte
+
+// streamedMediaTypes are written while they are produced and never buffered
+// for response validation.
+var streamedMediaTypes = []string{"text/csv", "application/x-ndjson"}
+
+func Load(ctx context.Context) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("can not load openapi spec: %w", err)
+	}
+
+	err = doc.Validate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid openapi spec: %w", err)
+	}
+
+	return doc, nil
+}
+
+func Spec() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "application/json", spec)
+	}
+}
+
+func Docs() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", docs)
+	}
+}
+
+type Validator struct {
+	logger            *zap.Logger
+	router            routers.Router
+	validateResponses bool
+}
+
+// NewValidator creates a middleware validating requests against the spec.
+// With validateResponses it also buffers every response that is not streamed
+// and replaces the ones that do not match the spec with 500, which is meant for
+// tests only.
+func NewValidator(logger *zap.Logger, doc *openapi3.T, validateResponses bool) (*Validator, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("can not create openapi router: %w", err)
+	}
+
+	return &Validator{
+		logger:            logger,
+		router:            router,
+		validateResponses: validateResponses,
+	}, nil
+}
+
+func (v *Validator) Validate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route, pathParams, err := v.router.FindRoute(ctx.Request)
+		if err != nil {
+			ctx.Next()
+			return
+		}
+
+		requestInput := &openapi3filter.RequestValidationInput{
+			Request:    ctx.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		err = openapi3filter.ValidateRequest(ctx, requestInput)
+		if err != nil {
+			v.logger.Debug("Request does not match openapi spec", zap.Error(err))
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+			ctx.Abort()
+			return
+		}
+
+		if !v.validateResponses || streamed(route.Operation) {
+			ctx.Next()
+			return
+		}
+
+		writer := &bufferedWriter{ResponseWriter: ctx.Writer, status: http.StatusOK}
+		ctx.Writer = writer
+		ctx.Next()
+		ctx.Writer = writer.ResponseWriter
+
+		body := writer.body.Bytes()
+		if writer.status == http.StatusNoContent {
+			body = nil
+		}
+		responseInput := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: requestInput,
+			Status:                 writer.status,
+			Header:                 writer.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(body)),
+			Options: &openapi3filter.Options{
+				IncludeResponseStatus: true,
+			},
+		}
+		err = openapi3filter.ValidateResponse(ctx, responseInput)
+		if err != nil {
+			v.logger.Error("Response does not match openapi spec",
+				zap.String("method", ctx.Request.Method),
+				zap.String("path", ctx.Request.URL.Path),
+				zap.Int("code", writer.status),
+				zap.Error(err))
+			ctx.Writer.Header().Del("Content-Type")
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+			return
+		}
+
+		ctx.Writer.WriteHeader(writer.status)
+		_, _ = ctx.Writer.Write(body)
+	}
+}
+
+func streamed(operation *openapi3.Operation) bool {
+	for _, response := range operation.Responses.Map() {
+		if response.Value == nil {
+			continue
+		}
+		for _, mediaType := range streamedMediaTypes {
+			if _, ok := response.Value.Content[mediaType]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body    bytes.Buffer
+	status  int
+	written bool
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
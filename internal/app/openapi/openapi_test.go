@@ -0,0 +1,79 @@
+package openapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RexArseny/loyalty_system/internal/app/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidator(t *testing.T) {
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+	doc, err := Load(context.Background())
+	require.NoError(t, err)
+	validator, err := NewValidator(testLogger.Named("openapi"), doc, true)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(validator.Validate())
+	router.POST("/api/user/login", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"status": http.StatusText(http.StatusOK)})
+	})
+	router.GET("/api/user/balance", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"current": "unknown"})
+	})
+	router.GET(SpecPath, Spec())
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		statusCode int
+	}{
+		{
+			name:       "valid request and response",
+			method:     http.MethodPost,
+			path:       "/api/user/login",
+			body:       `{"login":"testlogin","password":"testpassword"}`,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "invalid request",
+			method:     http.MethodPost,
+			path:       "/api/user/login",
+			body:       `{"login":1}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid response",
+			method:     http.MethodGet,
+			path:       "/api/user/balance",
+			statusCode: http.StatusInternalServerError,
+		},
+		{
+			name:       "undocumented route",
+			method:     http.MethodGet,
+			path:       SpecPath,
+			statusCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, request)
+
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
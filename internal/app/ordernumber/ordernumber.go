@@ -0,0 +1,71 @@
+package ordernumber
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Validator checks an order number against one check digit scheme.
+type Validator interface {
+	Name() string
+	Valid(orderNumber string) bool
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Validator)
+)
+
+func init() {
+	Register(Luhn)
+	Register(Verhoeff)
+	Register(Damm)
+	Register(Mod11)
+}
+
+// Register makes a validator available to the config by its name. It panics
+// if the name is empty or already registered.
+func Register(validator Validator) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name := validator.Name()
+	if name == "" {
+		panic("ordernumber: validator without a name")
+	}
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("ordernumber: validator %q registered twice", name))
+	}
+	registry[name] = validator
+}
+
+func Lookup(name string) (Validator, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	validator, ok := registry[name]
+	return validator, ok
+}
+
+// Names returns the sorted names of the registered validators.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func digits(value string) bool {
+	for index := 0; index < len(value); index++ {
+		if value[index] < '0' || value[index] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,250 @@
+package ordernumber
+
+import (
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name        string
+		validator   Validator
+		orderNumber string
+		want        bool
+	}{
+		{
+			name:        "luhn",
+			validator:   Luhn,
+			orderNumber: "12345678903",
+			want:        true,
+		},
+		{
+			name:        "luhn leading zeros",
+			validator:   Luhn,
+			orderNumber: "0012345678903",
+			want:        true,
+		},
+		{
+			name:        "luhn longer than int64",
+			validator:   Luhn,
+			orderNumber: "12345678901234567890123459",
+			want:        true,
+		},
+		{
+			name:        "luhn invalid checksum",
+			validator:   Luhn,
+			orderNumber: "12345678902",
+			want:        false,
+		},
+		{
+			name:        "verhoeff",
+			validator:   Verhoeff,
+			orderNumber: "2363",
+			want:        true,
+		},
+		{
+			name:        "verhoeff invalid checksum",
+			validator:   Verhoeff,
+			orderNumber: "2364",
+			want:        false,
+		},
+		{
+			name:        "damm",
+			validator:   Damm,
+			orderNumber: "5724",
+			want:        true,
+		},
+		{
+			name:        "damm invalid checksum",
+			validator:   Damm,
+			orderNumber: "5723",
+			want:        false,
+		},
+		{
+			name:        "mod11",
+			validator:   Mod11,
+			orderNumber: "03653277",
+			want:        true,
+		},
+		{
+			name:        "mod11 invalid checksum",
+			validator:   Mod11,
+			orderNumber: "03653278",
+			want:        false,
+		},
+		{
+			name:        "not digits",
+			validator:   Luhn,
+			orderNumber: "-12345678903",
+			want:        false,
+		},
+		{
+			name:        "empty",
+			validator:   Damm,
+			orderNumber: "",
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.validator.Valid(tt.orderNumber))
+		})
+	}
+}
+
+func TestCheckDigitProperties(t *testing.T) {
+	tests := []struct {
+		scheme checkDigitScheme
+		// missedTranspositions are adjacent digit pairs the scheme does not
+		// detect when swapped.
+		missedTranspositions map[[2]byte]bool
+	}{
+		{
+			scheme:               Luhn.(checkDigitScheme),
+			missedTranspositions: map[[2]byte]bool{{0, 9}: true, {9, 0}: true},
+		},
+		{
+			scheme: Verhoeff.(checkDigitScheme),
+		},
+		{
+			scheme: Damm.(checkDigitScheme),
+		},
+		{
+			scheme: Mod11.(checkDigitScheme),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scheme.Name(), func(t *testing.T) {
+			onlyCheckDigit := func(values []byte) bool {
+				payload := digitString(values)
+				check, ok := tt.scheme.checkDigit(payload)
+				for digit := byte(0); digit < 10; digit++ {
+					if tt.scheme.Valid(payload+string('0'+digit)) != (ok && digit == check) {
+						return false
+					}
+				}
+				return true
+			}
+			require.NoError(t, quick.Check(onlyCheckDigit, nil))
+
+			detectsSubstitution := func(values []byte, position uint, delta uint8) bool {
+				orderNumber, ok := validNumber(tt.scheme, values)
+				if !ok {
+					return true
+				}
+				changed := []byte(orderNumber)
+				index := int(position % uint(len(changed)))
+				changed[index] = '0' + (changed[index]-'0'+delta%9+1)%10
+				return !tt.scheme.Valid(string(changed))
+			}
+			require.NoError(t, quick.Check(detectsSubstitution, nil))
+
+			detectsTransposition := func(values []byte, position uint) bool {
+				orderNumber, ok := validNumber(tt.scheme, values)
+				if !ok || len(orderNumber) < 2 {
+					return true
+				}
+				changed := []byte(orderNumber)
+				index := int(position % uint(len(changed)-1))
+				pair := [2]byte{changed[index] - '0', changed[index+1] - '0'}
+				if pair[0] == pair[1] || tt.missedTranspositions[pair] {
+					return true
+				}
+				changed[index], changed[index+1] = changed[index+1], changed[index]
+				return !tt.scheme.Valid(string(changed))
+			}
+			require.NoError(t, quick.Check(detectsTransposition, nil))
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := &Policy{
+		Default: []Validator{Luhn},
+		Rules: []Rule{
+			{From: "7", To: "7", Validators: []Validator{Verhoeff, Damm}},
+			{From: "70", To: "72", Validators: []Validator{Mod11}},
+		},
+	}
+	tests := []struct {
+		name        string
+		orderNumber string
+		want        bool
+	}{
+		{
+			name:        "default luhn",
+			orderNumber: "12345678903",
+			want:        true,
+		},
+		{
+			name:        "default rejects other schemes",
+			orderNumber: "2363",
+			want:        false,
+		},
+		{
+			name:        "prefix verhoeff",
+			orderNumber: "7571",
+			want:        true,
+		},
+		{
+			name:        "prefix damm",
+			orderNumber: "7573",
+			want:        true,
+		},
+		{
+			name:        "prefix rejects luhn",
+			orderNumber: "7575",
+			want:        false,
+		},
+		{
+			name:        "longer range wins",
+			orderNumber: "701",
+			want:        true,
+		},
+		{
+			name:        "longer range rejects shorter prefix schemes",
+			orderNumber: "703",
+			want:        false,
+		},
+		{
+			name:        "not digits",
+			orderNumber: "7a",
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.Valid(tt.orderNumber))
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	assert.Equal(t, []string{"damm", "luhn", "mod11", "verhoeff"}, Names())
+
+	validator, ok := Lookup("verhoeff")
+	require.True(t, ok)
+	assert.Equal(t, "verhoeff", validator.Name())
+
+	_, ok = Lookup("unknown")
+	assert.False(t, ok)
+
+	assert.Panics(t, func() { Register(Luhn) })
+}
+
+func digitString(values []byte) string {
+	result := make([]byte, len(values))
+	for index, value := range values {
+		result[index] = '0' + value%10
+	}
+	return string(result)
+}
+
+func validNumber(scheme checkDigitScheme, values []byte) (string, bool) {
+	payload := digitString(values)
+	check, ok := scheme.checkDigit(payload)
+	return payload + string('0'+check), ok
+}
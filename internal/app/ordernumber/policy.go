@@ -0,0 +1,55 @@
+package ordernumber
+
+// Rule applies its validators to the order numbers starting with a prefix
+// from From to To. Both bounds have the same length.
+type Rule struct {
+	From       string
+	To         string
+	Validators []Validator
+}
+
+func (r Rule) matches(orderNumber string) bool {
+	if len(orderNumber) < len(r.From) {
+		return false
+	}
+	prefix := orderNumber[:len(r.From)]
+	return prefix >= r.From && prefix <= r.To
+}
+
+// Policy selects the validators of an order number. The rule with the longest
+// matching prefix applies, numbers matching no rule are checked by Default.
+// A number is valid if any of the selected validators accepts it.
+type Policy struct {
+	Default []Validator
+	Rules   []Rule
+}
+
+// DefaultPolicy accepts every number passing the Luhn check.
+func DefaultPolicy() *Policy {
+	return &Policy{Default: []Validator{Luhn}}
+}
+
+func (p *Policy) Valid(orderNumber string) bool {
+	if orderNumber == "" || !digits(orderNumber) {
+		return false
+	}
+
+	validators := p.Default
+	var matched *Rule
+	for index := range p.Rules {
+		rule := &p.Rules[index]
+		if rule.matches(orderNumber) && (matched == nil || len(rule.From) > len(matched.From)) {
+			matched = rule
+		}
+	}
+	if matched != nil {
+		validators = matched.Validators
+	}
+
+	for _, validator := range validators {
+		if validator.Valid(orderNumber) {
+			return true
+		}
+	}
+	return false
+}
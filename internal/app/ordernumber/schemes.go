@@ -0,0 +1,115 @@
+package ordernumber
+
+var (
+	Luhn     Validator = checkDigitScheme{name: "luhn", checkDigit: luhnCheckDigit}
+	Verhoeff Validator = checkDigitScheme{name: "verhoeff", checkDigit: verhoeffCheckDigit}
+	Damm     Validator = checkDigitScheme{name: "damm", checkDigit: dammCheckDigit}
+	Mod11    Validator = checkDigitScheme{name: "mod11", checkDigit: mod11CheckDigit}
+)
+
+// checkDigitScheme accepts numbers whose last digit is the check digit of
+// the digits before it.
+type checkDigitScheme struct {
+	name       string
+	checkDigit func(payload string) (byte, bool)
+}
+
+func (s checkDigitScheme) Name() string {
+	return s.name
+}
+
+func (s checkDigitScheme) Valid(orderNumber string) bool {
+	if orderNumber == "" || !digits(orderNumber) {
+		return false
+	}
+
+	check, ok := s.checkDigit(orderNumber[:len(orderNumber)-1])
+	return ok && check == orderNumber[len(orderNumber)-1]-'0'
+}
+
+func luhnCheckDigit(payload string) (byte, bool) {
+	var sum int
+	for index := 0; index < len(payload); index++ {
+		cur := int(payload[len(payload)-1-index] - '0')
+		if index%2 == 0 {
+			cur = cur * 2
+			if cur > 9 {
+				cur = cur%10 + cur/10
+			}
+		}
+		sum += cur
+	}
+	return byte((10 - sum%10) % 10), true
+}
+
+var (
+	verhoeffMultiplication = [10][10]byte{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+		{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+		{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+		{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+		{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffPermutation = [8][10]byte{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+		{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 6, 8, 7, 0},
+		{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+		{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+	verhoeffInverse = [10]byte{0, 4, 3, 2, 1, 5, 6, 7, 8, 9}
+)
+
+func verhoeffCheckDigit(payload string) (byte, bool) {
+	var check byte
+	for index := 0; index < len(payload); index++ {
+		cur := payload[len(payload)-1-index] - '0'
+		check = verhoeffMultiplication[check][verhoeffPermutation[(index+1)%8][cur]]
+	}
+	return verhoeffInverse[check], true
+}
+
+// dammQuasigroup has zeros on the diagonal, so the check digit is the interim
+// digit of the payload.
+var dammQuasigroup = [10][10]byte{
+	{0, 3, 1, 7, 5, 9, 8, 6, 4, 2},
+	{7, 0, 9, 2, 1, 5, 4, 8, 6, 3},
+	{4, 2, 0, 6, 8, 7, 1, 3, 5, 9},
+	{1, 7, 5, 0, 9, 8, 3, 4, 2, 6},
+	{6, 1, 2, 3, 0, 4, 5, 9, 7, 8},
+	{3, 6, 7, 4, 2, 0, 9, 5, 8, 1},
+	{5, 8, 6, 9, 7, 2, 0, 1, 3, 4},
+	{8, 9, 4, 5, 3, 6, 2, 0, 1, 7},
+	{9, 4, 3, 8, 6, 1, 7, 2, 0, 5},
+	{2, 5, 8, 1, 4, 3, 6, 7, 9, 0},
+}
+
+func dammCheckDigit(payload string) (byte, bool) {
+	var interim byte
+	for index := 0; index < len(payload); index++ {
+		interim = dammQuasigroup[interim][payload[index]-'0']
+	}
+	return interim, true
+}
+
+// mod11CheckDigit weights the payload with 2 to 7 from the right. Payloads
+// whose check digit would be 10 have no valid number.
+func mod11CheckDigit(payload string) (byte, bool) {
+	var sum int
+	for index := 0; index < len(payload); index++ {
+		sum += int(payload[len(payload)-1-index]-'0') * (index%6 + 2)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 0, false
+	}
+	return byte(check), true
+}
@@ -0,0 +1,1568 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/config"
+	"github.com/RexArseny/loyalty_system/internal/app/external"
+	"github.com/RexArseny/loyalty_system/internal/app/logger"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testDatabaseURIEnv = "TEST_DATABASE_URI"
+	testLogin          = "testlogin"
+	testAnotherLogin   = "testanotherlogin"
+	testHash           = "testhash"
+	testSalt           = "testsalt"
+	testOrderNumber    = "12345678903"
+	testAnotherOrder   = "2377225624"
+	testWithdrawOrder  = "49927398716"
+)
+
+type repositoryFactory func(t *testing.T) Repository
+
+func TestMemoryRepositoryConformance(t *testing.T) {
+	runConformanceTests(t, func(t *testing.T) Repository {
+		testLogger, err := logger.InitLogger()
+		require.NoError(t, err)
+		return NewMemoryRepository(testLogger.Named("repository"))
+	})
+}
+
+func TestDBRepositoryConformance(t *testing.T) {
+	databaseURI := os.Getenv(testDatabaseURIEnv)
+	if databaseURI == "" {
+		t.Skipf("%s is not set", testDatabaseURIEnv)
+	}
+
+	runConformanceTests(t, func(t *testing.T) Repository {
+		ctx := context.Background()
+		testLogger, err := logger.InitLogger()
+		require.NoError(t, err)
+
+		dbRepository, err := NewDBRepository(ctx, testLogger.Named("repository"), &config.Config{
+			DatabaseURI: databaseURI,
+			AutoMigrate: true,
+		})
+		require.NoError(t, err)
+		_, err = dbRepository.pool.Exec(ctx, `TRUNCATE users, orders, balances, withdrawals, admin_actions,
+			point_lots, point_expirations, transfers, reversals, holds, hold_lots, campaigns, campaign_bonuses,
+			referrals, merchants`)
+		require.NoError(t, err)
+
+		return dbRepository
+	})
+}
+
+func runConformanceTests(t *testing.T, newRepository repositoryFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, dataRepository Repository)
+	}{
+		{
+			name: "registration",
+			run:  testConformanceRegistration,
+		},
+		{
+			name: "duplicate login",
+			run:  testConformanceDuplicateLogin,
+		},
+		{
+			name: "unknown login",
+			run:  testConformanceUnknownLogin,
+		},
+		{
+			name: "user roles",
+			run:  testConformanceUserRoles,
+		},
+		{
+			name: "order ownership",
+			run:  testConformanceOrderOwnership,
+		},
+		{
+			name: "no orders",
+			run:  testConformanceNoOrders,
+		},
+		{
+			name: "balance crediting",
+			run:  testConformanceBalanceCrediting,
+		},
+		{
+			name: "repeated processing",
+			run:  testConformanceRepeatedProcessing,
+		},
+		{
+			name: "overdraft refusal",
+			run:  testConformanceOverdraftRefusal,
+		},
+		{
+			name: "withdrawals",
+			run:  testConformanceWithdrawals,
+		},
+		{
+			name: "status updates",
+			run:  testConformanceStatusUpdates,
+		},
+		{
+			name: "duplicate withdrawal",
+			run:  testConformanceDuplicateWithdrawal,
+		},
+		{
+			name: "invalid withdrawal sum",
+			run:  testConformanceInvalidWithdrawalSum,
+		},
+		{
+			name: "unknown user",
+			run:  testConformanceUnknownUser,
+		},
+		{
+			name: "invalid order status",
+			run:  testConformanceInvalidOrderStatus,
+		},
+		{
+			name: "user search",
+			run:  testConformanceUserSearch,
+		},
+		{
+			name: "balance adjustments",
+			run:  testConformanceBalanceAdjustments,
+		},
+		{
+			name: "user disabling",
+			run:  testConformanceUserDisabling,
+		},
+		{
+			name: "admin actions",
+			run:  testConformanceAdminActions,
+		},
+		{
+			name: "points expiration",
+			run:  testConformancePointsExpiration,
+		},
+		{
+			name: "points expiry order",
+			run:  testConformancePointsExpiryOrder,
+		},
+		{
+			name: "transfers",
+			run:  testConformanceTransfers,
+		},
+		{
+			name: "transfer expiry",
+			run:  testConformanceTransferExpiry,
+		},
+		{
+			name: "withdrawal reversals",
+			run:  testConformanceWithdrawalReversals,
+		},
+		{
+			name: "merchant reversals",
+			run:  testConformanceMerchantReversals,
+		},
+		{
+			name: "holds",
+			run:  testConformanceHolds,
+		},
+		{
+			name: "loyalty tiers",
+			run:  testConformanceLoyaltyTiers,
+		},
+		{
+			name: "campaigns",
+			run:  testConformanceCampaigns,
+		},
+		{
+			name: "referrals",
+			run:  testConformanceReferrals,
+		},
+		{
+			name: "batch orders",
+			run:  testConformanceBatchOrders,
+		},
+		{
+			name: "merchants",
+			run:  testConformanceMerchants,
+		},
+		{
+			name: "statement",
+			run:  testConformanceStatement,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataRepository := newRepository(t)
+			defer dataRepository.Close()
+
+			tt.run(t, dataRepository)
+		})
+	}
+}
+
+func registerTestUser(t *testing.T, dataRepository Repository, login string) uuid.UUID {
+	userID := uuid.New()
+	err := dataRepository.Registration(context.Background(), login, testHash, testSalt, userID,
+		strings.ToUpper(login), nil)
+	require.NoError(t, err)
+	return userID
+}
+
+func creditTestUser(t *testing.T, dataRepository Repository, userID uuid.UUID, orderNumber string, sum float64) {
+	ctx := context.Background()
+	err := dataRepository.AddOrder(ctx, orderNumber, "", userID)
+	require.NoError(t, err)
+	err = dataRepository.UpdateOrder(ctx, orderNumber, string(external.StatusProcessed), &sum, userID, nil, nil)
+	require.NoError(t, err)
+}
+
+func testConformanceRegistration(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+
+	user, err := dataRepository.GetUser(ctx, testLogin)
+	require.NoError(t, err)
+	assert.Equal(t, &User{
+		Login:        testLogin,
+		Hash:         testHash,
+		Salt:         testSalt,
+		Role:         string(models.RoleUser),
+		ReferralCode: strings.ToUpper(testLogin),
+		UserID:       userID,
+	}, user)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, &Balance{}, balance)
+}
+
+func testConformanceDuplicateLogin(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+
+	err := dataRepository.Registration(ctx, testLogin, testHash, testSalt, uuid.New(), "DUPLICATE", nil)
+	var errOriginalLoginUniqueViolation *ErrOriginalLoginUniqueViolation
+	assert.ErrorAs(t, err, &errOriginalLoginUniqueViolation)
+
+	user, err := dataRepository.GetUser(ctx, testLogin)
+	require.NoError(t, err)
+	assert.Equal(t, userID, user.UserID)
+}
+
+func testConformanceUnknownLogin(t *testing.T, dataRepository Repository) {
+	_, err := dataRepository.GetUser(context.Background(), testLogin)
+	var errInvalidAuthData *ErrInvalidAuthData
+	assert.ErrorAs(t, err, &errInvalidAuthData)
+}
+
+func testConformanceUserRoles(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	registerTestUser(t, dataRepository, testLogin)
+
+	err := dataRepository.SetUserRole(ctx, testLogin, string(models.RoleAdmin), "")
+	require.NoError(t, err)
+	user, err := dataRepository.GetUser(ctx, testLogin)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.RoleAdmin), user.Role)
+
+	err = dataRepository.SetUserRole(ctx, testLogin, "root", "")
+	var errInvalidRole *ErrInvalidRole
+	assert.ErrorAs(t, err, &errInvalidRole)
+
+	err = dataRepository.SetUserRole(ctx, testAnotherLogin, string(models.RoleAdmin), "")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func testConformanceOrderOwnership(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	anotherUserID := registerTestUser(t, dataRepository, testAnotherLogin)
+
+	err := dataRepository.AddOrder(ctx, testOrderNumber, "", userID)
+	require.NoError(t, err)
+
+	err = dataRepository.AddOrder(ctx, testOrderNumber, "", userID)
+	var errAlreadyAdded *ErrAlreadyAdded
+	assert.ErrorAs(t, err, &errAlreadyAdded)
+
+	err = dataRepository.AddOrder(ctx, testOrderNumber, "", anotherUserID)
+	var errAlreadyAddedByAnotherUser *ErrAlreadyAddedByAnotherUser
+	assert.ErrorAs(t, err, &errAlreadyAddedByAnotherUser)
+
+	orders, err := dataRepository.GetOrders(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, testOrderNumber, orders[0].Number)
+	assert.Equal(t, string(models.StatusNew), orders[0].Status)
+	assert.Nil(t, orders[0].Accrual)
+
+	_, err = dataRepository.GetOrders(ctx, anotherUserID)
+	assert.ErrorIs(t, err, ErrNoOrders)
+}
+
+func testConformanceNoOrders(t *testing.T, dataRepository Repository) {
+	userID := registerTestUser(t, dataRepository, testLogin)
+
+	_, err := dataRepository.GetOrders(context.Background(), userID)
+	assert.ErrorIs(t, err, ErrNoOrders)
+}
+
+func testConformanceBalanceCrediting(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	anotherUserID := registerTestUser(t, dataRepository, testAnotherLogin)
+
+	err := dataRepository.AddOrder(ctx, testAnotherOrder, "", userID)
+	require.NoError(t, err)
+	accrual := float64(50)
+	err = dataRepository.UpdateOrder(ctx, testAnotherOrder, string(external.StatusProcessing), &accrual, userID, nil, nil)
+	require.NoError(t, err)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, &Balance{}, balance)
+
+	creditTestUser(t, dataRepository, userID, testOrderNumber, 100.5)
+
+	balance, err = dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, &Balance{Current: 100.5}, balance)
+
+	balance, err = dataRepository.GetBalance(ctx, anotherUserID)
+	require.NoError(t, err)
+	assert.Equal(t, &Balance{}, balance)
+}
+
+func testConformanceRepeatedProcessing(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	expiresAt := time.Now().Add(24 * time.Hour)
+	policy := &TierPolicy{
+		Tiers: models.LoyaltyTiers{
+			{Name: "silver", Threshold: 0, Multiplier: 1},
+			{Name: "gold", Threshold: 100, Multiplier: 2},
+		},
+	}
+
+	err := dataRepository.AddOrder(ctx, testOrderNumber, "", userID)
+	require.NoError(t, err)
+	for _, accrual := range []float64{100, 70} {
+		err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusProcessed), &accrual, userID,
+			&expiresAt, policy)
+		require.NoError(t, err)
+	}
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusInvalid), nil, userID, nil, nil)
+	require.NoError(t, err)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, balance.Current, 0.001)
+	order, err := dataRepository.GetOrder(ctx, testOrderNumber)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.StatusProcessed), order.Status)
+	require.NotNil(t, order.Accrual)
+	assert.InDelta(t, 100, *order.Accrual, 0.001)
+	lots, err := dataRepository.GetExpiringPoints(ctx, userID, expiresAt)
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	assert.InDelta(t, 100, lots[0].Remaining, 0.001)
+	status, err := dataRepository.GetLoyaltyStatus(ctx, userID, policy.Since)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, status.Accrued, 0.001)
+}
+
+func testConformanceOverdraftRefusal(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	creditTestUser(t, dataRepository, userID, testOrderNumber, 100)
+
+	err := dataRepository.Withdraw(ctx, testWithdrawOrder, 100.01, userID)
+	assert.ErrorIs(t, err, ErrNotEnoughBalance)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, &Balance{Current: 100}, balance)
+
+	_, err = dataRepository.GetWithdrawals(ctx, userID)
+	assert.ErrorIs(t, err, ErrNoWithdrawals)
+}
+
+func testConformanceWithdrawals(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	creditTestUser(t, dataRepository, userID, testOrderNumber, 100)
+
+	_, err := dataRepository.GetWithdrawals(ctx, userID)
+	assert.ErrorIs(t, err, ErrNoWithdrawals)
+
+	start := time.Now().Add(-time.Second)
+	err = dataRepository.Withdraw(ctx, testWithdrawOrder, 40, userID)
+	require.NoError(t, err)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, &Balance{Current: 60, Withdrawn: 40}, balance)
+
+	withdrawals, err := dataRepository.GetWithdrawals(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, testWithdrawOrder, withdrawals[0].Order)
+	assert.Equal(t, float64(40), withdrawals[0].Sum)
+	assert.True(t, withdrawals[0].ProcessedAt.After(start))
+}
+
+func testConformanceStatusUpdates(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+
+	err := dataRepository.AddOrder(ctx, testOrderNumber, "", userID)
+	require.NoError(t, err)
+
+	orders, err := dataRepository.GetOrdersForUpdate(ctx, "", config.DefaultStatusCheckBatchSize)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, testOrderNumber, orders[0].Number)
+	assert.Equal(t, userID, orders[0].UserID)
+
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusInvalid), nil, userID, nil, nil)
+	require.NoError(t, err)
+
+	orders, err = dataRepository.GetOrdersForUpdate(ctx, "", config.DefaultStatusCheckBatchSize)
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+
+	orders, err = dataRepository.GetOrders(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, string(models.StatusInvalid), orders[0].Status)
+	assert.Nil(t, orders[0].Accrual)
+}
+
+func testConformanceDuplicateWithdrawal(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	anotherUserID := registerTestUser(t, dataRepository, testAnotherLogin)
+	creditTestUser(t, dataRepository, userID, testOrderNumber, 100)
+	creditTestUser(t, dataRepository, anotherUserID, testAnotherOrder, 100)
+
+	err := dataRepository.Withdraw(ctx, testWithdrawOrder, 10, userID)
+	require.NoError(t, err)
+
+	err = dataRepository.Withdraw(ctx, testWithdrawOrder, 10, userID)
+	var errWithdrawalAlreadyExists *ErrWithdrawalAlreadyExists
+	assert.ErrorAs(t, err, &errWithdrawalAlreadyExists)
+
+	err = dataRepository.Withdraw(ctx, testWithdrawOrder, 10, anotherUserID)
+	assert.ErrorAs(t, err, &errWithdrawalAlreadyExists)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, &Balance{Current: 90, Withdrawn: 10}, balance)
+
+	balance, err = dataRepository.GetBalance(ctx, anotherUserID)
+	require.NoError(t, err)
+	assert.Equal(t, &Balance{Current: 100}, balance)
+}
+
+func testConformanceInvalidWithdrawalSum(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	creditTestUser(t, dataRepository, userID, testOrderNumber, 100)
+
+	err := dataRepository.Withdraw(ctx, testWithdrawOrder, -10, userID)
+	assert.ErrorIs(t, err, ErrInvalidSum)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, &Balance{Current: 100}, balance)
+}
+
+func testConformanceUnknownUser(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+
+	err := dataRepository.AddOrder(ctx, testOrderNumber, "", uuid.New())
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	err = dataRepository.Withdraw(ctx, testWithdrawOrder, 10, uuid.New())
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func testConformanceInvalidOrderStatus(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+
+	err := dataRepository.AddOrder(ctx, testOrderNumber, "", userID)
+	require.NoError(t, err)
+
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusRegistered), nil, userID, nil, nil)
+	var errInvalidOrderStatus *ErrInvalidOrderStatus
+	assert.ErrorAs(t, err, &errInvalidOrderStatus)
+
+	orders, err := dataRepository.GetOrders(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, string(models.StatusNew), orders[0].Status)
+}
+
+func testConformanceUserSearch(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	anotherUserID := registerTestUser(t, dataRepository, testAnotherLogin)
+
+	users, err := dataRepository.SearchUsers(ctx, "test", 10)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, testAnotherLogin, users[0].Login)
+	assert.Equal(t, anotherUserID, users[0].UserID)
+	assert.Empty(t, users[0].Hash)
+
+	users, err = dataRepository.SearchUsers(ctx, "test", 1)
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	users, err = dataRepository.SearchUsers(ctx, "test_", 10)
+	require.NoError(t, err)
+	assert.Empty(t, users)
+
+	user, err := dataRepository.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, testLogin, user.Login)
+	assert.Equal(t, string(models.RoleUser), user.Role)
+
+	_, err = dataRepository.GetUserByID(ctx, uuid.New())
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func testConformanceBalanceAdjustments(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	adminID := registerTestUser(t, dataRepository, testAnotherLogin)
+	userID := registerTestUser(t, dataRepository, testLogin)
+
+	credit := 100.5
+	err := dataRepository.AdjustBalance(ctx, AdminAction{
+		Amount:  &credit,
+		UserID:  &userID,
+		Action:  string(models.AdminActionAdjustBalance),
+		Reason:  string(models.ReasonGoodwill),
+		AdminID: adminID,
+	}, nil)
+	require.NoError(t, err)
+
+	debit := -200.0
+	err = dataRepository.AdjustBalance(ctx, AdminAction{
+		Amount:  &debit,
+		UserID:  &userID,
+		Action:  string(models.AdminActionAdjustBalance),
+		Reason:  string(models.ReasonCorrection),
+		AdminID: adminID,
+	}, nil)
+	assert.ErrorIs(t, err, ErrNotEnoughBalance)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, credit, balance.Current, 0.001)
+	assert.InDelta(t, 0, balance.Withdrawn, 0.001)
+
+	unknownUserID := uuid.New()
+	err = dataRepository.AdjustBalance(ctx, AdminAction{
+		Amount:  &credit,
+		UserID:  &unknownUserID,
+		Action:  string(models.AdminActionAdjustBalance),
+		Reason:  string(models.ReasonGoodwill),
+		AdminID: adminID,
+	}, nil)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func testConformanceUserDisabling(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	adminID := registerTestUser(t, dataRepository, testAnotherLogin)
+	userID := registerTestUser(t, dataRepository, testLogin)
+
+	action := AdminAction{
+		UserID:  &userID,
+		Action:  string(models.AdminActionDisableUser),
+		Reason:  string(models.ReasonFraud),
+		AdminID: adminID,
+	}
+	err := dataRepository.SetUserDisabled(ctx, action, true)
+	require.NoError(t, err)
+	user, err := dataRepository.GetUser(ctx, testLogin)
+	require.NoError(t, err)
+	assert.True(t, user.Disabled)
+
+	action.Action = string(models.AdminActionEnableUser)
+	err = dataRepository.SetUserDisabled(ctx, action, false)
+	require.NoError(t, err)
+	user, err = dataRepository.GetUser(ctx, testLogin)
+	require.NoError(t, err)
+	assert.False(t, user.Disabled)
+
+	unknownUserID := uuid.New()
+	action.UserID = &unknownUserID
+	err = dataRepository.SetUserDisabled(ctx, action, true)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func testConformanceAdminActions(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	adminID := registerTestUser(t, dataRepository, testAnotherLogin)
+	userID := registerTestUser(t, dataRepository, testLogin)
+
+	err := dataRepository.AddAdminAction(ctx, AdminAction{
+		Action:  string(models.AdminActionSearchUsers),
+		AdminID: adminID,
+	})
+	require.NoError(t, err)
+	err = dataRepository.AddAdminAction(ctx, AdminAction{
+		UserID:  &userID,
+		Action:  string(models.AdminActionViewBalance),
+		AdminID: adminID,
+	})
+	require.NoError(t, err)
+
+	unknownUserID := uuid.New()
+	err = dataRepository.AddAdminAction(ctx, AdminAction{
+		UserID:  &unknownUserID,
+		Action:  string(models.AdminActionViewUser),
+		AdminID: adminID,
+	})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	actions, err := dataRepository.GetAdminActions(ctx, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, actions, 2)
+	assert.Equal(t, string(models.AdminActionViewBalance), actions[0].Action)
+	assert.Equal(t, string(models.AdminActionSearchUsers), actions[1].Action)
+	assert.Nil(t, actions[1].UserID)
+
+	actions, err = dataRepository.GetAdminActions(ctx, &userID, 10)
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, adminID, actions[0].AdminID)
+	require.NotNil(t, actions[0].UserID)
+	assert.Equal(t, userID, *actions[0].UserID)
+}
+
+func testConformancePointsExpiration(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	now := time.Now()
+	expired := now.Add(-time.Hour)
+	expiring := now.Add(10 * 24 * time.Hour)
+
+	err := dataRepository.AddOrder(ctx, testOrderNumber, "", userID)
+	require.NoError(t, err)
+	accrual := 50.0
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusProcessed), &accrual,
+		userID, &expired, nil)
+	require.NoError(t, err)
+	err = dataRepository.AddOrder(ctx, testAnotherOrder, "", userID)
+	require.NoError(t, err)
+	accrual = 30.0
+	err = dataRepository.UpdateOrder(ctx, testAnotherOrder, string(external.StatusProcessed), &accrual,
+		userID, &expiring, nil)
+	require.NoError(t, err)
+	creditTestUser(t, dataRepository, userID, "79927398713", 5)
+
+	err = dataRepository.Withdraw(ctx, testWithdrawOrder, 20, userID)
+	require.NoError(t, err)
+
+	lots, err := dataRepository.GetExpiringPoints(ctx, userID, now.Add(30*24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, lots, 2)
+	assert.Equal(t, testOrderNumber, lots[0].Order)
+	assert.InDelta(t, 30, lots[0].Remaining, 0.001)
+	assert.InDelta(t, 50, lots[0].Amount, 0.001)
+	assert.Equal(t, testAnotherOrder, lots[1].Order)
+	assert.InDelta(t, 30, lots[1].Remaining, 0.001)
+
+	expirations, err := dataRepository.ExpirePoints(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, expirations, 1)
+	assert.Equal(t, testOrderNumber, expirations[0].Order)
+	assert.Equal(t, userID, expirations[0].UserID)
+	assert.InDelta(t, 30, expirations[0].Sum, 0.001)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 35, balance.Current, 0.001)
+	assert.InDelta(t, 20, balance.Withdrawn, 0.001)
+
+	expirations, err = dataRepository.ExpirePoints(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Empty(t, expirations)
+
+	lots, err = dataRepository.GetExpiringPoints(ctx, userID, now)
+	require.NoError(t, err)
+	assert.Empty(t, lots)
+}
+
+func testConformancePointsExpiryOrder(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	now := time.Now()
+	later := now.Add(20 * 24 * time.Hour)
+	sooner := now.Add(10 * 24 * time.Hour)
+
+	creditTestUser(t, dataRepository, userID, "79927398713", 100)
+	err := dataRepository.AddOrder(ctx, testOrderNumber, "", userID)
+	require.NoError(t, err)
+	accrual := 50.0
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusProcessed), &accrual,
+		userID, &later, nil)
+	require.NoError(t, err)
+	err = dataRepository.AddOrder(ctx, testAnotherOrder, "", userID)
+	require.NoError(t, err)
+	accrual = 30.0
+	err = dataRepository.UpdateOrder(ctx, testAnotherOrder, string(external.StatusProcessed), &accrual,
+		userID, &sooner, nil)
+	require.NoError(t, err)
+
+	err = dataRepository.Withdraw(ctx, testWithdrawOrder, 40, userID)
+	require.NoError(t, err)
+
+	lots, err := dataRepository.GetExpiringPoints(ctx, userID, now.Add(30*24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	assert.Equal(t, testOrderNumber, lots[0].Order)
+	assert.InDelta(t, 40, lots[0].Remaining, 0.001)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 140, balance.Current, 0.001)
+}
+
+func testConformanceTransfers(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	senderID := registerTestUser(t, dataRepository, testLogin)
+	recipientID := registerTestUser(t, dataRepository, testAnotherLogin)
+	creditTestUser(t, dataRepository, senderID, testOrderNumber, 100)
+
+	_, err := dataRepository.GetTransfers(ctx, senderID)
+	assert.ErrorIs(t, err, ErrNoTransfers)
+
+	err = dataRepository.Transfer(ctx, senderID, testAnotherLogin, 30, 50)
+	require.NoError(t, err)
+	err = dataRepository.Transfer(ctx, senderID, testAnotherLogin, 30, 50)
+	assert.ErrorIs(t, err, ErrTransferLimit)
+	err = dataRepository.Transfer(ctx, senderID, testAnotherLogin, 200, 0)
+	assert.ErrorIs(t, err, ErrNotEnoughBalance)
+	err = dataRepository.Transfer(ctx, senderID, testLogin, 10, 0)
+	assert.ErrorIs(t, err, ErrSelfTransfer)
+	err = dataRepository.Transfer(ctx, senderID, "unknown", 10, 0)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	err = dataRepository.Transfer(ctx, senderID, testAnotherLogin, 0, 0)
+	assert.ErrorIs(t, err, ErrInvalidSum)
+
+	err = dataRepository.Transfer(ctx, recipientID, testLogin, 10, 0)
+	require.NoError(t, err)
+
+	balance, err := dataRepository.GetBalance(ctx, senderID)
+	require.NoError(t, err)
+	assert.InDelta(t, 80, balance.Current, 0.001)
+	assert.InDelta(t, 0, balance.Withdrawn, 0.001)
+	balance, err = dataRepository.GetBalance(ctx, recipientID)
+	require.NoError(t, err)
+	assert.InDelta(t, 20, balance.Current, 0.001)
+
+	for _, userID := range []uuid.UUID{senderID, recipientID} {
+		transfers, err := dataRepository.GetTransfers(ctx, userID)
+		require.NoError(t, err)
+		require.Len(t, transfers, 2)
+		assert.Equal(t, testLogin, transfers[0].FromLogin)
+		assert.Equal(t, testAnotherLogin, transfers[0].ToLogin)
+		assert.InDelta(t, 30, transfers[0].Sum, 0.001)
+		assert.Equal(t, recipientID, transfers[1].FromUserID)
+		assert.Equal(t, senderID, transfers[1].ToUserID)
+	}
+
+	err = dataRepository.SetUserDisabled(ctx, AdminAction{
+		UserID:  &recipientID,
+		Action:  string(models.AdminActionDisableUser),
+		Reason:  string(models.ReasonFraud),
+		AdminID: senderID,
+	}, true)
+	require.NoError(t, err)
+	err = dataRepository.Transfer(ctx, senderID, testAnotherLogin, 10, 0)
+	assert.ErrorIs(t, err, ErrUserDisabled)
+}
+
+func testConformanceTransferExpiry(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	senderID := registerTestUser(t, dataRepository, testLogin)
+	recipientID := registerTestUser(t, dataRepository, testAnotherLogin)
+	expiresAt := time.Now().Add(24 * time.Hour).Truncate(time.Microsecond)
+	sum := 50.0
+	err := dataRepository.AddOrder(ctx, testOrderNumber, "", senderID)
+	require.NoError(t, err)
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusProcessed), &sum, senderID,
+		&expiresAt, nil)
+	require.NoError(t, err)
+	creditTestUser(t, dataRepository, senderID, testAnotherOrder, 30)
+
+	err = dataRepository.Transfer(ctx, senderID, testAnotherLogin, 60, 0)
+	require.NoError(t, err)
+
+	lots, err := dataRepository.GetExpiringPoints(ctx, recipientID, expiresAt)
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	assert.InDelta(t, 50, lots[0].Remaining, 0.001)
+	require.NotNil(t, lots[0].ExpiresAt)
+	assert.True(t, expiresAt.Equal(*lots[0].ExpiresAt))
+	lots, err = dataRepository.GetExpiringPoints(ctx, senderID, expiresAt)
+	require.NoError(t, err)
+	assert.Empty(t, lots)
+
+	balance, err := dataRepository.GetBalance(ctx, recipientID)
+	require.NoError(t, err)
+	assert.InDelta(t, 60, balance.Current, 0.001)
+}
+
+func testConformanceWithdrawalReversals(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	adminID := registerTestUser(t, dataRepository, testAnotherLogin)
+	expiresAt := time.Now().Add(24 * time.Hour).Truncate(time.Microsecond)
+	accrual := 100.0
+	err := dataRepository.AddOrder(ctx, testOrderNumber, "", userID)
+	require.NoError(t, err)
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusProcessed), &accrual, userID,
+		&expiresAt, nil)
+	require.NoError(t, err)
+	err = dataRepository.Withdraw(ctx, testWithdrawOrder, 40, userID)
+	require.NoError(t, err)
+
+	_, err = dataRepository.ReverseWithdrawal(ctx, "r1", testAnotherOrder, nil, adminID, "", nil)
+	assert.ErrorIs(t, err, ErrNoWithdrawal)
+
+	sum := 15.0
+	reversal, err := dataRepository.ReverseWithdrawal(ctx, "r1", testWithdrawOrder, &sum, adminID, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "r1", reversal.ReversalID)
+	assert.Equal(t, testWithdrawOrder, reversal.Order)
+	assert.Equal(t, userID, reversal.UserID)
+	assert.InDelta(t, 15, reversal.Sum, 0.001)
+
+	repeated, err := dataRepository.ReverseWithdrawal(ctx, "r1", testWithdrawOrder, &sum, adminID, "", nil)
+	require.NoError(t, err)
+	assert.InDelta(t, 15, repeated.Sum, 0.001)
+	assert.WithinDuration(t, reversal.CreatedAt, repeated.CreatedAt, time.Millisecond)
+
+	other := 5.0
+	_, err = dataRepository.ReverseWithdrawal(ctx, "r1", testWithdrawOrder, &other, adminID, "", nil)
+	assert.ErrorIs(t, err, ErrReversalConflict)
+	other = 30
+	_, err = dataRepository.ReverseWithdrawal(ctx, "r2", testWithdrawOrder, &other, adminID, "", nil)
+	assert.ErrorIs(t, err, ErrInvalidSum)
+
+	reversal, err = dataRepository.ReverseWithdrawal(ctx, "r2", testWithdrawOrder, nil, adminID, "", nil)
+	require.NoError(t, err)
+	assert.InDelta(t, 25, reversal.Sum, 0.001)
+	_, err = dataRepository.ReverseWithdrawal(ctx, "r3", testWithdrawOrder, nil, adminID, "", nil)
+	assert.ErrorIs(t, err, ErrReversed)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, balance.Current, 0.001)
+	assert.InDelta(t, 0, balance.Withdrawn, 0.001)
+
+	withdrawals, err := dataRepository.GetWithdrawals(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.InDelta(t, 40, withdrawals[0].Reversed, 0.001)
+
+	hold := Hold{
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+		Order:     testAnotherOrder,
+		Status:    string(models.HoldActive),
+		Sum:       30,
+		HoldID:    uuid.New(),
+		UserID:    userID,
+	}
+	err = dataRepository.AuthorizeHold(ctx, hold)
+	require.NoError(t, err)
+	_, err = dataRepository.CaptureHold(ctx, userID, hold.HoldID, time.Now())
+	require.NoError(t, err)
+	freshExpiry := expiresAt.Add(365 * 24 * time.Hour)
+	_, err = dataRepository.ReverseWithdrawal(ctx, "r4", testAnotherOrder, nil, adminID, "", &freshExpiry)
+	require.NoError(t, err)
+
+	lots, err := dataRepository.GetExpiringPoints(ctx, userID, freshExpiry)
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	assert.InDelta(t, 100, lots[0].Remaining, 0.001)
+	require.NotNil(t, lots[0].ExpiresAt)
+	assert.True(t, expiresAt.Equal(*lots[0].ExpiresAt))
+}
+
+func testConformanceMerchantReversals(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	merchantUserID := registerTestUser(t, dataRepository, testAnotherLogin)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	acmePrefix, globexPrefix := "4", "2"
+	err := dataRepository.AddMerchant(ctx, Merchant{CreatedAt: now, OrderPrefix: &acmePrefix, MerchantID: "acme",
+		Name: "Acme", AccrualAddress: "http://acme"})
+	require.NoError(t, err)
+	err = dataRepository.AddMerchant(ctx, Merchant{CreatedAt: now, OrderPrefix: &globexPrefix, MerchantID: "globex",
+		Name: "Globex", AccrualAddress: "http://globex"})
+	require.NoError(t, err)
+
+	err = dataRepository.SetUserRole(ctx, testAnotherLogin, string(models.RoleMerchant), "unknown")
+	assert.ErrorIs(t, err, ErrMerchantNotFound)
+	err = dataRepository.SetUserRole(ctx, testAnotherLogin, string(models.RoleMerchant), "acme")
+	require.NoError(t, err)
+	user, err := dataRepository.GetUserByID(ctx, merchantUserID)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.RoleMerchant), user.Role)
+	require.NotNil(t, user.MerchantID)
+	assert.Equal(t, "acme", *user.MerchantID)
+
+	accrual := 100.0
+	err = dataRepository.AddOrder(ctx, testOrderNumber, "globex", userID)
+	require.NoError(t, err)
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusProcessed), &accrual, userID,
+		nil, nil)
+	require.NoError(t, err)
+	err = dataRepository.Withdraw(ctx, testWithdrawOrder, 40, userID)
+	require.NoError(t, err)
+	err = dataRepository.Withdraw(ctx, testAnotherOrder, 20, userID)
+	require.NoError(t, err)
+
+	_, err = dataRepository.ReverseWithdrawal(ctx, "r1", testWithdrawOrder, nil, merchantUserID, "globex", nil)
+	assert.ErrorIs(t, err, ErrNoWithdrawal)
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 40, balance.Current, 0.001)
+
+	reversal, err := dataRepository.ReverseWithdrawal(ctx, "r1", testWithdrawOrder, nil, merchantUserID, "acme", nil)
+	require.NoError(t, err)
+	assert.InDelta(t, 40, reversal.Sum, 0.001)
+	_, err = dataRepository.ReverseWithdrawal(ctx, "r2", testAnotherOrder, nil, merchantUserID, "acme", nil)
+	assert.ErrorIs(t, err, ErrNoWithdrawal)
+	reversal, err = dataRepository.ReverseWithdrawal(ctx, "r2", testAnotherOrder, nil, merchantUserID, "globex", nil)
+	require.NoError(t, err)
+	assert.InDelta(t, 20, reversal.Sum, 0.001)
+
+	err = dataRepository.SetUserRole(ctx, testAnotherLogin, string(models.RoleUser), "")
+	require.NoError(t, err)
+	user, err = dataRepository.GetUserByID(ctx, merchantUserID)
+	require.NoError(t, err)
+	assert.Nil(t, user.MerchantID)
+}
+
+func testConformanceHolds(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	anotherUserID := registerTestUser(t, dataRepository, testAnotherLogin)
+	now := time.Now()
+	expiresAt := now.Add(10 * 24 * time.Hour)
+
+	err := dataRepository.AddOrder(ctx, testOrderNumber, "", userID)
+	require.NoError(t, err)
+	accrual := 100.0
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusProcessed), &accrual,
+		userID, &expiresAt, nil)
+	require.NoError(t, err)
+
+	_, err = dataRepository.GetHolds(ctx, userID)
+	assert.ErrorIs(t, err, ErrNoHolds)
+
+	newHold := func(order string, sum float64, expiresAt time.Time) Hold {
+		return Hold{
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+			Order:     order,
+			Status:    string(models.HoldActive),
+			Sum:       sum,
+			HoldID:    uuid.New(),
+			UserID:    userID,
+		}
+	}
+
+	voided := newHold(testWithdrawOrder, 40, now.Add(time.Hour))
+	err = dataRepository.AuthorizeHold(ctx, voided)
+	require.NoError(t, err)
+	err = dataRepository.AuthorizeHold(ctx, newHold(testWithdrawOrder, 10, now.Add(time.Hour)))
+	assert.ErrorIs(t, err, ErrHoldExists)
+	err = dataRepository.AuthorizeHold(ctx, newHold(testAnotherOrder, 100, now.Add(time.Hour)))
+	assert.ErrorIs(t, err, ErrNotEnoughBalance)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 60, balance.Current, 0.001)
+	assert.InDelta(t, 40, balance.Held, 0.001)
+	assert.InDelta(t, 0, balance.Withdrawn, 0.001)
+	lots, err := dataRepository.GetExpiringPoints(ctx, userID, expiresAt)
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	assert.InDelta(t, 60, lots[0].Remaining, 0.001)
+
+	_, err = dataRepository.VoidHold(ctx, anotherUserID, voided.HoldID, now)
+	assert.ErrorIs(t, err, ErrHoldNotFound)
+	hold, err := dataRepository.VoidHold(ctx, userID, voided.HoldID, now)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.HoldVoided), hold.Status)
+	assert.NotNil(t, hold.FinishedAt)
+	_, err = dataRepository.VoidHold(ctx, userID, voided.HoldID, now)
+	assert.ErrorIs(t, err, ErrHoldFinished)
+	_, err = dataRepository.CaptureHold(ctx, userID, uuid.New(), now)
+	assert.ErrorIs(t, err, ErrHoldNotFound)
+
+	balance, err = dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, balance.Current, 0.001)
+	assert.InDelta(t, 0, balance.Held, 0.001)
+	lots, err = dataRepository.GetExpiringPoints(ctx, userID, expiresAt)
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	assert.InDelta(t, 100, lots[0].Remaining, 0.001)
+
+	captured := newHold(testWithdrawOrder, 30, now.Add(time.Hour))
+	err = dataRepository.AuthorizeHold(ctx, captured)
+	require.NoError(t, err)
+	hold, err = dataRepository.CaptureHold(ctx, userID, captured.HoldID, now)
+	require.NoError(t, err)
+	assert.Equal(t, string(models.HoldCaptured), hold.Status)
+	_, err = dataRepository.VoidHold(ctx, userID, captured.HoldID, now)
+	assert.ErrorIs(t, err, ErrHoldFinished)
+	var errWithdrawalAlreadyExists *ErrWithdrawalAlreadyExists
+	err = dataRepository.AuthorizeHold(ctx, newHold(testWithdrawOrder, 10, now.Add(time.Hour)))
+	assert.ErrorAs(t, err, &errWithdrawalAlreadyExists)
+
+	expired := newHold(testAnotherOrder, 20, now.Add(-time.Minute))
+	err = dataRepository.AuthorizeHold(ctx, expired)
+	require.NoError(t, err)
+	_, err = dataRepository.CaptureHold(ctx, userID, expired.HoldID, now)
+	assert.ErrorIs(t, err, ErrHoldExpired)
+
+	holds, err := dataRepository.ExpireHolds(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, holds, 1)
+	assert.Equal(t, expired.HoldID, holds[0].HoldID)
+	assert.Equal(t, string(models.HoldExpired), holds[0].Status)
+	holds, err = dataRepository.ExpireHolds(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Empty(t, holds)
+
+	balance, err = dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 70, balance.Current, 0.001)
+	assert.InDelta(t, 0, balance.Held, 0.001)
+	assert.InDelta(t, 30, balance.Withdrawn, 0.001)
+
+	withdrawals, err := dataRepository.GetWithdrawals(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, testWithdrawOrder, withdrawals[0].Order)
+	assert.InDelta(t, 30, withdrawals[0].Sum, 0.001)
+
+	holds, err = dataRepository.GetHolds(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, holds, 3)
+	_, err = dataRepository.GetHolds(ctx, anotherUserID)
+	assert.ErrorIs(t, err, ErrNoHolds)
+}
+
+func testConformanceLoyaltyTiers(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	now := time.Now()
+	policy := &TierPolicy{
+		Since: now.Add(-time.Hour),
+		Tiers: models.LoyaltyTiers{
+			{Name: "silver", Threshold: 0, Multiplier: 1},
+			{Name: "gold", Threshold: 100, Multiplier: 1.5},
+			{Name: "platinum", Threshold: 1000, Multiplier: 2},
+		},
+	}
+	process := func(orderNumber string, accrual float64, policy *TierPolicy) {
+		err := dataRepository.AddOrder(ctx, orderNumber, "", userID)
+		require.NoError(t, err)
+		err = dataRepository.UpdateOrder(ctx, orderNumber, string(external.StatusProcessed), &accrual, userID, nil,
+			policy)
+		require.NoError(t, err)
+	}
+
+	status, err := dataRepository.GetLoyaltyStatus(ctx, userID, policy.Since)
+	require.NoError(t, err)
+	assert.Equal(t, "", status.Tier)
+	assert.InDelta(t, 0, status.Accrued, 0.001)
+	_, err = dataRepository.GetLoyaltyStatus(ctx, uuid.New(), policy.Since)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	process(testOrderNumber, 100, policy)
+	status, err = dataRepository.GetLoyaltyStatus(ctx, userID, policy.Since)
+	require.NoError(t, err)
+	assert.Equal(t, "gold", status.Tier)
+	assert.InDelta(t, 100, status.Accrued, 0.001)
+
+	process(testAnotherOrder, 10, policy)
+	status, err = dataRepository.GetLoyaltyStatus(ctx, userID, policy.Since)
+	require.NoError(t, err)
+	assert.Equal(t, "gold", status.Tier)
+	assert.InDelta(t, 110, status.Accrued, 0.001)
+
+	order, err := dataRepository.GetOrder(ctx, testAnotherOrder)
+	require.NoError(t, err)
+	require.NotNil(t, order.Accrual)
+	assert.InDelta(t, 15, *order.Accrual, 0.001)
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 115, balance.Current, 0.001)
+
+	policy.Since = now.Add(time.Hour)
+	process("79927398713", 10, policy)
+	status, err = dataRepository.GetLoyaltyStatus(ctx, userID, policy.Since)
+	require.NoError(t, err)
+	assert.Equal(t, "silver", status.Tier)
+	assert.InDelta(t, 0, status.Accrued, 0.001)
+	order, err = dataRepository.GetOrder(ctx, "79927398713")
+	require.NoError(t, err)
+	require.NotNil(t, order.Accrual)
+	assert.InDelta(t, 10, *order.Accrual, 0.001)
+	balance, err = dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 125, balance.Current, 0.001)
+}
+
+func testConformanceCampaigns(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	adminID := registerTestUser(t, dataRepository, testLogin)
+	userID := registerTestUser(t, dataRepository, testAnotherLogin)
+	now := time.Now().Truncate(time.Second)
+	policy := &TierPolicy{
+		Since: now.Add(-time.Hour),
+		Tiers: models.LoyaltyTiers{
+			{Name: "silver", Threshold: 0, Multiplier: 1},
+			{Name: "gold", Threshold: 1000, Multiplier: 1},
+		},
+	}
+	multiplier := 2.0
+	bonus := 5.0
+	budget := 8.0
+
+	_, err := dataRepository.GetCampaigns(ctx)
+	assert.ErrorIs(t, err, ErrNoCampaigns)
+
+	err = dataRepository.AddCampaign(ctx, Campaign{
+		StartsAt:   now.Add(time.Hour),
+		EndsAt:     now,
+		Multiplier: &multiplier,
+		Name:       "invalid",
+		CampaignID: uuid.New(),
+		CreatedBy:  adminID,
+	})
+	assert.ErrorIs(t, err, ErrInvalidCampaign)
+	err = dataRepository.AddCampaign(ctx, Campaign{
+		StartsAt:   now.Add(-time.Hour),
+		EndsAt:     now.Add(time.Hour),
+		Multiplier: &multiplier,
+		Name:       "unknown admin",
+		CampaignID: uuid.New(),
+		CreatedBy:  uuid.New(),
+	})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	double := Campaign{
+		StartsAt:   now.Add(-time.Hour),
+		EndsAt:     now.Add(time.Hour),
+		CreatedAt:  now,
+		Multiplier: &multiplier,
+		Budget:     &budget,
+		Name:       "double",
+		CampaignID: uuid.New(),
+		CreatedBy:  adminID,
+	}
+	fixed := Campaign{
+		StartsAt:   now.Add(-time.Hour),
+		EndsAt:     now.Add(time.Hour),
+		CreatedAt:  now,
+		Bonus:      &bonus,
+		Name:       "fixed",
+		Tiers:      []string{"silver"},
+		UserIDs:    []uuid.UUID{userID},
+		CampaignID: uuid.New(),
+		CreatedBy:  adminID,
+	}
+	gold := Campaign{
+		StartsAt:   now.Add(-time.Hour),
+		EndsAt:     now.Add(time.Hour),
+		CreatedAt:  now,
+		Bonus:      &bonus,
+		Name:       "gold",
+		Tiers:      []string{"gold"},
+		CampaignID: uuid.New(),
+		CreatedBy:  adminID,
+	}
+	for _, campaign := range []Campaign{double, fixed, gold} {
+		err = dataRepository.AddCampaign(ctx, campaign)
+		require.NoError(t, err)
+	}
+
+	process := func(orderNumber string, accrual float64) {
+		err := dataRepository.AddOrder(ctx, orderNumber, "", userID)
+		require.NoError(t, err)
+		err = dataRepository.UpdateOrder(ctx, orderNumber, string(external.StatusProcessed), &accrual, userID, nil,
+			policy)
+		require.NoError(t, err)
+	}
+
+	process(testOrderNumber, 5)
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 15, balance.Current, 0.001)
+
+	process(testAnotherOrder, 5)
+	balance, err = dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, 28, balance.Current, 0.001)
+
+	bonuses, err := dataRepository.GetCampaignBonuses(ctx, userID)
+	require.NoError(t, err)
+	sums := make(map[string]float64)
+	for _, item := range bonuses {
+		sums[item.Order+" "+item.CampaignName] += item.Sum
+	}
+	assert.Equal(t, map[string]float64{
+		testOrderNumber + " double":  5,
+		testOrderNumber + " fixed":   5,
+		testAnotherOrder + " double": 3,
+		testAnotherOrder + " fixed":  5,
+	}, sums)
+	bonuses, err = dataRepository.GetCampaignBonuses(ctx, adminID)
+	require.NoError(t, err)
+	assert.Empty(t, bonuses)
+
+	ended, err := dataRepository.EndCampaign(ctx, fixed.CampaignID, now)
+	require.NoError(t, err)
+	assert.True(t, ended.EndsAt.Equal(now))
+	_, err = dataRepository.EndCampaign(ctx, fixed.CampaignID, now)
+	assert.ErrorIs(t, err, ErrCampaignEnded)
+	_, err = dataRepository.EndCampaign(ctx, uuid.New(), now)
+	assert.ErrorIs(t, err, ErrCampaignNotFound)
+
+	campaigns, err := dataRepository.GetCampaigns(ctx)
+	require.NoError(t, err)
+	require.Len(t, campaigns, 3)
+	spent := make(map[string]float64)
+	for _, campaign := range campaigns {
+		spent[campaign.Name] = campaign.Spent
+	}
+	assert.Equal(t, map[string]float64{"double": 8, "fixed": 10, "gold": 0}, spent)
+}
+
+func testConformanceReferrals(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	referrerID := registerTestUser(t, dataRepository, testLogin)
+	policy := &ReferralPolicy{
+		Since:      time.Now().Add(-time.Hour),
+		Code:       strings.ToUpper(testLogin),
+		Bonus:      10,
+		DailyLimit: 2,
+		MaxRewards: 1,
+	}
+	register := func(login string, referral *ReferralPolicy) (uuid.UUID, error) {
+		userID := uuid.New()
+		return userID, dataRepository.Registration(ctx, login, testHash, testSalt, userID, strings.ToUpper(login),
+			referral)
+	}
+	process := func(orderNumber string, userID uuid.UUID) {
+		accrual := 100.0
+		err := dataRepository.AddOrder(ctx, orderNumber, "", userID)
+		require.NoError(t, err)
+		err = dataRepository.UpdateOrder(ctx, orderNumber, string(external.StatusProcessed), &accrual, userID, nil,
+			nil)
+		require.NoError(t, err)
+	}
+	current := func(userID uuid.UUID) float64 {
+		balance, err := dataRepository.GetBalance(ctx, userID)
+		require.NoError(t, err)
+		return balance.Current
+	}
+
+	_, err := register("unknowncode", &ReferralPolicy{Code: "UNKNOWN"})
+	assert.ErrorIs(t, err, ErrReferralCode)
+	_, err = register("duplicatecode", nil)
+	require.NoError(t, err)
+	err = dataRepository.Registration(ctx, "anothercode", testHash, testSalt, uuid.New(), "DUPLICATECODE", nil)
+	assert.ErrorIs(t, err, ErrReferralCodeUsed)
+
+	refereeID, err := register(testAnotherLogin, policy)
+	require.NoError(t, err)
+	secondRefereeID, err := register("secondreferee", policy)
+	require.NoError(t, err)
+	_, err = register("thirdreferee", policy)
+	assert.ErrorIs(t, err, ErrReferralLimit)
+	_, err = dataRepository.GetUser(ctx, "thirdreferee")
+	var errInvalidAuthData *ErrInvalidAuthData
+	assert.ErrorAs(t, err, &errInvalidAuthData)
+
+	process(testOrderNumber, refereeID)
+	assert.InDelta(t, 110, current(refereeID), 0.001)
+	assert.InDelta(t, 10, current(referrerID), 0.001)
+
+	process(testAnotherOrder, refereeID)
+	process(testWithdrawOrder, secondRefereeID)
+	assert.InDelta(t, 210, current(refereeID), 0.001)
+	assert.InDelta(t, 110, current(secondRefereeID), 0.001)
+	assert.InDelta(t, 10, current(referrerID), 0.001)
+
+	referrals, err := dataRepository.GetReferrals(ctx, referrerID)
+	require.NoError(t, err)
+	assert.Equal(t, strings.ToUpper(testLogin), referrals.Code)
+	assert.Nil(t, referrals.ReferredBy)
+	require.Len(t, referrals.Referrals, 2)
+	bonuses := make(map[string]float64)
+	for _, referral := range referrals.Referrals {
+		assert.Equal(t, testLogin, referral.ReferrerLogin)
+		assert.NotNil(t, referral.RewardedAt)
+		bonuses[referral.RefereeLogin] = referral.ReferrerBonus
+	}
+	assert.Equal(t, map[string]float64{testAnotherLogin: 10, "secondreferee": 0}, bonuses)
+
+	referrals, err = dataRepository.GetReferrals(ctx, refereeID)
+	require.NoError(t, err)
+	require.NotNil(t, referrals.ReferredBy)
+	assert.Equal(t, testLogin, referrals.ReferredBy.ReferrerLogin)
+	assert.InDelta(t, 10, referrals.ReferredBy.RefereeBonus, 0.001)
+	assert.Empty(t, referrals.Referrals)
+
+	_, err = dataRepository.GetReferrals(ctx, uuid.New())
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func testConformanceBatchOrders(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	anotherUserID := registerTestUser(t, dataRepository, testAnotherLogin)
+
+	err := dataRepository.AddOrder(ctx, testOrderNumber, "", userID)
+	require.NoError(t, err)
+	err = dataRepository.AddOrder(ctx, testAnotherOrder, "", anotherUserID)
+	require.NoError(t, err)
+
+	results, err := dataRepository.AddOrders(ctx,
+		[]string{testOrderNumber, testAnotherOrder, testWithdrawOrder, testWithdrawOrder}, "", userID)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	var errAlreadyAdded *ErrAlreadyAdded
+	assert.ErrorAs(t, results[0], &errAlreadyAdded)
+	var errAlreadyAddedByAnotherUser *ErrAlreadyAddedByAnotherUser
+	assert.ErrorAs(t, results[1], &errAlreadyAddedByAnotherUser)
+	assert.NoError(t, results[2])
+	assert.ErrorAs(t, results[3], &errAlreadyAdded)
+
+	orders, err := dataRepository.GetOrders(ctx, userID)
+	require.NoError(t, err)
+	numbers := make([]string, 0, len(orders))
+	for _, order := range orders {
+		numbers = append(numbers, order.Number)
+		assert.Equal(t, string(models.StatusNew), order.Status)
+	}
+	assert.ElementsMatch(t, []string{testOrderNumber, testWithdrawOrder}, numbers)
+
+	_, err = dataRepository.AddOrders(ctx, []string{"79927398713"}, "", uuid.New())
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	_, err = dataRepository.GetOrder(ctx, "79927398713")
+	assert.Error(t, err)
+}
+
+func testConformanceMerchants(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+
+	_, err := dataRepository.GetMerchants(ctx)
+	assert.ErrorIs(t, err, ErrNoMerchants)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	short, long := "1", "12"
+	merchants := []Merchant{
+		{CreatedAt: now, OrderPrefix: &short, MerchantID: "acme", Name: "Acme", AccrualAddress: "http://acme"},
+		{CreatedAt: now, OrderPrefix: &long, MerchantID: "globex", Name: "Globex", AccrualAddress: "http://globex",
+			RateLimit: 5},
+		{CreatedAt: now, MerchantID: "initech", Name: "Initech", AccrualAddress: "http://initech"},
+	}
+	for _, merchant := range merchants {
+		err = dataRepository.AddMerchant(ctx, merchant)
+		require.NoError(t, err)
+	}
+	err = dataRepository.AddMerchant(ctx, Merchant{CreatedAt: now, MerchantID: "acme", AccrualAddress: "http://a"})
+	assert.ErrorIs(t, err, ErrMerchantExists)
+	err = dataRepository.AddMerchant(ctx, Merchant{CreatedAt: now, OrderPrefix: &long, MerchantID: "hooli",
+		AccrualAddress: "http://hooli"})
+	assert.ErrorIs(t, err, ErrMerchantExists)
+	err = dataRepository.AddMerchant(ctx, Merchant{CreatedAt: now, MerchantID: "hooli",
+		AccrualAddress: "http://hooli", RateLimit: -1})
+	assert.ErrorIs(t, err, ErrInvalidMerchant)
+
+	result, err := dataRepository.GetMerchants(ctx)
+	require.NoError(t, err)
+	require.Len(t, result, 3)
+	for index, merchant := range merchants {
+		assert.Equal(t, merchant.MerchantID, result[index].MerchantID)
+		assert.Equal(t, merchant.OrderPrefix, result[index].OrderPrefix)
+		assert.Equal(t, merchant.RateLimit, result[index].RateLimit)
+		assert.True(t, merchant.CreatedAt.Equal(result[index].CreatedAt))
+	}
+
+	err = dataRepository.AddOrder(ctx, testOrderNumber, "", userID)
+	require.NoError(t, err)
+	err = dataRepository.AddOrder(ctx, testAnotherOrder, "initech", userID)
+	require.NoError(t, err)
+	results, err := dataRepository.AddOrders(ctx, []string{"18", testWithdrawOrder}, "", userID)
+	require.NoError(t, err)
+	assert.Equal(t, []error{nil, nil}, results)
+	err = dataRepository.AddOrder(ctx, "79927398713", "unknown", userID)
+	assert.ErrorIs(t, err, ErrMerchantNotFound)
+	_, err = dataRepository.AddOrders(ctx, []string{"79927398713"}, "unknown", userID)
+	assert.ErrorIs(t, err, ErrMerchantNotFound)
+
+	wantMerchants := map[string]string{
+		testOrderNumber:   "globex",
+		testAnotherOrder:  "initech",
+		"18":              "acme",
+		testWithdrawOrder: "",
+	}
+	orders, err := dataRepository.GetOrders(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, orders, len(wantMerchants))
+	for _, order := range orders {
+		var merchantID string
+		if order.MerchantID != nil {
+			merchantID = *order.MerchantID
+		}
+		assert.Equal(t, wantMerchants[order.Number], merchantID, order.Number)
+	}
+
+	for number, merchantID := range wantMerchants {
+		orders, err = dataRepository.GetOrdersForUpdate(ctx, merchantID, config.DefaultStatusCheckBatchSize)
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		assert.Equal(t, number, orders[0].Number)
+	}
+}
+
+func testConformanceStatement(t *testing.T, dataRepository Repository) {
+	ctx := context.Background()
+	userID := registerTestUser(t, dataRepository, testLogin)
+	otherID := registerTestUser(t, dataRepository, testAnotherLogin)
+	statement := func(from *time.Time, to *time.Time) []StatementEntry {
+		var entries []StatementEntry
+		err := dataRepository.GetStatement(ctx, userID, from, to, func(entry StatementEntry) error {
+			entries = append(entries, entry)
+			return nil
+		})
+		require.NoError(t, err)
+		return entries
+	}
+
+	assert.Empty(t, statement(nil, nil))
+
+	creditTestUser(t, dataRepository, userID, testOrderNumber, 100)
+	creditTestUser(t, dataRepository, otherID, "79927398713", 10)
+	err := dataRepository.Withdraw(ctx, testWithdrawOrder, 20, userID)
+	require.NoError(t, err)
+	err = dataRepository.Transfer(ctx, userID, testAnotherLogin, 10, 0)
+	require.NoError(t, err)
+	err = dataRepository.Transfer(ctx, otherID, testLogin, 5, 0)
+	require.NoError(t, err)
+	amount := -3.0
+	err = dataRepository.AdjustBalance(ctx, AdminAction{
+		UserID:  &userID,
+		Amount:  &amount,
+		Action:  string(models.AdminActionAdjustBalance),
+		Reason:  string(models.ReasonCorrection),
+		AdminID: otherID,
+	}, nil)
+	require.NoError(t, err)
+	_, err = dataRepository.ReverseWithdrawal(ctx, "r1", testWithdrawOrder, nil, otherID, "", nil)
+	require.NoError(t, err)
+	err = dataRepository.AddOrder(ctx, testAnotherOrder, "", userID)
+	require.NoError(t, err)
+	accrual := 30.0
+	expired := time.Now().Add(-time.Hour)
+	err = dataRepository.UpdateOrder(ctx, testAnotherOrder, string(external.StatusProcessed), &accrual,
+		userID, &expired, nil)
+	require.NoError(t, err)
+	_, err = dataRepository.ExpirePoints(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	hold := func(orderNumber string, sum float64) uuid.UUID {
+		holdID := uuid.New()
+		err := dataRepository.AuthorizeHold(ctx, Hold{
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(time.Hour),
+			Order:     orderNumber,
+			Status:    string(models.HoldActive),
+			Sum:       sum,
+			HoldID:    holdID,
+			UserID:    userID,
+		})
+		require.NoError(t, err)
+		return holdID
+	}
+	_, err = dataRepository.CaptureHold(ctx, userID, hold("4561261212345467", 10), time.Now())
+	require.NoError(t, err)
+	_, err = dataRepository.VoidHold(ctx, userID, hold("5555555555554444", 5), time.Now())
+	require.NoError(t, err)
+	hold("1234567812345670", 7)
+
+	entries := statement(nil, nil)
+	type row struct {
+		Type    models.StatementEntryType
+		Order   string
+		Amount  float64
+		Balance float64
+	}
+	rows := make([]row, 0, len(entries))
+	for _, entry := range entries {
+		rows = append(rows, row{
+			Type:    models.StatementEntryType(entry.Type),
+			Order:   entry.Order,
+			Amount:  entry.Amount,
+			Balance: entry.Balance,
+		})
+	}
+	assert.Equal(t, []row{
+		{Type: models.StatementAccrual, Order: testOrderNumber, Amount: 100, Balance: 100},
+		{Type: models.StatementWithdrawal, Order: testWithdrawOrder, Amount: -20, Balance: 80},
+		{Type: models.StatementTransferOut, Amount: -10, Balance: 70},
+		{Type: models.StatementTransferIn, Amount: 5, Balance: 75},
+		{Type: models.StatementAdjustment, Amount: -3, Balance: 72},
+		{Type: models.StatementReversal, Order: testWithdrawOrder, Amount: 20, Balance: 92},
+		{Type: models.StatementAccrual, Order: testAnotherOrder, Amount: 30, Balance: 122},
+		{Type: models.StatementExpiration, Order: testAnotherOrder, Amount: -30, Balance: 92},
+		{Type: models.StatementHold, Order: "4561261212345467", Amount: -10, Balance: 82},
+		{Type: models.StatementHold, Order: "5555555555554444", Amount: -5, Balance: 77},
+		{Type: models.StatementHoldRelease, Order: "5555555555554444", Amount: 5, Balance: 82},
+		{Type: models.StatementHold, Order: "1234567812345670", Amount: -7, Balance: 75},
+	}, rows)
+
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, entries[len(entries)-1].Balance, balance.Current, 0.001)
+
+	filtered := statement(&entries[2].CreatedAt, &entries[5].CreatedAt)
+	require.Len(t, filtered, 3)
+	assert.InDelta(t, 70, filtered[0].Balance, 0.001)
+	assert.InDelta(t, 72, filtered[2].Balance, 0.001)
+
+	errStop := errors.New("stop")
+	var handled int
+	err = dataRepository.GetStatement(ctx, userID, nil, nil, func(StatementEntry) error {
+		handled++
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, handled)
+}
@@ -7,11 +7,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/RexArseny/loyalty_system/internal/app/config"
 	"github.com/RexArseny/loyalty_system/internal/app/external"
 	"github.com/RexArseny/loyalty_system/internal/app/models"
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/google/uuid"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
@@ -19,37 +17,85 @@ import (
 	"go.uber.org/zap"
 )
 
-const ordersForUpdate = 10
+const (
+	constraintOrdersUsers       = "orders_users_fk"
+	constraintBalancesBalance   = "balances_balance_check"
+	constraintBalancesWithdrawn = "balances_withdrawn_check"
+	constraintWithdrawalsOrder  = "withdrawals_order_unique"
+	constraintWithdrawalsSum    = "withdrawals_sum_check"
+	constraintWithdrawalsUsers  = "withdrawals_users_fk"
+	constraintOrdersStatusCheck = "orders_status_check"
+	constraintUsersRoleCheck    = "users_role_check"
+	constraintAdminActionsUsers = "admin_actions_users_fk"
+	constraintTransfersSum      = "transfers_sum_check"
+	constraintReversalsPK       = "reversals_pk"
+	constraintHoldsOrderActive  = "holds_order_active_idx"
+	constraintCampaignsUsers    = "campaigns_users_fk"
+	constraintCampaignsPeriod   = "campaigns_period_check"
+	constraintCampaignsRule     = "campaigns_rule_check"
+	constraintUsersReferralCode = "users_referral_code_unique"
+	constraintOrdersMerchants   = "orders_merchants_fk"
+	constraintMerchantsPK       = "merchants_pk"
+	constraintMerchantsPrefix   = "merchants_order_prefix_unique"
+	constraintMerchantsDigits   = "merchants_order_prefix_check"
+	constraintMerchantsRate     = "merchants_rate_limit_check"
+	constraintUsersMerchants    = "users_merchants_fk"
+)
 
 type DBRepository struct {
-	logger *zap.Logger
-	pool   *Pool
+	logger   *zap.Logger
+	pool     *Pool
+	replicas *ReplicaRouter
 }
 
-func NewDBRepository(ctx context.Context, logger *zap.Logger, connString string) (*DBRepository, error) {
-	m, err := migrate.New("file://./internal/app/repository/migrations", connString)
-	if err != nil {
-		return nil, fmt.Errorf("can not create migration instance: %w", err)
-	}
-	err = m.Up()
-	if err != nil {
-		if !errors.Is(err, migrate.ErrNoChange) {
-			return nil, fmt.Errorf("can not migrate up: %w", err)
+func NewDBRepository(ctx context.Context, logger *zap.Logger, cfg *config.Config) (*DBRepository, error) {
+	if cfg.AutoMigrate {
+		err := NewMigrator(logger.Named("migrator"), cfg.DatabaseURI).Up(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("can not apply migrations: %w", err)
 		}
 	}
 
-	pool, err := NewPool(ctx, connString)
+	policy := RetryPolicy{
+		MaxAttempts:    cfg.DatabaseRetryAttempts,
+		InitialBackoff: cfg.DatabaseRetryInitialBackoff,
+		MaxBackoff:     cfg.DatabaseRetryMaxBackoff,
+	}
+	limits := PoolLimits{
+		MaxConns:        cfg.DatabaseMaxConns,
+		MinConns:        cfg.DatabaseMinConns,
+		MaxConnLifetime: cfg.DatabaseMaxConnLifetime,
+		MaxConnIdleTime: cfg.DatabaseMaxConnIdleTime,
+	}
+	pool, err := NewPool(ctx, logger.Named("pool"), cfg.DatabaseURI, policy, limits)
 	if err != nil {
 		return nil, fmt.Errorf("can not create new pool: %w", err)
 	}
 	err = pool.Ping(ctx)
 	if err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("can not ping PostgreSQL server: %w", err)
 	}
 
+	replicas, err := NewReplicaRouter(
+		ctx,
+		logger.Named("replicas"),
+		pool,
+		cfg.DatabaseReplicaURIs,
+		policy,
+		limits,
+		cfg.DatabaseReplicaHealthCheckInterval,
+		cfg.DatabaseReadYourWrites,
+	)
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("can not create replica router: %w", err)
+	}
+
 	return &DBRepository{
-		logger: logger,
-		pool:   pool,
+		logger:   logger,
+		pool:     pool,
+		replicas: replicas,
 	}, nil
 }
 
@@ -59,41 +105,88 @@ func (d *DBRepository) Registration(
 	hash string,
 	salt string,
 	userID uuid.UUID,
+	referralCode string,
+	referral *ReferralPolicy,
 ) error {
-	tx, err := d.pool.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("can not start transaction: %w", err)
-	}
-	defer func() {
-		err = tx.Rollback(ctx)
-		if err != nil && !strings.Contains(err.Error(), "tx is closed") {
-			d.logger.Error("Can not rollback transaction", zap.Error(err))
+	return d.inUserTx(ctx, userID, func(tx pgx.Tx) error {
+		var referrerID uuid.UUID
+		if referral != nil {
+			// The referrer is locked so that concurrent registrations with
+			// the same code can not exceed the limits.
+			var disabled bool
+			err := tx.QueryRow(ctx, `SELECT user_id, disabled
+									FROM users
+									WHERE referral_code = $1
+									FOR UPDATE`, referral.Code).Scan(&referrerID, &disabled)
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					return ErrReferralCode
+				}
+				return fmt.Errorf("can not get referrer: %w", err)
+			}
+			if disabled {
+				return ErrReferralCode
+			}
 		}
-	}()
 
-	_, err = tx.Exec(ctx, `INSERT INTO users (user_id, login, hash, salt)
-							VALUES ($1, $2, $3, $4)`, userID, login, hash, salt)
-	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
-			return NewErrOriginalLoginUniqueViolation(login)
+		_, err := tx.Exec(ctx, `INSERT INTO users (user_id, login, hash, salt, referral_code)
+								VALUES ($1, $2, $3, $4, $5)`, userID, login, hash, salt, referralCode)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.ConstraintName == constraintUsersReferralCode {
+				return ErrReferralCodeUsed
+			}
+			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+				return NewErrOriginalLoginUniqueViolation(login)
+			}
+			return fmt.Errorf("can not add user: %w", err)
 		}
-		return fmt.Errorf("can not add user: %w", err)
-	}
 
-	_, err = tx.Exec(ctx, `INSERT INTO balances (user_id, balance, withdrawn)
-							VALUES ($1, $2, $3)`, userID, 0, 0)
-	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
-			return NewErrOriginalLoginUniqueViolation(login)
+		_, err = tx.Exec(ctx, `INSERT INTO balances (user_id, balance, withdrawn)
+								VALUES ($1, $2, $3)`, userID, 0, 0)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+				return NewErrOriginalLoginUniqueViolation(login)
+			}
+			return fmt.Errorf("can not add user: %w", err)
+		}
+
+		if referral != nil {
+			return addReferral(ctx, tx, referrerID, userID, referral)
 		}
-		return fmt.Errorf("can not add user: %w", err)
+
+		return nil
+	})
+}
+
+func addReferral(
+	ctx context.Context,
+	tx pgx.Tx,
+	referrerID uuid.UUID,
+	refereeID uuid.UUID,
+	referral *ReferralPolicy,
+) error {
+	var recent, rewarded int
+	err := tx.QueryRow(ctx, `SELECT count(*) FILTER (WHERE created_at >= $2),
+									count(*) FILTER (WHERE referrer_bonus > 0)
+								FROM referrals
+								WHERE referrer_id = $1`, referrerID, referral.Since).Scan(&recent, &rewarded)
+	if err != nil {
+		return fmt.Errorf("can not count referrals: %w", err)
+	}
+	if referral.DailyLimit > 0 && recent >= referral.DailyLimit {
+		return ErrReferralLimit
+	}
+	referrerBonus := referral.Bonus
+	if referral.MaxRewards > 0 && rewarded >= referral.MaxRewards {
+		referrerBonus = 0
 	}
 
-	err = tx.Commit(ctx)
+	_, err = tx.Exec(ctx, `INSERT INTO referrals (referee_id, referrer_id, referrer_bonus, referee_bonus, created_at)
+							VALUES ($1, $2, $3, $4, $5)`, refereeID, referrerID, referrerBonus, referral.Bonus, time.Now())
 	if err != nil {
-		return fmt.Errorf("can not commit transaction: %w", err)
+		return fmt.Errorf("can not add referral: %w", err)
 	}
 
 	return nil
@@ -101,9 +194,10 @@ func (d *DBRepository) Registration(
 
 func (d *DBRepository) GetUser(ctx context.Context, login string) (*User, error) {
 	var user User
-	err := d.pool.QueryRow(ctx, `SELECT user_id, login, hash, salt
+	err := d.pool.QueryRow(ctx, `SELECT user_id, login, hash, salt, role, referral_code, disabled
 								FROM users
-								WHERE login = $1`, login).Scan(&user.UserID, &user.Login, &user.Hash, &user.Salt)
+								WHERE login = $1`, login).
+		Scan(&user.UserID, &user.Login, &user.Hash, &user.Salt, &user.Role, &user.ReferralCode, &user.Disabled)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, NewErrInvalidAuthData(login)
@@ -114,50 +208,174 @@ func (d *DBRepository) GetUser(ctx context.Context, login string) (*User, error)
 	return &user, nil
 }
 
-func (d *DBRepository) AddOrder(ctx context.Context, orderNumber string, userID uuid.UUID) error {
-	tx, err := d.pool.Begin(ctx)
+func (d *DBRepository) SetUserRole(ctx context.Context, login string, role string, merchantID string) error {
+	tag, err := d.pool.Exec(ctx, `UPDATE users SET role = $1, merchant_id = NULLIF($2, '') WHERE login = $3`,
+		role, merchantID, login)
 	if err != nil {
-		return fmt.Errorf("can not start transaction: %w", err)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.ConstraintName {
+			case constraintUsersRoleCheck:
+				return NewErrInvalidRole(role)
+			case constraintUsersMerchants:
+				return ErrMerchantNotFound
+			}
+		}
+		return fmt.Errorf("can not set user role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
 	}
-	defer func() {
-		err = tx.Rollback(ctx)
-		if err != nil && !strings.Contains(err.Error(), "tx is closed") {
-			d.logger.Error("Can not rollback transaction", zap.Error(err))
+
+	return nil
+}
+
+// insertOrder takes the merchant of an order from the request or else from
+// the longest order prefix matching the number.
+const insertOrder = `INSERT INTO orders (order_id, status, uploaded_at, user_id, merchant_id)
+	VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), (SELECT merchant_id
+		FROM merchants
+		WHERE starts_with($1, order_prefix)
+		ORDER BY length(order_prefix) DESC
+		LIMIT 1)))`
+
+// selectOrderMerchant returns the merchant of an uploaded order or else the
+// merchant a new order with the number would belong to.
+const selectOrderMerchant = `SELECT COALESCE((SELECT merchant_id FROM orders WHERE order_id = $1), (SELECT merchant_id
+		FROM merchants
+		WHERE starts_with($1, order_prefix)
+		ORDER BY length(order_prefix) DESC
+		LIMIT 1))`
+
+func (d *DBRepository) AddOrder(ctx context.Context, orderNumber string, merchantID string, userID uuid.UUID) error {
+	return d.inUserTx(ctx, userID, func(tx pgx.Tx) error {
+		var orderUserID uuid.UUID
+		err := tx.QueryRow(ctx, "SELECT user_id FROM orders WHERE order_id = $1", orderNumber).Scan(&orderUserID)
+		if err == nil {
+			if orderUserID == userID {
+				return NewErrAlreadyAdded(orderNumber)
+			}
+			return NewErrAlreadyAddedByAnotherUser(orderNumber)
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("can not get order: %w", err)
 		}
-	}()
 
-	var orderUserID uuid.UUID
-	err = tx.QueryRow(ctx, "SELECT user_id FROM orders WHERE order_id = $1", orderNumber).Scan(&orderUserID)
-	if err == nil {
-		if orderUserID == userID {
-			return NewErrAlreadyAdded(orderNumber)
+		_, err = tx.Exec(ctx, insertOrder,
+			orderNumber,
+			models.StatusNew,
+			time.Now(),
+			userID,
+			merchantID)
+		if err != nil {
+			return orderError(err)
 		}
-		return NewErrAlreadyAddedByAnotherUser(orderNumber)
-	}
-	if !errors.Is(err, pgx.ErrNoRows) {
-		return fmt.Errorf("can not get order: %w", err)
-	}
 
-	_, err = tx.Exec(ctx, `INSERT INTO orders (order_id, status, uploaded_at, user_id)
-							VALUES ($1, $2, $3, $4)`,
-		orderNumber,
-		models.StatusNew,
-		time.Now(),
-		userID)
+		return nil
+	})
+}
+
+func (d *DBRepository) AddOrders(
+	ctx context.Context,
+	orderNumbers []string,
+	merchantID string,
+	userID uuid.UUID,
+) ([]error, error) {
+	results := make([]error, len(orderNumbers))
+	err := d.inUserTx(ctx, userID, func(tx pgx.Tx) error {
+		now := time.Now()
+		batch := &pgx.Batch{}
+		for _, orderNumber := range orderNumbers {
+			batch.Queue(insertOrder+` ON CONFLICT (order_id) DO NOTHING`,
+				orderNumber, models.StatusNew, now, userID, merchantID)
+		}
+
+		batchResults := tx.SendBatch(ctx, batch)
+		var conflicts []string
+		for index, orderNumber := range orderNumbers {
+			tag, err := batchResults.Exec()
+			if err != nil {
+				batchResults.Close()
+				return orderError(err)
+			}
+			if tag.RowsAffected() == 0 {
+				conflicts = append(conflicts, orderNumber)
+				results[index] = NewErrAlreadyAddedByAnotherUser(orderNumber)
+			}
+		}
+		err := batchResults.Close()
+		if err != nil {
+			return fmt.Errorf("can not add orders: %w", err)
+		}
+		if len(conflicts) == 0 {
+			return nil
+		}
+
+		// Orders added before or repeated in the batch belong to the user.
+		rows, err := tx.Query(ctx, `SELECT order_id FROM orders WHERE order_id = ANY($1) AND user_id = $2`,
+			conflicts, userID)
+		if err != nil {
+			return fmt.Errorf("can not get orders: %w", err)
+		}
+		own := make(map[string]struct{})
+		for rows.Next() {
+			var orderNumber string
+			err = rows.Scan(&orderNumber)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("can not read order: %w", err)
+			}
+			own[orderNumber] = struct{}{}
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return fmt.Errorf("can not read rows: %w", rows.Err())
+		}
+
+		for index, orderNumber := range orderNumbers {
+			if _, ok := own[orderNumber]; ok && results[index] != nil {
+				results[index] = NewErrAlreadyAdded(orderNumber)
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("can not add order: %w", err)
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func orderError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.ConstraintName {
+		case constraintOrdersUsers:
+			return ErrUserNotFound
+		case constraintOrdersMerchants:
+			return ErrMerchantNotFound
+		}
 	}
+	return fmt.Errorf("can not add order: %w", err)
+}
 
-	err = tx.Commit(ctx)
+func (d *DBRepository) GetOrders(ctx context.Context, userID uuid.UUID) ([]Order, error) {
+	var result []Order
+	err := d.replicas.Read(ctx, userID, func(pool *Pool) error {
+		var err error
+		result, err = d.getOrders(ctx, pool, userID)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("can not commit transaction: %w", err)
+		return nil, err
 	}
 
-	return nil
+	return result, nil
 }
 
-func (d *DBRepository) GetOrders(ctx context.Context, userID uuid.UUID) ([]Order, error) {
-	rows, err := d.pool.Query(ctx, `SELECT order_id, status, accrual, uploaded_at 
+func (d *DBRepository) getOrders(ctx context.Context, pool *Pool, userID uuid.UUID) ([]Order, error) {
+	rows, err := pool.Query(ctx, `SELECT order_id, status, accrual, uploaded_at, merchant_id
 									FROM orders 
 									WHERE user_id = $1 
 									ORDER BY uploaded_at`, userID)
@@ -174,6 +392,7 @@ func (d *DBRepository) GetOrders(ctx context.Context, userID uuid.UUID) ([]Order
 			&order.Status,
 			&order.Accrual,
 			&order.UploadedAt,
+			&order.MerchantID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("can not read row: %w", err)
@@ -192,10 +411,24 @@ func (d *DBRepository) GetOrders(ctx context.Context, userID uuid.UUID) ([]Order
 }
 
 func (d *DBRepository) GetBalance(ctx context.Context, userID uuid.UUID) (*Balance, error) {
+	var result *Balance
+	err := d.replicas.Read(ctx, userID, func(pool *Pool) error {
+		var err error
+		result, err = d.getBalance(ctx, pool, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *DBRepository) getBalance(ctx context.Context, pool *Pool, userID uuid.UUID) (*Balance, error) {
 	var balance Balance
-	err := d.pool.QueryRow(ctx, `SELECT balance, withdrawn
+	err := pool.QueryRow(ctx, `SELECT balance, held, withdrawn
 								FROM balances
-								WHERE user_id = $1`, userID).Scan(&balance.Current, &balance.Withdrawn)
+								WHERE user_id = $1`, userID).Scan(&balance.Current, &balance.Held, &balance.Withdrawn)
 	if err != nil {
 		return nil, fmt.Errorf("can not get balance: %w", err)
 	}
@@ -204,51 +437,70 @@ func (d *DBRepository) GetBalance(ctx context.Context, userID uuid.UUID) (*Balan
 }
 
 func (d *DBRepository) Withdraw(ctx context.Context, orderNumber string, sum float64, userID uuid.UUID) error {
-	tx, err := d.pool.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("can not start transaction: %w", err)
-	}
-	defer func() {
-		err = tx.Rollback(ctx)
-		if err != nil && !strings.Contains(err.Error(), "tx is closed") {
-			d.logger.Error("Can not rollback transaction", zap.Error(err))
+	return d.inUserTx(ctx, userID, func(tx pgx.Tx) error {
+		var balance Balance
+		err := tx.QueryRow(ctx, `SELECT balance, withdrawn
+								FROM balances
+								WHERE user_id = $1
+								FOR UPDATE`, userID).Scan(&balance.Current, &balance.Withdrawn)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("can not get balance: %w", err)
 		}
-	}()
 
-	var balance Balance
-	err = tx.QueryRow(ctx, `SELECT balance, withdrawn
-							FROM balances
-							WHERE user_id = $1`, userID).Scan(&balance.Current, &balance.Withdrawn)
-	if err != nil {
-		return fmt.Errorf("can not get balance: %w", err)
-	}
+		if balance.Current-sum < 0 {
+			return ErrNotEnoughBalance
+		}
 
-	if balance.Current-sum < 0 {
-		return ErrNotEnoughBalance
-	}
+		_, err = tx.Exec(ctx, `UPDATE balances SET balance = balance - $1, withdrawn = withdrawn + $1 WHERE user_id = $2`,
+			sum, userID)
+		if err != nil {
+			return withdrawError(err, orderNumber, "can not update balance")
+		}
 
-	_, err = tx.Exec(ctx, `UPDATE balances SET balance = $1, withdrawn = $2 WHERE user_id = $3`,
-		balance.Current-sum, balance.Withdrawn+sum, userID)
-	if err != nil {
-		return fmt.Errorf("can not update balance: %w", err)
-	}
+		var withdrawalID int64
+		err = tx.QueryRow(ctx, `INSERT INTO withdrawals (user_id, order_id, sum, processed_at)
+								VALUES ($1, $2, $3, $4)
+								RETURNING withdrawal_id`, userID, orderNumber, sum, time.Now()).Scan(&withdrawalID)
+		if err != nil {
+			return withdrawError(err, orderNumber, "can not add withdraw")
+		}
 
-	_, err = tx.Exec(ctx, `INSERT INTO withdrawals (user_id, order_id, sum, processed_at)
-							VALUES ($1, $2, $3, $4)`, userID, orderNumber, sum, time.Now())
-	if err != nil {
-		return fmt.Errorf("can not add withdraw: %w", err)
-	}
+		portions, err := consumePointLots(ctx, tx, userID, sum)
+		if err != nil {
+			return err
+		}
+		for _, portion := range portions {
+			_, err = tx.Exec(ctx, `INSERT INTO withdrawal_lots (withdrawal_id, lot_id, sum) VALUES ($1, $2, $3)`,
+				withdrawalID, portion.lotID, portion.sum)
+			if err != nil {
+				return fmt.Errorf("can not add withdrawal lot: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
 
-	err = tx.Commit(ctx)
+func (d *DBRepository) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]Withdraw, error) {
+	var result []Withdraw
+	err := d.replicas.Read(ctx, userID, func(pool *Pool) error {
+		var err error
+		result, err = d.getWithdrawals(ctx, pool, userID)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("can not commit transaction: %w", err)
+		return nil, err
 	}
 
-	return nil
+	return result, nil
 }
 
-func (d *DBRepository) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]Withdraw, error) {
-	rows, err := d.pool.Query(ctx, "SELECT order_id, sum, processed_at FROM withdrawals WHERE user_id = $1", userID)
+func (d *DBRepository) getWithdrawals(ctx context.Context, pool *Pool, userID uuid.UUID) ([]Withdraw, error) {
+	rows, err := pool.Query(ctx, "SELECT order_id, sum, reversed, processed_at FROM withdrawals WHERE user_id = $1",
+		userID)
 	if err != nil {
 		return nil, fmt.Errorf("can not get withdrawals: %w", err)
 	}
@@ -260,6 +512,7 @@ func (d *DBRepository) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]
 		err = rows.Scan(
 			&withdraw.Order,
 			&withdraw.Sum,
+			&withdraw.Reversed,
 			&withdraw.ProcessedAt,
 		)
 		if err != nil {
@@ -278,12 +531,19 @@ func (d *DBRepository) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]
 	return withdrawals, nil
 }
 
-func (d *DBRepository) GetOrdersForUpdate(ctx context.Context) ([]Order, error) {
-	rows, err := d.pool.Query(ctx, `SELECT order_id, user_id
+func (d *DBRepository) GetOrdersForUpdate(ctx context.Context, merchantID string, limit int) ([]Order, error) {
+	merchant := "merchant_id IS NULL"
+	args := []any{models.StatusNew, limit}
+	if merchantID != "" {
+		merchant = "merchant_id = $3"
+		args = append(args, merchantID)
+	}
+
+	rows, err := d.pool.Query(ctx, `SELECT order_id, user_id, merchant_id
 									FROM orders
-									WHERE status = $1
+									WHERE status = $1 AND `+merchant+`
 									ORDER BY uploaded_at DESC
-									LIMIT $2`, models.StatusNew, ordersForUpdate)
+									LIMIT $2`, args...)
 	if err != nil {
 		return nil, fmt.Errorf("can not get orders: %w", err)
 	}
@@ -295,6 +555,7 @@ func (d *DBRepository) GetOrdersForUpdate(ctx context.Context) ([]Order, error)
 		err = rows.Scan(
 			&order.Number,
 			&order.UserID,
+			&order.MerchantID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("can not read row: %w", err)
@@ -315,40 +576,1827 @@ func (d *DBRepository) UpdateOrder(
 	status string,
 	accrual *float64,
 	userID uuid.UUID,
+	expiresAt *time.Time,
+	tiers *TierPolicy,
 ) error {
-	tx, err := d.pool.Begin(ctx)
+	var referrerID *uuid.UUID
+	err := d.inUserTx(ctx, userID, func(tx pgx.Tx) error {
+		// A processed order is final. The row lock makes a recheck racing the
+		// status check see the processed order instead of crediting it twice.
+		var currentStatus string
+		err := tx.QueryRow(ctx, `SELECT status FROM orders WHERE order_id = $1 FOR UPDATE`, orderNumber).
+			Scan(&currentStatus)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("can not lock order: %w", err)
+		}
+		if currentStatus == string(external.StatusProcessed) {
+			return nil
+		}
+
+		var processedAt *time.Time
+		if status == string(external.StatusProcessed) {
+			now := time.Now()
+			processedAt = &now
+		}
+
+		var loyalty *LoyaltyStatus
+		baseAccrual := accrual
+		if processedAt != nil && accrual != nil && tiers != nil {
+			loyalty, err = getLoyaltyStatus(ctx, tx, userID, tiers.Since)
+			if err != nil {
+				return err
+			}
+			credited := tiers.accrual(loyalty.Accrued, *accrual)
+			accrual = &credited
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE orders SET status = $1, accrual = $2, base_accrual = $3, processed_at = $4
+								WHERE order_id = $5`,
+			status, accrual, baseAccrual, processedAt, orderNumber)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.ConstraintName == constraintOrdersStatusCheck {
+				return NewErrInvalidOrderStatus(status)
+			}
+			return fmt.Errorf("can not update order: %w", err)
+		}
+
+		if processedAt != nil && accrual != nil {
+			_, err = tx.Exec(ctx, `UPDATE balances SET balance = balance + $1 WHERE user_id = $2`,
+				accrual, userID)
+			if err != nil {
+				return fmt.Errorf("can not update balance: %w", err)
+			}
+
+			err = addPointLot(ctx, tx, userID, orderNumber, *accrual, expiresAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		if loyalty != nil {
+			tier := tiers.Tiers[tiers.Tiers.ForAccrual(loyalty.Accrued+*baseAccrual)]
+			_, err = tx.Exec(ctx, `UPDATE users SET tier = $1 WHERE user_id = $2`, tier.Name, userID)
+			if err != nil {
+				return fmt.Errorf("can not update tier: %w", err)
+			}
+		}
+
+		if processedAt != nil && accrual != nil {
+			err = applyCampaigns(ctx, tx, userID, orderNumber, *accrual, *processedAt, expiresAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		if processedAt != nil {
+			referrerID, err = rewardReferral(ctx, tx, userID, orderNumber, *processedAt, expiresAt)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if referrerID != nil {
+		d.replicas.Written(*referrerID)
+	}
+
+	return nil
+}
+
+func (d *DBRepository) GetLoyaltyStatus(
+	ctx context.Context,
+	userID uuid.UUID,
+	since time.Time,
+) (*LoyaltyStatus, error) {
+	var result *LoyaltyStatus
+	err := d.replicas.Read(ctx, userID, func(pool *Pool) error {
+		var err error
+		result, err = getLoyaltyStatus(ctx, pool, userID, since)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func getLoyaltyStatus(ctx context.Context, q rowQuerier, userID uuid.UUID, since time.Time) (*LoyaltyStatus, error) {
+	var status LoyaltyStatus
+	err := q.QueryRow(ctx, `SELECT tier, (SELECT COALESCE(SUM(base_accrual), 0)
+									FROM orders
+									WHERE user_id = $1 AND status = $2 AND processed_at >= $3)
+								FROM users
+								WHERE user_id = $1`, userID, external.StatusProcessed, since).
+		Scan(&status.Tier, &status.Accrued)
 	if err != nil {
-		return fmt.Errorf("can not start transaction: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("can not get loyalty status: %w", err)
+	}
+
+	return &status, nil
+}
+
+func (d *DBRepository) SearchUsers(ctx context.Context, loginPrefix string, limit int) ([]User, error) {
+	rows, err := d.pool.Query(ctx, `SELECT user_id, login, role, disabled
+								FROM users
+								WHERE login LIKE $1 || '%'
+								ORDER BY login
+								LIMIT $2`, escapeLike(loginPrefix), limit)
+	if err != nil {
+		return nil, fmt.Errorf("can not search users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err = rows.Scan(&user.UserID, &user.Login, &user.Role, &user.Disabled)
+		if err != nil {
+			return nil, fmt.Errorf("can not read user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("can not read rows: %w", rows.Err())
 	}
-	defer func() {
-		err = tx.Rollback(ctx)
-		if err != nil && !strings.Contains(err.Error(), "tx is closed") {
-			d.logger.Error("Can not rollback transaction", zap.Error(err))
+
+	return users, nil
+}
+
+func (d *DBRepository) GetUserByID(ctx context.Context, userID uuid.UUID) (*User, error) {
+	var user User
+	err := d.pool.QueryRow(ctx, `SELECT user_id, login, role, merchant_id, disabled
+								FROM users
+								WHERE user_id = $1`, userID).
+		Scan(&user.UserID, &user.Login, &user.Role, &user.MerchantID, &user.Disabled)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
 		}
-	}()
+		return nil, fmt.Errorf("can not get user: %w", err)
+	}
+
+	return &user, nil
+}
 
-	_, err = tx.Exec(ctx, `UPDATE orders SET status = $1, accrual = $2 WHERE order_id = $3`,
-		status, accrual, orderNumber)
+func (d *DBRepository) GetOrder(ctx context.Context, orderNumber string) (*Order, error) {
+	var order Order
+	err := d.pool.QueryRow(ctx, `SELECT order_id, status, accrual, uploaded_at, user_id, merchant_id
+								FROM orders
+								WHERE order_id = $1`, orderNumber).
+		Scan(&order.Number, &order.Status, &order.Accrual, &order.UploadedAt, &order.UserID, &order.MerchantID)
 	if err != nil {
-		return fmt.Errorf("can not update order: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("can not get order: %w", err)
+	}
+
+	return &order, nil
+}
+
+func (d *DBRepository) AdjustBalance(ctx context.Context, action AdminAction, expiresAt *time.Time) error {
+	if action.UserID == nil || action.Amount == nil || *action.Amount == 0 {
+		return ErrInvalidSum
 	}
 
-	if status == string(external.StatusProcessed) && accrual != nil {
+	return d.inUserTx(ctx, *action.UserID, func(tx pgx.Tx) error {
+		var balance float64
+		err := tx.QueryRow(ctx, `SELECT balance FROM balances WHERE user_id = $1 FOR UPDATE`, *action.UserID).
+			Scan(&balance)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("can not get balance: %w", err)
+		}
+		if balance+*action.Amount < 0 {
+			return ErrNotEnoughBalance
+		}
+
 		_, err = tx.Exec(ctx, `UPDATE balances SET balance = balance + $1 WHERE user_id = $2`,
-			accrual, userID)
+			*action.Amount, *action.UserID)
 		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.ConstraintName == constraintBalancesBalance {
+				return ErrNotEnoughBalance
+			}
 			return fmt.Errorf("can not update balance: %w", err)
 		}
+
+		if *action.Amount > 0 {
+			err = addPointLot(ctx, tx, *action.UserID, "", *action.Amount, expiresAt)
+		} else {
+			_, err = consumePointLots(ctx, tx, *action.UserID, -*action.Amount)
+		}
+		if err != nil {
+			return err
+		}
+
+		return addAdminAction(ctx, tx, action)
+	})
+}
+
+func (d *DBRepository) SetUserDisabled(ctx context.Context, action AdminAction, disabled bool) error {
+	if action.UserID == nil {
+		return ErrUserNotFound
+	}
+
+	return d.inUserTx(ctx, *action.UserID, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE users SET disabled = $1 WHERE user_id = $2`, disabled, *action.UserID)
+		if err != nil {
+			return fmt.Errorf("can not update user: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrUserNotFound
+		}
+
+		return addAdminAction(ctx, tx, action)
+	})
+}
+
+func (d *DBRepository) AddAdminAction(ctx context.Context, action AdminAction) error {
+	return d.pool.InTx(ctx, func(tx pgx.Tx) error {
+		return addAdminAction(ctx, tx, action)
+	})
+}
+
+func (d *DBRepository) GetAdminActions(ctx context.Context, userID *uuid.UUID, limit int) ([]AdminAction, error) {
+	rows, err := d.pool.Query(ctx, `SELECT admin_id, user_id, action, order_id, amount, reason, comment, created_at
+								FROM admin_actions
+								WHERE $1::uuid IS NULL OR user_id = $1
+								ORDER BY created_at DESC, action_id DESC
+								LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can not get admin actions: %w", err)
+	}
+	defer rows.Close()
+
+	var actions []AdminAction
+	for rows.Next() {
+		var action AdminAction
+		var orderNumber, reason, comment *string
+		err = rows.Scan(&action.AdminID, &action.UserID, &action.Action, &orderNumber, &action.Amount,
+			&reason, &comment, &action.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("can not read admin action: %w", err)
+		}
+		action.OrderNumber = fromNullString(orderNumber)
+		action.Reason = fromNullString(reason)
+		action.Comment = fromNullString(comment)
+		actions = append(actions, action)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("can not read rows: %w", rows.Err())
 	}
 
-	err = tx.Commit(ctx)
+	return actions, nil
+}
+
+func (d *DBRepository) GetExpiringPoints(ctx context.Context, userID uuid.UUID, until time.Time) ([]PointLot, error) {
+	var result []PointLot
+	err := d.replicas.Read(ctx, userID, func(pool *Pool) error {
+		var err error
+		result, err = d.getExpiringPoints(ctx, pool, userID, until)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("can not commit transaction: %w", err)
+		return nil, err
 	}
 
-	return nil
+	return result, nil
 }
 
-func (d *DBRepository) Close() {
-	d.pool.Close()
+func (d *DBRepository) getExpiringPoints(
+	ctx context.Context,
+	pool *Pool,
+	userID uuid.UUID,
+	until time.Time,
+) ([]PointLot, error) {
+	rows, err := pool.Query(ctx, `SELECT order_id, amount, remaining, accrued_at, expires_at
+								FROM point_lots
+								WHERE user_id = $1 AND remaining > 0 AND expires_at <= $2
+								ORDER BY expires_at, lot_id`, userID, until)
+	if err != nil {
+		return nil, fmt.Errorf("can not get point lots: %w", err)
+	}
+	defer rows.Close()
+
+	var lots []PointLot
+	for rows.Next() {
+		var lot PointLot
+		var orderNumber *string
+		err = rows.Scan(&orderNumber, &lot.Amount, &lot.Remaining, &lot.AccruedAt, &lot.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("can not read point lot: %w", err)
+		}
+		lot.Order = fromNullString(orderNumber)
+		lots = append(lots, lot)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("can not read rows: %w", rows.Err())
+	}
+
+	return lots, nil
+}
+
+func (d *DBRepository) ExpirePoints(ctx context.Context, now time.Time, limit int) ([]PointExpiration, error) {
+	rows, err := d.pool.Query(ctx, `SELECT lot_id, user_id
+								FROM point_lots
+								WHERE remaining > 0 AND expires_at <= $1
+								ORDER BY expires_at, lot_id
+								LIMIT $2`, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can not get expired point lots: %w", err)
+	}
+	lots := make(map[uuid.UUID][]int64)
+	var users []uuid.UUID
+	for rows.Next() {
+		var lotID int64
+		var userID uuid.UUID
+		err = rows.Scan(&lotID, &userID)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("can not read point lot: %w", err)
+		}
+		if _, ok := lots[userID]; !ok {
+			users = append(users, userID)
+		}
+		lots[userID] = append(lots[userID], lotID)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("can not read rows: %w", rows.Err())
+	}
+
+	var expirations []PointExpiration
+	for _, userID := range users {
+		var userExpirations []PointExpiration
+		err = d.inUserTx(ctx, userID, func(tx pgx.Tx) error {
+			var err error
+			userExpirations, err = expirePointLots(ctx, tx, userID, lots[userID], now)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("can not expire points of user %s: %w", userID, err)
+		}
+		expirations = append(expirations, userExpirations...)
+	}
+
+	return expirations, nil
+}
+
+func (d *DBRepository) Transfer(
+	ctx context.Context,
+	fromUserID uuid.UUID,
+	toLogin string,
+	sum float64,
+	dailyLimit float64,
+) error {
+	if sum <= 0 {
+		return ErrInvalidSum
+	}
+
+	var toUserID uuid.UUID
+	err := d.pool.InTx(ctx, func(tx pgx.Tx) error {
+		var disabled bool
+		err := tx.QueryRow(ctx, `SELECT user_id, disabled FROM users WHERE login = $1`, toLogin).
+			Scan(&toUserID, &disabled)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("can not get recipient: %w", err)
+		}
+		if toUserID == fromUserID {
+			return ErrSelfTransfer
+		}
+		if disabled {
+			return ErrUserDisabled
+		}
+
+		// Both balances are locked in user_id order so that opposite transfers
+		// between the same users can not deadlock.
+		rows, err := tx.Query(ctx, `SELECT user_id, balance
+									FROM balances
+									WHERE user_id = ANY($1)
+									ORDER BY user_id
+									FOR UPDATE`, []uuid.UUID{fromUserID, toUserID})
+		if err != nil {
+			return fmt.Errorf("can not lock balances: %w", err)
+		}
+		balances := make(map[uuid.UUID]float64, 2)
+		for rows.Next() {
+			var userID uuid.UUID
+			var balance float64
+			err = rows.Scan(&userID, &balance)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("can not read balance: %w", err)
+			}
+			balances[userID] = balance
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return fmt.Errorf("can not read rows: %w", rows.Err())
+		}
+		balance, ok := balances[fromUserID]
+		if !ok {
+			return ErrUserNotFound
+		}
+		if _, ok = balances[toUserID]; !ok {
+			return ErrUserNotFound
+		}
+
+		now := time.Now()
+		if dailyLimit > 0 {
+			var sent float64
+			err = tx.QueryRow(ctx, `SELECT COALESCE(SUM(sum), 0)
+									FROM transfers
+									WHERE from_user_id = $1 AND processed_at > $2`,
+				fromUserID, now.Add(-24*time.Hour)).Scan(&sent)
+			if err != nil {
+				return fmt.Errorf("can not get sent transfers: %w", err)
+			}
+			if sent+sum > dailyLimit {
+				return ErrTransferLimit
+			}
+		}
+		if balance-sum < 0 {
+			return ErrNotEnoughBalance
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE balances SET balance = balance - $1 WHERE user_id = $2`, sum, fromUserID)
+		if err != nil {
+			return transferError(err, "can not update sender balance")
+		}
+		_, err = tx.Exec(ctx, `UPDATE balances SET balance = balance + $1 WHERE user_id = $2`, sum, toUserID)
+		if err != nil {
+			return transferError(err, "can not update recipient balance")
+		}
+
+		portions, err := consumePointLots(ctx, tx, fromUserID, sum)
+		if err != nil {
+			return err
+		}
+		err = addPortionLots(ctx, tx, toUserID, "", portions)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `INSERT INTO transfers (from_user_id, to_user_id, sum, processed_at)
+								VALUES ($1, $2, $3, $4)`, fromUserID, toUserID, sum, now)
+		if err != nil {
+			return transferError(err, "can not add transfer")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.replicas.Written(fromUserID)
+	d.replicas.Written(toUserID)
+
+	return nil
+}
+
+func (d *DBRepository) GetTransfers(ctx context.Context, userID uuid.UUID) ([]Transfer, error) {
+	var result []Transfer
+	err := d.replicas.Read(ctx, userID, func(pool *Pool) error {
+		var err error
+		result, err = d.getTransfers(ctx, pool, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *DBRepository) getTransfers(ctx context.Context, pool *Pool, userID uuid.UUID) ([]Transfer, error) {
+	rows, err := pool.Query(ctx, `SELECT transfers.from_user_id, senders.login, transfers.to_user_id,
+									recipients.login, transfers.sum, transfers.processed_at
+								FROM transfers
+								JOIN users senders ON senders.user_id = transfers.from_user_id
+								JOIN users recipients ON recipients.user_id = transfers.to_user_id
+								WHERE transfers.from_user_id = $1 OR transfers.to_user_id = $1
+								ORDER BY transfers.processed_at, transfers.transfer_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not get transfers: %w", err)
+	}
+	defer rows.Close()
+
+	var transfers []Transfer
+	for rows.Next() {
+		var transfer Transfer
+		err = rows.Scan(
+			&transfer.FromUserID,
+			&transfer.FromLogin,
+			&transfer.ToUserID,
+			&transfer.ToLogin,
+			&transfer.Sum,
+			&transfer.ProcessedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("can not read row: %w", err)
+		}
+
+		transfers = append(transfers, transfer)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("can not read rows: %w", rows.Err())
+	}
+	if len(transfers) == 0 {
+		return nil, ErrNoTransfers
+	}
+
+	return transfers, nil
+}
+
+func (d *DBRepository) ReverseWithdrawal(
+	ctx context.Context,
+	reversalID string,
+	orderNumber string,
+	sum *float64,
+	initiatorID uuid.UUID,
+	merchantID string,
+	expiresAt *time.Time,
+) (*Reversal, error) {
+	reversal := Reversal{
+		ReversalID:  reversalID,
+		Order:       orderNumber,
+		InitiatorID: initiatorID,
+	}
+	err := d.pool.InTx(ctx, func(tx pgx.Tx) error {
+		var withdrawalID int64
+		var withdrawn, reversed float64
+		err := tx.QueryRow(ctx, `SELECT withdrawal_id, user_id, sum, reversed
+								FROM withdrawals
+								WHERE order_id = $1
+								FOR UPDATE`, orderNumber).Scan(&withdrawalID, &reversal.UserID, &withdrawn, &reversed)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNoWithdrawal
+			}
+			return fmt.Errorf("can not get withdrawal: %w", err)
+		}
+		if merchantID != "" {
+			var withdrawalMerchantID *string
+			err = tx.QueryRow(ctx, selectOrderMerchant, orderNumber).Scan(&withdrawalMerchantID)
+			if err != nil {
+				return fmt.Errorf("can not get withdrawal merchant: %w", err)
+			}
+			if withdrawalMerchantID == nil || *withdrawalMerchantID != merchantID {
+				return ErrNoWithdrawal
+			}
+		}
+
+		var existingWithdrawalID int64
+		err = tx.QueryRow(ctx, `SELECT withdrawal_id, sum, initiator_id, created_at
+								FROM reversals
+								WHERE reversal_id = $1`, reversalID).
+			Scan(&existingWithdrawalID, &reversal.Sum, &reversal.InitiatorID, &reversal.CreatedAt)
+		if err == nil {
+			if existingWithdrawalID != withdrawalID || (sum != nil && *sum != reversal.Sum) {
+				return ErrReversalConflict
+			}
+			return nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("can not get reversal: %w", err)
+		}
+
+		reversal.Sum, err = reversalSum(withdrawn, reversed, sum)
+		if err != nil {
+			return err
+		}
+		reversal.CreatedAt = time.Now()
+
+		_, err = tx.Exec(ctx, `UPDATE withdrawals SET reversed = LEAST(reversed + $1, sum) WHERE withdrawal_id = $2`,
+			reversal.Sum, withdrawalID)
+		if err != nil {
+			return fmt.Errorf("can not update withdrawal: %w", err)
+		}
+		_, err = tx.Exec(ctx, `UPDATE balances
+								SET balance = balance + $1, withdrawn = GREATEST(withdrawn - $1, 0)
+								WHERE user_id = $2`, reversal.Sum, reversal.UserID)
+		if err != nil {
+			return fmt.Errorf("can not update balance: %w", err)
+		}
+		restored, err := restoreWithdrawalLots(ctx, tx, withdrawalID, reversal.Sum)
+		if err != nil {
+			return err
+		}
+		err = addPointLot(ctx, tx, reversal.UserID, orderNumber, reversal.Sum-restored, expiresAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `INSERT INTO reversals (reversal_id, withdrawal_id, sum, initiator_id, created_at)
+								VALUES ($1, $2, $3, $4, $5)`,
+			reversalID, withdrawalID, reversal.Sum, initiatorID, reversal.CreatedAt)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.ConstraintName == constraintReversalsPK {
+				return ErrReversalConflict
+			}
+			return fmt.Errorf("can not add reversal: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.replicas.Written(reversal.UserID)
+
+	return &reversal, nil
+}
+
+// restoreWithdrawalLots returns up to sum to the lots a withdrawal was taken
+// from, the lots taken last first, and returns the restored points. Lots that
+// expired meanwhile are written off by the next points expiration run.
+func restoreWithdrawalLots(ctx context.Context, tx pgx.Tx, withdrawalID int64, sum float64) (float64, error) {
+	rows, err := tx.Query(ctx, `SELECT lot_id, sum
+								FROM withdrawal_lots
+								WHERE withdrawal_id = $1 AND sum > 0
+								ORDER BY lot_id DESC
+								FOR UPDATE`, withdrawalID)
+	if err != nil {
+		return 0, fmt.Errorf("can not get withdrawal lots: %w", err)
+	}
+	var lots []lotPortion
+	for rows.Next() {
+		var lot lotPortion
+		err = rows.Scan(&lot.lotID, &lot.sum)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("can not read withdrawal lot: %w", err)
+		}
+		lots = append(lots, lot)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, fmt.Errorf("can not read rows: %w", rows.Err())
+	}
+
+	var restored float64
+	for _, lot := range lots {
+		if sum <= 0 {
+			break
+		}
+		taken := min(lot.sum, sum)
+		remaining := lot.sum - taken
+		if taken == lot.sum {
+			remaining = 0
+		}
+		_, err = tx.Exec(ctx, `UPDATE withdrawal_lots SET sum = $1 WHERE withdrawal_id = $2 AND lot_id = $3`,
+			remaining, withdrawalID, lot.lotID)
+		if err != nil {
+			return 0, fmt.Errorf("can not update withdrawal lot: %w", err)
+		}
+		_, err = tx.Exec(ctx, `UPDATE point_lots SET remaining = LEAST(remaining + $1, amount) WHERE lot_id = $2`,
+			taken, lot.lotID)
+		if err != nil {
+			return 0, fmt.Errorf("can not restore point lot: %w", err)
+		}
+		restored += taken
+		sum -= taken
+	}
+
+	return restored, nil
+}
+
+func (d *DBRepository) AuthorizeHold(ctx context.Context, hold Hold) error {
+	if hold.Sum <= 0 {
+		return ErrInvalidSum
+	}
+
+	return d.inUserTx(ctx, hold.UserID, func(tx pgx.Tx) error {
+		var balance float64
+		err := tx.QueryRow(ctx, `SELECT balance FROM balances WHERE user_id = $1 FOR UPDATE`, hold.UserID).
+			Scan(&balance)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("can not get balance: %w", err)
+		}
+		if balance-hold.Sum < 0 {
+			return ErrNotEnoughBalance
+		}
+
+		var exists bool
+		err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM withdrawals WHERE order_id = $1)`, hold.Order).
+			Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("can not get withdrawal: %w", err)
+		}
+		if exists {
+			return NewErrWithdrawalAlreadyExists(hold.Order)
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE balances SET balance = balance - $1, held = held + $1 WHERE user_id = $2`,
+			hold.Sum, hold.UserID)
+		if err != nil {
+			return withdrawError(err, hold.Order, "can not update balance")
+		}
+
+		_, err = tx.Exec(ctx, `INSERT INTO holds (hold_id, user_id, order_id, sum, status, created_at, expires_at)
+								VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			hold.HoldID, hold.UserID, hold.Order, hold.Sum, hold.Status, hold.CreatedAt, hold.ExpiresAt)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.ConstraintName == constraintHoldsOrderActive {
+				return ErrHoldExists
+			}
+			return fmt.Errorf("can not add hold: %w", err)
+		}
+
+		portions, err := consumePointLots(ctx, tx, hold.UserID, hold.Sum)
+		if err != nil {
+			return err
+		}
+		for _, portion := range portions {
+			_, err = tx.Exec(ctx, `INSERT INTO hold_lots (hold_id, lot_id, sum) VALUES ($1, $2, $3)`,
+				hold.HoldID, portion.lotID, portion.sum)
+			if err != nil {
+				return fmt.Errorf("can not add hold lot: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (d *DBRepository) CaptureHold(
+	ctx context.Context,
+	userID uuid.UUID,
+	holdID uuid.UUID,
+	now time.Time,
+) (*Hold, error) {
+	var hold *Hold
+	err := d.inUserTx(ctx, userID, func(tx pgx.Tx) error {
+		var err error
+		hold, err = lockHold(ctx, tx, userID, holdID)
+		if err != nil {
+			return err
+		}
+		if hold.Status != string(models.HoldActive) {
+			return ErrHoldFinished
+		}
+		if !hold.ExpiresAt.After(now) {
+			return ErrHoldExpired
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE balances
+								SET held = GREATEST(held - $1, 0), withdrawn = withdrawn + $1
+								WHERE user_id = $2`, hold.Sum, userID)
+		if err != nil {
+			return withdrawError(err, hold.Order, "can not update balance")
+		}
+		var withdrawalID int64
+		err = tx.QueryRow(ctx, `INSERT INTO withdrawals (user_id, order_id, sum, processed_at)
+								VALUES ($1, $2, $3, $4)
+								RETURNING withdrawal_id`, userID, hold.Order, hold.Sum, now).Scan(&withdrawalID)
+		if err != nil {
+			return withdrawError(err, hold.Order, "can not add withdraw")
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO withdrawal_lots (withdrawal_id, lot_id, sum)
+								SELECT $1, lot_id, sum FROM hold_lots WHERE hold_id = $2`, withdrawalID, hold.HoldID)
+		if err != nil {
+			return fmt.Errorf("can not add withdrawal lots: %w", err)
+		}
+
+		return finishHold(ctx, tx, hold, string(models.HoldCaptured), now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+func (d *DBRepository) VoidHold(
+	ctx context.Context,
+	userID uuid.UUID,
+	holdID uuid.UUID,
+	now time.Time,
+) (*Hold, error) {
+	var hold *Hold
+	err := d.inUserTx(ctx, userID, func(tx pgx.Tx) error {
+		var err error
+		hold, err = lockHold(ctx, tx, userID, holdID)
+		if err != nil {
+			return err
+		}
+		if hold.Status != string(models.HoldActive) {
+			return ErrHoldFinished
+		}
+
+		return releaseHold(ctx, tx, hold, string(models.HoldVoided), now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+func (d *DBRepository) GetHolds(ctx context.Context, userID uuid.UUID) ([]Hold, error) {
+	var result []Hold
+	err := d.replicas.Read(ctx, userID, func(pool *Pool) error {
+		var err error
+		result, err = d.getHolds(ctx, pool, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *DBRepository) getHolds(ctx context.Context, pool *Pool, userID uuid.UUID) ([]Hold, error) {
+	rows, err := pool.Query(ctx, `SELECT hold_id, user_id, order_id, sum, status, created_at, expires_at, finished_at
+								FROM holds
+								WHERE user_id = $1
+								ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not get holds: %w", err)
+	}
+	defer rows.Close()
+
+	var holds []Hold
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, *hold)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("can not read rows: %w", rows.Err())
+	}
+	if len(holds) == 0 {
+		return nil, ErrNoHolds
+	}
+
+	return holds, nil
+}
+
+func (d *DBRepository) ExpireHolds(ctx context.Context, now time.Time, limit int) ([]Hold, error) {
+	rows, err := d.pool.Query(ctx, `SELECT hold_id, user_id
+								FROM holds
+								WHERE status = $1 AND expires_at <= $2
+								ORDER BY expires_at
+								LIMIT $3`, models.HoldActive, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can not get expired holds: %w", err)
+	}
+	type expiredHold struct {
+		holdID uuid.UUID
+		userID uuid.UUID
+	}
+	var expired []expiredHold
+	for rows.Next() {
+		var value expiredHold
+		err = rows.Scan(&value.holdID, &value.userID)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("can not read hold: %w", err)
+		}
+		expired = append(expired, value)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("can not read rows: %w", rows.Err())
+	}
+
+	var holds []Hold
+	for _, value := range expired {
+		var hold *Hold
+		err = d.inUserTx(ctx, value.userID, func(tx pgx.Tx) error {
+			var err error
+			hold, err = lockHold(ctx, tx, value.userID, value.holdID)
+			if err != nil {
+				return err
+			}
+			if hold.Status != string(models.HoldActive) {
+				hold = nil
+				return nil
+			}
+
+			return releaseHold(ctx, tx, hold, string(models.HoldExpired), now)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("can not expire hold %s: %w", value.holdID, err)
+		}
+		if hold != nil {
+			holds = append(holds, *hold)
+		}
+	}
+
+	return holds, nil
+}
+
+func (d *DBRepository) Close() {
+	d.replicas.Close()
+	d.pool.Close()
+}
+
+func (d *DBRepository) inUserTx(ctx context.Context, userID uuid.UUID, action func(tx pgx.Tx) error) error {
+	err := d.pool.InTx(ctx, action)
+	if err != nil {
+		return err
+	}
+	d.replicas.Written(userID)
+
+	return nil
+}
+
+func withdrawError(err error, orderNumber string, message string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.ConstraintName {
+		case constraintBalancesBalance:
+			return ErrNotEnoughBalance
+		case constraintWithdrawalsOrder:
+			return NewErrWithdrawalAlreadyExists(orderNumber)
+		case constraintBalancesWithdrawn, constraintWithdrawalsSum:
+			return ErrInvalidSum
+		case constraintWithdrawalsUsers:
+			return ErrUserNotFound
+		}
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
+
+// reversalSum returns the points to restore: sum when set, the rest of the
+// withdrawal otherwise.
+func reversalSum(withdrawn float64, reversed float64, sum *float64) (float64, error) {
+	remaining := withdrawn - reversed
+	if remaining <= 0 {
+		return 0, ErrReversed
+	}
+	if sum == nil {
+		return remaining, nil
+	}
+	if *sum <= 0 || *sum > remaining {
+		return 0, ErrInvalidSum
+	}
+	return *sum, nil
+}
+
+// lockHold locks the balance of the user and then the hold, in the same order
+// as withdrawals, so that they can not deadlock.
+func lockHold(ctx context.Context, tx pgx.Tx, userID uuid.UUID, holdID uuid.UUID) (*Hold, error) {
+	_, err := tx.Exec(ctx, `SELECT 1 FROM balances WHERE user_id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not lock balance: %w", err)
+	}
+
+	hold, err := scanHold(tx.QueryRow(ctx, `SELECT hold_id, user_id, order_id, sum, status, created_at, expires_at,
+									finished_at
+								FROM holds
+								WHERE hold_id = $1 AND user_id = $2
+								FOR UPDATE`, holdID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrHoldNotFound
+		}
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+func scanHold(row pgx.Row) (*Hold, error) {
+	var hold Hold
+	err := row.Scan(
+		&hold.HoldID,
+		&hold.UserID,
+		&hold.Order,
+		&hold.Sum,
+		&hold.Status,
+		&hold.CreatedAt,
+		&hold.ExpiresAt,
+		&hold.FinishedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("can not read hold: %w", err)
+	}
+	return &hold, nil
+}
+
+// releaseHold returns the held points to the balance and to the lots they
+// were taken from. Lots that expired meanwhile are written off by the next
+// points expiration run.
+func releaseHold(ctx context.Context, tx pgx.Tx, hold *Hold, status string, now time.Time) error {
+	_, err := tx.Exec(ctx, `UPDATE balances
+								SET balance = balance + $1, held = GREATEST(held - $1, 0)
+								WHERE user_id = $2`, hold.Sum, hold.UserID)
+	if err != nil {
+		return fmt.Errorf("can not update balance: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE point_lots
+								SET remaining = LEAST(point_lots.remaining + hold_lots.sum, point_lots.amount)
+								FROM hold_lots
+								WHERE hold_lots.hold_id = $1 AND point_lots.lot_id = hold_lots.lot_id`, hold.HoldID)
+	if err != nil {
+		return fmt.Errorf("can not restore point lots: %w", err)
+	}
+
+	return finishHold(ctx, tx, hold, status, now)
+}
+
+func finishHold(ctx context.Context, tx pgx.Tx, hold *Hold, status string, now time.Time) error {
+	_, err := tx.Exec(ctx, `UPDATE holds SET status = $1, finished_at = $2 WHERE hold_id = $3`,
+		status, now, hold.HoldID)
+	if err != nil {
+		return fmt.Errorf("can not update hold: %w", err)
+	}
+	hold.Status = status
+	hold.FinishedAt = &now
+	return nil
+}
+
+func transferError(err error, message string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.ConstraintName {
+		case constraintBalancesBalance:
+			return ErrNotEnoughBalance
+		case constraintTransfersSum:
+			return ErrInvalidSum
+		}
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
+
+func addAdminAction(ctx context.Context, tx pgx.Tx, action AdminAction) error {
+	_, err := tx.Exec(ctx, `INSERT INTO admin_actions
+								(admin_id, user_id, action, order_id, amount, reason, comment, created_at)
+								VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		action.AdminID, action.UserID, action.Action, toNullString(action.OrderNumber), action.Amount,
+		toNullString(action.Reason), toNullString(action.Comment), time.Now())
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == constraintAdminActionsUsers {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("can not add admin action: %w", err)
+	}
+	return nil
+}
+
+func addPointLot(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID uuid.UUID,
+	orderNumber string,
+	amount float64,
+	expiresAt *time.Time,
+) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `INSERT INTO point_lots (user_id, order_id, amount, remaining, accrued_at, expires_at)
+								VALUES ($1, $2, $3, $3, $4, $5)`,
+		userID, toNullString(orderNumber), amount, time.Now(), expiresAt)
+	if err != nil {
+		return fmt.Errorf("can not add point lot: %w", err)
+	}
+	return nil
+}
+
+// lotPortion is the part of a point lot taken by a debit.
+type lotPortion struct {
+	expiresAt *time.Time
+	lotID     int64
+	sum       float64
+}
+
+// addPortionLots credits portions taken from other lots as new lots of the
+// user that keep the expiry of the lots they were taken from.
+func addPortionLots(ctx context.Context, tx pgx.Tx, userID uuid.UUID, orderNumber string, portions []lotPortion) error {
+	for _, portion := range portions {
+		err := addPointLot(ctx, tx, userID, orderNumber, portion.sum, portion.expiresAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumePointLots takes sum from the lots of the user closest to expiry
+// first, lots that never expire last. The balance row must already be locked
+// by the caller.
+func consumePointLots(ctx context.Context, tx pgx.Tx, userID uuid.UUID, sum float64) ([]lotPortion, error) {
+	rows, err := tx.Query(ctx, `SELECT lot_id, remaining, expires_at
+								FROM point_lots
+								WHERE user_id = $1 AND remaining > 0
+								ORDER BY expires_at NULLS LAST, accrued_at, lot_id
+								FOR UPDATE`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not get point lots: %w", err)
+	}
+	var lots []lotPortion
+	for rows.Next() {
+		var lot lotPortion
+		err = rows.Scan(&lot.lotID, &lot.sum, &lot.expiresAt)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("can not read point lot: %w", err)
+		}
+		lots = append(lots, lot)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("can not read rows: %w", rows.Err())
+	}
+
+	var portions []lotPortion
+	for _, lot := range lots {
+		if sum <= 0 {
+			break
+		}
+		taken := min(lot.sum, sum)
+		remaining := lot.sum - taken
+		if taken == lot.sum {
+			remaining = 0
+		}
+		_, err = tx.Exec(ctx, `UPDATE point_lots SET remaining = $1 WHERE lot_id = $2`, remaining, lot.lotID)
+		if err != nil {
+			return nil, fmt.Errorf("can not update point lot: %w", err)
+		}
+		portions = append(portions, lotPortion{expiresAt: lot.expiresAt, lotID: lot.lotID, sum: taken})
+		sum -= taken
+	}
+
+	return portions, nil
+}
+
+func expirePointLots(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID uuid.UUID,
+	lotIDs []int64,
+	now time.Time,
+) ([]PointExpiration, error) {
+	_, err := tx.Exec(ctx, `SELECT 1 FROM balances WHERE user_id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not lock balance: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `WITH expired AS (
+									SELECT lot_id, order_id, remaining
+									FROM point_lots
+									WHERE lot_id = ANY($1) AND remaining > 0
+									FOR UPDATE
+								)
+								UPDATE point_lots
+								SET remaining = 0
+								FROM expired
+								WHERE point_lots.lot_id = expired.lot_id
+								RETURNING expired.lot_id, expired.order_id, expired.remaining`, lotIDs)
+	if err != nil {
+		return nil, fmt.Errorf("can not expire point lots: %w", err)
+	}
+	var expiredLots []int64
+	var expirations []PointExpiration
+	var sum float64
+	for rows.Next() {
+		var lotID int64
+		var orderNumber *string
+		expiration := PointExpiration{
+			ExpiredAt: now,
+			UserID:    userID,
+		}
+		err = rows.Scan(&lotID, &orderNumber, &expiration.Sum)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("can not read point lot: %w", err)
+		}
+		expiration.Order = fromNullString(orderNumber)
+		expiredLots = append(expiredLots, lotID)
+		expirations = append(expirations, expiration)
+		sum += expiration.Sum
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("can not read rows: %w", rows.Err())
+	}
+	if len(expirations) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE balances SET balance = GREATEST(balance - $1, 0) WHERE user_id = $2`, sum, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not update balance: %w", err)
+	}
+
+	for i, expiration := range expirations {
+		_, err = tx.Exec(ctx, `INSERT INTO point_expirations (lot_id, user_id, sum, expired_at)
+								VALUES ($1, $2, $3, $4)`, expiredLots[i], userID, expiration.Sum, now)
+		if err != nil {
+			return nil, fmt.Errorf("can not add point expiration: %w", err)
+		}
+	}
+
+	return expirations, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+func toNullString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func fromNullString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+const campaignColumns = `campaign_id, name, starts_at, ends_at, tiers, user_ids, multiplier, bonus, budget, spent,
+								created_by, created_at`
+
+func (d *DBRepository) AddCampaign(ctx context.Context, campaign Campaign) error {
+	tiers := campaign.Tiers
+	if tiers == nil {
+		tiers = []string{}
+	}
+	userIDs := campaign.UserIDs
+	if userIDs == nil {
+		userIDs = []uuid.UUID{}
+	}
+
+	_, err := d.pool.Exec(ctx, `INSERT INTO campaigns (campaign_id, name, starts_at, ends_at, tiers, user_ids,
+									multiplier, bonus, budget, created_by, created_at)
+								VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		campaign.CampaignID,
+		campaign.Name,
+		campaign.StartsAt,
+		campaign.EndsAt,
+		tiers,
+		userIDs,
+		campaign.Multiplier,
+		campaign.Bonus,
+		campaign.Budget,
+		campaign.CreatedBy,
+		campaign.CreatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.ConstraintName {
+			case constraintCampaignsUsers:
+				return ErrUserNotFound
+			case constraintCampaignsPeriod, constraintCampaignsRule:
+				return ErrInvalidCampaign
+			}
+		}
+		return fmt.Errorf("can not add campaign: %w", err)
+	}
+
+	return nil
+}
+
+func (d *DBRepository) EndCampaign(ctx context.Context, campaignID uuid.UUID, now time.Time) (*Campaign, error) {
+	campaign, err := scanCampaign(d.pool.QueryRow(ctx, `UPDATE campaigns
+								SET ends_at = GREATEST($1, starts_at)
+								WHERE campaign_id = $2 AND ends_at > $1
+								RETURNING `+campaignColumns, now, campaignID))
+	if err == nil {
+		return campaign, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	var exists bool
+	err = d.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM campaigns WHERE campaign_id = $1)`, campaignID).
+		Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("can not get campaign: %w", err)
+	}
+	if exists {
+		return nil, ErrCampaignEnded
+	}
+	return nil, ErrCampaignNotFound
+}
+
+func (d *DBRepository) GetCampaigns(ctx context.Context) ([]Campaign, error) {
+	rows, err := d.pool.Query(ctx, `SELECT `+campaignColumns+`
+								FROM campaigns
+								ORDER BY starts_at DESC, campaign_id`)
+	if err != nil {
+		return nil, fmt.Errorf("can not get campaigns: %w", err)
+	}
+
+	campaigns, err := scanCampaigns(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(campaigns) == 0 {
+		return nil, ErrNoCampaigns
+	}
+
+	return campaigns, nil
+}
+
+func (d *DBRepository) GetCampaignBonuses(ctx context.Context, userID uuid.UUID) ([]CampaignBonus, error) {
+	var result []CampaignBonus
+	err := d.replicas.Read(ctx, userID, func(pool *Pool) error {
+		rows, err := pool.Query(ctx, `SELECT b.campaign_id, c.name, b.user_id, b.order_id, b.sum, b.created_at
+								FROM campaign_bonuses b
+								JOIN campaigns c ON c.campaign_id = b.campaign_id
+								WHERE b.user_id = $1
+								ORDER BY b.created_at, b.bonus_id`, userID)
+		if err != nil {
+			return fmt.Errorf("can not get campaign bonuses: %w", err)
+		}
+		defer rows.Close()
+
+		result = nil
+		for rows.Next() {
+			var bonus CampaignBonus
+			err = rows.Scan(
+				&bonus.CampaignID,
+				&bonus.CampaignName,
+				&bonus.UserID,
+				&bonus.Order,
+				&bonus.Sum,
+				&bonus.CreatedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("can not read campaign bonus: %w", err)
+			}
+			result = append(result, bonus)
+		}
+		if rows.Err() != nil {
+			return fmt.Errorf("can not read rows: %w", rows.Err())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// applyCampaigns credits the bonuses of the campaigns running when an order
+// is processed. The campaigns are locked in a fixed order, so concurrent
+// orders can neither spend more than a budget nor deadlock.
+func applyCampaigns(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID uuid.UUID,
+	orderNumber string,
+	accrual float64,
+	now time.Time,
+	expiresAt *time.Time,
+) error {
+	var tier string
+	err := tx.QueryRow(ctx, `SELECT tier FROM users WHERE user_id = $1`, userID).Scan(&tier)
+	if err != nil {
+		return fmt.Errorf("can not get tier: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `SELECT `+campaignColumns+`
+								FROM campaigns
+								WHERE starts_at <= $1 AND ends_at > $1
+									AND (budget IS NULL OR spent < budget)
+								ORDER BY campaign_id
+								FOR UPDATE`, now)
+	if err != nil {
+		return fmt.Errorf("can not get campaigns: %w", err)
+	}
+	campaigns, err := scanCampaigns(rows)
+	if err != nil {
+		return err
+	}
+
+	var total float64
+	for _, campaign := range campaigns {
+		if !campaign.eligible(userID, tier, now) {
+			continue
+		}
+		bonus := campaign.bonus(accrual)
+		if bonus <= 0 {
+			continue
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE campaigns SET spent = spent + $1 WHERE campaign_id = $2`,
+			bonus, campaign.CampaignID)
+		if err != nil {
+			return fmt.Errorf("can not update campaign: %w", err)
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO campaign_bonuses (campaign_id, user_id, order_id, sum, created_at)
+								VALUES ($1, $2, $3, $4, $5)`, campaign.CampaignID, userID, orderNumber, bonus, now)
+		if err != nil {
+			return fmt.Errorf("can not add campaign bonus: %w", err)
+		}
+		err = addPointLot(ctx, tx, userID, orderNumber, bonus, expiresAt)
+		if err != nil {
+			return err
+		}
+		total += bonus
+	}
+	if total == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE balances SET balance = balance + $1 WHERE user_id = $2`, total, userID)
+	if err != nil {
+		return fmt.Errorf("can not update balance: %w", err)
+	}
+
+	return nil
+}
+
+func scanCampaigns(rows pgx.Rows) ([]Campaign, error) {
+	defer rows.Close()
+
+	var campaigns []Campaign
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, *campaign)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("can not read rows: %w", rows.Err())
+	}
+
+	return campaigns, nil
+}
+
+func scanCampaign(row pgx.Row) (*Campaign, error) {
+	var campaign Campaign
+	err := row.Scan(
+		&campaign.CampaignID,
+		&campaign.Name,
+		&campaign.StartsAt,
+		&campaign.EndsAt,
+		&campaign.Tiers,
+		&campaign.UserIDs,
+		&campaign.Multiplier,
+		&campaign.Bonus,
+		&campaign.Budget,
+		&campaign.Spent,
+		&campaign.CreatedBy,
+		&campaign.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("can not read campaign: %w", err)
+	}
+	return &campaign, nil
+}
+
+// rewardReferral credits the referral bonuses when the first order of a
+// referred user is processed and returns the referrer.
+func rewardReferral(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID uuid.UUID,
+	orderNumber string,
+	now time.Time,
+	expiresAt *time.Time,
+) (*uuid.UUID, error) {
+	var referrerID uuid.UUID
+	var referrerBonus, refereeBonus float64
+	err := tx.QueryRow(ctx, `UPDATE referrals SET rewarded_at = $1, order_id = $2
+								WHERE referee_id = $3 AND rewarded_at IS NULL
+								RETURNING referrer_id, referrer_bonus, referee_bonus`, now, orderNumber, userID).
+		Scan(&referrerID, &referrerBonus, &refereeBonus)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("can not reward referral: %w", err)
+	}
+
+	credits := []struct {
+		userID      uuid.UUID
+		orderNumber string
+		bonus       float64
+	}{
+		{userID: userID, orderNumber: orderNumber, bonus: refereeBonus},
+		{userID: referrerID, bonus: referrerBonus},
+	}
+	for _, credit := range credits {
+		if credit.bonus <= 0 {
+			continue
+		}
+		_, err = tx.Exec(ctx, `UPDATE balances SET balance = balance + $1 WHERE user_id = $2`,
+			credit.bonus, credit.userID)
+		if err != nil {
+			return nil, fmt.Errorf("can not update balance: %w", err)
+		}
+		err = addPointLot(ctx, tx, credit.userID, credit.orderNumber, credit.bonus, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &referrerID, nil
+}
+
+func (d *DBRepository) GetReferrals(ctx context.Context, userID uuid.UUID) (*Referrals, error) {
+	var result *Referrals
+	err := d.replicas.Read(ctx, userID, func(pool *Pool) error {
+		result = &Referrals{}
+		err := pool.QueryRow(ctx, `SELECT referral_code FROM users WHERE user_id = $1`, userID).Scan(&result.Code)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("can not get referral code: %w", err)
+		}
+
+		rows, err := pool.Query(ctx, `SELECT r.referee_id, referee.login, r.referrer_id, referrer.login,
+										r.referrer_bonus, r.referee_bonus, r.created_at, r.rewarded_at
+									FROM referrals r
+									JOIN users referee ON referee.user_id = r.referee_id
+									JOIN users referrer ON referrer.user_id = r.referrer_id
+									WHERE r.referrer_id = $1 OR r.referee_id = $1
+									ORDER BY r.created_at DESC, r.referee_id`, userID)
+		if err != nil {
+			return fmt.Errorf("can not get referrals: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var referral Referral
+			err = rows.Scan(
+				&referral.RefereeID,
+				&referral.RefereeLogin,
+				&referral.ReferrerID,
+				&referral.ReferrerLogin,
+				&referral.ReferrerBonus,
+				&referral.RefereeBonus,
+				&referral.CreatedAt,
+				&referral.RewardedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("can not read referral: %w", err)
+			}
+			if referral.RefereeID == userID {
+				result.ReferredBy = &referral
+				continue
+			}
+			result.Referrals = append(result.Referrals, referral)
+		}
+		if rows.Err() != nil {
+			return fmt.Errorf("can not read rows: %w", rows.Err())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *DBRepository) AddMerchant(ctx context.Context, merchant Merchant) error {
+	_, err := d.pool.Exec(ctx, `INSERT INTO merchants (merchant_id, name, order_prefix, accrual_address, rate_limit,
+									created_at)
+								VALUES ($1, $2, $3, $4, $5, $6)`,
+		merchant.MerchantID,
+		merchant.Name,
+		merchant.OrderPrefix,
+		merchant.AccrualAddress,
+		merchant.RateLimit,
+		merchant.CreatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.ConstraintName {
+			case constraintMerchantsPK, constraintMerchantsPrefix:
+				return ErrMerchantExists
+			case constraintMerchantsDigits, constraintMerchantsRate:
+				return ErrInvalidMerchant
+			}
+		}
+		return fmt.Errorf("can not add merchant: %w", err)
+	}
+
+	return nil
+}
+
+func (d *DBRepository) GetMerchants(ctx context.Context) ([]Merchant, error) {
+	rows, err := d.pool.Query(ctx, `SELECT merchant_id, name, order_prefix, accrual_address, rate_limit, created_at
+								FROM merchants
+								ORDER BY merchant_id`)
+	if err != nil {
+		return nil, fmt.Errorf("can not get merchants: %w", err)
+	}
+	defer rows.Close()
+
+	var merchants []Merchant
+	for rows.Next() {
+		var merchant Merchant
+		err = rows.Scan(
+			&merchant.MerchantID,
+			&merchant.Name,
+			&merchant.OrderPrefix,
+			&merchant.AccrualAddress,
+			&merchant.RateLimit,
+			&merchant.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("can not read merchant: %w", err)
+		}
+		merchants = append(merchants, merchant)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("can not read rows: %w", rows.Err())
+	}
+	if len(merchants) == 0 {
+		return nil, ErrNoMerchants
+	}
+
+	return merchants, nil
+}
+
+// statementQuery lists the balance changes of a user from the tables recording
+// them. The running balance covers the changes before from as well. Entries
+// at the same moment are ordered by priority, so the balance is stable.
+const statementQuery = `WITH entries AS (
+		SELECT 1 AS priority, $6::text AS type, order_id, accrual AS amount,
+			COALESCE(processed_at, uploaded_at) AS created_at
+		FROM orders
+		WHERE user_id = $1 AND status = $4 AND accrual > 0
+		UNION ALL
+		SELECT 2, $7::text, order_id, sum, created_at
+		FROM campaign_bonuses
+		WHERE user_id = $1
+		UNION ALL
+		SELECT 3, $8::text, NULL, referee_bonus, rewarded_at
+		FROM referrals
+		WHERE referee_id = $1 AND rewarded_at IS NOT NULL AND referee_bonus > 0
+		UNION ALL
+		SELECT 3, $8::text, NULL, referrer_bonus, rewarded_at
+		FROM referrals
+		WHERE referrer_id = $1 AND rewarded_at IS NOT NULL AND referrer_bonus > 0
+		UNION ALL
+		SELECT 4, $9::text, order_id, amount, created_at
+		FROM admin_actions
+		WHERE user_id = $1 AND action = $5 AND amount IS NOT NULL
+		UNION ALL
+		SELECT 5, $10::text, NULL, sum, processed_at
+		FROM transfers
+		WHERE to_user_id = $1
+		UNION ALL
+		SELECT 6, $11::text, NULL, -sum, processed_at
+		FROM transfers
+		WHERE from_user_id = $1
+		UNION ALL
+		SELECT 7, $12::text, order_id, -sum, processed_at
+		FROM withdrawals
+		WHERE user_id = $1 AND NOT EXISTS (
+			SELECT 1
+			FROM holds
+			WHERE holds.user_id = $1 AND holds.order_id = withdrawals.order_id AND holds.status = $17
+		)
+		UNION ALL
+		SELECT 8, $13::text, withdrawals.order_id, reversals.sum, reversals.created_at
+		FROM reversals
+		JOIN withdrawals ON withdrawals.withdrawal_id = reversals.withdrawal_id
+		WHERE withdrawals.user_id = $1
+		UNION ALL
+		SELECT 9, $14::text, point_lots.order_id, -point_expirations.sum, point_expirations.expired_at
+		FROM point_expirations
+		JOIN point_lots ON point_lots.lot_id = point_expirations.lot_id
+		WHERE point_expirations.user_id = $1
+		UNION ALL
+		SELECT 10, $15::text, order_id, -sum, created_at
+		FROM holds
+		WHERE user_id = $1
+		UNION ALL
+		SELECT 11, $16::text, order_id, sum, finished_at
+		FROM holds
+		WHERE user_id = $1 AND finished_at IS NOT NULL AND status <> $17
+	), ledger AS (
+		SELECT created_at, priority, type, COALESCE(order_id, '') AS order_id, amount,
+			round(SUM(amount::numeric) OVER (ORDER BY created_at, priority, COALESCE(order_id, ''), amount
+				ROWS UNBOUNDED PRECEDING), 2) AS balance
+		FROM entries
+	)
+	SELECT created_at, type, order_id, amount, balance
+	FROM ledger
+	WHERE ($2::timestamptz IS NULL OR created_at >= $2) AND ($3::timestamptz IS NULL OR created_at < $3)
+	ORDER BY created_at, priority, order_id, amount`
+
+// GetStatement streams the statement rows to handle as they are read, so
+// statements are never loaded whole.
+func (d *DBRepository) GetStatement(
+	ctx context.Context,
+	userID uuid.UUID,
+	from *time.Time,
+	to *time.Time,
+	handle func(entry StatementEntry) error,
+) error {
+	// Rows already handled can not be taken back, so a replica failing midway
+	// must not be read again from the primary.
+	var streamErr error
+	return d.replicas.Read(ctx, userID, func(pool *Pool) error {
+		if streamErr != nil {
+			return streamErr
+		}
+		var handled bool
+		err := d.getStatement(ctx, pool, userID, from, to, func(entry StatementEntry) error {
+			handled = true
+			return handle(entry)
+		})
+		if handled {
+			streamErr = err
+		}
+		return err
+	})
+}
+
+func (d *DBRepository) getStatement(
+	ctx context.Context,
+	pool *Pool,
+	userID uuid.UUID,
+	from *time.Time,
+	to *time.Time,
+	handle func(entry StatementEntry) error,
+) error {
+	rows, err := pool.Query(ctx, statementQuery,
+		userID,
+		from,
+		to,
+		models.StatusProcessed,
+		models.AdminActionAdjustBalance,
+		models.StatementAccrual,
+		models.StatementCampaignBonus,
+		models.StatementReferralBonus,
+		models.StatementAdjustment,
+		models.StatementTransferIn,
+		models.StatementTransferOut,
+		models.StatementWithdrawal,
+		models.StatementReversal,
+		models.StatementExpiration,
+		models.StatementHold,
+		models.StatementHoldRelease,
+		models.HoldCaptured,
+	)
+	if err != nil {
+		return fmt.Errorf("can not get statement: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry StatementEntry
+		err = rows.Scan(&entry.CreatedAt, &entry.Type, &entry.Order, &entry.Amount, &entry.Balance)
+		if err != nil {
+			return fmt.Errorf("can not read statement entry: %w", err)
+		}
+		err = handle(entry)
+		if err != nil {
+			return err
+		}
+	}
+	if rows.Err() != nil {
+		return fmt.Errorf("can not read rows: %w", rows.Err())
+	}
+
+	return nil
 }
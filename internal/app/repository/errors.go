@@ -71,3 +71,59 @@ func NewErrInvalidOrderNumber(order string) error {
 func (e *ErrInvalidOrderNumber) Error() string {
 	return fmt.Sprintf("invalid order number %s", e.order)
 }
+
+type ErrWithdrawalAlreadyExists struct {
+	order string
+}
+
+func NewErrWithdrawalAlreadyExists(order string) error {
+	return &ErrWithdrawalAlreadyExists{
+		order: order,
+	}
+}
+
+func (e *ErrWithdrawalAlreadyExists) Error() string {
+	return fmt.Sprintf("withdrawal for order %s already exists", e.order)
+}
+
+type ErrInvalidOrderStatus struct {
+	status string
+}
+
+func NewErrInvalidOrderStatus(status string) error {
+	return &ErrInvalidOrderStatus{
+		status: status,
+	}
+}
+
+func (e *ErrInvalidOrderStatus) Error() string {
+	return fmt.Sprintf("invalid order status %s", e.status)
+}
+
+type ErrInvalidRole struct {
+	role string
+}
+
+func NewErrInvalidRole(role string) error {
+	return &ErrInvalidRole{
+		role: role,
+	}
+}
+
+func (e *ErrInvalidRole) Error() string {
+	return fmt.Sprintf("invalid role %s", e.role)
+}
+
+type ErrInvalidReason struct {
+	reason string
+}
+
+func NewErrInvalidReason(reason string) error {
+	return &ErrInvalidReason{
+		reason: reason,
+	}
+}
+
+func (e *ErrInvalidReason) Error() string {
+	return fmt.Sprintf("invalid reason %s", e.reason)
+}
@@ -0,0 +1,1545 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/external"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type MemoryRepository struct {
+	logger         *zap.Logger
+	users          map[string]User
+	orders         map[string]Order
+	balances       map[uuid.UUID]Balance
+	withdrawals    map[uuid.UUID][]Withdraw
+	withdrawn      map[string]struct{}
+	actions        []AdminAction
+	lots           map[uuid.UUID][]PointLot
+	expirations    []PointExpiration
+	transfers      []Transfer
+	reversals      map[string]Reversal
+	holds          map[uuid.UUID]Hold
+	holdLots       map[uuid.UUID][]lotPortion
+	withdrawalLots map[string][]lotPortion
+	tiers          map[uuid.UUID]string
+	processedAt    map[string]time.Time
+	baseAccrual    map[string]float64
+	campaigns      map[uuid.UUID]Campaign
+	bonuses        []CampaignBonus
+	referrals      map[uuid.UUID]Referral
+	merchants      map[string]Merchant
+	m              sync.RWMutex
+}
+
+func NewMemoryRepository(logger *zap.Logger) *MemoryRepository {
+	return &MemoryRepository{
+		logger:         logger,
+		users:          make(map[string]User),
+		orders:         make(map[string]Order),
+		balances:       make(map[uuid.UUID]Balance),
+		withdrawals:    make(map[uuid.UUID][]Withdraw),
+		withdrawn:      make(map[string]struct{}),
+		lots:           make(map[uuid.UUID][]PointLot),
+		reversals:      make(map[string]Reversal),
+		holds:          make(map[uuid.UUID]Hold),
+		holdLots:       make(map[uuid.UUID][]lotPortion),
+		withdrawalLots: make(map[string][]lotPortion),
+		tiers:          make(map[uuid.UUID]string),
+		processedAt:    make(map[string]time.Time),
+		baseAccrual:    make(map[string]float64),
+		campaigns:      make(map[uuid.UUID]Campaign),
+		referrals:      make(map[uuid.UUID]Referral),
+		merchants:      make(map[string]Merchant),
+	}
+}
+
+func (r *MemoryRepository) Registration(
+	_ context.Context,
+	login string,
+	hash string,
+	salt string,
+	userID uuid.UUID,
+	referralCode string,
+	referral *ReferralPolicy,
+) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if _, ok := r.users[login]; ok {
+		return NewErrOriginalLoginUniqueViolation(login)
+	}
+	if _, ok := r.balances[userID]; ok {
+		return NewErrOriginalLoginUniqueViolation(login)
+	}
+	if _, ok := r.userByReferralCode(referralCode); ok {
+		return ErrReferralCodeUsed
+	}
+
+	var newReferral *Referral
+	if referral != nil {
+		var err error
+		newReferral, err = r.newReferral(userID, referral)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.users[login] = User{
+		Login:        login,
+		Hash:         hash,
+		Salt:         salt,
+		Role:         string(models.RoleUser),
+		ReferralCode: referralCode,
+		UserID:       userID,
+	}
+	r.balances[userID] = Balance{}
+	if newReferral != nil {
+		r.referrals[userID] = *newReferral
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) newReferral(userID uuid.UUID, referral *ReferralPolicy) (*Referral, error) {
+	referrer, ok := r.userByReferralCode(referral.Code)
+	if !ok || referrer.Disabled {
+		return nil, ErrReferralCode
+	}
+
+	var recent, rewarded int
+	for _, item := range r.referrals {
+		if item.ReferrerID != referrer.UserID {
+			continue
+		}
+		if !item.CreatedAt.Before(referral.Since) {
+			recent++
+		}
+		if item.ReferrerBonus > 0 {
+			rewarded++
+		}
+	}
+	if referral.DailyLimit > 0 && recent >= referral.DailyLimit {
+		return nil, ErrReferralLimit
+	}
+	referrerBonus := referral.Bonus
+	if referral.MaxRewards > 0 && rewarded >= referral.MaxRewards {
+		referrerBonus = 0
+	}
+
+	return &Referral{
+		CreatedAt:     time.Now(),
+		ReferrerBonus: referrerBonus,
+		RefereeBonus:  referral.Bonus,
+		RefereeID:     userID,
+		ReferrerID:    referrer.UserID,
+	}, nil
+}
+
+func (r *MemoryRepository) GetUser(_ context.Context, login string) (*User, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	user, ok := r.users[login]
+	if !ok {
+		return nil, NewErrInvalidAuthData(login)
+	}
+
+	return &user, nil
+}
+
+func (r *MemoryRepository) SetUserRole(_ context.Context, login string, role string, merchantID string) error {
+	if !models.Role(role).Valid() {
+		return NewErrInvalidRole(role)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	user, ok := r.users[login]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Role = role
+	user.MerchantID = nil
+	if merchantID != "" {
+		if _, ok := r.merchants[merchantID]; !ok {
+			return ErrMerchantNotFound
+		}
+		user.MerchantID = &merchantID
+	}
+	r.users[login] = user
+
+	return nil
+}
+
+func (r *MemoryRepository) AddOrder(
+	_ context.Context,
+	orderNumber string,
+	merchantID string,
+	userID uuid.UUID,
+) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if order, ok := r.orders[orderNumber]; ok {
+		if order.UserID == userID {
+			return NewErrAlreadyAdded(orderNumber)
+		}
+		return NewErrAlreadyAddedByAnotherUser(orderNumber)
+	}
+	if _, ok := r.balances[userID]; !ok {
+		return ErrUserNotFound
+	}
+	merchant, err := r.orderMerchant(orderNumber, merchantID)
+	if err != nil {
+		return err
+	}
+
+	r.orders[orderNumber] = Order{
+		UploadedAt: time.Now(),
+		MerchantID: merchant,
+		Number:     orderNumber,
+		Status:     string(models.StatusNew),
+		UserID:     userID,
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) AddOrders(
+	_ context.Context,
+	orderNumbers []string,
+	merchantID string,
+	userID uuid.UUID,
+) ([]error, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if _, ok := r.balances[userID]; !ok {
+		return nil, ErrUserNotFound
+	}
+	if _, ok := r.merchants[merchantID]; merchantID != "" && !ok {
+		return nil, ErrMerchantNotFound
+	}
+
+	now := time.Now()
+	results := make([]error, len(orderNumbers))
+	for index, orderNumber := range orderNumbers {
+		if order, ok := r.orders[orderNumber]; ok {
+			results[index] = NewErrAlreadyAddedByAnotherUser(orderNumber)
+			if order.UserID == userID {
+				results[index] = NewErrAlreadyAdded(orderNumber)
+			}
+			continue
+		}
+
+		merchant, err := r.orderMerchant(orderNumber, merchantID)
+		if err != nil {
+			return nil, err
+		}
+		r.orders[orderNumber] = Order{
+			UploadedAt: now,
+			MerchantID: merchant,
+			Number:     orderNumber,
+			Status:     string(models.StatusNew),
+			UserID:     userID,
+		}
+	}
+
+	return results, nil
+}
+
+func (r *MemoryRepository) GetOrders(_ context.Context, userID uuid.UUID) ([]Order, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var orders []Order
+	for _, order := range r.orders {
+		if order.UserID != userID {
+			continue
+		}
+		order.Accrual = copyFloat(order.Accrual)
+		order.MerchantID = copyString(order.MerchantID)
+		orders = append(orders, order)
+	}
+	if len(orders) == 0 {
+		return nil, ErrNoOrders
+	}
+
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].UploadedAt.Before(orders[j].UploadedAt)
+	})
+
+	return orders, nil
+}
+
+func (r *MemoryRepository) GetBalance(_ context.Context, userID uuid.UUID) (*Balance, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	balance, ok := r.balances[userID]
+	if !ok {
+		return nil, fmt.Errorf("can not get balance: no balance for user %s", userID)
+	}
+
+	return &balance, nil
+}
+
+func (r *MemoryRepository) Withdraw(_ context.Context, orderNumber string, sum float64, userID uuid.UUID) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if sum <= 0 {
+		return ErrInvalidSum
+	}
+	balance, ok := r.balances[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	if balance.Current-sum < 0 {
+		return ErrNotEnoughBalance
+	}
+	if _, ok := r.withdrawn[orderNumber]; ok {
+		return NewErrWithdrawalAlreadyExists(orderNumber)
+	}
+
+	balance.Current -= sum
+	balance.Withdrawn += sum
+	r.balances[userID] = balance
+
+	r.withdrawn[orderNumber] = struct{}{}
+	r.withdrawals[userID] = append(r.withdrawals[userID], Withdraw{
+		ProcessedAt: time.Now(),
+		Order:       orderNumber,
+		Sum:         sum,
+	})
+	r.withdrawalLots[orderNumber] = r.consumePointLots(userID, sum)
+
+	return nil
+}
+
+func (r *MemoryRepository) GetWithdrawals(_ context.Context, userID uuid.UUID) ([]Withdraw, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	if len(r.withdrawals[userID]) == 0 {
+		return nil, ErrNoWithdrawals
+	}
+
+	withdrawals := make([]Withdraw, len(r.withdrawals[userID]))
+	copy(withdrawals, r.withdrawals[userID])
+
+	return withdrawals, nil
+}
+
+func (r *MemoryRepository) GetOrdersForUpdate(_ context.Context, merchantID string, limit int) ([]Order, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var orders []Order
+	for _, order := range r.orders {
+		if order.Status != string(models.StatusNew) {
+			continue
+		}
+		if (order.MerchantID == nil && merchantID != "") ||
+			(order.MerchantID != nil && *order.MerchantID != merchantID) {
+			continue
+		}
+		orders = append(orders, Order{
+			UploadedAt: order.UploadedAt,
+			MerchantID: copyString(order.MerchantID),
+			Number:     order.Number,
+			UserID:     order.UserID,
+		})
+	}
+
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].UploadedAt.After(orders[j].UploadedAt)
+	})
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+
+	return orders, nil
+}
+
+func (r *MemoryRepository) UpdateOrder(
+	_ context.Context,
+	orderNumber string,
+	status string,
+	accrual *float64,
+	userID uuid.UUID,
+	expiresAt *time.Time,
+	tiers *TierPolicy,
+) error {
+	switch models.Status(status) {
+	case models.StatusNew, models.StatusProcessing, models.StatusInvalid, models.StatusProcessed:
+	default:
+		return NewErrInvalidOrderStatus(status)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	order, ok := r.orders[orderNumber]
+	if !ok || order.Status == string(external.StatusProcessed) {
+		return nil
+	}
+	processed := status == string(external.StatusProcessed)
+	now := time.Now()
+
+	var loyalty *LoyaltyStatus
+	baseAccrual := accrual
+	if processed && accrual != nil && tiers != nil {
+		loyalty = r.loyaltyStatus(userID, tiers.Since)
+		credited := tiers.accrual(loyalty.Accrued, *accrual)
+		accrual = &credited
+	}
+
+	order.Status = status
+	order.Accrual = copyFloat(accrual)
+	r.orders[orderNumber] = order
+	delete(r.processedAt, orderNumber)
+	delete(r.baseAccrual, orderNumber)
+	if processed {
+		r.processedAt[orderNumber] = now
+		if baseAccrual != nil {
+			r.baseAccrual[orderNumber] = *baseAccrual
+		}
+	}
+
+	if processed && accrual != nil {
+		balance, ok := r.balances[userID]
+		if ok {
+			balance.Current += *accrual
+			r.balances[userID] = balance
+			r.addPointLot(userID, orderNumber, *accrual, expiresAt)
+		}
+	}
+
+	if loyalty != nil {
+		r.tiers[userID] = tiers.Tiers[tiers.Tiers.ForAccrual(loyalty.Accrued+*baseAccrual)].Name
+	}
+
+	if processed && accrual != nil {
+		r.applyCampaigns(userID, orderNumber, *accrual, now, expiresAt)
+	}
+
+	if processed {
+		r.rewardReferral(userID, orderNumber, now, expiresAt)
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) GetLoyaltyStatus(
+	_ context.Context,
+	userID uuid.UUID,
+	since time.Time,
+) (*LoyaltyStatus, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	if _, ok := r.userByID(userID); !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return r.loyaltyStatus(userID, since), nil
+}
+
+func (r *MemoryRepository) loyaltyStatus(userID uuid.UUID, since time.Time) *LoyaltyStatus {
+	status := &LoyaltyStatus{
+		Tier: r.tiers[userID],
+	}
+	for number, order := range r.orders {
+		if order.UserID != userID || order.Status != string(external.StatusProcessed) {
+			continue
+		}
+		processedAt, ok := r.processedAt[number]
+		if ok && !processedAt.Before(since) {
+			status.Accrued += r.baseAccrual[number]
+		}
+	}
+
+	return status
+}
+
+func (r *MemoryRepository) Close() {
+	r.logger.Debug("Memory repository closed")
+}
+
+func copyFloat(value *float64) *float64 {
+	if value == nil {
+		return nil
+	}
+	result := *value
+	return &result
+}
+
+func copyString(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	result := *value
+	return &result
+}
+
+func copyTime(value *time.Time) *time.Time {
+	if value == nil {
+		return nil
+	}
+	result := *value
+	return &result
+}
+
+func (r *MemoryRepository) SearchUsers(_ context.Context, loginPrefix string, limit int) ([]User, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var users []User
+	for _, user := range r.users {
+		if !strings.HasPrefix(user.Login, loginPrefix) {
+			continue
+		}
+		users = append(users, User{
+			Login:    user.Login,
+			Role:     user.Role,
+			UserID:   user.UserID,
+			Disabled: user.Disabled,
+		})
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Login < users[j].Login
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+
+	return users, nil
+}
+
+func (r *MemoryRepository) GetUserByID(_ context.Context, userID uuid.UUID) (*User, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	user, ok := r.userByID(userID)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return &User{
+		Login:      user.Login,
+		Role:       user.Role,
+		MerchantID: copyString(user.MerchantID),
+		UserID:     user.UserID,
+		Disabled:   user.Disabled,
+	}, nil
+}
+
+func (r *MemoryRepository) GetOrder(_ context.Context, orderNumber string) (*Order, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	order, ok := r.orders[orderNumber]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	order.Accrual = copyFloat(order.Accrual)
+	order.MerchantID = copyString(order.MerchantID)
+
+	return &order, nil
+}
+
+func (r *MemoryRepository) AdjustBalance(_ context.Context, action AdminAction, expiresAt *time.Time) error {
+	if action.UserID == nil || action.Amount == nil || *action.Amount == 0 {
+		return ErrInvalidSum
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	balance, ok := r.balances[*action.UserID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if balance.Current+*action.Amount < 0 {
+		return ErrNotEnoughBalance
+	}
+
+	balance.Current += *action.Amount
+	r.balances[*action.UserID] = balance
+	if *action.Amount > 0 {
+		r.addPointLot(*action.UserID, "", *action.Amount, expiresAt)
+	} else {
+		r.consumePointLots(*action.UserID, -*action.Amount)
+	}
+	r.addAdminAction(action)
+
+	return nil
+}
+
+func (r *MemoryRepository) SetUserDisabled(_ context.Context, action AdminAction, disabled bool) error {
+	if action.UserID == nil {
+		return ErrUserNotFound
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	user, ok := r.userByID(*action.UserID)
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Disabled = disabled
+	r.users[user.Login] = user
+	r.addAdminAction(action)
+
+	return nil
+}
+
+func (r *MemoryRepository) AddAdminAction(_ context.Context, action AdminAction) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if action.UserID != nil {
+		if _, ok := r.balances[*action.UserID]; !ok {
+			return ErrUserNotFound
+		}
+	}
+	r.addAdminAction(action)
+
+	return nil
+}
+
+func (r *MemoryRepository) GetAdminActions(_ context.Context, userID *uuid.UUID, limit int) ([]AdminAction, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var actions []AdminAction
+	for i := len(r.actions) - 1; i >= 0 && len(actions) < limit; i-- {
+		action := r.actions[i]
+		if userID != nil && (action.UserID == nil || *action.UserID != *userID) {
+			continue
+		}
+		action.Amount = copyFloat(action.Amount)
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
+
+func (r *MemoryRepository) GetExpiringPoints(_ context.Context, userID uuid.UUID, until time.Time) ([]PointLot, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var lots []PointLot
+	for _, lot := range r.lots[userID] {
+		if lot.Remaining <= 0 || lot.ExpiresAt == nil || lot.ExpiresAt.After(until) {
+			continue
+		}
+		lot.ExpiresAt = copyTime(lot.ExpiresAt)
+		lots = append(lots, lot)
+	}
+
+	sort.SliceStable(lots, func(i, j int) bool {
+		return lots[i].ExpiresAt.Before(*lots[j].ExpiresAt)
+	})
+
+	return lots, nil
+}
+
+func (r *MemoryRepository) ExpirePoints(_ context.Context, now time.Time, limit int) ([]PointExpiration, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	type expiredLot struct {
+		expiresAt time.Time
+		userID    uuid.UUID
+		index     int
+	}
+	var expired []expiredLot
+	for userID, lots := range r.lots {
+		for i, lot := range lots {
+			if lot.Remaining <= 0 || lot.ExpiresAt == nil || lot.ExpiresAt.After(now) {
+				continue
+			}
+			expired = append(expired, expiredLot{
+				expiresAt: *lot.ExpiresAt,
+				userID:    userID,
+				index:     i,
+			})
+		}
+	}
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].expiresAt.Before(expired[j].expiresAt)
+	})
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+
+	var expirations []PointExpiration
+	for _, value := range expired {
+		lot := &r.lots[value.userID][value.index]
+		expiration := PointExpiration{
+			ExpiredAt: now,
+			Order:     lot.Order,
+			Sum:       lot.Remaining,
+			UserID:    value.userID,
+		}
+		lot.Remaining = 0
+
+		balance := r.balances[value.userID]
+		balance.Current = max(balance.Current-expiration.Sum, 0)
+		r.balances[value.userID] = balance
+
+		r.expirations = append(r.expirations, expiration)
+		expirations = append(expirations, expiration)
+	}
+
+	return expirations, nil
+}
+
+func (r *MemoryRepository) Transfer(
+	_ context.Context,
+	fromUserID uuid.UUID,
+	toLogin string,
+	sum float64,
+	dailyLimit float64,
+) error {
+	if sum <= 0 {
+		return ErrInvalidSum
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	recipient, ok := r.users[toLogin]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if recipient.UserID == fromUserID {
+		return ErrSelfTransfer
+	}
+	if recipient.Disabled {
+		return ErrUserDisabled
+	}
+	sender, ok := r.userByID(fromUserID)
+	if !ok {
+		return ErrUserNotFound
+	}
+	balance, ok := r.balances[fromUserID]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	now := time.Now()
+	if dailyLimit > 0 {
+		var sent float64
+		for _, transfer := range r.transfers {
+			if transfer.FromUserID == fromUserID && transfer.ProcessedAt.After(now.Add(-24*time.Hour)) {
+				sent += transfer.Sum
+			}
+		}
+		if sent+sum > dailyLimit {
+			return ErrTransferLimit
+		}
+	}
+	if balance.Current-sum < 0 {
+		return ErrNotEnoughBalance
+	}
+
+	balance.Current -= sum
+	r.balances[fromUserID] = balance
+	recipientBalance := r.balances[recipient.UserID]
+	recipientBalance.Current += sum
+	r.balances[recipient.UserID] = recipientBalance
+
+	portions := r.consumePointLots(fromUserID, sum)
+	r.addPortionLots(recipient.UserID, "", portions)
+
+	r.transfers = append(r.transfers, Transfer{
+		ProcessedAt: now,
+		FromLogin:   sender.Login,
+		ToLogin:     recipient.Login,
+		Sum:         sum,
+		FromUserID:  fromUserID,
+		ToUserID:    recipient.UserID,
+	})
+
+	return nil
+}
+
+func (r *MemoryRepository) GetTransfers(_ context.Context, userID uuid.UUID) ([]Transfer, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var transfers []Transfer
+	for _, transfer := range r.transfers {
+		if transfer.FromUserID == userID || transfer.ToUserID == userID {
+			transfers = append(transfers, transfer)
+		}
+	}
+	if len(transfers) == 0 {
+		return nil, ErrNoTransfers
+	}
+
+	return transfers, nil
+}
+
+func (r *MemoryRepository) ReverseWithdrawal(
+	_ context.Context,
+	reversalID string,
+	orderNumber string,
+	sum *float64,
+	initiatorID uuid.UUID,
+	merchantID string,
+	expiresAt *time.Time,
+) (*Reversal, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var withdrawal *Withdraw
+	var userID uuid.UUID
+	for id, withdrawals := range r.withdrawals {
+		for i := range withdrawals {
+			if withdrawals[i].Order == orderNumber {
+				withdrawal = &withdrawals[i]
+				userID = id
+			}
+		}
+	}
+	if withdrawal == nil {
+		return nil, ErrNoWithdrawal
+	}
+	if merchantID != "" {
+		withdrawalMerchantID := r.existingOrderMerchant(orderNumber)
+		if withdrawalMerchantID == nil || *withdrawalMerchantID != merchantID {
+			return nil, ErrNoWithdrawal
+		}
+	}
+
+	if reversal, ok := r.reversals[reversalID]; ok {
+		if reversal.Order != orderNumber || (sum != nil && *sum != reversal.Sum) {
+			return nil, ErrReversalConflict
+		}
+		return &reversal, nil
+	}
+
+	reversedSum, err := reversalSum(withdrawal.Sum, withdrawal.Reversed, sum)
+	if err != nil {
+		return nil, err
+	}
+
+	withdrawal.Reversed = min(withdrawal.Reversed+reversedSum, withdrawal.Sum)
+	balance := r.balances[userID]
+	balance.Current += reversedSum
+	balance.Withdrawn = max(balance.Withdrawn-reversedSum, 0)
+	r.balances[userID] = balance
+	restored := r.restoreWithdrawalLots(userID, orderNumber, reversedSum)
+	r.addPointLot(userID, orderNumber, reversedSum-restored, expiresAt)
+
+	reversal := Reversal{
+		CreatedAt:   time.Now(),
+		ReversalID:  reversalID,
+		Order:       orderNumber,
+		Sum:         reversedSum,
+		UserID:      userID,
+		InitiatorID: initiatorID,
+	}
+	r.reversals[reversalID] = reversal
+
+	return &reversal, nil
+}
+
+func (r *MemoryRepository) AuthorizeHold(_ context.Context, hold Hold) error {
+	if hold.Sum <= 0 {
+		return ErrInvalidSum
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	balance, ok := r.balances[hold.UserID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if balance.Current-hold.Sum < 0 {
+		return ErrNotEnoughBalance
+	}
+	if _, ok := r.withdrawn[hold.Order]; ok {
+		return NewErrWithdrawalAlreadyExists(hold.Order)
+	}
+	for _, existing := range r.holds {
+		if existing.Order == hold.Order && existing.Status == string(models.HoldActive) {
+			return ErrHoldExists
+		}
+	}
+
+	balance.Current -= hold.Sum
+	balance.Held += hold.Sum
+	r.balances[hold.UserID] = balance
+	r.holds[hold.HoldID] = hold
+	r.holdLots[hold.HoldID] = r.consumePointLots(hold.UserID, hold.Sum)
+
+	return nil
+}
+
+func (r *MemoryRepository) CaptureHold(
+	_ context.Context,
+	userID uuid.UUID,
+	holdID uuid.UUID,
+	now time.Time,
+) (*Hold, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	hold, ok := r.holds[holdID]
+	if !ok || hold.UserID != userID {
+		return nil, ErrHoldNotFound
+	}
+	if hold.Status != string(models.HoldActive) {
+		return nil, ErrHoldFinished
+	}
+	if !hold.ExpiresAt.After(now) {
+		return nil, ErrHoldExpired
+	}
+	if _, ok := r.withdrawn[hold.Order]; ok {
+		return nil, NewErrWithdrawalAlreadyExists(hold.Order)
+	}
+
+	balance := r.balances[userID]
+	balance.Held = max(balance.Held-hold.Sum, 0)
+	balance.Withdrawn += hold.Sum
+	r.balances[userID] = balance
+
+	r.withdrawn[hold.Order] = struct{}{}
+	r.withdrawals[userID] = append(r.withdrawals[userID], Withdraw{
+		ProcessedAt: now,
+		Order:       hold.Order,
+		Sum:         hold.Sum,
+	})
+	r.withdrawalLots[hold.Order] = slices.Clone(r.holdLots[hold.HoldID])
+
+	return r.finishHold(hold, string(models.HoldCaptured), now), nil
+}
+
+func (r *MemoryRepository) VoidHold(
+	_ context.Context,
+	userID uuid.UUID,
+	holdID uuid.UUID,
+	now time.Time,
+) (*Hold, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	hold, ok := r.holds[holdID]
+	if !ok || hold.UserID != userID {
+		return nil, ErrHoldNotFound
+	}
+	if hold.Status != string(models.HoldActive) {
+		return nil, ErrHoldFinished
+	}
+
+	return r.releaseHold(hold, string(models.HoldVoided), now), nil
+}
+
+func (r *MemoryRepository) GetHolds(_ context.Context, userID uuid.UUID) ([]Hold, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var holds []Hold
+	for _, hold := range r.holds {
+		if hold.UserID != userID {
+			continue
+		}
+		hold.FinishedAt = copyTime(hold.FinishedAt)
+		holds = append(holds, hold)
+	}
+	if len(holds) == 0 {
+		return nil, ErrNoHolds
+	}
+
+	sort.SliceStable(holds, func(i, j int) bool {
+		return holds[i].CreatedAt.Before(holds[j].CreatedAt)
+	})
+
+	return holds, nil
+}
+
+func (r *MemoryRepository) ExpireHolds(_ context.Context, now time.Time, limit int) ([]Hold, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var expired []Hold
+	for _, hold := range r.holds {
+		if hold.Status == string(models.HoldActive) && !hold.ExpiresAt.After(now) {
+			expired = append(expired, hold)
+		}
+	}
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].ExpiresAt.Before(expired[j].ExpiresAt)
+	})
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+
+	holds := make([]Hold, 0, len(expired))
+	for _, hold := range expired {
+		holds = append(holds, *r.releaseHold(hold, string(models.HoldExpired), now))
+	}
+
+	return holds, nil
+}
+
+func (r *MemoryRepository) releaseHold(hold Hold, status string, now time.Time) *Hold {
+	balance := r.balances[hold.UserID]
+	balance.Current += hold.Sum
+	balance.Held = max(balance.Held-hold.Sum, 0)
+	r.balances[hold.UserID] = balance
+
+	lots := r.lots[hold.UserID]
+	for _, portion := range r.holdLots[hold.HoldID] {
+		lot := &lots[portion.lotID]
+		lot.Remaining = min(lot.Remaining+portion.sum, lot.Amount)
+	}
+
+	return r.finishHold(hold, status, now)
+}
+
+// restoreWithdrawalLots returns up to sum to the lots the withdrawal of the
+// order was taken from, the lots taken last first.
+func (r *MemoryRepository) restoreWithdrawalLots(userID uuid.UUID, orderNumber string, sum float64) float64 {
+	lots := r.lots[userID]
+	portions := r.withdrawalLots[orderNumber]
+	var restored float64
+	for i := len(portions) - 1; i >= 0 && sum > 0; i-- {
+		taken := min(portions[i].sum, sum)
+		portions[i].sum -= taken
+		lot := &lots[portions[i].lotID]
+		lot.Remaining = min(lot.Remaining+taken, lot.Amount)
+		restored += taken
+		sum -= taken
+	}
+	return restored
+}
+
+func (r *MemoryRepository) finishHold(hold Hold, status string, now time.Time) *Hold {
+	hold.Status = status
+	hold.FinishedAt = &now
+	r.holds[hold.HoldID] = hold
+
+	hold.FinishedAt = copyTime(hold.FinishedAt)
+	return &hold
+}
+
+func (r *MemoryRepository) addPointLot(userID uuid.UUID, orderNumber string, amount float64, expiresAt *time.Time) {
+	if amount <= 0 {
+		return
+	}
+	r.lots[userID] = append(r.lots[userID], PointLot{
+		AccruedAt: time.Now(),
+		ExpiresAt: copyTime(expiresAt),
+		Order:     orderNumber,
+		Amount:    amount,
+		Remaining: amount,
+	})
+}
+
+// consumePointLots takes sum from the lots of the user like the database
+// repository, the lots closest to expiry first.
+func (r *MemoryRepository) consumePointLots(userID uuid.UUID, sum float64) []lotPortion {
+	var portions []lotPortion
+	lots := r.lots[userID]
+	order := make([]int, len(lots))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		first, second := lots[order[a]], lots[order[b]]
+		switch {
+		case first.ExpiresAt == nil || second.ExpiresAt == nil:
+			return first.ExpiresAt != nil && second.ExpiresAt == nil
+		case !first.ExpiresAt.Equal(*second.ExpiresAt):
+			return first.ExpiresAt.Before(*second.ExpiresAt)
+		default:
+			return first.AccruedAt.Before(second.AccruedAt)
+		}
+	})
+	for _, i := range order {
+		if sum <= 0 {
+			break
+		}
+		if lots[i].Remaining <= 0 {
+			continue
+		}
+		taken := min(lots[i].Remaining, sum)
+		lots[i].Remaining -= taken
+		portions = append(portions, lotPortion{expiresAt: copyTime(lots[i].ExpiresAt), lotID: int64(i), sum: taken})
+		sum -= taken
+	}
+	return portions
+}
+
+func (r *MemoryRepository) addPortionLots(userID uuid.UUID, orderNumber string, portions []lotPortion) {
+	for _, portion := range portions {
+		r.addPointLot(userID, orderNumber, portion.sum, portion.expiresAt)
+	}
+}
+
+func (r *MemoryRepository) userByReferralCode(code string) (User, bool) {
+	for _, user := range r.users {
+		if user.ReferralCode == code {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+func (r *MemoryRepository) userByID(userID uuid.UUID) (User, bool) {
+	for _, user := range r.users {
+		if user.UserID == userID {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+func (r *MemoryRepository) addAdminAction(action AdminAction) {
+	action.CreatedAt = time.Now()
+	action.Amount = copyFloat(action.Amount)
+	if action.UserID != nil {
+		userID := *action.UserID
+		action.UserID = &userID
+	}
+	r.actions = append(r.actions, action)
+}
+
+func (r *MemoryRepository) AddCampaign(_ context.Context, campaign Campaign) error {
+	if campaign.EndsAt.Before(campaign.StartsAt) || (campaign.Multiplier == nil) == (campaign.Bonus == nil) {
+		return ErrInvalidCampaign
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if _, ok := r.userByID(campaign.CreatedBy); !ok {
+		return ErrUserNotFound
+	}
+
+	r.campaigns[campaign.CampaignID] = copyCampaign(campaign)
+
+	return nil
+}
+
+func (r *MemoryRepository) EndCampaign(_ context.Context, campaignID uuid.UUID, now time.Time) (*Campaign, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	campaign, ok := r.campaigns[campaignID]
+	if !ok {
+		return nil, ErrCampaignNotFound
+	}
+	if !campaign.EndsAt.After(now) {
+		return nil, ErrCampaignEnded
+	}
+	campaign.EndsAt = now
+	if campaign.EndsAt.Before(campaign.StartsAt) {
+		campaign.EndsAt = campaign.StartsAt
+	}
+	r.campaigns[campaignID] = campaign
+
+	result := copyCampaign(campaign)
+	return &result, nil
+}
+
+func (r *MemoryRepository) GetCampaigns(_ context.Context) ([]Campaign, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	if len(r.campaigns) == 0 {
+		return nil, ErrNoCampaigns
+	}
+
+	campaigns := make([]Campaign, 0, len(r.campaigns))
+	for _, campaign := range r.campaigns {
+		campaigns = append(campaigns, copyCampaign(campaign))
+	}
+	sort.Slice(campaigns, func(i, j int) bool {
+		if !campaigns[i].StartsAt.Equal(campaigns[j].StartsAt) {
+			return campaigns[i].StartsAt.After(campaigns[j].StartsAt)
+		}
+		return campaigns[i].CampaignID.String() < campaigns[j].CampaignID.String()
+	})
+
+	return campaigns, nil
+}
+
+func (r *MemoryRepository) GetCampaignBonuses(_ context.Context, userID uuid.UUID) ([]CampaignBonus, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var bonuses []CampaignBonus
+	for _, bonus := range r.bonuses {
+		if bonus.UserID == userID {
+			bonuses = append(bonuses, bonus)
+		}
+	}
+
+	return bonuses, nil
+}
+
+func (r *MemoryRepository) applyCampaigns(
+	userID uuid.UUID,
+	orderNumber string,
+	accrual float64,
+	now time.Time,
+	expiresAt *time.Time,
+) {
+	balance, ok := r.balances[userID]
+	if !ok {
+		return
+	}
+
+	campaignIDs := make([]uuid.UUID, 0, len(r.campaigns))
+	for campaignID := range r.campaigns {
+		campaignIDs = append(campaignIDs, campaignID)
+	}
+	sort.Slice(campaignIDs, func(i, j int) bool {
+		return campaignIDs[i].String() < campaignIDs[j].String()
+	})
+
+	for _, campaignID := range campaignIDs {
+		campaign := r.campaigns[campaignID]
+		if !campaign.eligible(userID, r.tiers[userID], now) {
+			continue
+		}
+		bonus := campaign.bonus(accrual)
+		if bonus <= 0 {
+			continue
+		}
+
+		campaign.Spent += bonus
+		r.campaigns[campaignID] = campaign
+		r.bonuses = append(r.bonuses, CampaignBonus{
+			CreatedAt:    now,
+			Order:        orderNumber,
+			CampaignName: campaign.Name,
+			Sum:          bonus,
+			CampaignID:   campaignID,
+			UserID:       userID,
+		})
+		r.addPointLot(userID, orderNumber, bonus, expiresAt)
+		balance.Current += bonus
+	}
+	r.balances[userID] = balance
+}
+
+func copyCampaign(campaign Campaign) Campaign {
+	campaign.Multiplier = copyFloat(campaign.Multiplier)
+	campaign.Bonus = copyFloat(campaign.Bonus)
+	campaign.Budget = copyFloat(campaign.Budget)
+	campaign.Tiers = slices.Clone(campaign.Tiers)
+	campaign.UserIDs = slices.Clone(campaign.UserIDs)
+	return campaign
+}
+
+func (r *MemoryRepository) GetReferrals(_ context.Context, userID uuid.UUID) (*Referrals, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	user, ok := r.userByID(userID)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	result := &Referrals{
+		Code: user.ReferralCode,
+	}
+	for _, referral := range r.referrals {
+		if referral.RefereeID != userID && referral.ReferrerID != userID {
+			continue
+		}
+		referee, _ := r.userByID(referral.RefereeID)
+		referrer, _ := r.userByID(referral.ReferrerID)
+		referral.RefereeLogin = referee.Login
+		referral.ReferrerLogin = referrer.Login
+		if referral.RewardedAt != nil {
+			rewardedAt := *referral.RewardedAt
+			referral.RewardedAt = &rewardedAt
+		}
+		if referral.RefereeID == userID {
+			result.ReferredBy = &referral
+			continue
+		}
+		result.Referrals = append(result.Referrals, referral)
+	}
+	sort.Slice(result.Referrals, func(i, j int) bool {
+		if !result.Referrals[i].CreatedAt.Equal(result.Referrals[j].CreatedAt) {
+			return result.Referrals[i].CreatedAt.After(result.Referrals[j].CreatedAt)
+		}
+		return result.Referrals[i].RefereeID.String() < result.Referrals[j].RefereeID.String()
+	})
+
+	return result, nil
+}
+
+func (r *MemoryRepository) rewardReferral(userID uuid.UUID, orderNumber string, now time.Time, expiresAt *time.Time) {
+	referral, ok := r.referrals[userID]
+	if !ok || referral.RewardedAt != nil {
+		return
+	}
+	referral.RewardedAt = &now
+	r.referrals[userID] = referral
+
+	r.creditBonus(userID, orderNumber, referral.RefereeBonus, expiresAt)
+	r.creditBonus(referral.ReferrerID, "", referral.ReferrerBonus, expiresAt)
+}
+
+func (r *MemoryRepository) creditBonus(userID uuid.UUID, orderNumber string, bonus float64, expiresAt *time.Time) {
+	balance, ok := r.balances[userID]
+	if !ok || bonus <= 0 {
+		return
+	}
+	balance.Current += bonus
+	r.balances[userID] = balance
+	r.addPointLot(userID, orderNumber, bonus, expiresAt)
+}
+
+// orderMerchant returns the merchant of a new order like insertOrder.
+func (r *MemoryRepository) orderMerchant(orderNumber string, merchantID string) (*string, error) {
+	if merchantID != "" {
+		if _, ok := r.merchants[merchantID]; !ok {
+			return nil, ErrMerchantNotFound
+		}
+		return &merchantID, nil
+	}
+
+	var result *string
+	var prefixLength int
+	for _, merchant := range r.merchants {
+		if merchant.OrderPrefix == nil || !strings.HasPrefix(orderNumber, *merchant.OrderPrefix) ||
+			len(*merchant.OrderPrefix) <= prefixLength {
+			continue
+		}
+		id := merchant.MerchantID
+		result = &id
+		prefixLength = len(*merchant.OrderPrefix)
+	}
+	return result, nil
+}
+
+// existingOrderMerchant returns the merchant of an order like
+// selectOrderMerchant.
+func (r *MemoryRepository) existingOrderMerchant(orderNumber string) *string {
+	if order, ok := r.orders[orderNumber]; ok && order.MerchantID != nil {
+		return order.MerchantID
+	}
+	merchantID, _ := r.orderMerchant(orderNumber, "")
+	return merchantID
+}
+
+func (r *MemoryRepository) AddMerchant(_ context.Context, merchant Merchant) error {
+	if merchant.RateLimit < 0 || (merchant.OrderPrefix != nil && !onlyDigits(*merchant.OrderPrefix)) {
+		return ErrInvalidMerchant
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if _, ok := r.merchants[merchant.MerchantID]; ok {
+		return ErrMerchantExists
+	}
+	for _, other := range r.merchants {
+		if merchant.OrderPrefix != nil && other.OrderPrefix != nil && *merchant.OrderPrefix == *other.OrderPrefix {
+			return ErrMerchantExists
+		}
+	}
+
+	merchant.OrderPrefix = copyString(merchant.OrderPrefix)
+	r.merchants[merchant.MerchantID] = merchant
+
+	return nil
+}
+
+func (r *MemoryRepository) GetMerchants(_ context.Context) ([]Merchant, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	if len(r.merchants) == 0 {
+		return nil, ErrNoMerchants
+	}
+
+	merchants := make([]Merchant, 0, len(r.merchants))
+	for _, merchant := range r.merchants {
+		merchant.OrderPrefix = copyString(merchant.OrderPrefix)
+		merchants = append(merchants, merchant)
+	}
+	sort.Slice(merchants, func(i, j int) bool {
+		return merchants[i].MerchantID < merchants[j].MerchantID
+	})
+
+	return merchants, nil
+}
+
+func onlyDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, char := range value {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// statementPriorities orders entries at the same moment like statementQuery.
+var statementPriorities = map[string]int{
+	string(models.StatementAccrual):       1,
+	string(models.StatementCampaignBonus): 2,
+	string(models.StatementReferralBonus): 3,
+	string(models.StatementAdjustment):    4,
+	string(models.StatementTransferIn):    5,
+	string(models.StatementTransferOut):   6,
+	string(models.StatementWithdrawal):    7,
+	string(models.StatementReversal):      8,
+	string(models.StatementExpiration):    9,
+	string(models.StatementHold):          10,
+	string(models.StatementHoldRelease):   11,
+}
+
+func (r *MemoryRepository) GetStatement(
+	_ context.Context,
+	userID uuid.UUID,
+	from *time.Time,
+	to *time.Time,
+	handle func(entry StatementEntry) error,
+) error {
+	entries := r.statementEntries(userID)
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case !a.CreatedAt.Equal(b.CreatedAt):
+			return a.CreatedAt.Before(b.CreatedAt)
+		case statementPriorities[a.Type] != statementPriorities[b.Type]:
+			return statementPriorities[a.Type] < statementPriorities[b.Type]
+		case a.Order != b.Order:
+			return a.Order < b.Order
+		default:
+			return a.Amount < b.Amount
+		}
+	})
+
+	var balance float64
+	for _, entry := range entries {
+		balance += entry.Amount
+		if from != nil && entry.CreatedAt.Before(*from) {
+			continue
+		}
+		if to != nil && !entry.CreatedAt.Before(*to) {
+			continue
+		}
+		entry.Balance = math.Round(balance*100) / 100
+		err := handle(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) statementEntries(userID uuid.UUID) []StatementEntry {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var entries []StatementEntry
+	add := func(createdAt time.Time, entryType models.StatementEntryType, orderNumber string, amount float64) {
+		entries = append(entries, StatementEntry{
+			CreatedAt: createdAt,
+			Type:      string(entryType),
+			Order:     orderNumber,
+			Amount:    amount,
+		})
+	}
+
+	for _, order := range r.orders {
+		processedAt, ok := r.processedAt[order.Number]
+		if order.UserID == userID && ok && order.Accrual != nil && *order.Accrual > 0 {
+			add(processedAt, models.StatementAccrual, order.Number, *order.Accrual)
+		}
+	}
+	for _, bonus := range r.bonuses {
+		if bonus.UserID == userID {
+			add(bonus.CreatedAt, models.StatementCampaignBonus, bonus.Order, bonus.Sum)
+		}
+	}
+	for _, referral := range r.referrals {
+		if referral.RewardedAt == nil {
+			continue
+		}
+		if referral.RefereeID == userID && referral.RefereeBonus > 0 {
+			add(*referral.RewardedAt, models.StatementReferralBonus, "", referral.RefereeBonus)
+		}
+		if referral.ReferrerID == userID && referral.ReferrerBonus > 0 {
+			add(*referral.RewardedAt, models.StatementReferralBonus, "", referral.ReferrerBonus)
+		}
+	}
+	for _, action := range r.actions {
+		if action.Action == string(models.AdminActionAdjustBalance) && action.UserID != nil &&
+			*action.UserID == userID && action.Amount != nil {
+			add(action.CreatedAt, models.StatementAdjustment, action.OrderNumber, *action.Amount)
+		}
+	}
+	for _, transfer := range r.transfers {
+		if transfer.ToUserID == userID {
+			add(transfer.ProcessedAt, models.StatementTransferIn, "", transfer.Sum)
+		}
+		if transfer.FromUserID == userID {
+			add(transfer.ProcessedAt, models.StatementTransferOut, "", -transfer.Sum)
+		}
+	}
+	// A captured hold is already debited by its hold entry.
+	captured := make(map[string]struct{})
+	for _, hold := range r.holds {
+		if hold.UserID != userID {
+			continue
+		}
+		add(hold.CreatedAt, models.StatementHold, hold.Order, -hold.Sum)
+		switch {
+		case hold.Status == string(models.HoldCaptured):
+			captured[hold.Order] = struct{}{}
+		case hold.FinishedAt != nil:
+			add(*hold.FinishedAt, models.StatementHoldRelease, hold.Order, hold.Sum)
+		}
+	}
+	for _, withdrawal := range r.withdrawals[userID] {
+		if _, ok := captured[withdrawal.Order]; !ok {
+			add(withdrawal.ProcessedAt, models.StatementWithdrawal, withdrawal.Order, -withdrawal.Sum)
+		}
+	}
+	for _, reversal := range r.reversals {
+		if reversal.UserID == userID {
+			add(reversal.CreatedAt, models.StatementReversal, reversal.Order, reversal.Sum)
+		}
+	}
+	for _, expiration := range r.expirations {
+		if expiration.UserID == userID {
+			add(expiration.ExpiredAt, models.StatementExpiration, expiration.Order, -expiration.Sum)
+		}
+	}
+
+	return entries
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/RexArseny/loyalty_system/internal/app/external"
+	"github.com/RexArseny/loyalty_system/internal/app/logger"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRepositoryAddOrder(t *testing.T) {
+	firstUserID := uuid.New()
+	secondUserID := uuid.New()
+	tests := []struct {
+		name    string
+		userID  uuid.UUID
+		wantErr any
+	}{
+		{
+			name:    "new order",
+			userID:  firstUserID,
+			wantErr: nil,
+		},
+		{
+			name:    "same user",
+			userID:  firstUserID,
+			wantErr: new(*ErrAlreadyAdded),
+		},
+		{
+			name:    "another user",
+			userID:  secondUserID,
+			wantErr: new(*ErrAlreadyAddedByAnotherUser),
+		},
+	}
+
+	testLogger, err := logger.InitLogger()
+	assert.NoError(t, err)
+	dataRepository := NewMemoryRepository(testLogger.Named("repository"))
+	err = dataRepository.Registration(context.Background(), "testlogin", "hash", "salt", firstUserID, "FIRST",
+		nil)
+	assert.NoError(t, err)
+	err = dataRepository.Registration(context.Background(), "testanotherlogin", "hash", "salt", secondUserID,
+		"SECOND", nil)
+	assert.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := dataRepository.AddOrder(context.Background(), "12345678903", "", tt.userID)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorAs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestMemoryRepositoryConcurrentWithdraw(t *testing.T) {
+	ctx := context.Background()
+	testLogger, err := logger.InitLogger()
+	assert.NoError(t, err)
+	dataRepository := NewMemoryRepository(testLogger.Named("repository"))
+
+	userID := uuid.New()
+	err = dataRepository.Registration(ctx, "testlogin", "hash", "salt", userID, "TESTLOGIN", nil)
+	assert.NoError(t, err)
+	err = dataRepository.AddOrder(ctx, "12345678903", "", userID)
+	assert.NoError(t, err)
+	accrual := float64(100)
+	err = dataRepository.UpdateOrder(ctx, "12345678903", string(external.StatusProcessed), &accrual, userID, nil, nil)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	var succeeded int
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := dataRepository.Withdraw(ctx, strconv.Itoa(i), 10, userID)
+			if err == nil {
+				m.Lock()
+				succeeded++
+				m.Unlock()
+				return
+			}
+			assert.ErrorIs(t, err, ErrNotEnoughBalance)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, succeeded)
+	balance, err := dataRepository.GetBalance(ctx, userID)
+	assert.NoError(t, err)
+	assert.Equal(t, &Balance{Current: 0, Withdrawn: 100}, balance)
+}
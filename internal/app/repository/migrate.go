@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const migrationsLockID = 7316584219053417
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+type Migrator struct {
+	logger     *zap.Logger
+	connString string
+}
+
+func NewMigrator(logger *zap.Logger, connString string) *Migrator {
+	return &Migrator{
+		logger:     logger,
+		connString: connString,
+	}
+}
+
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.run(ctx, func(instance *migrate.Migrate) error {
+		err := instance.Up()
+		if err != nil {
+			if errors.Is(err, migrate.ErrNoChange) {
+				return nil
+			}
+			return fmt.Errorf("can not migrate up: %w", err)
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.run(ctx, func(instance *migrate.Migrate) error {
+		err := instance.Steps(-steps)
+		if err != nil {
+			if errors.Is(err, migrate.ErrNoChange) {
+				return nil
+			}
+			return fmt.Errorf("can not migrate down: %w", err)
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	return m.run(ctx, func(instance *migrate.Migrate) error {
+		err := instance.Force(version)
+		if err != nil {
+			return fmt.Errorf("can not force version: %w", err)
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) Version(ctx context.Context) (uint, bool, error) {
+	var version uint
+	var dirty bool
+	err := m.run(ctx, func(instance *migrate.Migrate) error {
+		var err error
+		version, dirty, err = instance.Version()
+		if err != nil {
+			if errors.Is(err, migrate.ErrNilVersion) {
+				return nil
+			}
+			return fmt.Errorf("can not get version: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	return version, dirty, nil
+}
+
+func (m *Migrator) run(ctx context.Context, action func(instance *migrate.Migrate) error) error {
+	conn, err := pgx.Connect(ctx, m.connString)
+	if err != nil {
+		return fmt.Errorf("can not connect to PostgreSQL server: %w", err)
+	}
+	defer func() {
+		err = conn.Close(context.Background())
+		if err != nil {
+			m.logger.Error("Can not close connection", zap.Error(err))
+		}
+	}()
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationsLockID)
+	if err != nil {
+		return fmt.Errorf("can not acquire migrations lock: %w", err)
+	}
+	defer func() {
+		_, err = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationsLockID)
+		if err != nil {
+			m.logger.Error("Can not release migrations lock", zap.Error(err))
+		}
+	}()
+
+	source, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		return fmt.Errorf("can not open embedded migrations: %w", err)
+	}
+	instance, err := migrate.NewWithSourceInstance("iofs", source, m.connString)
+	if err != nil {
+		return fmt.Errorf("can not create migration instance: %w", err)
+	}
+	defer func() {
+		sourceErr, databaseErr := instance.Close()
+		if sourceErr != nil || databaseErr != nil {
+			m.logger.Error("Can not close migration instance",
+				zap.NamedError("source", sourceErr),
+				zap.NamedError("database", databaseErr))
+		}
+	}()
+
+	return action(instance)
+}
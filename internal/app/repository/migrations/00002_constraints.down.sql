@@ -0,0 +1,20 @@
+START TRANSACTION;
+
+DROP INDEX withdrawals_user_id_idx;
+DROP INDEX orders_status_uploaded_at_idx;
+DROP INDEX orders_user_id_idx;
+
+ALTER TABLE withdrawals DROP CONSTRAINT withdrawals_sum_check;
+ALTER TABLE balances DROP CONSTRAINT balances_withdrawn_check;
+ALTER TABLE balances DROP CONSTRAINT balances_balance_check;
+ALTER TABLE orders DROP CONSTRAINT orders_status_check;
+
+ALTER TABLE withdrawals DROP CONSTRAINT withdrawals_users_fk;
+ALTER TABLE balances DROP CONSTRAINT balances_users_fk;
+ALTER TABLE orders DROP CONSTRAINT orders_users_fk;
+
+ALTER TABLE withdrawals DROP CONSTRAINT withdrawals_order_unique;
+ALTER TABLE withdrawals DROP CONSTRAINT withdrawals_pk;
+ALTER TABLE withdrawals DROP COLUMN withdrawal_id;
+
+COMMIT;
@@ -0,0 +1,62 @@
+START TRANSACTION;
+
+DELETE FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.user_id = o.user_id);
+
+DELETE FROM balances b
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.user_id = b.user_id);
+
+DELETE FROM withdrawals w
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.user_id = w.user_id);
+
+INSERT INTO balances (user_id, balance, withdrawn)
+SELECT u.user_id, 0, 0
+FROM users u
+WHERE NOT EXISTS (SELECT 1 FROM balances b WHERE b.user_id = u.user_id);
+
+UPDATE orders SET status = 'NEW'
+WHERE status NOT IN ('NEW', 'PROCESSING', 'INVALID', 'PROCESSED');
+
+ALTER TABLE withdrawals ADD COLUMN withdrawal_id bigint GENERATED ALWAYS AS IDENTITY;
+
+CREATE TEMPORARY TABLE withdrawal_duplicates ON COMMIT DROP AS
+SELECT withdrawal_id, user_id, sum
+FROM (
+	SELECT withdrawal_id, user_id, sum,
+		row_number() OVER (PARTITION BY order_id ORDER BY processed_at, withdrawal_id) AS position
+	FROM withdrawals
+) ranked
+WHERE position > 1;
+
+UPDATE balances b
+SET balance = b.balance + d.total,
+	withdrawn = b.withdrawn - d.total
+FROM (
+	SELECT user_id, sum(sum) AS total
+	FROM withdrawal_duplicates
+	GROUP BY user_id
+) d
+WHERE b.user_id = d.user_id;
+
+DELETE FROM withdrawals w
+USING withdrawal_duplicates d
+WHERE w.withdrawal_id = d.withdrawal_id;
+
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_pk PRIMARY KEY (withdrawal_id);
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_order_unique UNIQUE (order_id);
+
+ALTER TABLE orders ADD CONSTRAINT orders_users_fk FOREIGN KEY (user_id) REFERENCES users (user_id);
+ALTER TABLE balances ADD CONSTRAINT balances_users_fk FOREIGN KEY (user_id) REFERENCES users (user_id);
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_users_fk FOREIGN KEY (user_id) REFERENCES users (user_id);
+
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+	CHECK (status IN ('NEW', 'PROCESSING', 'INVALID', 'PROCESSED'));
+ALTER TABLE balances ADD CONSTRAINT balances_balance_check CHECK (balance >= 0) NOT VALID;
+ALTER TABLE balances ADD CONSTRAINT balances_withdrawn_check CHECK (withdrawn >= 0) NOT VALID;
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_sum_check CHECK (sum > 0) NOT VALID;
+
+CREATE INDEX orders_user_id_idx ON orders (user_id);
+CREATE INDEX orders_status_uploaded_at_idx ON orders (status, uploaded_at);
+CREATE INDEX withdrawals_user_id_idx ON withdrawals (user_id);
+
+COMMIT;
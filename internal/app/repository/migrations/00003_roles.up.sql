@@ -0,0 +1,6 @@
+START TRANSACTION;
+
+ALTER TABLE users ADD COLUMN role text NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'support', 'admin', 'merchant'));
+
+COMMIT;
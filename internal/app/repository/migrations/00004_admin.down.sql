@@ -0,0 +1,9 @@
+START TRANSACTION;
+
+DROP TABLE IF EXISTS admin_actions;
+
+DROP INDEX IF EXISTS users_login_pattern_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS disabled;
+
+COMMIT;
@@ -0,0 +1,24 @@
+START TRANSACTION;
+
+ALTER TABLE users ADD COLUMN disabled boolean NOT NULL DEFAULT false;
+
+CREATE INDEX users_login_pattern_idx ON users (login text_pattern_ops);
+
+CREATE TABLE admin_actions (
+	action_id bigint GENERATED ALWAYS AS IDENTITY,
+	admin_id uuid NOT NULL,
+	user_id uuid,
+	action text NOT NULL,
+	order_id text,
+	amount double precision,
+	reason text,
+	comment text,
+	created_at timestamp with time zone NOT NULL,
+	CONSTRAINT admin_actions_pk PRIMARY KEY (action_id),
+	CONSTRAINT admin_actions_admins_fk FOREIGN KEY (admin_id) REFERENCES users (user_id),
+	CONSTRAINT admin_actions_users_fk FOREIGN KEY (user_id) REFERENCES users (user_id)
+);
+
+CREATE INDEX admin_actions_user_id_idx ON admin_actions (user_id, created_at);
+
+COMMIT;
@@ -0,0 +1,7 @@
+START TRANSACTION;
+
+DROP TABLE IF EXISTS point_expirations;
+
+DROP TABLE IF EXISTS point_lots;
+
+COMMIT;
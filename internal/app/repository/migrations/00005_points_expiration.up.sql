@@ -0,0 +1,38 @@
+START TRANSACTION;
+
+CREATE TABLE point_lots (
+	lot_id bigint GENERATED ALWAYS AS IDENTITY,
+	user_id uuid NOT NULL,
+	order_id text,
+	amount double precision NOT NULL,
+	remaining double precision NOT NULL,
+	accrued_at timestamp with time zone NOT NULL,
+	expires_at timestamp with time zone,
+	CONSTRAINT point_lots_pk PRIMARY KEY (lot_id),
+	CONSTRAINT point_lots_users_fk FOREIGN KEY (user_id) REFERENCES users (user_id),
+	CONSTRAINT point_lots_remaining_check CHECK (remaining >= 0 AND remaining <= amount)
+);
+
+CREATE INDEX point_lots_user_id_idx ON point_lots (user_id, accrued_at, lot_id) WHERE remaining > 0;
+CREATE INDEX point_lots_expires_at_idx ON point_lots (expires_at) WHERE remaining > 0;
+
+-- Points accrued before expiration was introduced never expire.
+INSERT INTO point_lots (user_id, amount, remaining, accrued_at)
+SELECT user_id, balance, balance, now()
+FROM balances
+WHERE balance > 0;
+
+CREATE TABLE point_expirations (
+	expiration_id bigint GENERATED ALWAYS AS IDENTITY,
+	lot_id bigint NOT NULL,
+	user_id uuid NOT NULL,
+	sum double precision NOT NULL,
+	expired_at timestamp with time zone NOT NULL,
+	CONSTRAINT point_expirations_pk PRIMARY KEY (expiration_id),
+	CONSTRAINT point_expirations_lots_fk FOREIGN KEY (lot_id) REFERENCES point_lots (lot_id),
+	CONSTRAINT point_expirations_users_fk FOREIGN KEY (user_id) REFERENCES users (user_id)
+);
+
+CREATE INDEX point_expirations_user_id_idx ON point_expirations (user_id, expired_at);
+
+COMMIT;
@@ -0,0 +1,19 @@
+START TRANSACTION;
+
+CREATE TABLE transfers (
+	transfer_id bigint GENERATED ALWAYS AS IDENTITY,
+	from_user_id uuid NOT NULL,
+	to_user_id uuid NOT NULL,
+	sum double precision NOT NULL,
+	processed_at timestamp with time zone NOT NULL,
+	CONSTRAINT transfers_pk PRIMARY KEY (transfer_id),
+	CONSTRAINT transfers_senders_fk FOREIGN KEY (from_user_id) REFERENCES users (user_id),
+	CONSTRAINT transfers_recipients_fk FOREIGN KEY (to_user_id) REFERENCES users (user_id),
+	CONSTRAINT transfers_sum_check CHECK (sum > 0),
+	CONSTRAINT transfers_users_check CHECK (from_user_id <> to_user_id)
+);
+
+CREATE INDEX transfers_from_user_id_idx ON transfers (from_user_id, processed_at);
+CREATE INDEX transfers_to_user_id_idx ON transfers (to_user_id, processed_at);
+
+COMMIT;
@@ -0,0 +1,8 @@
+START TRANSACTION;
+
+DROP TABLE IF EXISTS reversals;
+
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_reversed_check;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS reversed;
+
+COMMIT;
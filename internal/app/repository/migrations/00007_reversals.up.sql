@@ -0,0 +1,20 @@
+START TRANSACTION;
+
+ALTER TABLE withdrawals ADD COLUMN reversed double precision NOT NULL DEFAULT 0;
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_reversed_check CHECK (reversed >= 0 AND reversed <= sum);
+
+CREATE TABLE reversals (
+	reversal_id text NOT NULL,
+	withdrawal_id bigint NOT NULL,
+	sum double precision NOT NULL,
+	initiator_id uuid NOT NULL,
+	created_at timestamp with time zone NOT NULL,
+	CONSTRAINT reversals_pk PRIMARY KEY (reversal_id),
+	CONSTRAINT reversals_withdrawals_fk FOREIGN KEY (withdrawal_id) REFERENCES withdrawals (withdrawal_id),
+	CONSTRAINT reversals_initiators_fk FOREIGN KEY (initiator_id) REFERENCES users (user_id),
+	CONSTRAINT reversals_sum_check CHECK (sum > 0)
+);
+
+CREATE INDEX reversals_withdrawal_id_idx ON reversals (withdrawal_id);
+
+COMMIT;
@@ -0,0 +1,10 @@
+START TRANSACTION;
+
+DROP TABLE IF EXISTS hold_lots;
+
+DROP TABLE IF EXISTS holds;
+
+ALTER TABLE balances DROP CONSTRAINT IF EXISTS balances_held_check;
+ALTER TABLE balances DROP COLUMN IF EXISTS held;
+
+COMMIT;
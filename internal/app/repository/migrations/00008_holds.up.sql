@@ -0,0 +1,34 @@
+START TRANSACTION;
+
+ALTER TABLE balances ADD COLUMN held double precision NOT NULL DEFAULT 0;
+ALTER TABLE balances ADD CONSTRAINT balances_held_check CHECK (held >= 0);
+
+CREATE TABLE holds (
+	hold_id uuid NOT NULL,
+	user_id uuid NOT NULL,
+	order_id text NOT NULL,
+	sum double precision NOT NULL,
+	status text NOT NULL,
+	created_at timestamp with time zone NOT NULL,
+	expires_at timestamp with time zone NOT NULL,
+	finished_at timestamp with time zone,
+	CONSTRAINT holds_pk PRIMARY KEY (hold_id),
+	CONSTRAINT holds_users_fk FOREIGN KEY (user_id) REFERENCES users (user_id),
+	CONSTRAINT holds_sum_check CHECK (sum > 0),
+	CONSTRAINT holds_status_check CHECK (status IN ('active', 'captured', 'voided', 'expired'))
+);
+
+CREATE UNIQUE INDEX holds_order_active_idx ON holds (order_id) WHERE status = 'active';
+CREATE INDEX holds_user_id_idx ON holds (user_id, created_at);
+CREATE INDEX holds_expires_at_idx ON holds (expires_at) WHERE status = 'active';
+
+CREATE TABLE hold_lots (
+	hold_id uuid NOT NULL,
+	lot_id bigint NOT NULL,
+	sum double precision NOT NULL,
+	CONSTRAINT hold_lots_pk PRIMARY KEY (hold_id, lot_id),
+	CONSTRAINT hold_lots_holds_fk FOREIGN KEY (hold_id) REFERENCES holds (hold_id),
+	CONSTRAINT hold_lots_lots_fk FOREIGN KEY (lot_id) REFERENCES point_lots (lot_id)
+);
+
+COMMIT;
@@ -0,0 +1,9 @@
+START TRANSACTION;
+
+DROP INDEX IF EXISTS orders_user_processed_at_idx;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS processed_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS tier;
+
+COMMIT;
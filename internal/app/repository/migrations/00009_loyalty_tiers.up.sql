@@ -0,0 +1,10 @@
+START TRANSACTION;
+
+ALTER TABLE users ADD COLUMN tier text NOT NULL DEFAULT '';
+
+ALTER TABLE orders ADD COLUMN processed_at timestamp with time zone;
+UPDATE orders SET processed_at = uploaded_at WHERE status = 'PROCESSED';
+
+CREATE INDEX orders_user_processed_at_idx ON orders (user_id, processed_at) WHERE status = 'PROCESSED';
+
+COMMIT;
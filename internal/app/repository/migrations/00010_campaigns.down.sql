@@ -0,0 +1,7 @@
+START TRANSACTION;
+
+DROP TABLE IF EXISTS campaign_bonuses;
+
+DROP TABLE IF EXISTS campaigns;
+
+COMMIT;
@@ -0,0 +1,41 @@
+START TRANSACTION;
+
+CREATE TABLE campaigns (
+	campaign_id uuid NOT NULL,
+	name text NOT NULL,
+	starts_at timestamp with time zone NOT NULL,
+	ends_at timestamp with time zone NOT NULL,
+	tiers text[] NOT NULL DEFAULT '{}',
+	user_ids uuid[] NOT NULL DEFAULT '{}',
+	multiplier double precision,
+	bonus double precision,
+	budget double precision,
+	spent double precision NOT NULL DEFAULT 0,
+	created_by uuid NOT NULL,
+	created_at timestamp with time zone NOT NULL,
+	CONSTRAINT campaigns_pk PRIMARY KEY (campaign_id),
+	CONSTRAINT campaigns_users_fk FOREIGN KEY (created_by) REFERENCES users (user_id),
+	CONSTRAINT campaigns_period_check CHECK (starts_at <= ends_at),
+	CONSTRAINT campaigns_rule_check CHECK ((multiplier IS NULL) <> (bonus IS NULL)),
+	CONSTRAINT campaigns_spent_check CHECK (spent >= 0)
+);
+
+CREATE INDEX campaigns_period_idx ON campaigns (ends_at, starts_at);
+
+CREATE TABLE campaign_bonuses (
+	bonus_id bigint GENERATED ALWAYS AS IDENTITY,
+	campaign_id uuid NOT NULL,
+	user_id uuid NOT NULL,
+	order_id text NOT NULL,
+	sum double precision NOT NULL,
+	created_at timestamp with time zone NOT NULL,
+	CONSTRAINT campaign_bonuses_pk PRIMARY KEY (bonus_id),
+	CONSTRAINT campaign_bonuses_campaigns_fk FOREIGN KEY (campaign_id) REFERENCES campaigns (campaign_id),
+	CONSTRAINT campaign_bonuses_users_fk FOREIGN KEY (user_id) REFERENCES users (user_id),
+	CONSTRAINT campaign_bonuses_order_unique UNIQUE (campaign_id, order_id),
+	CONSTRAINT campaign_bonuses_sum_check CHECK (sum > 0)
+);
+
+CREATE INDEX campaign_bonuses_user_id_idx ON campaign_bonuses (user_id, created_at);
+
+COMMIT;
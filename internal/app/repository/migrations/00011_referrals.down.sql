@@ -0,0 +1,7 @@
+START TRANSACTION;
+
+DROP TABLE IF EXISTS referrals;
+
+ALTER TABLE users DROP COLUMN IF EXISTS referral_code;
+
+COMMIT;
@@ -0,0 +1,25 @@
+START TRANSACTION;
+
+ALTER TABLE users ADD COLUMN referral_code text;
+UPDATE users SET referral_code = upper(substr(md5(user_id::text), 1, 10));
+ALTER TABLE users ALTER COLUMN referral_code SET NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_referral_code_unique UNIQUE (referral_code);
+
+CREATE TABLE referrals (
+	referee_id uuid NOT NULL,
+	referrer_id uuid NOT NULL,
+	referrer_bonus double precision NOT NULL,
+	referee_bonus double precision NOT NULL,
+	created_at timestamp with time zone NOT NULL,
+	order_id text,
+	rewarded_at timestamp with time zone,
+	CONSTRAINT referrals_pk PRIMARY KEY (referee_id),
+	CONSTRAINT referrals_referee_fk FOREIGN KEY (referee_id) REFERENCES users (user_id),
+	CONSTRAINT referrals_referrer_fk FOREIGN KEY (referrer_id) REFERENCES users (user_id),
+	CONSTRAINT referrals_self_check CHECK (referee_id <> referrer_id),
+	CONSTRAINT referrals_bonus_check CHECK (referrer_bonus >= 0 AND referee_bonus >= 0)
+);
+
+CREATE INDEX referrals_referrer_id_idx ON referrals (referrer_id, created_at);
+
+COMMIT;
@@ -0,0 +1,9 @@
+START TRANSACTION;
+
+DROP INDEX IF EXISTS orders_merchant_status_idx;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS merchant_id;
+
+DROP TABLE IF EXISTS merchants;
+
+COMMIT;
@@ -0,0 +1,21 @@
+START TRANSACTION;
+
+CREATE TABLE merchants (
+	merchant_id text NOT NULL,
+	name text NOT NULL,
+	order_prefix text,
+	accrual_address text NOT NULL,
+	rate_limit double precision NOT NULL DEFAULT 0,
+	created_at timestamp with time zone NOT NULL,
+	CONSTRAINT merchants_pk PRIMARY KEY (merchant_id),
+	CONSTRAINT merchants_order_prefix_unique UNIQUE (order_prefix),
+	CONSTRAINT merchants_order_prefix_check CHECK (order_prefix ~ '^[0-9]+$'),
+	CONSTRAINT merchants_rate_limit_check CHECK (rate_limit >= 0)
+);
+
+ALTER TABLE orders ADD COLUMN merchant_id text;
+ALTER TABLE orders ADD CONSTRAINT orders_merchants_fk FOREIGN KEY (merchant_id) REFERENCES merchants (merchant_id);
+
+CREATE INDEX orders_merchant_status_idx ON orders (merchant_id, status, uploaded_at);
+
+COMMIT;
@@ -0,0 +1,5 @@
+START TRANSACTION;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS base_accrual;
+
+COMMIT;
@@ -0,0 +1,6 @@
+START TRANSACTION;
+
+ALTER TABLE orders ADD COLUMN base_accrual double precision;
+UPDATE orders SET base_accrual = accrual WHERE status = 'PROCESSED';
+
+COMMIT;
@@ -0,0 +1,13 @@
+START TRANSACTION;
+
+CREATE TABLE withdrawal_lots (
+	withdrawal_id bigint NOT NULL,
+	lot_id bigint NOT NULL,
+	sum double precision NOT NULL,
+	CONSTRAINT withdrawal_lots_pk PRIMARY KEY (withdrawal_id, lot_id),
+	CONSTRAINT withdrawal_lots_withdrawals_fk FOREIGN KEY (withdrawal_id) REFERENCES withdrawals (withdrawal_id),
+	CONSTRAINT withdrawal_lots_lots_fk FOREIGN KEY (lot_id) REFERENCES point_lots (lot_id),
+	CONSTRAINT withdrawal_lots_sum_check CHECK (sum >= 0)
+);
+
+COMMIT;
@@ -0,0 +1,5 @@
+START TRANSACTION;
+
+ALTER TABLE users DROP COLUMN IF EXISTS merchant_id;
+
+COMMIT;
@@ -0,0 +1,6 @@
+START TRANSACTION;
+
+ALTER TABLE users ADD COLUMN merchant_id text;
+ALTER TABLE users ADD CONSTRAINT users_merchants_fk FOREIGN KEY (merchant_id) REFERENCES merchants (merchant_id);
+
+COMMIT;
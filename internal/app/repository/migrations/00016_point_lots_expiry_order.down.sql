@@ -0,0 +1,6 @@
+START TRANSACTION;
+
+DROP INDEX IF EXISTS point_lots_user_id_idx;
+CREATE INDEX point_lots_user_id_idx ON point_lots (user_id, accrued_at, lot_id) WHERE remaining > 0;
+
+COMMIT;
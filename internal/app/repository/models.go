@@ -1,21 +1,29 @@
 package repository
 
 import (
+	"math"
+	"slices"
 	"time"
 
+	"github.com/RexArseny/loyalty_system/internal/app/models"
 	"github.com/google/uuid"
 )
 
 type User struct {
-	Login  string
-	Hash   string
-	Salt   string
-	UserID uuid.UUID
+	MerchantID   *string
+	Login        string
+	Hash         string
+	Salt         string
+	Role         string
+	ReferralCode string
+	UserID       uuid.UUID
+	Disabled     bool
 }
 
 type Order struct {
 	UploadedAt time.Time
 	Accrual    *float64
+	MerchantID *string
 	Number     string
 	Status     string
 	UserID     uuid.UUID
@@ -23,6 +31,7 @@ type Order struct {
 
 type Balance struct {
 	Current   float64
+	Held      float64
 	Withdrawn float64
 }
 
@@ -30,4 +39,186 @@ type Withdraw struct {
 	ProcessedAt time.Time
 	Order       string
 	Sum         float64
+	Reversed    float64
+}
+
+type AdminAction struct {
+	CreatedAt   time.Time
+	Amount      *float64
+	UserID      *uuid.UUID
+	Action      string
+	OrderNumber string
+	Reason      string
+	Comment     string
+	AdminID     uuid.UUID
+}
+
+type PointLot struct {
+	AccruedAt time.Time
+	ExpiresAt *time.Time
+	Order     string
+	Amount    float64
+	Remaining float64
+}
+
+type PointExpiration struct {
+	ExpiredAt time.Time
+	Order     string
+	Sum       float64
+	UserID    uuid.UUID
+}
+
+type Transfer struct {
+	ProcessedAt time.Time
+	FromLogin   string
+	ToLogin     string
+	Sum         float64
+	FromUserID  uuid.UUID
+	ToUserID    uuid.UUID
+}
+
+type Reversal struct {
+	CreatedAt   time.Time
+	ReversalID  string
+	Order       string
+	Sum         float64
+	UserID      uuid.UUID
+	InitiatorID uuid.UUID
+}
+
+type Hold struct {
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	FinishedAt *time.Time
+	Order      string
+	Status     string
+	Sum        float64
+	HoldID     uuid.UUID
+	UserID     uuid.UUID
+}
+
+// TierPolicy applies loyalty tier multipliers to accruals. Accruals from the
+// accrual service processed since Since count towards a tier, the tier stored
+// for a user is only a cache of the last computed one.
+type TierPolicy struct {
+	Since time.Time
+	Tiers models.LoyaltyTiers
+}
+
+// accrual returns the points credited for an accrual of a user with the points
+// accrued in the window.
+func (p *TierPolicy) accrual(accrued float64, accrual float64) float64 {
+	index := p.Tiers.ForAccrual(accrued)
+	return math.Round(accrual*p.Tiers[index].Multiplier*100) / 100
+}
+
+type Campaign struct {
+	StartsAt   time.Time
+	EndsAt     time.Time
+	CreatedAt  time.Time
+	Multiplier *float64
+	Bonus      *float64
+	Budget     *float64
+	Name       string
+	Tiers      []string
+	UserIDs    []uuid.UUID
+	Spent      float64
+	CampaignID uuid.UUID
+	CreatedBy  uuid.UUID
+}
+
+// eligible reports whether an order of the user in the tier processed at the
+// moment gets a bonus from the campaign.
+func (c *Campaign) eligible(userID uuid.UUID, tier string, now time.Time) bool {
+	if now.Before(c.StartsAt) || !now.Before(c.EndsAt) {
+		return false
+	}
+	if len(c.UserIDs) != 0 && !slices.Contains(c.UserIDs, userID) {
+		return false
+	}
+	if len(c.Tiers) != 0 && !slices.Contains(c.Tiers, tier) {
+		return false
+	}
+	return true
+}
+
+// bonus returns the points the campaign adds to an accrual, limited by what
+// is left of its budget.
+func (c *Campaign) bonus(accrual float64) float64 {
+	var bonus float64
+	if c.Multiplier != nil {
+		bonus = accrual * (*c.Multiplier - 1)
+	}
+	if c.Bonus != nil {
+		bonus += *c.Bonus
+	}
+	bonus = math.Round(bonus*100) / 100
+	if c.Budget != nil {
+		bonus = min(bonus, *c.Budget-c.Spent)
+	}
+	return max(bonus, 0)
+}
+
+type CampaignBonus struct {
+	CreatedAt    time.Time
+	Order        string
+	CampaignName string
+	Sum          float64
+	CampaignID   uuid.UUID
+	UserID       uuid.UUID
+}
+
+type LoyaltyStatus struct {
+	Tier    string
+	Accrued float64
+}
+
+// ReferralPolicy links a new user to the owner of Code. The referral is
+// rejected when the referrer brought DailyLimit users since Since, the
+// referrer gets no bonus after MaxRewards rewarded referrals. Zero limits are
+// not checked.
+type ReferralPolicy struct {
+	Since      time.Time
+	Code       string
+	Bonus      float64
+	DailyLimit int
+	MaxRewards int
+}
+
+type Referral struct {
+	CreatedAt     time.Time
+	RewardedAt    *time.Time
+	RefereeLogin  string
+	ReferrerLogin string
+	ReferrerBonus float64
+	RefereeBonus  float64
+	RefereeID     uuid.UUID
+	ReferrerID    uuid.UUID
+}
+
+type Referrals struct {
+	ReferredBy *Referral
+	Code       string
+	Referrals  []Referral
+}
+
+// Merchant is a partner chain running its own accrual service. RateLimit is
+// the number of requests per second to the service, 0 means no limit.
+type Merchant struct {
+	CreatedAt      time.Time
+	OrderPrefix    *string
+	MerchantID     string
+	Name           string
+	AccrualAddress string
+	RateLimit      float64
+}
+
+// StatementEntry is a change of the balance of a user. Amount is negative for
+// debits and Balance is the balance after the change.
+type StatementEntry struct {
+	CreatedAt time.Time
+	Type      string
+	Order     string
+	Amount    float64
+	Balance   float64
 }
@@ -2,160 +2,239 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"math/rand/v2"
+	"time"
 
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
 )
 
-const (
-	retry      = 3
-	connClosed = "conn closed"
-)
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+type PoolLimits struct {
+	MaxConns        int
+	MinConns        int
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+}
 
 type Pool struct {
 	*pgxpool.Pool
+	logger *zap.Logger
+	policy RetryPolicy
 }
 
 type Row struct {
 	pgx.Row
 	retry func() pgx.Row
+	pool  *Pool
+	ctx   context.Context
 }
 
-type Tx struct {
-	pgx.Tx
-}
-
-type BatchResults struct {
-	pgx.BatchResults
-	retry func() pgx.BatchResults
-}
+func NewPool(
+	ctx context.Context,
+	logger *zap.Logger,
+	connString string,
+	policy RetryPolicy,
+	limits PoolLimits,
+) (*Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse database uri: %w", err)
+	}
+	if limits.MaxConns > 0 {
+		poolConfig.MaxConns = int32(limits.MaxConns)
+	}
+	if limits.MinConns > 0 {
+		poolConfig.MinConns = int32(limits.MinConns)
+	}
+	if limits.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = limits.MaxConnLifetime
+	}
+	if limits.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = limits.MaxConnIdleTime
+	}
 
-func NewPool(ctx context.Context, connString string) (*Pool, error) {
-	pool, err := pgxpool.New(ctx, connString)
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("can not create new pool for PostgreSQL server: %w", err)
 	}
 	return &Pool{
-		Pool: pool,
+		Pool:   pool,
+		logger: logger,
+		policy: policy,
 	}, nil
 }
 
 func (r *Row) Scan(dest ...any) error {
-	var err error
-	for range retry {
-		err = r.Row.Scan(dest...)
-		if err == nil {
-			return nil
+	first := true
+	return r.pool.retry(r.ctx, pgconn.SafeToRetry, func() error {
+		if !first {
+			r.Row = r.retry()
 		}
-		if !strings.Contains(err.Error(), connClosed) {
-			return err
-		}
-		r.Row = r.retry()
-	}
-
-	return err
+		first = false
+		return r.Row.Scan(dest...)
+	})
 }
 
 func (p *Pool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
-	row := p.Pool.QueryRow(ctx, sql, args...)
 	return &Row{
-		Row: row,
+		Row: p.Pool.QueryRow(ctx, sql, args...),
 		retry: func() pgx.Row {
 			return p.Pool.QueryRow(ctx, sql, args...)
 		},
+		pool: p,
+		ctx:  ctx,
 	}
 }
 
-func (p *Pool) Begin(ctx context.Context) (pgx.Tx, error) {
-	var err error
-	for range retry {
-		var tx pgx.Tx
-		tx, err = p.Pool.Begin(ctx)
-		if err == nil {
-			return &Tx{
-				Tx: tx,
-			}, nil
-		}
-		if !strings.Contains(err.Error(), connClosed) {
-			return nil, err
-		}
+func (p *Pool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	var rows pgx.Rows
+	err := p.retry(ctx, pgconn.SafeToRetry, func() error {
+		var err error
+		rows, err = p.Pool.Query(ctx, sql, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, err
+	return rows, nil
 }
 
-func (t *Tx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
-	var err error
-	for range retry {
-		var rows pgx.Rows
-		rows, err = t.Tx.Query(ctx, sql, args...)
-		if err == nil {
-			return rows, nil
-		}
-		if !strings.Contains(err.Error(), connClosed) {
-			return nil, err
-		}
+func (p *Pool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	var commandTag pgconn.CommandTag
+	err := p.retry(ctx, pgconn.SafeToRetry, func() error {
+		var err error
+		commandTag, err = p.Pool.Exec(ctx, sql, args...)
+		return err
+	})
+	if err != nil {
+		return pgconn.CommandTag{}, err
 	}
 
-	return nil, err
+	return commandTag, nil
 }
 
-func (t *Tx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
-	batchResults := t.Tx.SendBatch(ctx, b)
-	return &BatchResults{
-		BatchResults: batchResults,
-		retry: func() pgx.BatchResults {
-			return t.Tx.SendBatch(ctx, b)
-		},
+func (p *Pool) Begin(ctx context.Context) (pgx.Tx, error) {
+	var tx pgx.Tx
+	err := p.retry(ctx, isRetryable, func() error {
+		var err error
+		tx, err = p.Pool.Begin(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+
+	return tx, nil
 }
 
-func (t *Tx) Commit(ctx context.Context) error {
-	var err error
-	for range retry {
-		err = t.Tx.Commit(ctx)
-		if err == nil {
-			return nil
+func (p *Pool) Ping(ctx context.Context) error {
+	return p.retry(ctx, isRetryable, func() error {
+		return p.Pool.Ping(ctx)
+	})
+}
+
+// InTx runs action in a transaction and commits it. The whole transaction
+// is retried when it fails with a retryable error, so action must not have
+// side effects outside of tx.
+func (p *Pool) InTx(ctx context.Context, action func(tx pgx.Tx) error) error {
+	return p.retry(ctx, isRetryable, func() error {
+		tx, err := p.Pool.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("can not start transaction: %w", err)
 		}
-		if !strings.Contains(err.Error(), connClosed) {
+		defer func() {
+			err = tx.Rollback(context.Background())
+			if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+				p.logger.Error("Can not rollback transaction", zap.Error(err))
+			}
+		}()
+
+		err = action(tx)
+		if err != nil {
 			return err
 		}
-	}
 
-	return err
+		err = tx.Commit(ctx)
+		if err != nil {
+			return fmt.Errorf("can not commit transaction: %w", err)
+		}
+
+		return nil
+	})
 }
 
-func (b *BatchResults) Exec() (pgconn.CommandTag, error) {
+// retry runs action until it succeeds, fails with an error retryable does
+// not accept or runs out of attempts.
+func (p *Pool) retry(ctx context.Context, retryable func(err error) bool, action func() error) error {
 	var err error
-	for range retry {
-		var commandTag pgconn.CommandTag
-		commandTag, err = b.BatchResults.Exec()
-		if err == nil {
-			return commandTag, nil
+	for attempt := 0; ; attempt++ {
+		err = action()
+		if err == nil || !retryable(err) || attempt+1 >= p.policy.MaxAttempts {
+			return err
 		}
-		if !strings.Contains(err.Error(), connClosed) {
-			return pgconn.CommandTag{}, err
+
+		backoff := p.policy.backoff(attempt)
+		p.logger.Warn("Retrying database operation",
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
 		}
-		b.BatchResults = b.retry()
 	}
+}
 
-	return pgconn.CommandTag{}, err
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 0; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, p.MaxBackoff)
+	if backoff <= 0 {
+		return 0
+	}
+
+	return rand.N(backoff + 1)
 }
 
-func (p *Pool) Ping(ctx context.Context) error {
-	var err error
-	for range retry {
-		err = p.Pool.Ping(ctx)
-		if err == nil {
-			return nil
-		}
-		if !strings.Contains(err.Error(), connClosed) {
-			return err
-		}
+// isRetryable reports whether a whole transaction, a begin or a ping may be
+// repeated after err. Single statements outside of a transaction are repeated
+// only when pgconn.SafeToRetry reports that they were never sent, since a
+// statement failing with a lost connection may have been applied already.
+func isRetryable(err error) bool {
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code {
+	case pgerrcode.SerializationFailure,
+		pgerrcode.DeadlockDetected,
+		pgerrcode.CannotConnectNow:
+		return true
+	case pgerrcode.TransactionResolutionUnknown:
+		return false
 	}
 
-	return err
+	return pgerrcode.IsConnectionException(pgErr.Code)
 }
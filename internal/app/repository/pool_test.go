@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/logger"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "serialization failure",
+			err:  fmt.Errorf("can not update: %w", &pgconn.PgError{Code: pgerrcode.SerializationFailure}),
+			want: true,
+		},
+		{
+			name: "deadlock",
+			err:  &pgconn.PgError{Code: pgerrcode.DeadlockDetected},
+			want: true,
+		},
+		{
+			name: "connection failure",
+			err:  &pgconn.PgError{Code: pgerrcode.ConnectionFailure},
+			want: true,
+		},
+		{
+			name: "transaction resolution unknown",
+			err:  &pgconn.PgError{Code: pgerrcode.TransactionResolutionUnknown},
+			want: false,
+		},
+		{
+			name: "unique violation",
+			err:  &pgconn.PgError{Code: pgerrcode.UniqueViolation},
+			want: false,
+		},
+		{
+			name: "not a database error",
+			err:  ErrNotEnoughBalance,
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isRetryable(tt.err))
+		})
+	}
+}
+
+func TestPoolRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		retryable    func(err error) bool
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "success",
+			retryable:    isRetryable,
+			failures:     0,
+			wantAttempts: 1,
+			wantErr:      false,
+		},
+		{
+			name:         "retryable error",
+			err:          &pgconn.PgError{Code: pgerrcode.SerializationFailure},
+			retryable:    isRetryable,
+			failures:     2,
+			wantAttempts: 3,
+			wantErr:      false,
+		},
+		{
+			name:         "attempts exhausted",
+			err:          &pgconn.PgError{Code: pgerrcode.DeadlockDetected},
+			retryable:    isRetryable,
+			failures:     5,
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+		{
+			name:         "not retryable error",
+			err:          errors.New("test error"),
+			retryable:    isRetryable,
+			failures:     5,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "statement after serialization failure",
+			err:          &pgconn.PgError{Code: pgerrcode.SerializationFailure},
+			retryable:    pgconn.SafeToRetry,
+			failures:     5,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "statement after connection failure",
+			err:          &pgconn.PgError{Code: pgerrcode.ConnectionFailure},
+			retryable:    pgconn.SafeToRetry,
+			failures:     5,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testLogger, err := logger.InitLogger()
+			require.NoError(t, err)
+			pool := &Pool{
+				logger: testLogger.Named("pool"),
+				policy: RetryPolicy{
+					MaxAttempts:    3,
+					InitialBackoff: time.Millisecond,
+					MaxBackoff:     2 * time.Millisecond,
+				},
+			}
+
+			var attempts int
+			err = pool.retry(context.Background(), tt.retryable, func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantAttempts, attempts)
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     100 * time.Millisecond,
+	}
+	for attempt := range 64 {
+		backoff := policy.backoff(attempt)
+		assert.GreaterOrEqual(t, backoff, time.Duration(0))
+		assert.LessOrEqual(t, backoff, min(policy.InitialBackoff<<min(attempt, 4), policy.MaxBackoff))
+	}
+}
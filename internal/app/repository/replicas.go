@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type replica struct {
+	pool    *Pool
+	healthy atomic.Bool
+}
+
+type ReplicaRouter struct {
+	logger         *zap.Logger
+	primary        *Pool
+	recentWrites   map[uuid.UUID]time.Time
+	cancel         context.CancelFunc
+	replicas       []*replica
+	wg             sync.WaitGroup
+	next           atomic.Uint64
+	readYourWrites time.Duration
+	m              sync.Mutex
+}
+
+func NewReplicaRouter(
+	ctx context.Context,
+	logger *zap.Logger,
+	primary *Pool,
+	connStrings []string,
+	policy RetryPolicy,
+	limits PoolLimits,
+	healthCheckInterval time.Duration,
+	readYourWrites time.Duration,
+) (*ReplicaRouter, error) {
+	router := &ReplicaRouter{
+		logger:         logger,
+		primary:        primary,
+		recentWrites:   make(map[uuid.UUID]time.Time),
+		readYourWrites: readYourWrites,
+	}
+
+	for _, connString := range connStrings {
+		pool, err := NewPool(ctx, logger, connString, policy, limits)
+		if err != nil {
+			router.closeReplicas()
+			return nil, fmt.Errorf("can not create replica pool: %w", err)
+		}
+		router.replicas = append(router.replicas, &replica{
+			pool: pool,
+		})
+	}
+
+	checkCtx, cancel := context.WithCancel(context.Background())
+	router.cancel = cancel
+	router.checkHealth(ctx)
+	if len(router.replicas) > 0 && healthCheckInterval > 0 {
+		router.wg.Add(1)
+		go router.runHealthCheck(checkCtx, healthCheckInterval)
+	}
+
+	return router, nil
+}
+
+func (r *ReplicaRouter) Read(ctx context.Context, userID uuid.UUID, action func(pool *Pool) error) error {
+	pool := r.reader(userID)
+	err := action(pool)
+	if err == nil || pool == r.primary || !isRetryable(err) {
+		return err
+	}
+
+	r.logger.Warn("Replica read failed, falling back to primary", zap.Error(err))
+	r.markUnhealthy(pool)
+
+	return action(r.primary)
+}
+
+func (r *ReplicaRouter) Written(userID uuid.UUID) {
+	if r.readYourWrites <= 0 || len(r.replicas) == 0 {
+		return
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.recentWrites[userID] = time.Now()
+}
+
+func (r *ReplicaRouter) Close() {
+	r.cancel()
+	r.wg.Wait()
+	r.closeReplicas()
+}
+
+func (r *ReplicaRouter) reader(userID uuid.UUID) *Pool {
+	if len(r.replicas) == 0 || r.wroteRecently(userID) {
+		return r.primary
+	}
+
+	start := r.next.Add(1)
+	for i := range uint64(len(r.replicas)) {
+		replica := r.replicas[(start+i)%uint64(len(r.replicas))]
+		if replica.healthy.Load() {
+			return replica.pool
+		}
+	}
+
+	return r.primary
+}
+
+func (r *ReplicaRouter) wroteRecently(userID uuid.UUID) bool {
+	if r.readYourWrites <= 0 {
+		return false
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	writtenAt, ok := r.recentWrites[userID]
+	if !ok {
+		return false
+	}
+	if time.Since(writtenAt) > r.readYourWrites {
+		delete(r.recentWrites, userID)
+		return false
+	}
+
+	return true
+}
+
+func (r *ReplicaRouter) markUnhealthy(pool *Pool) {
+	for _, replica := range r.replicas {
+		if replica.pool == pool {
+			replica.healthy.Store(false)
+		}
+	}
+}
+
+func (r *ReplicaRouter) runHealthCheck(ctx context.Context, interval time.Duration) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.checkHealth(ctx)
+			r.forgetWrites()
+		}
+	}
+}
+
+func (r *ReplicaRouter) checkHealth(ctx context.Context) {
+	for i, replica := range r.replicas {
+		err := replica.pool.Pool.Ping(ctx)
+		healthy := err == nil
+		if replica.healthy.Swap(healthy) != healthy {
+			if healthy {
+				r.logger.Info("Replica is healthy", zap.Int("replica", i))
+			} else {
+				r.logger.Warn("Replica is unhealthy", zap.Int("replica", i), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (r *ReplicaRouter) forgetWrites() {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for userID, writtenAt := range r.recentWrites {
+		if time.Since(writtenAt) > r.readYourWrites {
+			delete(r.recentWrites, userID)
+		}
+	}
+}
+
+func (r *ReplicaRouter) closeReplicas() {
+	for _, replica := range r.replicas {
+		replica.pool.Close()
+	}
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/logger"
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReplicaRouter(t *testing.T, healthy ...bool) *ReplicaRouter {
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+
+	router := &ReplicaRouter{
+		logger:         testLogger.Named("replicas"),
+		primary:        &Pool{},
+		recentWrites:   make(map[uuid.UUID]time.Time),
+		readYourWrites: time.Minute,
+	}
+	for _, value := range healthy {
+		replica := &replica{
+			pool: &Pool{},
+		}
+		replica.healthy.Store(value)
+		router.replicas = append(router.replicas, replica)
+	}
+
+	return router
+}
+
+func TestReplicaRouterReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		healthy []bool
+		want    []int
+	}{
+		{
+			name:    "no replicas",
+			healthy: nil,
+			want:    []int{-1, -1, -1},
+		},
+		{
+			name:    "round robin",
+			healthy: []bool{true, true},
+			want:    []int{1, 0, 1, 0},
+		},
+		{
+			name:    "skip unhealthy",
+			healthy: []bool{true, false, true},
+			want:    []int{2, 2, 0, 2},
+		},
+		{
+			name:    "all unhealthy",
+			healthy: []bool{false, false},
+			want:    []int{-1, -1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestReplicaRouter(t, tt.healthy...)
+
+			for _, want := range tt.want {
+				pool := router.reader(uuid.New())
+				if want < 0 {
+					assert.Same(t, router.primary, pool)
+					continue
+				}
+				assert.Same(t, router.replicas[want].pool, pool)
+			}
+		})
+	}
+}
+
+func TestReplicaRouterReadYourWrites(t *testing.T) {
+	router := newTestReplicaRouter(t, true)
+	userID := uuid.New()
+
+	assert.Same(t, router.replicas[0].pool, router.reader(userID))
+
+	router.Written(userID)
+	assert.Same(t, router.primary, router.reader(userID))
+	assert.Same(t, router.replicas[0].pool, router.reader(uuid.New()))
+
+	router.recentWrites[userID] = time.Now().Add(-2 * time.Minute)
+	assert.Same(t, router.replicas[0].pool, router.reader(userID))
+}
+
+func TestReplicaRouterReadFallback(t *testing.T) {
+	router := newTestReplicaRouter(t, true)
+
+	var pools []*Pool
+	err := router.Read(context.Background(), uuid.New(), func(pool *Pool) error {
+		pools = append(pools, pool)
+		if pool != router.primary {
+			return &pgconn.PgError{Code: pgerrcode.ConnectionFailure}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, pools, 2)
+	assert.Same(t, router.replicas[0].pool, pools[0])
+	assert.Same(t, router.primary, pools[1])
+	assert.False(t, router.replicas[0].healthy.Load())
+
+	err = router.Read(context.Background(), uuid.New(), func(pool *Pool) error {
+		return ErrNoOrders
+	})
+	assert.ErrorIs(t, err, ErrNoOrders)
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/RexArseny/loyalty_system/internal/app/config"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
@@ -13,6 +15,37 @@ var (
 	ErrNoOrders         = errors.New("no orders")
 	ErrNotEnoughBalance = errors.New("not enough balance")
 	ErrNoWithdrawals    = errors.New("no withdrawals")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrInvalidSum       = errors.New("invalid sum")
+	ErrUserDisabled     = errors.New("user disabled")
+	ErrOrderNotFound    = errors.New("order not found")
+	ErrOrderProcessed   = errors.New("order already processed")
+	ErrNoTransfers      = errors.New("no transfers")
+	ErrSelfTransfer     = errors.New("transfer to self")
+	ErrTransferLimit    = errors.New("transfer limit exceeded")
+	ErrNoWithdrawal     = errors.New("withdrawal not found")
+	ErrReversed         = errors.New("withdrawal already reversed")
+	ErrReversalConflict = errors.New("reversal id already used")
+	ErrInvalidReversal  = errors.New("invalid reversal id")
+	ErrNoHolds          = errors.New("no holds")
+	ErrHoldNotFound     = errors.New("hold not found")
+	ErrHoldExists       = errors.New("active hold for order already exists")
+	ErrHoldFinished     = errors.New("hold already finished")
+	ErrHoldExpired      = errors.New("hold expired")
+	ErrNoTiers          = errors.New("loyalty tiers are disabled")
+	ErrNoCampaigns      = errors.New("no campaigns")
+	ErrCampaignNotFound = errors.New("campaign not found")
+	ErrCampaignEnded    = errors.New("campaign already ended")
+	ErrInvalidCampaign  = errors.New("invalid campaign")
+	ErrReferralCode     = errors.New("referral code not found")
+	ErrReferralCodeUsed = errors.New("referral code already exists")
+	ErrReferralLimit    = errors.New("referral limit reached")
+	ErrEmptyBatch       = errors.New("empty batch")
+	ErrBatchTooLarge    = errors.New("batch too large")
+	ErrNoMerchants      = errors.New("no merchants")
+	ErrMerchantNotFound = errors.New("merchant not found")
+	ErrMerchantExists   = errors.New("merchant or order prefix already exists")
+	ErrInvalidMerchant  = errors.New("invalid merchant")
 )
 
 type Repository interface {
@@ -22,16 +55,37 @@ type Repository interface {
 		hash string,
 		salt string,
 		userID uuid.UUID,
+		referralCode string,
+		referral *ReferralPolicy,
 	) error
 	GetUser(
 		ctx context.Context,
 		login string,
 	) (*User, error)
+	// SetUserRole sets the role of the user and links the user to the
+	// merchant, an empty merchant ID removes the link.
+	SetUserRole(
+		ctx context.Context,
+		login string,
+		role string,
+		merchantID string,
+	) error
+	// AddOrder adds an order of the merchant, an empty merchant ID selects
+	// the merchant with the longest order prefix matching the number.
 	AddOrder(
 		ctx context.Context,
 		orderNumber string,
+		merchantID string,
 		userID uuid.UUID,
 	) error
+	// AddOrders adds the orders in one transaction and returns the result of
+	// every order in the same order, nil for added orders.
+	AddOrders(
+		ctx context.Context,
+		orderNumbers []string,
+		merchantID string,
+		userID uuid.UUID,
+	) ([]error, error)
 	GetOrders(
 		ctx context.Context,
 		userID uuid.UUID,
@@ -50,8 +104,12 @@ type Repository interface {
 		ctx context.Context,
 		userID uuid.UUID,
 	) ([]Withdraw, error)
+	// GetOrdersForUpdate returns the new orders of the merchant, an empty
+	// merchant ID returns the orders without a merchant.
 	GetOrdersForUpdate(
 		ctx context.Context,
+		merchantID string,
+		limit int,
 	) ([]Order, error)
 	UpdateOrder(
 		ctx context.Context,
@@ -59,6 +117,136 @@ type Repository interface {
 		status string,
 		accrual *float64,
 		userID uuid.UUID,
+		expiresAt *time.Time,
+		tiers *TierPolicy,
+	) error
+	SearchUsers(
+		ctx context.Context,
+		loginPrefix string,
+		limit int,
+	) ([]User, error)
+	GetUserByID(
+		ctx context.Context,
+		userID uuid.UUID,
+	) (*User, error)
+	GetOrder(
+		ctx context.Context,
+		orderNumber string,
+	) (*Order, error)
+	AdjustBalance(
+		ctx context.Context,
+		action AdminAction,
+		expiresAt *time.Time,
+	) error
+	SetUserDisabled(
+		ctx context.Context,
+		action AdminAction,
+		disabled bool,
+	) error
+	AddAdminAction(
+		ctx context.Context,
+		action AdminAction,
+	) error
+	GetAdminActions(
+		ctx context.Context,
+		userID *uuid.UUID,
+		limit int,
+	) ([]AdminAction, error)
+	GetExpiringPoints(
+		ctx context.Context,
+		userID uuid.UUID,
+		until time.Time,
+	) ([]PointLot, error)
+	ExpirePoints(
+		ctx context.Context,
+		now time.Time,
+		limit int,
+	) ([]PointExpiration, error)
+	Transfer(
+		ctx context.Context,
+		fromUserID uuid.UUID,
+		toLogin string,
+		sum float64,
+		dailyLimit float64,
+	) error
+	GetTransfers(
+		ctx context.Context,
+		userID uuid.UUID,
+	) ([]Transfer, error)
+	// ReverseWithdrawal reverses a withdrawal, a non-empty merchant ID
+	// restricts it to withdrawals of orders of that merchant.
+	ReverseWithdrawal(
+		ctx context.Context,
+		reversalID string,
+		orderNumber string,
+		sum *float64,
+		initiatorID uuid.UUID,
+		merchantID string,
+		expiresAt *time.Time,
+	) (*Reversal, error)
+	AuthorizeHold(
+		ctx context.Context,
+		hold Hold,
+	) error
+	CaptureHold(
+		ctx context.Context,
+		userID uuid.UUID,
+		holdID uuid.UUID,
+		now time.Time,
+	) (*Hold, error)
+	VoidHold(
+		ctx context.Context,
+		userID uuid.UUID,
+		holdID uuid.UUID,
+		now time.Time,
+	) (*Hold, error)
+	GetHolds(
+		ctx context.Context,
+		userID uuid.UUID,
+	) ([]Hold, error)
+	ExpireHolds(
+		ctx context.Context,
+		now time.Time,
+		limit int,
+	) ([]Hold, error)
+	GetLoyaltyStatus(
+		ctx context.Context,
+		userID uuid.UUID,
+		since time.Time,
+	) (*LoyaltyStatus, error)
+	AddCampaign(
+		ctx context.Context,
+		campaign Campaign,
+	) error
+	EndCampaign(
+		ctx context.Context,
+		campaignID uuid.UUID,
+		now time.Time,
+	) (*Campaign, error)
+	GetCampaigns(
+		ctx context.Context,
+	) ([]Campaign, error)
+	GetCampaignBonuses(
+		ctx context.Context,
+		userID uuid.UUID,
+	) ([]CampaignBonus, error)
+	GetReferrals(
+		ctx context.Context,
+		userID uuid.UUID,
+	) (*Referrals, error)
+	AddMerchant(
+		ctx context.Context,
+		merchant Merchant,
+	) error
+	GetMerchants(
+		ctx context.Context,
+	) ([]Merchant, error)
+	GetStatement(
+		ctx context.Context,
+		userID uuid.UUID,
+		from *time.Time,
+		to *time.Time,
+		handle func(entry StatementEntry) error,
 	) error
 	Close()
 }
@@ -66,9 +254,14 @@ type Repository interface {
 func NewRepository(
 	ctx context.Context,
 	logger *zap.Logger,
-	databaseURI string,
+	cfg *config.Config,
 ) (Repository, error) {
-	dbRepository, err := NewDBRepository(ctx, logger, databaseURI)
+	if cfg.DatabaseURI == "" {
+		logger.Info("Database URI is not set, using in-memory repository")
+		return NewMemoryRepository(logger), nil
+	}
+
+	dbRepository, err := NewDBRepository(ctx, logger, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("can not init db repository: %w", err)
 	}
@@ -4,6 +4,8 @@ import (
 	"github.com/RexArseny/loyalty_system/internal/app/config"
 	"github.com/RexArseny/loyalty_system/internal/app/controllers"
 	"github.com/RexArseny/loyalty_system/internal/app/middlewares"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/openapi"
 	"github.com/gin-gonic/gin"
 )
 
@@ -11,26 +13,73 @@ func NewRouter(
 	cfg *config.Config,
 	controller controllers.Controller,
 	middleware *middlewares.Middleware,
+	validator *openapi.Validator,
 ) (*gin.Engine, error) {
 	router := gin.New()
 	router.Use(
+		middleware.ResponseAborter(),
 		gin.Recovery(),
 		middleware.Logger(),
 	)
 
-	groupWithoutJWT := router.Group("", middleware.SetJWT())
+	router.GET(openapi.SpecPath, openapi.Spec())
+	router.GET(openapi.DocsPath, openapi.Docs())
+
+	withoutJWT := []gin.HandlerFunc{middleware.SetJWT()}
+	withJWT := []gin.HandlerFunc{middleware.GetJWT(), controller.ActiveUser}
+	if validator != nil {
+		withoutJWT = []gin.HandlerFunc{validator.Validate(), middleware.SetJWT()}
+		withJWT = []gin.HandlerFunc{validator.Validate(), middleware.GetJWT(), controller.ActiveUser}
+	}
+
+	groupWithoutJWT := router.Group("", withoutJWT...)
 	{
 		groupWithoutJWT.POST("/api/user/register", controller.Registration)
 		groupWithoutJWT.POST("/api/user/login", controller.Login)
 	}
 
-	groupWithJWT := router.Group("", middleware.GetJWT())
+	groupWithJWT := router.Group("", withJWT...)
 	{
 		groupWithJWT.POST("/api/user/orders", controller.AddOrder)
+		groupWithJWT.POST("/api/user/orders/batch", controller.AddOrders)
 		groupWithJWT.GET("/api/user/orders", controller.GetOrders)
 		groupWithJWT.GET("/api/user/balance", controller.GetBalance)
 		groupWithJWT.POST("/api/user/balance/withdraw", controller.Withdraw)
 		groupWithJWT.GET("/api/user/withdrawals", controller.GetWithdrawals)
+		groupWithJWT.POST("/api/user/balance/transfer", controller.Transfer)
+		groupWithJWT.GET("/api/user/transfers", controller.GetTransfers)
+		groupWithJWT.POST("/api/user/balance/holds", controller.AuthorizeHold)
+		groupWithJWT.GET("/api/user/balance/holds", controller.GetHolds)
+		groupWithJWT.POST("/api/user/balance/holds/:hold_id/capture", controller.CaptureHold)
+		groupWithJWT.POST("/api/user/balance/holds/:hold_id/void", controller.VoidHold)
+		groupWithJWT.GET("/api/user/tier", controller.GetLoyaltyTier)
+		groupWithJWT.GET("/api/user/referrals", controller.GetReferrals)
+		groupWithJWT.GET("/api/user/statement", controller.GetStatement)
+	}
+
+	groupReversals := router.Group("/api/withdrawals",
+		append(withJWT, middleware.RequireRoles(models.RoleAdmin, models.RoleMerchant))...)
+	{
+		groupReversals.POST("/:number/reversals", controller.ReverseWithdrawal)
+	}
+
+	groupAdmin := router.Group("/api/admin", append(withJWT, middleware.RequireRoles(models.RoleAdmin))...)
+	{
+		groupAdmin.GET("/users", controller.AdminSearchUsers)
+		groupAdmin.GET("/users/:user_id", controller.AdminGetUser)
+		groupAdmin.GET("/users/:user_id/orders", controller.AdminGetOrders)
+		groupAdmin.GET("/users/:user_id/withdrawals", controller.AdminGetWithdrawals)
+		groupAdmin.GET("/users/:user_id/balance", controller.AdminGetBalance)
+		groupAdmin.POST("/users/:user_id/adjustments", controller.AdminAdjustBalance)
+		groupAdmin.POST("/users/:user_id/disable", controller.AdminDisableUser)
+		groupAdmin.POST("/users/:user_id/enable", controller.AdminEnableUser)
+		groupAdmin.POST("/orders/:number/recheck", controller.AdminRecheckOrder)
+		groupAdmin.GET("/actions", controller.AdminGetActions)
+		groupAdmin.POST("/campaigns", controller.AdminCreateCampaign)
+		groupAdmin.GET("/campaigns", controller.AdminGetCampaigns)
+		groupAdmin.POST("/campaigns/:campaign_id/end", controller.AdminEndCampaign)
+		groupAdmin.POST("/merchants", controller.AdminCreateMerchant)
+		groupAdmin.GET("/merchants", controller.AdminGetMerchants)
 	}
 
 	return router, nil
@@ -0,0 +1,1384 @@
+package routers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/config"
+	"github.com/RexArseny/loyalty_system/internal/app/controllers"
+	"github.com/RexArseny/loyalty_system/internal/app/external"
+	"github.com/RexArseny/loyalty_system/internal/app/logger"
+	"github.com/RexArseny/loyalty_system/internal/app/middlewares"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/openapi"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/RexArseny/loyalty_system/internal/app/usecases"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = &config.Config{
+	PublicKeyPath:        "../../../public.pem",
+	PrivateKeyPath:       "../../../private.pem",
+	StatusCheckInterval:  time.Hour,
+	StatusCheckBatchSize: config.DefaultStatusCheckBatchSize,
+	CookieMaxAge:         config.DefaultCookieMaxAge,
+	CookiePath:           config.DefaultCookiePath,
+	HoldTTL:              time.Hour,
+	LoyaltyTiers:         []string{"silver:0:1", "gold:1000:1.1"},
+	ReferralBonus:        50,
+	OrderBatchMaxSize:    3,
+}
+
+func newTestRouter(t *testing.T) (*gin.Engine, *repository.MemoryRepository) {
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+
+	dataRepository := repository.NewMemoryRepository(testLogger.Named("repository"))
+	return newTestRouterWithRepository(t, dataRepository), dataRepository
+}
+
+func newTestRouterWithRepository(t *testing.T, dataRepository repository.Repository) *gin.Engine {
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	interactor := usecases.NewInteractor(
+		ctx,
+		testLogger.Named("interactor"),
+		testConfig,
+		dataRepository,
+		external.NewAccrualServiceClient(testLogger.Named("accrual"), "", 0),
+	)
+	controller := controllers.NewController(testLogger.Named("controller"), interactor)
+	middleware, err := middlewares.NewMiddleware(testConfig, testLogger.Named("middleware"))
+	require.NoError(t, err)
+
+	doc, err := openapi.Load(ctx)
+	require.NoError(t, err)
+	validator, err := openapi.NewValidator(testLogger.Named("openapi"), doc, true)
+	require.NoError(t, err)
+
+	router, err := NewRouter(testConfig, controller, middleware, validator)
+	require.NoError(t, err)
+
+	return router
+}
+
+var specParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+func TestRouterMatchesSpec(t *testing.T) {
+	doc, err := openapi.Load(context.Background())
+	require.NoError(t, err)
+
+	documented := make(map[string]struct{})
+	for path, item := range doc.Paths.Map() {
+		path = specParam.ReplaceAllString(path, ":$1")
+		for method := range item.Operations() {
+			documented[method+" "+path] = struct{}{}
+		}
+	}
+
+	router, _ := newTestRouter(t)
+	routes := make(map[string]struct{})
+	for _, route := range router.Routes() {
+		if route.Path == openapi.SpecPath || route.Path == openapi.DocsPath {
+			continue
+		}
+		routes[route.Method+" "+route.Path] = struct{}{}
+	}
+
+	assert.Equal(t, documented, routes)
+}
+
+func TestRouterResponsesMatchSpec(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	var cookies []*http.Cookie
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		statusCode  int
+	}{
+		{
+			name:        "register",
+			method:      http.MethodPost,
+			path:        "/api/user/register",
+			contentType: "application/json",
+			body:        `{"login":"testlogin","password":"testpassword"}`,
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "register twice",
+			method:      http.MethodPost,
+			path:        "/api/user/register",
+			contentType: "application/json",
+			body:        `{"login":"testlogin","password":"testpassword"}`,
+			statusCode:  http.StatusConflict,
+		},
+		{
+			name:        "register without password",
+			method:      http.MethodPost,
+			path:        "/api/user/register",
+			contentType: "application/json",
+			body:        `{"login":"testlogin"}`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "login",
+			method:      http.MethodPost,
+			path:        "/api/user/login",
+			contentType: "application/json",
+			body:        `{"login":"testlogin","password":"testpassword"}`,
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:       "no orders",
+			method:     http.MethodGet,
+			path:       "/api/user/orders",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:        "add order",
+			method:      http.MethodPost,
+			path:        "/api/user/orders",
+			contentType: "text/plain",
+			body:        "12345678903",
+			statusCode:  http.StatusAccepted,
+		},
+		{
+			name:        "add invalid order",
+			method:      http.MethodPost,
+			path:        "/api/user/orders",
+			contentType: "text/plain",
+			body:        "12345678902",
+			statusCode:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "orders",
+			method:     http.MethodGet,
+			path:       "/api/user/orders",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "balance",
+			method:     http.MethodGet,
+			path:       "/api/user/balance",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:        "withdraw",
+			method:      http.MethodPost,
+			path:        "/api/user/balance/withdraw",
+			contentType: "application/json",
+			body:        `{"order":"2377225624","sum":10}`,
+			statusCode:  http.StatusPaymentRequired,
+		},
+		{
+			name:       "no withdrawals",
+			method:     http.MethodGet,
+			path:       "/api/user/withdrawals",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:        "transfer to unknown user",
+			method:      http.MethodPost,
+			path:        "/api/user/balance/transfer",
+			contentType: "application/json",
+			body:        `{"login":"unknown","sum":10}`,
+			statusCode:  http.StatusNotFound,
+		},
+		{
+			name:        "transfer to self",
+			method:      http.MethodPost,
+			path:        "/api/user/balance/transfer",
+			contentType: "application/json",
+			body:        `{"login":"testlogin","sum":10}`,
+			statusCode:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "no transfers",
+			method:     http.MethodGet,
+			path:       "/api/user/transfers",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "loyalty tier",
+			method:     http.MethodGet,
+			path:       "/api/user/tier",
+			statusCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				request.Header.Set("Content-Type", tt.contentType)
+			}
+			for _, cookie := range cookies {
+				request.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			if len(result.Cookies()) > 0 {
+				cookies = result.Cookies()
+			}
+		})
+	}
+}
+
+func TestRouterAdminResponsesMatchSpec(t *testing.T) {
+	router, dataRepository := newTestRouter(t)
+
+	serve := func(method string, path string, body string, cookies []*http.Cookie) *http.Response {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+	login := func(path string, login string) []*http.Cookie {
+		result := serve(http.MethodPost, path, `{"login":"`+login+`","password":"testpassword"}`, nil)
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		return result.Cookies()
+	}
+
+	userCookies := login("/api/user/register", "testlogin")
+	login("/api/user/register", "testadmin")
+	err := dataRepository.SetUserRole(context.Background(), "testadmin", string(models.RoleAdmin), "")
+	require.NoError(t, err)
+	adminCookies := login("/api/user/login", "testadmin")
+
+	result := serve(http.MethodGet, "/api/admin/users?login=testlogin", "", adminCookies)
+	var users []models.AdminUserResponse
+	err = json.NewDecoder(result.Body).Decode(&users)
+	require.NoError(t, err)
+	result.Body.Close()
+	require.Len(t, users, 1)
+	userPath := "/api/admin/users/" + users[0].UserID
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		cookies    []*http.Cookie
+		statusCode int
+	}{
+		{
+			name:       "not an admin",
+			method:     http.MethodGet,
+			path:       "/api/admin/users",
+			cookies:    userCookies,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "user",
+			method:     http.MethodGet,
+			path:       userPath,
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "unknown user",
+			method:     http.MethodGet,
+			path:       "/api/admin/users/" + uuid.NewString(),
+			cookies:    adminCookies,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "invalid user id",
+			method:     http.MethodGet,
+			path:       "/api/admin/users/testlogin",
+			cookies:    adminCookies,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "no orders",
+			method:     http.MethodGet,
+			path:       userPath + "/orders",
+			cookies:    adminCookies,
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "credit",
+			method:     http.MethodPost,
+			path:       userPath + "/adjustments",
+			body:       `{"reason":"goodwill","comment":"delivery delay","amount":100}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "overdraft",
+			method:     http.MethodPost,
+			path:       userPath + "/adjustments",
+			body:       `{"reason":"correction","amount":-200}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusPaymentRequired,
+		},
+		{
+			name:       "unknown reason",
+			method:     http.MethodPost,
+			path:       userPath + "/adjustments",
+			body:       `{"reason":"because","amount":10}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "balance",
+			method:     http.MethodGet,
+			path:       userPath + "/balance",
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "disable",
+			method:     http.MethodPost,
+			path:       userPath + "/disable",
+			body:       `{"reason":"fraud"}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "disabled user",
+			method:     http.MethodGet,
+			path:       "/api/user/balance",
+			cookies:    userCookies,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "disabled login",
+			method:     http.MethodPost,
+			path:       "/api/user/login",
+			body:       `{"login":"testlogin","password":"testpassword"}`,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "enable",
+			method:     http.MethodPost,
+			path:       userPath + "/enable",
+			body:       `{"reason":"correction"}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "enabled user",
+			method:     http.MethodGet,
+			path:       "/api/user/balance",
+			cookies:    userCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "transfer",
+			method:     http.MethodPost,
+			path:       "/api/user/balance/transfer",
+			body:       `{"login":"testadmin","sum":10}`,
+			cookies:    userCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "transfers",
+			method:     http.MethodGet,
+			path:       "/api/user/transfers",
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "withdraw",
+			method:     http.MethodPost,
+			path:       "/api/user/balance/withdraw",
+			body:       `{"order":"2377225624","sum":20}`,
+			cookies:    userCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "reversal by a user",
+			method:     http.MethodPost,
+			path:       "/api/withdrawals/2377225624/reversals",
+			body:       `{"reversal_id":"r1","sum":5}`,
+			cookies:    userCookies,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "partial reversal",
+			method:     http.MethodPost,
+			path:       "/api/withdrawals/2377225624/reversals",
+			body:       `{"reversal_id":"r1","sum":5}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "repeated reversal",
+			method:     http.MethodPost,
+			path:       "/api/withdrawals/2377225624/reversals",
+			body:       `{"reversal_id":"r1","sum":5}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "conflicting reversal",
+			method:     http.MethodPost,
+			path:       "/api/withdrawals/2377225624/reversals",
+			body:       `{"reversal_id":"r1","sum":6}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "full reversal",
+			method:     http.MethodPost,
+			path:       "/api/withdrawals/2377225624/reversals",
+			body:       `{"reversal_id":"r2"}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "reversed withdrawals",
+			method:     http.MethodGet,
+			path:       "/api/user/withdrawals",
+			cookies:    userCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "unknown withdrawal",
+			method:     http.MethodPost,
+			path:       "/api/withdrawals/12345678903/reversals",
+			body:       `{"reversal_id":"r3"}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "unknown order",
+			method:     http.MethodPost,
+			path:       "/api/admin/orders/12345678903/recheck",
+			cookies:    adminCookies,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "actions",
+			method:     http.MethodGet,
+			path:       "/api/admin/actions?user_id=" + users[0].UserID,
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serve(tt.method, tt.path, tt.body, tt.cookies)
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+		})
+	}
+}
+
+func TestRouterMerchantReversals(t *testing.T) {
+	router, dataRepository := newTestRouter(t)
+
+	serve := func(path string, body string, cookies []*http.Cookie) *http.Response {
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+	login := func(path string, login string) []*http.Cookie {
+		result := serve(path, `{"login":"`+login+`","password":"testpassword"}`, nil)
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		return result.Cookies()
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	acmePrefix, globexPrefix := "4", "2"
+	err := dataRepository.AddMerchant(ctx, repository.Merchant{CreatedAt: now, OrderPrefix: &acmePrefix,
+		MerchantID: "acme", Name: "Acme", AccrualAddress: "http://localhost:8081"})
+	require.NoError(t, err)
+	err = dataRepository.AddMerchant(ctx, repository.Merchant{CreatedAt: now, OrderPrefix: &globexPrefix,
+		MerchantID: "globex", Name: "Globex", AccrualAddress: "http://localhost:8082"})
+	require.NoError(t, err)
+
+	login("/api/user/register", "testlogin")
+	user, err := dataRepository.GetUser(ctx, "testlogin")
+	require.NoError(t, err)
+	accrual := 100.0
+	err = dataRepository.AddOrder(ctx, "12345678903", "", user.UserID)
+	require.NoError(t, err)
+	err = dataRepository.UpdateOrder(ctx, "12345678903", string(external.StatusProcessed), &accrual, user.UserID,
+		nil, nil)
+	require.NoError(t, err)
+	err = dataRepository.Withdraw(ctx, "49927398716", 40, user.UserID)
+	require.NoError(t, err)
+
+	merchantCookies := make(map[string][]*http.Cookie)
+	for _, merchantID := range []string{"acme", "globex"} {
+		login("/api/user/register", merchantID)
+		err = dataRepository.SetUserRole(ctx, merchantID, string(models.RoleMerchant), merchantID)
+		require.NoError(t, err)
+		merchantCookies[merchantID] = login("/api/user/login", merchantID)
+	}
+	login("/api/user/register", "unlinked")
+	err = dataRepository.SetUserRole(ctx, "unlinked", string(models.RoleMerchant), "")
+	require.NoError(t, err)
+	unlinkedCookies := login("/api/user/login", "unlinked")
+
+	tests := []struct {
+		name       string
+		cookies    []*http.Cookie
+		statusCode int
+		balance    float64
+	}{
+		{
+			name:       "another merchant",
+			cookies:    merchantCookies["globex"],
+			statusCode: http.StatusNotFound,
+			balance:    60,
+		},
+		{
+			name:       "unlinked merchant",
+			cookies:    unlinkedCookies,
+			statusCode: http.StatusNotFound,
+			balance:    60,
+		},
+		{
+			name:       "own merchant",
+			cookies:    merchantCookies["acme"],
+			statusCode: http.StatusOK,
+			balance:    100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serve("/api/withdrawals/49927398716/reversals", `{"reversal_id":"r1"}`, tt.cookies)
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+
+			balance, err := dataRepository.GetBalance(ctx, user.UserID)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.balance, balance.Current, 0.001)
+		})
+	}
+}
+
+func TestRouterStoredRole(t *testing.T) {
+	router, dataRepository := newTestRouter(t)
+
+	serve := func(method string, path string, body string, cookies []*http.Cookie) *http.Response {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	ctx := context.Background()
+	result := serve(http.MethodPost, "/api/user/register", `{"login":"testadmin","password":"testpassword"}`, nil)
+	result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	err := dataRepository.SetUserRole(ctx, "testadmin", string(models.RoleAdmin), "")
+	require.NoError(t, err)
+	result = serve(http.MethodPost, "/api/user/login", `{"login":"testadmin","password":"testpassword"}`, nil)
+	result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	cookies := result.Cookies()
+
+	tests := []struct {
+		name       string
+		role       models.Role
+		statusCode int
+	}{
+		{
+			name:       "admin",
+			role:       models.RoleAdmin,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "demoted admin",
+			role:       models.RoleUser,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "promoted again",
+			role:       models.RoleAdmin,
+			statusCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := dataRepository.SetUserRole(ctx, "testadmin", string(tt.role), "")
+			require.NoError(t, err)
+
+			result := serve(http.MethodGet, "/api/admin/users?login=testadmin", "", cookies)
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+		})
+	}
+}
+
+func TestRouterHoldsMatchSpec(t *testing.T) {
+	router, dataRepository := newTestRouter(t)
+
+	var cookies []*http.Cookie
+	serve := func(method string, path string, body string) *http.Response {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+	authorize := func(body string) models.HoldResponse {
+		result := serve(http.MethodPost, "/api/user/balance/holds", body)
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		var hold models.HoldResponse
+		err := json.NewDecoder(result.Body).Decode(&hold)
+		require.NoError(t, err)
+		return hold
+	}
+
+	result := serve(http.MethodPost, "/api/user/register", `{"login":"testlogin","password":"testpassword"}`)
+	result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	cookies = result.Cookies()
+
+	ctx := context.Background()
+	user, err := dataRepository.GetUser(ctx, "testlogin")
+	require.NoError(t, err)
+	accrual := 100.0
+	err = dataRepository.AddOrder(ctx, "12345678903", "", user.UserID)
+	require.NoError(t, err)
+	err = dataRepository.UpdateOrder(ctx, "12345678903", string(models.StatusProcessed), &accrual, user.UserID, nil, nil)
+	require.NoError(t, err)
+
+	voided := authorize(`{"order":"2377225624","sum":40}`)
+	assert.Equal(t, models.HoldActive, voided.Status)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		statusCode int
+	}{
+		{
+			name:       "duplicate hold",
+			method:     http.MethodPost,
+			path:       "/api/user/balance/holds",
+			body:       `{"order":"2377225624","sum":10}`,
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "hold over balance",
+			method:     http.MethodPost,
+			path:       "/api/user/balance/holds",
+			body:       `{"order":"79927398713","sum":70}`,
+			statusCode: http.StatusPaymentRequired,
+		},
+		{
+			name:       "hold for invalid order",
+			method:     http.MethodPost,
+			path:       "/api/user/balance/holds",
+			body:       `{"order":"12345678902","sum":10}`,
+			statusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "balance with hold",
+			method:     http.MethodGet,
+			path:       "/api/user/balance",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "void",
+			method:     http.MethodPost,
+			path:       "/api/user/balance/holds/" + voided.HoldID + "/void",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "capture voided hold",
+			method:     http.MethodPost,
+			path:       "/api/user/balance/holds/" + voided.HoldID + "/capture",
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "unknown hold",
+			method:     http.MethodPost,
+			path:       "/api/user/balance/holds/" + uuid.NewString() + "/capture",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "invalid hold id",
+			method:     http.MethodPost,
+			path:       "/api/user/balance/holds/2377225624/void",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "holds",
+			method:     http.MethodGet,
+			path:       "/api/user/balance/holds",
+			statusCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serve(tt.method, tt.path, tt.body)
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+		})
+	}
+
+	captured := authorize(`{"order":"2377225624","sum":30}`)
+	result = serve(http.MethodPost, "/api/user/balance/holds/"+captured.HoldID+"/capture", "")
+	defer result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+
+	result = serve(http.MethodGet, "/api/user/balance", "")
+	defer result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	var balance models.BalanceResponse
+	err = json.NewDecoder(result.Body).Decode(&balance)
+	require.NoError(t, err)
+	assert.InDelta(t, 70, balance.Current, 0.001)
+	assert.InDelta(t, 0, balance.Held, 0.001)
+	assert.InDelta(t, 30, balance.Withdrawn, 0.001)
+}
+
+func TestRouterReferralsMatchSpec(t *testing.T) {
+	router, dataRepository := newTestRouter(t)
+
+	serve := func(method string, path string, body string, cookies []*http.Cookie) *http.Response {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+	referrals := func(cookies []*http.Cookie) models.ReferralsResponse {
+		result := serve(http.MethodGet, "/api/user/referrals", "", cookies)
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		var response models.ReferralsResponse
+		err := json.NewDecoder(result.Body).Decode(&response)
+		require.NoError(t, err)
+		return response
+	}
+
+	result := serve(http.MethodPost, "/api/user/register", `{"login":"testlogin","password":"testpassword"}`, nil)
+	result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	referrerCookies := result.Cookies()
+	code := referrals(referrerCookies).Code
+	require.NotEmpty(t, code)
+
+	result = serve(http.MethodPost, "/api/user/register",
+		`{"login":"testreferee","password":"testpassword","referral_code":"UNKNOWN"}`, nil)
+	result.Body.Close()
+	require.Equal(t, http.StatusUnprocessableEntity, result.StatusCode)
+
+	result = serve(http.MethodPost, "/api/user/register",
+		`{"login":"testreferee","password":"testpassword","referral_code":"`+strings.ToLower(code)+`"}`, nil)
+	result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	refereeCookies := result.Cookies()
+
+	pending := referrals(referrerCookies)
+	require.Len(t, pending.Referrals, 1)
+	assert.Equal(t, models.ReferralResponse{
+		Login:     "testreferee",
+		Status:    models.ReferralPending,
+		Bonus:     50,
+		CreatedAt: pending.Referrals[0].CreatedAt,
+	}, pending.Referrals[0])
+	assert.InDelta(t, 0, pending.Earned, 0.001)
+
+	ctx := context.Background()
+	referee, err := dataRepository.GetUser(ctx, "testreferee")
+	require.NoError(t, err)
+	accrual := 100.0
+	err = dataRepository.AddOrder(ctx, "12345678903", "", referee.UserID)
+	require.NoError(t, err)
+	err = dataRepository.UpdateOrder(ctx, "12345678903", string(models.StatusProcessed), &accrual, referee.UserID, nil,
+		nil)
+	require.NoError(t, err)
+
+	rewarded := referrals(refereeCookies)
+	require.NotNil(t, rewarded.ReferredBy)
+	assert.Equal(t, "testlogin", rewarded.ReferredBy.Login)
+	assert.Equal(t, models.ReferralRewarded, rewarded.ReferredBy.Status)
+	assert.InDelta(t, 50, rewarded.Earned, 0.001)
+	assert.InDelta(t, 50, referrals(referrerCookies).Earned, 0.001)
+}
+
+func TestRouterOrderBatchMatchSpec(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	var cookies []*http.Cookie
+	serve := func(contentType string, body string) *http.Response {
+		request := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", strings.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/api/user/register",
+		strings.NewReader(`{"login":"testlogin","password":"testpassword"}`))
+	request.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	require.Equal(t, http.StatusOK, w.Code)
+	cookies = w.Result().Cookies()
+
+	result := serve("application/json", `["12345678903", 2377225624, "12345678902"]`)
+	defer result.Body.Close()
+	require.Equal(t, http.StatusMultiStatus, result.StatusCode)
+	var uploads []models.OrderUploadResponse
+	err := json.NewDecoder(result.Body).Decode(&uploads)
+	require.NoError(t, err)
+	assert.Equal(t, []models.OrderUploadResponse{
+		{Number: "12345678903", Result: models.OrderUploadAccepted, Status: http.StatusAccepted},
+		{Number: "2377225624", Result: models.OrderUploadAccepted, Status: http.StatusAccepted},
+		{Number: "12345678902", Result: models.OrderUploadInvalid, Status: http.StatusUnprocessableEntity},
+	}, uploads)
+
+	result = serve("text/plain", "12345678903\r\n\n79927398713\n")
+	defer result.Body.Close()
+	require.Equal(t, http.StatusMultiStatus, result.StatusCode)
+	err = json.NewDecoder(result.Body).Decode(&uploads)
+	require.NoError(t, err)
+	assert.Equal(t, []models.OrderUploadResponse{
+		{Number: "12345678903", Result: models.OrderUploadAlreadyAdded, Status: http.StatusOK},
+		{Number: "79927398713", Result: models.OrderUploadAccepted, Status: http.StatusAccepted},
+	}, uploads)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		statusCode  int
+	}{
+		{
+			name:        "empty batch",
+			contentType: "application/json",
+			body:        `[]`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "not an array",
+			contentType: "application/json",
+			body:        `{"orders":["12345678903"]}`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "too many orders",
+			contentType: "text/plain",
+			body:        "12345678903\n2377225624\n79927398713\n49927398716",
+			statusCode:  http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serve(tt.contentType, tt.body)
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+		})
+	}
+}
+
+func TestRouterCampaignsMatchSpec(t *testing.T) {
+	router, dataRepository := newTestRouter(t)
+
+	serve := func(method string, path string, body string, cookies []*http.Cookie) *http.Response {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+	login := func(path string, login string) []*http.Cookie {
+		result := serve(http.MethodPost, path, `{"login":"`+login+`","password":"testpassword"}`, nil)
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		return result.Cookies()
+	}
+
+	userCookies := login("/api/user/register", "testlogin")
+	login("/api/user/register", "testadmin")
+	ctx := context.Background()
+	err := dataRepository.SetUserRole(ctx, "testadmin", string(models.RoleAdmin), "")
+	require.NoError(t, err)
+	adminCookies := login("/api/user/login", "testadmin")
+
+	result := serve(http.MethodGet, "/api/admin/campaigns", "", adminCookies)
+	result.Body.Close()
+	require.Equal(t, http.StatusNoContent, result.StatusCode)
+
+	startsAt := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	endsAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	result = serve(http.MethodPost, "/api/admin/campaigns",
+		`{"name":"welcome","starts_at":"`+startsAt+`","ends_at":"`+endsAt+`","bonus":5}`,
+		adminCookies)
+	var campaign models.CampaignResponse
+	err = json.NewDecoder(result.Body).Decode(&campaign)
+	require.NoError(t, err)
+	result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+
+	user, err := dataRepository.GetUser(ctx, "testlogin")
+	require.NoError(t, err)
+	accrual := 100.0
+	err = dataRepository.AddOrder(ctx, "12345678903", "", user.UserID)
+	require.NoError(t, err)
+	err = dataRepository.UpdateOrder(ctx, "12345678903", string(models.StatusProcessed), &accrual, user.UserID, nil, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		cookies    []*http.Cookie
+		statusCode int
+	}{
+		{
+			name:       "not an admin",
+			method:     http.MethodGet,
+			path:       "/api/admin/campaigns",
+			cookies:    userCookies,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:   "unknown tier",
+			method: http.MethodPost,
+			path:   "/api/admin/campaigns",
+			body: `{"name":"platinum","starts_at":"` + startsAt + `","ends_at":"` + endsAt +
+				`","multiplier":2,"tiers":["platinum"]}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "multiplier and bonus",
+			method:     http.MethodPost,
+			path:       "/api/admin/campaigns",
+			body:       `{"name":"both","starts_at":"` + startsAt + `","ends_at":"` + endsAt + `","multiplier":2,"bonus":5}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "orders with bonuses",
+			method:     http.MethodGet,
+			path:       "/api/user/orders",
+			cookies:    userCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "campaigns",
+			method:     http.MethodGet,
+			path:       "/api/admin/campaigns",
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "end",
+			method:     http.MethodPost,
+			path:       "/api/admin/campaigns/" + campaign.CampaignID + "/end",
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "end ended campaign",
+			method:     http.MethodPost,
+			path:       "/api/admin/campaigns/" + campaign.CampaignID + "/end",
+			cookies:    adminCookies,
+			statusCode: http.StatusConflict,
+		},
+		{
+			name:       "unknown campaign",
+			method:     http.MethodPost,
+			path:       "/api/admin/campaigns/" + uuid.NewString() + "/end",
+			cookies:    adminCookies,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "invalid campaign id",
+			method:     http.MethodPost,
+			path:       "/api/admin/campaigns/welcome/end",
+			cookies:    adminCookies,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serve(tt.method, tt.path, tt.body, tt.cookies)
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+		})
+	}
+
+	result = serve(http.MethodGet, "/api/user/balance", "", userCookies)
+	defer result.Body.Close()
+	var balance models.BalanceResponse
+	err = json.NewDecoder(result.Body).Decode(&balance)
+	require.NoError(t, err)
+	assert.InDelta(t, 105, balance.Current, 0.001)
+}
+
+func TestRouterMerchantsMatchSpec(t *testing.T) {
+	router, dataRepository := newTestRouter(t)
+
+	serve := func(method string, path string, contentType string, body string, cookies []*http.Cookie) *http.Response {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+	login := func(path string, login string) []*http.Cookie {
+		result := serve(http.MethodPost, path, "application/json",
+			`{"login":"`+login+`","password":"testpassword"}`, nil)
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		return result.Cookies()
+	}
+
+	userCookies := login("/api/user/register", "testlogin")
+	login("/api/user/register", "testadmin")
+	err := dataRepository.SetUserRole(context.Background(), "testadmin", string(models.RoleAdmin), "")
+	require.NoError(t, err)
+	adminCookies := login("/api/user/login", "testadmin")
+
+	result := serve(http.MethodGet, "/api/admin/merchants", "", "", adminCookies)
+	result.Body.Close()
+	require.Equal(t, http.StatusNoContent, result.StatusCode)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		cookies     []*http.Cookie
+		statusCode  int
+	}{
+		{
+			name:        "create",
+			method:      http.MethodPost,
+			path:        "/api/admin/merchants",
+			contentType: "application/json",
+			body: `{"merchant_id":"acme","name":"Acme","order_prefix":"79",` +
+				`"accrual_address":"http://localhost:8081","rate_limit":5}`,
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:        "create existing",
+			method:      http.MethodPost,
+			path:        "/api/admin/merchants",
+			contentType: "application/json",
+			body:        `{"merchant_id":"acme","name":"Acme","accrual_address":"http://localhost:8082"}`,
+			cookies:     adminCookies,
+			statusCode:  http.StatusConflict,
+		},
+		{
+			name:        "invalid address",
+			method:      http.MethodPost,
+			path:        "/api/admin/merchants",
+			contentType: "application/json",
+			body:        `{"merchant_id":"other","name":"Other","accrual_address":"localhost"}`,
+			cookies:     adminCookies,
+			statusCode:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "not an admin",
+			method:     http.MethodGet,
+			path:       "/api/admin/merchants",
+			cookies:    userCookies,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "merchants",
+			method:     http.MethodGet,
+			path:       "/api/admin/merchants",
+			cookies:    adminCookies,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:        "order by prefix",
+			method:      http.MethodPost,
+			path:        "/api/user/orders",
+			contentType: "text/plain",
+			body:        "79927398713",
+			cookies:     userCookies,
+			statusCode:  http.StatusAccepted,
+		},
+		{
+			name:        "order of merchant",
+			method:      http.MethodPost,
+			path:        "/api/user/orders?merchant_id=acme",
+			contentType: "text/plain",
+			body:        "12345678903",
+			cookies:     userCookies,
+			statusCode:  http.StatusAccepted,
+		},
+		{
+			name:        "order of unknown merchant",
+			method:      http.MethodPost,
+			path:        "/api/user/orders?merchant_id=unknown",
+			contentType: "text/plain",
+			body:        "2377225624",
+			cookies:     userCookies,
+			statusCode:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "batch of unknown merchant",
+			method:      http.MethodPost,
+			path:        "/api/user/orders/batch?merchant_id=unknown",
+			contentType: "text/plain",
+			body:        "2377225624",
+			cookies:     userCookies,
+			statusCode:  http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serve(tt.method, tt.path, tt.contentType, tt.body, tt.cookies)
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+		})
+	}
+
+	result = serve(http.MethodGet, "/api/user/orders", "", "", userCookies)
+	defer result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	var orders []models.OrderResponse
+	err = json.NewDecoder(result.Body).Decode(&orders)
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	for _, order := range orders {
+		assert.Equal(t, "acme", order.MerchantID)
+	}
+}
+
+func TestRouterStatementMatchSpec(t *testing.T) {
+	router, dataRepository := newTestRouter(t)
+
+	serve := func(path string, cookies []*http.Cookie) *http.Response {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/api/user/register",
+		strings.NewReader(`{"login":"testlogin","password":"testpassword"}`))
+	request.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	require.Equal(t, http.StatusOK, w.Code)
+	cookies := w.Result().Cookies()
+
+	ctx := context.Background()
+	user, err := dataRepository.GetUser(ctx, "testlogin")
+	require.NoError(t, err)
+	accrual := 100.0
+	err = dataRepository.AddOrder(ctx, "12345678903", "", user.UserID)
+	require.NoError(t, err)
+	err = dataRepository.UpdateOrder(ctx, "12345678903", string(models.StatusProcessed), &accrual, user.UserID, nil, nil)
+	require.NoError(t, err)
+	err = dataRepository.Withdraw(ctx, "2377225624", 30, user.UserID)
+	require.NoError(t, err)
+
+	result := serve("/api/user/statement", cookies)
+	defer result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", result.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=statement.csv`, result.Header.Get("Content-Disposition"))
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "created_at,type,order,amount,balance", lines[0])
+	assert.True(t, strings.HasSuffix(lines[2], ",withdrawal,2377225624,-30,70"), lines[2])
+
+	result = serve("/api/user/statement?format=ndjson&from=2020-01-01&to=2100-01-01T12:00:00Z", cookies)
+	defer result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "application/x-ndjson", result.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=statement_from_20200101_to_21000101T120000Z.ndjson`,
+		result.Header.Get("Content-Disposition"))
+	decoder := json.NewDecoder(result.Body)
+	var entries []models.StatementEntryResponse
+	for decoder.More() {
+		var entry models.StatementEntryResponse
+		require.NoError(t, decoder.Decode(&entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.StatementAccrual, entries[0].Type)
+	assert.InDelta(t, 70, entries[1].Balance, 0.001)
+
+	tests := []struct {
+		name       string
+		path       string
+		cookies    []*http.Cookie
+		statusCode int
+	}{
+		{
+			name:       "unknown format",
+			path:       "/api/user/statement?format=xml",
+			cookies:    cookies,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid from",
+			path:       "/api/user/statement?from=yesterday",
+			cookies:    cookies,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "to before from",
+			path:       "/api/user/statement?from=2024-02-01&to=2024-01-01",
+			cookies:    cookies,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unauthorized",
+			path:       "/api/user/statement",
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serve(tt.path, tt.cookies)
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+		})
+	}
+}
+
+// brokenStatementRepository fails a statement after more entries than the
+// statement writers buffer were handled.
+type brokenStatementRepository struct {
+	*repository.MemoryRepository
+}
+
+func (r brokenStatementRepository) GetStatement(
+	_ context.Context,
+	_ uuid.UUID,
+	_ *time.Time,
+	_ *time.Time,
+	handle func(entry repository.StatementEntry) error,
+) error {
+	for range 1000 {
+		err := handle(repository.StatementEntry{
+			CreatedAt: time.Now(),
+			Type:      string(models.StatementAccrual),
+			Order:     "12345678903",
+			Amount:    10,
+			Balance:   10,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return errors.New("connection lost")
+}
+
+func TestRouterStatementAbort(t *testing.T) {
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		http2      bool
+		protoMajor int
+	}{
+		{
+			name:       "http/1.1",
+			protoMajor: 1,
+		},
+		{
+			name:       "http/2",
+			http2:      true,
+			protoMajor: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouterWithRepository(t, brokenStatementRepository{
+				MemoryRepository: repository.NewMemoryRepository(testLogger.Named("repository")),
+			})
+			server := httptest.NewUnstartedServer(router)
+			server.EnableHTTP2 = tt.http2
+			server.StartTLS()
+			defer server.Close()
+			client := server.Client()
+
+			result, err := client.Post(server.URL+"/api/user/register", "application/json",
+				strings.NewReader(`{"login":"testlogin","password":"testpassword"}`))
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+			require.Equal(t, http.StatusOK, result.StatusCode)
+			cookies := result.Cookies()
+
+			request, err := http.NewRequest(http.MethodGet, server.URL+"/api/user/statement?format=ndjson", nil)
+			require.NoError(t, err)
+			for _, cookie := range cookies {
+				request.AddCookie(cookie)
+			}
+			result, err = client.Do(request)
+			require.NoError(t, err)
+			defer result.Body.Close()
+			assert.Equal(t, tt.protoMajor, result.ProtoMajor)
+			assert.Equal(t, http.StatusOK, result.StatusCode)
+			_, err = io.ReadAll(result.Body)
+			assert.Error(t, err)
+		})
+	}
+}
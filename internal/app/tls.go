@@ -0,0 +1,170 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/config"
+	"go.uber.org/zap"
+)
+
+type certificateReloader struct {
+	logger        *zap.Logger
+	certificate   *tls.Certificate
+	checkedAt     time.Time
+	modified      time.Time
+	certPath      string
+	keyPath       string
+	checkInterval time.Duration
+	m             sync.Mutex
+}
+
+func newCertificateReloader(
+	logger *zap.Logger,
+	certPath string,
+	keyPath string,
+	checkInterval time.Duration,
+) (*certificateReloader, error) {
+	reloader := &certificateReloader{
+		logger:        logger,
+		certPath:      certPath,
+		keyPath:       keyPath,
+		checkInterval: checkInterval,
+	}
+
+	err := reloader.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func (r *certificateReloader) Reload() error {
+	loaded, err := r.Load()
+	if err != nil {
+		return err
+	}
+	r.Store(loaded)
+
+	return nil
+}
+
+// Load reads the key pair without serving it, so a caller can validate the
+// rest of a reload before the certificate is swapped by Store.
+func (r *certificateReloader) Load() (loadedCertificate, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.read()
+}
+
+func (r *certificateReloader) Store(loaded loadedCertificate) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.store(loaded)
+}
+
+func (r *certificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.checkInterval > 0 && time.Since(r.checkedAt) >= r.checkInterval {
+		r.checkedAt = time.Now()
+		if modified := r.modTime(); modified.After(r.modified) {
+			loaded, err := r.read()
+			if err != nil {
+				r.logger.Error("Can not reload tls certificate, keeping previous", zap.Error(err))
+			} else {
+				r.store(loaded)
+				r.logger.Info("Tls certificate reloaded")
+			}
+		}
+	}
+
+	return r.certificate, nil
+}
+
+type loadedCertificate struct {
+	certificate *tls.Certificate
+	modified    time.Time
+}
+
+func (r *certificateReloader) read() (loadedCertificate, error) {
+	modified := r.modTime()
+
+	certificate, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return loadedCertificate{}, fmt.Errorf("can not load tls certificate: %w", err)
+	}
+	if certificate.Leaf == nil {
+		certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			return loadedCertificate{}, fmt.Errorf("can not parse tls certificate: %w", err)
+		}
+	}
+
+	return loadedCertificate{certificate: &certificate, modified: modified}, nil
+}
+
+func (r *certificateReloader) store(loaded loadedCertificate) {
+	r.certificate = loaded.certificate
+	r.modified = loaded.modified
+	r.checkedAt = time.Now()
+}
+
+func (r *certificateReloader) modTime() time.Time {
+	var modified time.Time
+	for _, path := range []string{r.certPath, r.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	return modified
+}
+
+func newTLSConfig(cfg *config.Config, certificates *certificateReloader) (*tls.Config, error) {
+	minVersion, err := config.ParseTLSVersion(cfg.TLSMinVersion)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse tls min version: %w", err)
+	}
+	cipherSuites, err := config.ParseCipherSuites(cfg.TLSCipherSuites)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse tls cipher suites: %w", err)
+	}
+
+	return &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: certificates.GetCertificate,
+	}, nil
+}
+
+func redirectHandler(httpsAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddress)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestCertificate(t *testing.T, certPath string, keyPath string, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	err = os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	require.NoError(t, err)
+}
+
+func TestCertificateReloader(t *testing.T) {
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	writeTestCertificate(t, certPath, keyPath, "first")
+
+	reloader, err := newCertificateReloader(testLogger.Named("tls"), certPath, keyPath, time.Nanosecond)
+	require.NoError(t, err)
+
+	certificate, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", certificate.Leaf.Subject.CommonName)
+
+	writeTestCertificate(t, certPath, keyPath, "second")
+	renewed := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certPath, renewed, renewed))
+
+	certificate, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", certificate.Leaf.Subject.CommonName)
+
+	err = os.WriteFile(keyPath, []byte("invalid"), 0o600)
+	require.NoError(t, err)
+	renewed = renewed.Add(time.Minute)
+	require.NoError(t, os.Chtimes(keyPath, renewed, renewed))
+
+	certificate, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", certificate.Leaf.Subject.CommonName)
+	assert.Error(t, reloader.Reload())
+
+	writeTestCertificate(t, certPath, keyPath, "third")
+	reloader, err = newCertificateReloader(testLogger.Named("tls"), certPath, keyPath, 0)
+	require.NoError(t, err)
+	writeTestCertificate(t, certPath, keyPath, "fourth")
+
+	loaded, err := reloader.Load()
+	require.NoError(t, err)
+	certificate, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "third", certificate.Leaf.Subject.CommonName)
+
+	reloader.Store(loaded)
+	certificate, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "fourth", certificate.Leaf.Subject.CommonName)
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		httpsAddress string
+		target       string
+		want         string
+	}{
+		{
+			name:         "default port",
+			httpsAddress: ":443",
+			target:       "http://example.com/api/user/orders?limit=1",
+			want:         "https://example.com/api/user/orders?limit=1",
+		},
+		{
+			name:         "custom port",
+			httpsAddress: "localhost:8443",
+			target:       "http://example.com:8080/api/user/balance",
+			want:         "https://example.com:8443/api/user/balance",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			redirectHandler(tt.httpsAddress).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("Location"))
+		})
+	}
+}
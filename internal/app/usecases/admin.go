@@ -0,0 +1,299 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	searchUsersLimit  = 50
+	adminActionsLimit = 100
+)
+
+// CheckUserActive returns the stored role of an enabled user, which replaces
+// the role in the token so that a changed role applies at once.
+func (i *Interactor) CheckUserActive(ctx context.Context, userID uuid.UUID) (models.Role, error) {
+	user, err := i.dataRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("can not get user: %w", err)
+	}
+	if user.Disabled {
+		return "", repository.ErrUserDisabled
+	}
+
+	return models.Role(user.Role), nil
+}
+
+func (i *Interactor) SearchUsers(ctx context.Context, adminID uuid.UUID, login string) ([]models.AdminUserResponse, error) {
+	err := i.recordAdminAction(ctx, repository.AdminAction{
+		AdminID: adminID,
+		Action:  string(models.AdminActionSearchUsers),
+		Comment: login,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := i.dataRepository.SearchUsers(ctx, login, searchUsersLimit)
+	if err != nil {
+		return nil, fmt.Errorf("can not search users: %w", err)
+	}
+
+	response := make([]models.AdminUserResponse, 0, len(data))
+	for _, user := range data {
+		response = append(response, adminUserResponse(user))
+	}
+
+	return response, nil
+}
+
+func (i *Interactor) GetUser(ctx context.Context, adminID uuid.UUID, userID uuid.UUID) (*models.AdminUserResponse, error) {
+	user, err := i.viewUser(ctx, adminID, userID, models.AdminActionViewUser)
+	if err != nil {
+		return nil, err
+	}
+
+	response := adminUserResponse(*user)
+	return &response, nil
+}
+
+func (i *Interactor) GetUserOrders(
+	ctx context.Context,
+	adminID uuid.UUID,
+	userID uuid.UUID,
+) ([]models.OrderResponse, error) {
+	_, err := i.viewUser(ctx, adminID, userID, models.AdminActionViewOrders)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.GetOrders(ctx, userID)
+}
+
+func (i *Interactor) GetUserWithdrawals(
+	ctx context.Context,
+	adminID uuid.UUID,
+	userID uuid.UUID,
+) ([]models.WithdrawResponse, error) {
+	_, err := i.viewUser(ctx, adminID, userID, models.AdminActionViewWithdrawals)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.GetWithdrawals(ctx, userID)
+}
+
+func (i *Interactor) GetUserBalance(
+	ctx context.Context,
+	adminID uuid.UUID,
+	userID uuid.UUID,
+) (*models.BalanceResponse, error) {
+	_, err := i.viewUser(ctx, adminID, userID, models.AdminActionViewBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.GetBalance(ctx, userID)
+}
+
+func (i *Interactor) AdjustBalance(
+	ctx context.Context,
+	adminID uuid.UUID,
+	userID uuid.UUID,
+	request models.AdjustmentRequest,
+) error {
+	if !request.Reason.Valid() {
+		return repository.NewErrInvalidReason(string(request.Reason))
+	}
+	if request.Amount == 0 || math.IsNaN(request.Amount) || math.IsInf(request.Amount, 0) {
+		return repository.ErrInvalidSum
+	}
+
+	err := i.dataRepository.AdjustBalance(ctx, repository.AdminAction{
+		Amount:  &request.Amount,
+		UserID:  &userID,
+		Action:  string(models.AdminActionAdjustBalance),
+		Reason:  string(request.Reason),
+		Comment: request.Comment,
+		AdminID: adminID,
+	}, i.pointsExpiresAt())
+	if err != nil {
+		return fmt.Errorf("can not adjust balance: %w", err)
+	}
+
+	return nil
+}
+
+func (i *Interactor) SetUserDisabled(
+	ctx context.Context,
+	adminID uuid.UUID,
+	userID uuid.UUID,
+	request models.UserStatusRequest,
+	disabled bool,
+) error {
+	if !request.Reason.Valid() {
+		return repository.NewErrInvalidReason(string(request.Reason))
+	}
+
+	action := models.AdminActionEnableUser
+	if disabled {
+		action = models.AdminActionDisableUser
+	}
+
+	err := i.dataRepository.SetUserDisabled(ctx, repository.AdminAction{
+		UserID:  &userID,
+		Action:  string(action),
+		Reason:  string(request.Reason),
+		Comment: request.Comment,
+		AdminID: adminID,
+	}, disabled)
+	if err != nil {
+		return fmt.Errorf("can not set user disabled: %w", err)
+	}
+
+	return nil
+}
+
+// RecheckOrder asks the accrual system about an order right away. Processed
+// orders are refused because their accrual is already credited.
+func (i *Interactor) RecheckOrder(
+	ctx context.Context,
+	adminID uuid.UUID,
+	orderNumber string,
+) (*models.OrderResponse, error) {
+	order, err := i.dataRepository.GetOrder(ctx, orderNumber)
+	if err != nil {
+		return nil, fmt.Errorf("can not get order: %w", err)
+	}
+	if order.Status == string(models.StatusProcessed) {
+		return nil, repository.ErrOrderProcessed
+	}
+
+	err = i.recordAdminAction(ctx, repository.AdminAction{
+		UserID:      &order.UserID,
+		Action:      string(models.AdminActionRecheckOrder),
+		OrderNumber: orderNumber,
+		AdminID:     adminID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := i.accrualClients.get(ctx, i.dataRepository, orderMerchantID(*order))
+	if err != nil {
+		return nil, fmt.Errorf("can not get accrual service: %w", err)
+	}
+	err = i.updateOrderStatus(ctx, client, orderNumber, order.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err = i.dataRepository.GetOrder(ctx, orderNumber)
+	if err != nil {
+		return nil, fmt.Errorf("can not get order: %w", err)
+	}
+
+	return &models.OrderResponse{
+		Number:     order.Number,
+		Status:     order.Status,
+		Accrual:    order.Accrual,
+		MerchantID: orderMerchantID(*order),
+		UploadedAt: order.UploadedAt.Format(time.RFC3339),
+	}, nil
+}
+
+func (i *Interactor) GetAdminActions(
+	ctx context.Context,
+	adminID uuid.UUID,
+	userID *uuid.UUID,
+) ([]models.AdminActionResponse, error) {
+	if userID != nil {
+		_, err := i.viewUser(ctx, adminID, *userID, models.AdminActionViewActions)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := i.recordAdminAction(ctx, repository.AdminAction{
+			AdminID: adminID,
+			Action:  string(models.AdminActionViewActions),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := i.dataRepository.GetAdminActions(ctx, userID, adminActionsLimit)
+	if err != nil {
+		return nil, fmt.Errorf("can not get admin actions: %w", err)
+	}
+
+	response := make([]models.AdminActionResponse, 0, len(data))
+	for _, action := range data {
+		item := models.AdminActionResponse{
+			Amount:      action.Amount,
+			AdminID:     action.AdminID.String(),
+			Action:      models.AdminAction(action.Action),
+			OrderNumber: action.OrderNumber,
+			Reason:      models.Reason(action.Reason),
+			Comment:     action.Comment,
+			CreatedAt:   action.CreatedAt.Format(time.RFC3339),
+		}
+		if action.UserID != nil {
+			item.UserID = action.UserID.String()
+		}
+		response = append(response, item)
+	}
+
+	return response, nil
+}
+
+func (i *Interactor) recordAdminAction(ctx context.Context, action repository.AdminAction) error {
+	err := i.dataRepository.AddAdminAction(ctx, action)
+	if err != nil {
+		return fmt.Errorf("can not record admin action: %w", err)
+	}
+	return nil
+}
+
+func (i *Interactor) viewUser(
+	ctx context.Context,
+	adminID uuid.UUID,
+	userID uuid.UUID,
+	action models.AdminAction,
+) (*repository.User, error) {
+	user, err := i.dataRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not get user: %w", err)
+	}
+
+	err = i.recordAdminAction(ctx, repository.AdminAction{
+		AdminID: adminID,
+		UserID:  &userID,
+		Action:  string(action),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func adminUserResponse(user repository.User) models.AdminUserResponse {
+	role := models.Role(user.Role)
+	if role == "" {
+		role = models.RoleUser
+	}
+
+	return models.AdminUserResponse{
+		UserID:   user.UserID.String(),
+		Login:    user.Login,
+		Role:     role,
+		Disabled: user.Disabled,
+	}
+}
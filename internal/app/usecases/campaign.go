@@ -0,0 +1,160 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/google/uuid"
+)
+
+// CreateCampaign starts a promotion that adds a bonus to the accruals of the
+// eligible users processed between its start and end.
+func (i *Interactor) CreateCampaign(
+	ctx context.Context,
+	adminID uuid.UUID,
+	request models.CampaignRequest,
+) (*models.CampaignResponse, error) {
+	campaign, err := i.newCampaign(adminID, request)
+	if err != nil {
+		return nil, err
+	}
+
+	err = i.recordAdminAction(ctx, repository.AdminAction{
+		AdminID: adminID,
+		Action:  string(models.AdminActionCreateCampaign),
+		Comment: campaign.CampaignID.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = i.dataRepository.AddCampaign(ctx, *campaign)
+	if err != nil {
+		return nil, fmt.Errorf("can not add campaign: %w", err)
+	}
+
+	return campaignResponse(*campaign), nil
+}
+
+// EndCampaign stops a campaign right away, the bonuses it already credited
+// are kept.
+func (i *Interactor) EndCampaign(
+	ctx context.Context,
+	adminID uuid.UUID,
+	campaignID uuid.UUID,
+) (*models.CampaignResponse, error) {
+	err := i.recordAdminAction(ctx, repository.AdminAction{
+		AdminID: adminID,
+		Action:  string(models.AdminActionEndCampaign),
+		Comment: campaignID.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	campaign, err := i.dataRepository.EndCampaign(ctx, campaignID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("can not end campaign: %w", err)
+	}
+
+	return campaignResponse(*campaign), nil
+}
+
+func (i *Interactor) GetCampaigns(ctx context.Context, adminID uuid.UUID) ([]models.CampaignResponse, error) {
+	err := i.recordAdminAction(ctx, repository.AdminAction{
+		AdminID: adminID,
+		Action:  string(models.AdminActionViewCampaigns),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := i.dataRepository.GetCampaigns(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can not get campaigns: %w", err)
+	}
+
+	response := make([]models.CampaignResponse, 0, len(data))
+	for _, campaign := range data {
+		response = append(response, *campaignResponse(campaign))
+	}
+
+	return response, nil
+}
+
+func (i *Interactor) newCampaign(adminID uuid.UUID, request models.CampaignRequest) (*repository.Campaign, error) {
+	name := strings.TrimSpace(request.Name)
+	if name == "" || request.StartsAt.IsZero() || !request.EndsAt.After(request.StartsAt) {
+		return nil, repository.ErrInvalidCampaign
+	}
+	if (request.Multiplier == nil) == (request.Bonus == nil) {
+		return nil, repository.ErrInvalidCampaign
+	}
+	if request.Multiplier != nil && (!validAmount(*request.Multiplier) || *request.Multiplier <= 1) {
+		return nil, repository.ErrInvalidCampaign
+	}
+	if request.Bonus != nil && !validAmount(*request.Bonus) {
+		return nil, repository.ErrInvalidCampaign
+	}
+	if request.Budget != nil && !validAmount(*request.Budget) {
+		return nil, repository.ErrInvalidCampaign
+	}
+	for _, tier := range request.Tiers {
+		if i.loyaltyTiers.Index(tier) < 0 {
+			return nil, repository.ErrInvalidCampaign
+		}
+	}
+
+	userIDs := make([]uuid.UUID, 0, len(request.UserIDs))
+	for _, value := range request.UserIDs {
+		userID, err := uuid.Parse(value)
+		if err != nil {
+			return nil, repository.ErrInvalidCampaign
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return &repository.Campaign{
+		StartsAt:   request.StartsAt,
+		EndsAt:     request.EndsAt,
+		CreatedAt:  time.Now(),
+		Multiplier: request.Multiplier,
+		Bonus:      request.Bonus,
+		Budget:     request.Budget,
+		Name:       name,
+		Tiers:      request.Tiers,
+		UserIDs:    userIDs,
+		CampaignID: uuid.New(),
+		CreatedBy:  adminID,
+	}, nil
+}
+
+func validAmount(value float64) bool {
+	return value > 0 && !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+func campaignResponse(campaign repository.Campaign) *models.CampaignResponse {
+	response := &models.CampaignResponse{
+		CampaignID: campaign.CampaignID.String(),
+		Name:       campaign.Name,
+		StartsAt:   campaign.StartsAt.Format(time.RFC3339),
+		EndsAt:     campaign.EndsAt.Format(time.RFC3339),
+		Tiers:      campaign.Tiers,
+		Multiplier: campaign.Multiplier,
+		Bonus:      campaign.Bonus,
+		Budget:     campaign.Budget,
+		Spent:      campaign.Spent,
+		CreatedBy:  campaign.CreatedBy.String(),
+		CreatedAt:  campaign.CreatedAt.Format(time.RFC3339),
+	}
+	for _, userID := range campaign.UserIDs {
+		response.UserIDs = append(response.UserIDs, userID.String())
+	}
+
+	return response
+}
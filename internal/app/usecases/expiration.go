@@ -0,0 +1,58 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	expiringPointsWindow      = 30 * 24 * time.Hour
+	pointsExpirationBatchSize = 100
+)
+
+func (i *Interactor) runPointsExpiration(ctx context.Context) {
+	ticker := time.NewTicker(i.expirationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := i.ExpirePoints(ctx)
+			if err != nil {
+				i.logger.Error("Can not expire points", zap.Error(err))
+			}
+		}
+	}
+}
+
+// ExpirePoints writes off the remaining points of every lot past its expiry
+// date and records an expiration for each of them.
+func (i *Interactor) ExpirePoints(ctx context.Context) error {
+	for {
+		expirations, err := i.dataRepository.ExpirePoints(ctx, time.Now(), pointsExpirationBatchSize)
+		if err != nil {
+			return fmt.Errorf("can not expire points: %w", err)
+		}
+		for _, expiration := range expirations {
+			i.logger.Info("Points expired",
+				zap.String("user_id", expiration.UserID.String()),
+				zap.String("order", expiration.Order),
+				zap.Float64("sum", expiration.Sum))
+		}
+		if len(expirations) < pointsExpirationBatchSize {
+			return nil
+		}
+	}
+}
+
+func (i *Interactor) pointsExpiresAt() *time.Time {
+	if i.pointsExpiry <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(i.pointsExpiry)
+	return &expiresAt
+}
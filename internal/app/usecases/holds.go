@@ -0,0 +1,130 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const holdExpirationBatchSize = 100
+
+// AuthorizeHold reserves points for an order. Held points are not available
+// for other withdrawals until the hold is voided or expires.
+func (i *Interactor) AuthorizeHold(
+	ctx context.Context,
+	request models.HoldRequest,
+	userID uuid.UUID,
+) (*models.HoldResponse, error) {
+	if !i.orderNumbers.Valid(request.Order) {
+		return nil, repository.NewErrInvalidOrderNumber(request.Order)
+	}
+	if request.Sum <= 0 || math.IsNaN(request.Sum) || math.IsInf(request.Sum, 0) {
+		return nil, repository.ErrInvalidSum
+	}
+
+	now := time.Now()
+	hold := repository.Hold{
+		CreatedAt: now,
+		ExpiresAt: now.Add(i.holdTTL),
+		Order:     request.Order,
+		Status:    string(models.HoldActive),
+		Sum:       request.Sum,
+		HoldID:    uuid.New(),
+		UserID:    userID,
+	}
+	err := i.dataRepository.AuthorizeHold(ctx, hold)
+	if err != nil {
+		return nil, fmt.Errorf("can not authorize hold: %w", err)
+	}
+
+	return holdResponse(hold), nil
+}
+
+func (i *Interactor) CaptureHold(ctx context.Context, holdID uuid.UUID, userID uuid.UUID) (*models.HoldResponse, error) {
+	hold, err := i.dataRepository.CaptureHold(ctx, userID, holdID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("can not capture hold: %w", err)
+	}
+
+	return holdResponse(*hold), nil
+}
+
+func (i *Interactor) VoidHold(ctx context.Context, holdID uuid.UUID, userID uuid.UUID) (*models.HoldResponse, error) {
+	hold, err := i.dataRepository.VoidHold(ctx, userID, holdID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("can not void hold: %w", err)
+	}
+
+	return holdResponse(*hold), nil
+}
+
+func (i *Interactor) GetHolds(ctx context.Context, userID uuid.UUID) ([]models.HoldResponse, error) {
+	data, err := i.dataRepository.GetHolds(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not get holds: %w", err)
+	}
+
+	response := make([]models.HoldResponse, 0, len(data))
+	for _, item := range data {
+		response = append(response, *holdResponse(item))
+	}
+
+	return response, nil
+}
+
+func (i *Interactor) runHoldExpiration(ctx context.Context) {
+	ticker := time.NewTicker(i.holdExpiration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := i.ExpireHolds(ctx)
+			if err != nil {
+				i.logger.Error("Can not expire holds", zap.Error(err))
+			}
+		}
+	}
+}
+
+// ExpireHolds releases the points of every active hold past its expiry date.
+func (i *Interactor) ExpireHolds(ctx context.Context) error {
+	for {
+		holds, err := i.dataRepository.ExpireHolds(ctx, time.Now(), holdExpirationBatchSize)
+		if err != nil {
+			return fmt.Errorf("can not expire holds: %w", err)
+		}
+		for _, hold := range holds {
+			i.logger.Info("Hold expired",
+				zap.String("user_id", hold.UserID.String()),
+				zap.String("hold_id", hold.HoldID.String()),
+				zap.Float64("sum", hold.Sum))
+		}
+		if len(holds) < holdExpirationBatchSize {
+			return nil
+		}
+	}
+}
+
+func holdResponse(hold repository.Hold) *models.HoldResponse {
+	response := &models.HoldResponse{
+		HoldID:    hold.HoldID.String(),
+		Order:     hold.Order,
+		Status:    models.HoldStatus(hold.Status),
+		CreatedAt: hold.CreatedAt.Format(time.RFC3339),
+		ExpiresAt: hold.ExpiresAt.Format(time.RFC3339),
+		Sum:       hold.Sum,
+	}
+	if hold.FinishedAt != nil {
+		response.FinishedAt = hold.FinishedAt.Format(time.RFC3339)
+	}
+
+	return response
+}
@@ -7,86 +7,180 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"strconv"
+	"math"
+	"sync"
 	"time"
 
+	"github.com/RexArseny/loyalty_system/internal/app/config"
 	"github.com/RexArseny/loyalty_system/internal/app/external"
 	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/ordernumber"
 	"github.com/RexArseny/loyalty_system/internal/app/repository"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
-const (
-	saltSize         = 16
-	statusCheckTimer = 100
-)
+const saltSize = 16
 
 type Interactor struct {
 	dataRepository       repository.Repository
 	logger               *zap.Logger
-	accrualServiceClient external.AccrualServiceClient
+	statusCheckInterval  time.Duration
+	statusCheckBatchSize int
+	pointsExpiry         time.Duration
+	expirationInterval   time.Duration
+	transferMaxSum       float64
+	transferDailyLimit   float64
+	holdTTL              time.Duration
+	holdExpiration       time.Duration
+	loyaltyTiers         models.LoyaltyTiers
+	loyaltyTierWindow    time.Duration
+	referralBonus        float64
+	referralDailyLimit   int
+	referralMaxRewards   int
+	orderBatchMaxSize    int
+	orderNumbers         *ordernumber.Policy
+	accrualClients       *accrualClients
 }
 
 func NewInteractor(
 	ctx context.Context,
 	logger *zap.Logger,
+	cfg *config.Config,
 	dataRepository repository.Repository,
 	accrualServiceClient external.AccrualServiceClient,
 ) Interactor {
 	interactor := Interactor{
 		dataRepository:       dataRepository,
-		accrualServiceClient: accrualServiceClient,
 		logger:               logger,
+		statusCheckInterval:  cfg.StatusCheckInterval,
+		statusCheckBatchSize: cfg.StatusCheckBatchSize,
+		pointsExpiry:         time.Duration(cfg.PointsExpiryDays) * 24 * time.Hour,
+		expirationInterval:   cfg.PointsExpirationInterval,
+		transferMaxSum:       cfg.TransferMaxSum,
+		transferDailyLimit:   cfg.TransferDailyLimit,
+		holdTTL:              cfg.HoldTTL,
+		holdExpiration:       cfg.HoldExpirationInterval,
+		loyaltyTierWindow:    time.Duration(cfg.LoyaltyTierWindowDays) * 24 * time.Hour,
+		referralBonus:        cfg.ReferralBonus,
+		referralDailyLimit:   cfg.ReferralDailyLimit,
+		referralMaxRewards:   cfg.ReferralMaxRewards,
+		orderBatchMaxSize:    cfg.OrderBatchMaxSize,
+		accrualClients: newAccrualClients(
+			logger.Named("accrual"),
+			accrualServiceClient,
+			cfg.AccrualRateLimit,
+			cfg.AccrualRequestTimeout,
+		),
+	}
+
+	tiers, err := config.ParseLoyaltyTiers(cfg.LoyaltyTiers)
+	if err != nil {
+		logger.Error("Can not parse loyalty tiers, tiers are disabled", zap.Error(err))
+	}
+	interactor.loyaltyTiers = tiers
+
+	interactor.orderNumbers, err = config.ParseOrderNumberPolicy(cfg.OrderNumberSchemes, cfg.OrderNumberPrefixSchemes)
+	if err != nil {
+		logger.Error("Can not parse order number schemes, using luhn", zap.Error(err))
+		interactor.orderNumbers = ordernumber.DefaultPolicy()
 	}
 
 	go interactor.runStatusCheck(ctx)
+	if interactor.pointsExpiry > 0 {
+		go interactor.runPointsExpiration(ctx)
+	}
+	if interactor.holdExpiration > 0 {
+		go interactor.runHoldExpiration(ctx)
+	}
 
 	return interactor
 }
 
 func (i *Interactor) runStatusCheck(ctx context.Context) {
-	ticker := time.NewTicker(statusCheckTimer * time.Millisecond)
-	for range ticker.C {
-		orders, err := i.dataRepository.GetOrdersForUpdate(ctx)
-		if err != nil {
-			i.logger.Error("Can not get order for update", zap.Error(err))
+	ticker := time.NewTicker(i.statusCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			i.checkOrderStatuses(ctx)
 		}
-		if len(orders) == 0 {
-			continue
-		}
+	}
+}
 
-		g, ctx := errgroup.WithContext(ctx)
-		for _, order := range orders {
-			g.Go(func() error {
-				data, err := i.accrualServiceClient.GetData(ctx, order.Number)
-				if err != nil {
-					return fmt.Errorf("can not get data from accrual service: %w", err)
-				}
-				err = i.dataRepository.UpdateOrder(ctx, data.Order, string(data.Status), data.Accrual, order.UserID)
-				if err != nil {
-					return fmt.Errorf("can not update order in repository: %w", err)
-				}
-
-				return nil
-			})
+// checkOrderStatuses asks the accrual service of every merchant about its new
+// orders. Merchants are checked concurrently, so a slow or failing service
+// only delays the orders of its merchant.
+func (i *Interactor) checkOrderStatuses(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, client := range i.accrualClients.list(ctx, i.dataRepository) {
+		if client.paused(time.Now()) {
+			continue
 		}
-
-		if err := g.Wait(); err != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := i.checkMerchantOrders(ctx, client)
+			if err == nil {
+				return
+			}
 			var errTooManyRequests *external.ErrTooManyRequests
 			if errors.As(err, &errTooManyRequests) {
-				time.Sleep(time.Second * time.Duration(errTooManyRequests.RetryAfter()))
-				continue
+				client.pause(time.Now().Add(time.Second * time.Duration(errTooManyRequests.RetryAfter())))
+				return
 			}
-			i.logger.Error("Can not update order", zap.Error(err))
-			return
-		}
+			i.logger.Error("Can not update order", zap.String("merchant_id", client.merchantID), zap.Error(err))
+			client.pause(time.Now().Add(accrualErrorDelay))
+		}()
+	}
+	wg.Wait()
+}
+
+func (i *Interactor) checkMerchantOrders(ctx context.Context, client *accrualClient) error {
+	orders, err := i.dataRepository.GetOrdersForUpdate(ctx, client.merchantID, i.statusCheckBatchSize)
+	if err != nil {
+		return fmt.Errorf("can not get orders for update: %w", err)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, order := range orders {
+		g.Go(func() error {
+			return i.updateOrderStatus(ctx, client, order.Number, order.UserID)
+		})
+	}
+	return g.Wait()
+}
+
+func (i *Interactor) updateOrderStatus(
+	ctx context.Context,
+	client *accrualClient,
+	orderNumber string,
+	userID uuid.UUID,
+) error {
+	data, err := client.getData(ctx, orderNumber)
+	if err != nil {
+		return fmt.Errorf("can not get data from accrual service: %w", err)
 	}
+	err = i.dataRepository.UpdateOrder(
+		ctx,
+		orderNumber,
+		string(orderStatus(data.Status)),
+		data.Accrual,
+		userID,
+		i.pointsExpiresAt(),
+		i.tierPolicy(),
+	)
+	if err != nil {
+		return fmt.Errorf("can not update order in repository: %w", err)
+	}
+
+	return nil
 }
 
-func (i *Interactor) Registration(ctx context.Context, request models.AuthRequest) (*uuid.UUID, error) {
+func (i *Interactor) Registration(ctx context.Context, request models.AuthRequest) (*models.User, error) {
 	userID := uuid.New()
 
 	salt, err := i.generateSalt()
@@ -95,15 +189,32 @@ func (i *Interactor) Registration(ctx context.Context, request models.AuthReques
 	}
 	hash := i.hash([]byte(request.Password), salt)
 
-	err = i.dataRepository.Registration(ctx, request.Login, hash, hex.EncodeToString(salt), userID)
-	if err != nil {
-		return nil, fmt.Errorf("can not register user: %w", err)
+	referral := i.referralPolicy(request.ReferralCode)
+	for attempt := 1; ; attempt++ {
+		var referralCode string
+		referralCode, err = generateReferralCode()
+		if err != nil {
+			return nil, err
+		}
+
+		err = i.dataRepository.Registration(ctx, request.Login, hash, hex.EncodeToString(salt), userID,
+			referralCode, referral)
+		if errors.Is(err, repository.ErrReferralCodeUsed) && attempt < referralCodeAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can not register user: %w", err)
+		}
+		break
 	}
 
-	return &userID, nil
+	return &models.User{
+		UserID: userID,
+		Role:   models.RoleUser,
+	}, nil
 }
 
-func (i *Interactor) Login(ctx context.Context, request models.AuthRequest) (*uuid.UUID, error) {
+func (i *Interactor) Login(ctx context.Context, request models.AuthRequest) (*models.User, error) {
 	data, err := i.dataRepository.GetUser(ctx, request.Login)
 	if err != nil {
 		return nil, fmt.Errorf("can not get login and password: %w", err)
@@ -116,16 +227,29 @@ func (i *Interactor) Login(ctx context.Context, request models.AuthRequest) (*uu
 	if i.hash([]byte(request.Password), salt) != data.Hash {
 		return nil, repository.NewErrInvalidAuthData(request.Login)
 	}
+	if data.Disabled {
+		return nil, repository.ErrUserDisabled
+	}
 
-	return &data.UserID, nil
+	role := models.Role(data.Role)
+	if role == "" {
+		role = models.RoleUser
+	}
+
+	return &models.User{
+		UserID: data.UserID,
+		Role:   role,
+	}, nil
 }
 
-func (i *Interactor) AddOrder(ctx context.Context, orderNumber int, userID uuid.UUID) error {
-	if (orderNumber%10+i.checksum(orderNumber/10))%10 != 0 {
-		return repository.NewErrInvalidOrderNumber(strconv.Itoa(orderNumber))
+// AddOrder uploads an order of the merchant, an empty merchant ID selects the
+// merchant by the order prefix.
+func (i *Interactor) AddOrder(ctx context.Context, orderNumber string, merchantID string, userID uuid.UUID) error {
+	if !i.orderNumbers.Valid(orderNumber) {
+		return repository.NewErrInvalidOrderNumber(orderNumber)
 	}
 
-	err := i.dataRepository.AddOrder(ctx, strconv.Itoa(orderNumber), userID)
+	err := i.dataRepository.AddOrder(ctx, orderNumber, merchantID, userID)
 	if err != nil {
 		return fmt.Errorf("can not add order: %w", err)
 	}
@@ -133,18 +257,88 @@ func (i *Interactor) AddOrder(ctx context.Context, orderNumber int, userID uuid.
 	return nil
 }
 
+// AddOrders uploads several orders at once. Invalid orders are reported
+// without failing the other ones.
+func (i *Interactor) AddOrders(
+	ctx context.Context,
+	orderNumbers []string,
+	merchantID string,
+	userID uuid.UUID,
+) ([]models.OrderUploadResponse, error) {
+	if len(orderNumbers) == 0 {
+		return nil, repository.ErrEmptyBatch
+	}
+	if i.orderBatchMaxSize > 0 && len(orderNumbers) > i.orderBatchMaxSize {
+		return nil, repository.ErrBatchTooLarge
+	}
+
+	response := make([]models.OrderUploadResponse, len(orderNumbers))
+	valid := make([]string, 0, len(orderNumbers))
+	indexes := make([]int, 0, len(orderNumbers))
+	for index, value := range orderNumbers {
+		response[index] = models.OrderUploadResponse{
+			Number: value,
+			Result: models.OrderUploadInvalid,
+		}
+		if !i.orderNumbers.Valid(value) {
+			continue
+		}
+		valid = append(valid, value)
+		indexes = append(indexes, index)
+	}
+	if len(valid) == 0 {
+		return response, nil
+	}
+
+	results, err := i.dataRepository.AddOrders(ctx, valid, merchantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not add orders: %w", err)
+	}
+	for position, result := range results {
+		index := indexes[position]
+		var errAlreadyAdded *repository.ErrAlreadyAdded
+		var errAlreadyAddedByAnotherUser *repository.ErrAlreadyAddedByAnotherUser
+		switch {
+		case result == nil:
+			response[index].Result = models.OrderUploadAccepted
+		case errors.As(result, &errAlreadyAdded):
+			response[index].Result = models.OrderUploadAlreadyAdded
+		case errors.As(result, &errAlreadyAddedByAnotherUser):
+			response[index].Result = models.OrderUploadConflict
+		default:
+			return nil, fmt.Errorf("can not add order: %w", result)
+		}
+	}
+
+	return response, nil
+}
+
 func (i *Interactor) GetOrders(ctx context.Context, userID uuid.UUID) ([]models.OrderResponse, error) {
 	data, err := i.dataRepository.GetOrders(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("can not get orders: %w", err)
 	}
 
+	bonuses, err := i.dataRepository.GetCampaignBonuses(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not get campaign bonuses: %w", err)
+	}
+	orderBonuses := make(map[string][]models.OrderBonusResponse)
+	for _, bonus := range bonuses {
+		orderBonuses[bonus.Order] = append(orderBonuses[bonus.Order], models.OrderBonusResponse{
+			Campaign: bonus.CampaignName,
+			Sum:      bonus.Sum,
+		})
+	}
+
 	response := make([]models.OrderResponse, 0, len(data))
 	for _, item := range data {
 		response = append(response, models.OrderResponse{
 			Number:     item.Number,
 			Status:     item.Status,
 			Accrual:    item.Accrual,
+			Bonuses:    orderBonuses[item.Number],
+			MerchantID: orderMerchantID(item),
 			UploadedAt: item.UploadedAt.Format(time.RFC3339),
 		})
 	}
@@ -158,22 +352,33 @@ func (i *Interactor) GetBalance(ctx context.Context, userID uuid.UUID) (*models.
 		return nil, fmt.Errorf("can not get balance: %w", err)
 	}
 
-	return &models.BalanceResponse{
+	lots, err := i.dataRepository.GetExpiringPoints(ctx, userID, time.Now().Add(expiringPointsWindow))
+	if err != nil {
+		return nil, fmt.Errorf("can not get expiring points: %w", err)
+	}
+
+	response := &models.BalanceResponse{
 		Current:   data.Current,
+		Held:      data.Held,
 		Withdrawn: data.Withdrawn,
-	}, nil
+	}
+	for _, lot := range lots {
+		response.Expiring = append(response.Expiring, models.ExpiringPointsResponse{
+			Order:     lot.Order,
+			ExpiresAt: lot.ExpiresAt.Format(time.RFC3339),
+			Sum:       lot.Remaining,
+		})
+	}
+
+	return response, nil
 }
 
 func (i *Interactor) Withdraw(ctx context.Context, request models.WithdrawRequest, userID uuid.UUID) error {
-	orderNumber, err := strconv.Atoi(request.Order)
-	if err != nil {
-		return fmt.Errorf("can not parse order number: %w", err)
-	}
-	if (orderNumber%10+i.checksum(orderNumber/10))%10 != 0 {
+	if !i.orderNumbers.Valid(request.Order) {
 		return repository.NewErrInvalidOrderNumber(request.Order)
 	}
 
-	err = i.dataRepository.Withdraw(ctx, request.Order, request.Sum, userID)
+	err := i.dataRepository.Withdraw(ctx, request.Order, request.Sum, userID)
 	if err != nil {
 		return fmt.Errorf("can not withdraw: %w", err)
 	}
@@ -193,12 +398,56 @@ func (i *Interactor) GetWithdrawals(ctx context.Context, userID uuid.UUID) ([]mo
 			Order:       item.Order,
 			Sum:         item.Sum,
 			ProcessedAt: item.ProcessedAt.Format(time.RFC3339),
+			Reversed:    item.Reversed,
 		})
 	}
 
 	return response, nil
 }
 
+func (i *Interactor) Transfer(ctx context.Context, request models.TransferRequest, userID uuid.UUID) error {
+	if request.Login == "" {
+		return repository.ErrUserNotFound
+	}
+	if request.Sum <= 0 || math.IsNaN(request.Sum) || math.IsInf(request.Sum, 0) {
+		return repository.ErrInvalidSum
+	}
+	if i.transferMaxSum > 0 && request.Sum > i.transferMaxSum {
+		return repository.ErrTransferLimit
+	}
+
+	err := i.dataRepository.Transfer(ctx, userID, request.Login, request.Sum, i.transferDailyLimit)
+	if err != nil {
+		return fmt.Errorf("can not transfer: %w", err)
+	}
+
+	return nil
+}
+
+func (i *Interactor) GetTransfers(ctx context.Context, userID uuid.UUID) ([]models.TransferResponse, error) {
+	data, err := i.dataRepository.GetTransfers(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not get transfers: %w", err)
+	}
+
+	response := make([]models.TransferResponse, 0, len(data))
+	for _, item := range data {
+		transfer := models.TransferResponse{
+			Login:       item.ToLogin,
+			Direction:   models.TransferOutgoing,
+			ProcessedAt: item.ProcessedAt.Format(time.RFC3339),
+			Sum:         item.Sum,
+		}
+		if item.ToUserID == userID {
+			transfer.Login = item.FromLogin
+			transfer.Direction = models.TransferIncoming
+		}
+		response = append(response, transfer)
+	}
+
+	return response, nil
+}
+
 func (i *Interactor) generateSalt() ([]byte, error) {
 	salt := make([]byte, saltSize)
 
@@ -218,22 +467,9 @@ func (i *Interactor) hash(password []byte, salt []byte) string {
 	return hex.EncodeToString(hashedPassword)
 }
 
-func (i *Interactor) checksum(number int) int {
-	var luhn int
-
-	for i := 0; number > 0; i++ {
-		cur := number % 10
-
-		if i%2 == 0 {
-			cur = cur * 2
-			if cur > 9 {
-				cur = cur%10 + cur/10
-			}
-		}
-
-		luhn += cur
-		number = number / 10
+func orderStatus(status external.Status) models.Status {
+	if status == external.StatusRegistered {
+		return models.StatusNew
 	}
-
-	return luhn % 10
+	return models.Status(status)
 }
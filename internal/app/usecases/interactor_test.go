@@ -2,17 +2,27 @@ package usecases
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/hex"
-	"strconv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/RexArseny/loyalty_system/internal/app/external"
 	"github.com/RexArseny/loyalty_system/internal/app/logger"
 	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/ordernumber"
 	"github.com/RexArseny/loyalty_system/internal/app/repository"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 const (
@@ -41,6 +51,8 @@ func (d *testRepository) Registration(
 	_ string,
 	_ string,
 	_ uuid.UUID,
+	_ string,
+	_ *repository.ReferralPolicy,
 ) error {
 	return nil
 }
@@ -62,7 +74,11 @@ func (d *testRepository) GetUser(_ context.Context, login string) (*repository.U
 	return nil, repository.NewErrInvalidAuthData(login)
 }
 
-func (d *testRepository) AddOrder(_ context.Context, _ string, _ uuid.UUID) error {
+func (d *testRepository) SetUserRole(_ context.Context, _ string, _ string, _ string) error {
+	return nil
+}
+
+func (d *testRepository) AddOrder(_ context.Context, _ string, _ string, _ uuid.UUID) error {
 	return nil
 }
 
@@ -107,7 +123,7 @@ func (d *testRepository) GetWithdrawals(_ context.Context, _ uuid.UUID) ([]repos
 	}, nil
 }
 
-func (d *testRepository) GetOrdersForUpdate(_ context.Context) ([]repository.Order, error) {
+func (d *testRepository) GetOrdersForUpdate(_ context.Context, _ string, _ int) ([]repository.Order, error) {
 	return []repository.Order{}, nil
 }
 
@@ -117,6 +133,8 @@ func (d *testRepository) UpdateOrder(
 	_ string,
 	_ *float64,
 	_ uuid.UUID,
+	_ *time.Time,
+	_ *repository.TierPolicy,
 ) error {
 	return nil
 }
@@ -124,6 +142,37 @@ func (d *testRepository) UpdateOrder(
 func (d *testRepository) Close() {
 }
 
+func (d *testRepository) SearchUsers(_ context.Context, _ string, _ int) ([]repository.User, error) {
+	return nil, nil
+}
+
+func (d *testRepository) GetUserByID(_ context.Context, userID uuid.UUID) (*repository.User, error) {
+	return &repository.User{
+		Role:   string(models.RoleAdmin),
+		UserID: userID,
+	}, nil
+}
+
+func (d *testRepository) GetOrder(_ context.Context, _ string) (*repository.Order, error) {
+	return nil, repository.ErrOrderNotFound
+}
+
+func (d *testRepository) AdjustBalance(_ context.Context, _ repository.AdminAction, _ *time.Time) error {
+	return nil
+}
+
+func (d *testRepository) SetUserDisabled(_ context.Context, _ repository.AdminAction, _ bool) error {
+	return nil
+}
+
+func (d *testRepository) AddAdminAction(_ context.Context, _ repository.AdminAction) error {
+	return nil
+}
+
+func (d *testRepository) GetAdminActions(_ context.Context, _ *uuid.UUID, _ int) ([]repository.AdminAction, error) {
+	return nil, nil
+}
+
 func TestRegistration(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -146,9 +195,9 @@ func TestRegistration(t *testing.T) {
 			assert.NoError(t, err)
 			dataRepository := newTestRepository()
 			interactor := &Interactor{
-				dataRepository:       dataRepository,
-				logger:               testLogger.Named("interactor"),
-				accrualServiceClient: external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				dataRepository: dataRepository,
+				logger:         testLogger.Named("interactor"),
+				accrualClients: newTestAccrualClients(testLogger),
 			}
 
 			result, err := interactor.Registration(ctx, tt.request)
@@ -168,7 +217,7 @@ func TestLogin(t *testing.T) {
 	tests := []struct {
 		name    string
 		request models.AuthRequest
-		want    *uuid.UUID
+		want    *models.User
 		wantErr bool
 	}{
 		{
@@ -186,7 +235,7 @@ func TestLogin(t *testing.T) {
 				Login:    testLogin,
 				Password: testPassword,
 			},
-			want:    &testUUID,
+			want:    &models.User{UserID: testUUID, Role: models.RoleUser},
 			wantErr: false,
 		},
 	}
@@ -197,9 +246,9 @@ func TestLogin(t *testing.T) {
 			assert.NoError(t, err)
 			dataRepository := newTestRepository()
 			interactor := &Interactor{
-				dataRepository:       dataRepository,
-				logger:               testLogger.Named("interactor"),
-				accrualServiceClient: external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				dataRepository: dataRepository,
+				logger:         testLogger.Named("interactor"),
+				accrualClients: newTestAccrualClients(testLogger),
 			}
 
 			result, err := interactor.Login(ctx, tt.request)
@@ -216,10 +265,8 @@ func TestLogin(t *testing.T) {
 func TestAddOrder(t *testing.T) {
 	testUUID, err := uuid.Parse(testUUIDString)
 	assert.NoError(t, err)
-	testOrderNumberValue, err := strconv.Atoi(testOrderNumber)
-	assert.NoError(t, err)
 	type args struct {
-		orderNumber int
+		orderNumber string
 		userID      uuid.UUID
 	}
 	tests := []struct {
@@ -230,11 +277,27 @@ func TestAddOrder(t *testing.T) {
 		{
 			name: "valid data",
 			args: args{
-				orderNumber: testOrderNumberValue,
+				orderNumber: testOrderNumber,
 				userID:      testUUID,
 			},
 			wantErr: false,
 		},
+		{
+			name: "longer than int64",
+			args: args{
+				orderNumber: "12345678901234567890123459",
+				userID:      testUUID,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid checksum",
+			args: args{
+				orderNumber: "12345678902",
+				userID:      testUUID,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		ctx := context.Background()
@@ -242,12 +305,13 @@ func TestAddOrder(t *testing.T) {
 		assert.NoError(t, err)
 		dataRepository := newTestRepository()
 		interactor := &Interactor{
-			dataRepository:       dataRepository,
-			logger:               testLogger.Named("interactor"),
-			accrualServiceClient: external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+			dataRepository: dataRepository,
+			logger:         testLogger.Named("interactor"),
+			accrualClients: newTestAccrualClients(testLogger),
+			orderNumbers:   ordernumber.DefaultPolicy(),
 		}
 
-		err = interactor.AddOrder(ctx, tt.args.orderNumber, tt.args.userID)
+		err = interactor.AddOrder(ctx, tt.args.orderNumber, "", tt.args.userID)
 		if tt.wantErr {
 			assert.Error(t, err)
 		} else {
@@ -287,9 +351,9 @@ func TestGetOrders(t *testing.T) {
 			assert.NoError(t, err)
 			dataRepository := newTestRepository()
 			interactor := &Interactor{
-				dataRepository:       dataRepository,
-				logger:               testLogger.Named("interactor"),
-				accrualServiceClient: external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				dataRepository: dataRepository,
+				logger:         testLogger.Named("interactor"),
+				accrualClients: newTestAccrualClients(testLogger),
 			}
 
 			result, err := interactor.GetOrders(ctx, tt.userID)
@@ -329,9 +393,9 @@ func TestGetBalance(t *testing.T) {
 			assert.NoError(t, err)
 			dataRepository := newTestRepository()
 			interactor := &Interactor{
-				dataRepository:       dataRepository,
-				logger:               testLogger.Named("interactor"),
-				accrualServiceClient: external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				dataRepository: dataRepository,
+				logger:         testLogger.Named("interactor"),
+				accrualClients: newTestAccrualClients(testLogger),
 			}
 
 			result, err := interactor.GetBalance(ctx, tt.userID)
@@ -376,9 +440,10 @@ func TestWithdraw(t *testing.T) {
 			assert.NoError(t, err)
 			dataRepository := newTestRepository()
 			interactor := &Interactor{
-				dataRepository:       dataRepository,
-				logger:               testLogger.Named("interactor"),
-				accrualServiceClient: external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				dataRepository: dataRepository,
+				logger:         testLogger.Named("interactor"),
+				accrualClients: newTestAccrualClients(testLogger),
+				orderNumbers:   ordernumber.DefaultPolicy(),
 			}
 
 			err = interactor.Withdraw(ctx, tt.args.request, tt.args.userID)
@@ -420,9 +485,9 @@ func TestGetWithdrawals(t *testing.T) {
 			assert.NoError(t, err)
 			dataRepository := newTestRepository()
 			interactor := &Interactor{
-				dataRepository:       dataRepository,
-				logger:               testLogger.Named("interactor"),
-				accrualServiceClient: external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				dataRepository: dataRepository,
+				logger:         testLogger.Named("interactor"),
+				accrualClients: newTestAccrualClients(testLogger),
 			}
 
 			result, err := interactor.GetWithdrawals(ctx, tt.userID)
@@ -450,9 +515,9 @@ func TestGenerateSalt(t *testing.T) {
 			assert.NoError(t, err)
 			dataRepository := newTestRepository()
 			interactor := &Interactor{
-				dataRepository:       dataRepository,
-				logger:               testLogger.Named("interactor"),
-				accrualServiceClient: external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				dataRepository: dataRepository,
+				logger:         testLogger.Named("interactor"),
+				accrualClients: newTestAccrualClients(testLogger),
 			}
 
 			result, err := interactor.generateSalt()
@@ -487,9 +552,9 @@ func TestHash(t *testing.T) {
 			assert.NoError(t, err)
 			dataRepository := newTestRepository()
 			interactor := &Interactor{
-				dataRepository:       dataRepository,
-				logger:               testLogger.Named("interactor"),
-				accrualServiceClient: external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				dataRepository: dataRepository,
+				logger:         testLogger.Named("interactor"),
+				accrualClients: newTestAccrualClients(testLogger),
 			}
 
 			result := interactor.hash(tt.args.password, tt.args.salt)
@@ -498,33 +563,1034 @@ func TestHash(t *testing.T) {
 	}
 }
 
-func TestChecksum(t *testing.T) {
-	testOrderNumberValue, err := strconv.Atoi(testOrderNumber)
+func (d *testRepository) GetExpiringPoints(_ context.Context, _ uuid.UUID, _ time.Time) ([]repository.PointLot, error) {
+	return nil, nil
+}
+
+func (d *testRepository) ExpirePoints(_ context.Context, _ time.Time, _ int) ([]repository.PointExpiration, error) {
+	return nil, nil
+}
+
+func TestTransfer(t *testing.T) {
+	testUUID, err := uuid.Parse(testUUIDString)
 	assert.NoError(t, err)
 	tests := []struct {
-		name   string
-		number int
-		want   int
+		name    string
+		request models.TransferRequest
+		wantErr error
 	}{
 		{
-			name:   "valid data",
-			number: testOrderNumberValue,
-			want:   9,
+			name: "valid data",
+			request: models.TransferRequest{
+				Login: testLogin,
+				Sum:   100,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "no login",
+			request: models.TransferRequest{
+				Sum: 100,
+			},
+			wantErr: repository.ErrUserNotFound,
+		},
+		{
+			name: "negative sum",
+			request: models.TransferRequest{
+				Login: testLogin,
+				Sum:   -1,
+			},
+			wantErr: repository.ErrInvalidSum,
+		},
+		{
+			name: "sum over limit",
+			request: models.TransferRequest{
+				Login: testLogin,
+				Sum:   1000.01,
+			},
+			wantErr: repository.ErrTransferLimit,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
 			testLogger, err := logger.InitLogger()
 			assert.NoError(t, err)
 			dataRepository := newTestRepository()
 			interactor := &Interactor{
-				dataRepository:       dataRepository,
-				logger:               testLogger.Named("interactor"),
-				accrualServiceClient: external.NewAccrualServiceClient(testLogger.Named("accrual"), ""),
+				dataRepository: dataRepository,
+				logger:         testLogger.Named("interactor"),
+				accrualClients: newTestAccrualClients(testLogger),
+				transferMaxSum: 1000,
 			}
 
-			result := interactor.checksum(tt.number)
-			assert.Equal(t, tt.want, result)
+			err = interactor.Transfer(ctx, tt.request, testUUID)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestReverseWithdrawal(t *testing.T) {
+	testUUID, err := uuid.Parse(testUUIDString)
+	assert.NoError(t, err)
+	negative := -1.0
+	tests := []struct {
+		name    string
+		request models.ReversalRequest
+		wantErr error
+	}{
+		{
+			name: "unknown withdrawal",
+			request: models.ReversalRequest{
+				ReversalID: "r1",
+			},
+			wantErr: repository.ErrNoWithdrawal,
+		},
+		{
+			name:    "no reversal id",
+			request: models.ReversalRequest{},
+			wantErr: repository.ErrInvalidReversal,
+		},
+		{
+			name: "long reversal id",
+			request: models.ReversalRequest{
+				ReversalID: strings.Repeat("r", 65),
+			},
+			wantErr: repository.ErrInvalidReversal,
+		},
+		{
+			name: "negative sum",
+			request: models.ReversalRequest{
+				Sum:        &negative,
+				ReversalID: "r1",
+			},
+			wantErr: repository.ErrInvalidSum,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			testLogger, err := logger.InitLogger()
+			assert.NoError(t, err)
+			dataRepository := newTestRepository()
+			interactor := &Interactor{
+				dataRepository: dataRepository,
+				logger:         testLogger.Named("interactor"),
+				accrualClients: newTestAccrualClients(testLogger),
+			}
+
+			result, err := interactor.ReverseWithdrawal(ctx, testUUID, testOrderNumber, tt.request)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Nil(t, result)
 		})
 	}
 }
+
+func TestReverseWithdrawalRecordsAction(t *testing.T) {
+	ctx := context.Background()
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+	dataRepository := repository.NewMemoryRepository(testLogger.Named("repository"))
+	interactor := &Interactor{
+		dataRepository: dataRepository,
+		logger:         testLogger.Named("interactor"),
+		accrualClients: newTestAccrualClients(testLogger),
+	}
+
+	user, err := interactor.Registration(ctx, models.AuthRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+	err = dataRepository.AddOrder(ctx, testOrderNumber, "", user.UserID)
+	require.NoError(t, err)
+	accrual := 100.0
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusProcessed), &accrual, user.UserID,
+		nil, nil)
+	require.NoError(t, err)
+	err = dataRepository.Withdraw(ctx, "2377225624", 40, user.UserID)
+	require.NoError(t, err)
+
+	admin, err := interactor.Registration(ctx, models.AuthRequest{Login: "testadmin", Password: testPassword})
+	require.NoError(t, err)
+	err = dataRepository.SetUserRole(ctx, "testadmin", string(models.RoleAdmin), "")
+	require.NoError(t, err)
+	adminID := admin.UserID
+	_, err = interactor.ReverseWithdrawal(ctx, adminID, "2377225624", models.ReversalRequest{ReversalID: "r1"})
+	require.NoError(t, err)
+
+	actions, err := dataRepository.GetAdminActions(ctx, &user.UserID, 10)
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, string(models.AdminActionReverseWithdrawal), actions[0].Action)
+	assert.Equal(t, adminID, actions[0].AdminID)
+	assert.Equal(t, "2377225624", actions[0].OrderNumber)
+	assert.Equal(t, "r1", actions[0].Comment)
+	require.NotNil(t, actions[0].Amount)
+	assert.InDelta(t, 40, *actions[0].Amount, 0.001)
+}
+
+func TestAuthorizeHold(t *testing.T) {
+	testUUID, err := uuid.Parse(testUUIDString)
+	assert.NoError(t, err)
+	tests := []struct {
+		name    string
+		request models.HoldRequest
+		wantErr bool
+	}{
+		{
+			name: "valid data",
+			request: models.HoldRequest{
+				Order: testOrderNumber,
+				Sum:   100,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid order number",
+			request: models.HoldRequest{
+				Order: "12345678902",
+				Sum:   100,
+			},
+			wantErr: true,
+		},
+		{
+			name: "not a number",
+			request: models.HoldRequest{
+				Order: "order",
+				Sum:   100,
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero sum",
+			request: models.HoldRequest{
+				Order: testOrderNumber,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			testLogger, err := logger.InitLogger()
+			assert.NoError(t, err)
+			dataRepository := newTestRepository()
+			interactor := &Interactor{
+				dataRepository: dataRepository,
+				logger:         testLogger.Named("interactor"),
+				accrualClients: newTestAccrualClients(testLogger),
+				orderNumbers:   ordernumber.DefaultPolicy(),
+				holdTTL:        time.Hour,
+			}
+
+			hold, err := interactor.AuthorizeHold(ctx, tt.request, testUUID)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, models.HoldActive, hold.Status)
+			assert.Equal(t, tt.request.Order, hold.Order)
+			assert.NotEmpty(t, hold.HoldID)
+			createdAt, err := time.Parse(time.RFC3339, hold.CreatedAt)
+			require.NoError(t, err)
+			expiresAt, err := time.Parse(time.RFC3339, hold.ExpiresAt)
+			require.NoError(t, err)
+			assert.Equal(t, time.Hour, expiresAt.Sub(createdAt))
+		})
+	}
+}
+
+func TestExpireHolds(t *testing.T) {
+	ctx := context.Background()
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+	dataRepository := repository.NewMemoryRepository(testLogger.Named("repository"))
+	interactor := &Interactor{
+		dataRepository: dataRepository,
+		logger:         testLogger.Named("interactor"),
+		accrualClients: newTestAccrualClients(testLogger),
+		orderNumbers:   ordernumber.DefaultPolicy(),
+		holdTTL:        time.Nanosecond,
+	}
+
+	user, err := interactor.Registration(ctx, models.AuthRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+	err = dataRepository.AddOrder(ctx, testOrderNumber, "", user.UserID)
+	require.NoError(t, err)
+	accrual := 100.0
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusProcessed), &accrual,
+		user.UserID, nil, nil)
+	require.NoError(t, err)
+
+	_, err = interactor.AuthorizeHold(ctx, models.HoldRequest{Order: "2377225624", Sum: 40}, user.UserID)
+	require.NoError(t, err)
+	balance, err := interactor.GetBalance(ctx, user.UserID)
+	require.NoError(t, err)
+	assert.InDelta(t, 60, balance.Current, 0.001)
+	assert.InDelta(t, 40, balance.Held, 0.001)
+
+	err = interactor.ExpireHolds(ctx)
+	require.NoError(t, err)
+
+	balance, err = interactor.GetBalance(ctx, user.UserID)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, balance.Current, 0.001)
+	assert.InDelta(t, 0, balance.Held, 0.001)
+	holds, err := interactor.GetHolds(ctx, user.UserID)
+	require.NoError(t, err)
+	require.Len(t, holds, 1)
+	assert.Equal(t, models.HoldExpired, holds[0].Status)
+	assert.NotEmpty(t, holds[0].FinishedAt)
+}
+
+func TestGetLoyaltyTier(t *testing.T) {
+	ctx := context.Background()
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+	dataRepository := repository.NewMemoryRepository(testLogger.Named("repository"))
+	interactor := &Interactor{
+		dataRepository: dataRepository,
+		logger:         testLogger.Named("interactor"),
+		accrualClients: newTestAccrualClients(testLogger),
+		loyaltyTiers: models.LoyaltyTiers{
+			{Name: "silver", Threshold: 0, Multiplier: 1},
+			{Name: "gold", Threshold: 100, Multiplier: 1.5},
+			{Name: "platinum", Threshold: 1000, Multiplier: 2},
+		},
+		loyaltyTierWindow: 24 * time.Hour,
+	}
+
+	user, err := interactor.Registration(ctx, models.AuthRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+
+	tier, err := interactor.GetLoyaltyTier(ctx, user.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.LoyaltyTierResponse{
+		Tier:              "silver",
+		Multiplier:        1,
+		NextTier:          "gold",
+		NextTierThreshold: 100,
+		Remaining:         100,
+	}, tier)
+
+	err = dataRepository.AddOrder(ctx, testOrderNumber, "", user.UserID)
+	require.NoError(t, err)
+	accrual := 120.0
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusProcessed), &accrual, user.UserID,
+		nil, interactor.tierPolicy())
+	require.NoError(t, err)
+
+	tier, err = interactor.GetLoyaltyTier(ctx, user.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.LoyaltyTierResponse{
+		Tier:              "gold",
+		Multiplier:        1.5,
+		Accrued:           120,
+		NextTier:          "platinum",
+		NextTierThreshold: 1000,
+		Remaining:         880,
+	}, tier)
+
+	interactor.loyaltyTierWindow = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	tier, err = interactor.GetLoyaltyTier(ctx, user.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.LoyaltyTierResponse{
+		Tier:              "silver",
+		Multiplier:        1,
+		NextTier:          "gold",
+		NextTierThreshold: 100,
+		Remaining:         100,
+	}, tier)
+
+	interactor.loyaltyTiers = nil
+	_, err = interactor.GetLoyaltyTier(ctx, user.UserID)
+	assert.ErrorIs(t, err, repository.ErrNoTiers)
+}
+
+func TestCreateCampaign(t *testing.T) {
+	ctx := context.Background()
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+	dataRepository := repository.NewMemoryRepository(testLogger.Named("repository"))
+	interactor := &Interactor{
+		dataRepository: dataRepository,
+		logger:         testLogger.Named("interactor"),
+		accrualClients: newTestAccrualClients(testLogger),
+		loyaltyTiers: models.LoyaltyTiers{
+			{Name: "silver", Threshold: 0, Multiplier: 1},
+			{Name: "gold", Threshold: 100, Multiplier: 1.5},
+		},
+	}
+
+	admin, err := interactor.Registration(ctx, models.AuthRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+
+	startsAt := time.Now().Add(-time.Hour)
+	endsAt := time.Now().Add(time.Hour)
+	multiplier := 2.0
+	lowMultiplier := 1.0
+	bonus := 5.0
+	negative := -1.0
+
+	tests := []struct {
+		name    string
+		request models.CampaignRequest
+		err     error
+	}{
+		{
+			name: "valid multiplier",
+			request: models.CampaignRequest{
+				StartsAt:   startsAt,
+				EndsAt:     endsAt,
+				Multiplier: &multiplier,
+				Name:       "double",
+				Tiers:      []string{"gold"},
+			},
+		},
+		{
+			name: "valid bonus",
+			request: models.CampaignRequest{
+				StartsAt: startsAt,
+				EndsAt:   endsAt,
+				Bonus:    &bonus,
+				Budget:   &bonus,
+				Name:     "fixed",
+				UserIDs:  []string{admin.UserID.String()},
+			},
+		},
+		{
+			name: "empty name",
+			request: models.CampaignRequest{
+				StartsAt: startsAt,
+				EndsAt:   endsAt,
+				Bonus:    &bonus,
+				Name:     " ",
+			},
+			err: repository.ErrInvalidCampaign,
+		},
+		{
+			name: "ends before start",
+			request: models.CampaignRequest{
+				StartsAt: endsAt,
+				EndsAt:   startsAt,
+				Bonus:    &bonus,
+				Name:     "reversed",
+			},
+			err: repository.ErrInvalidCampaign,
+		},
+		{
+			name: "no rule",
+			request: models.CampaignRequest{
+				StartsAt: startsAt,
+				EndsAt:   endsAt,
+				Name:     "empty",
+			},
+			err: repository.ErrInvalidCampaign,
+		},
+		{
+			name: "multiplier and bonus",
+			request: models.CampaignRequest{
+				StartsAt:   startsAt,
+				EndsAt:     endsAt,
+				Multiplier: &multiplier,
+				Bonus:      &bonus,
+				Name:       "both",
+			},
+			err: repository.ErrInvalidCampaign,
+		},
+		{
+			name: "multiplier of one",
+			request: models.CampaignRequest{
+				StartsAt:   startsAt,
+				EndsAt:     endsAt,
+				Multiplier: &lowMultiplier,
+				Name:       "same",
+			},
+			err: repository.ErrInvalidCampaign,
+		},
+		{
+			name: "negative budget",
+			request: models.CampaignRequest{
+				StartsAt: startsAt,
+				EndsAt:   endsAt,
+				Bonus:    &bonus,
+				Budget:   &negative,
+				Name:     "negative",
+			},
+			err: repository.ErrInvalidCampaign,
+		},
+		{
+			name: "unknown tier",
+			request: models.CampaignRequest{
+				StartsAt: startsAt,
+				EndsAt:   endsAt,
+				Bonus:    &bonus,
+				Name:     "platinum",
+				Tiers:    []string{"platinum"},
+			},
+			err: repository.ErrInvalidCampaign,
+		},
+		{
+			name: "invalid user",
+			request: models.CampaignRequest{
+				StartsAt: startsAt,
+				EndsAt:   endsAt,
+				Bonus:    &bonus,
+				Name:     "user",
+				UserIDs:  []string{"testlogin"},
+			},
+			err: repository.ErrInvalidCampaign,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			campaign, err := interactor.CreateCampaign(ctx, admin.UserID, tt.request)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.request.Name, campaign.Name)
+			assert.Equal(t, admin.UserID.String(), campaign.CreatedBy)
+		})
+	}
+
+	campaigns, err := interactor.GetCampaigns(ctx, admin.UserID)
+	require.NoError(t, err)
+	assert.Len(t, campaigns, 2)
+}
+
+func TestRegistrationReferral(t *testing.T) {
+	ctx := context.Background()
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+	dataRepository := repository.NewMemoryRepository(testLogger.Named("repository"))
+	interactor := &Interactor{
+		dataRepository:     dataRepository,
+		logger:             testLogger.Named("interactor"),
+		accrualClients:     newTestAccrualClients(testLogger),
+		referralBonus:      25,
+		referralDailyLimit: 1,
+	}
+
+	referrer, err := interactor.Registration(ctx, models.AuthRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+	referrals, err := interactor.GetReferrals(ctx, referrer.UserID)
+	require.NoError(t, err)
+	assert.Len(t, referrals.Code, referralCodeSize)
+	for _, char := range referrals.Code {
+		assert.Contains(t, referralCodeAlphabet, string(char))
+	}
+
+	_, err = interactor.Registration(ctx, models.AuthRequest{
+		Login:        "testreferee",
+		Password:     testPassword,
+		ReferralCode: " " + strings.ToLower(referrals.Code) + " ",
+	})
+	require.NoError(t, err)
+	_, err = interactor.Registration(ctx, models.AuthRequest{
+		Login:        "testanotherreferee",
+		Password:     testPassword,
+		ReferralCode: referrals.Code,
+	})
+	assert.ErrorIs(t, err, repository.ErrReferralLimit)
+
+	referrals, err = interactor.GetReferrals(ctx, referrer.UserID)
+	require.NoError(t, err)
+	require.Len(t, referrals.Referrals, 1)
+	assert.Equal(t, "testreferee", referrals.Referrals[0].Login)
+	assert.Equal(t, models.ReferralPending, referrals.Referrals[0].Status)
+	assert.InDelta(t, 25, referrals.Referrals[0].Bonus, 0.001)
+}
+
+func TestAddOrders(t *testing.T) {
+	ctx := context.Background()
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+	dataRepository := repository.NewMemoryRepository(testLogger.Named("repository"))
+	interactor := &Interactor{
+		dataRepository:    dataRepository,
+		logger:            testLogger.Named("interactor"),
+		accrualClients:    newTestAccrualClients(testLogger),
+		orderNumbers:      ordernumber.DefaultPolicy(),
+		orderBatchMaxSize: 4,
+	}
+
+	user, err := interactor.Registration(ctx, models.AuthRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+
+	_, err = interactor.AddOrders(ctx, nil, "", user.UserID)
+	assert.ErrorIs(t, err, repository.ErrEmptyBatch)
+	_, err = interactor.AddOrders(ctx, []string{"1", "2", "3", "4", "5"}, "", user.UserID)
+	assert.ErrorIs(t, err, repository.ErrBatchTooLarge)
+
+	result, err := interactor.AddOrders(
+		ctx,
+		[]string{testOrderNumber, "0" + testOrderNumber, "-18", "abc"},
+		"",
+		user.UserID,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []models.OrderUploadResponse{
+		{Number: testOrderNumber, Result: models.OrderUploadAccepted},
+		{Number: "0" + testOrderNumber, Result: models.OrderUploadAccepted},
+		{Number: "-18", Result: models.OrderUploadInvalid},
+		{Number: "abc", Result: models.OrderUploadInvalid},
+	}, result)
+}
+
+func TestExpirePoints(t *testing.T) {
+	ctx := context.Background()
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+	dataRepository := repository.NewMemoryRepository(testLogger.Named("repository"))
+	interactor := &Interactor{
+		dataRepository: dataRepository,
+		logger:         testLogger.Named("interactor"),
+		accrualClients: newTestAccrualClients(testLogger),
+		pointsExpiry:   24 * time.Hour,
+	}
+
+	user, err := interactor.Registration(ctx, models.AuthRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+	err = dataRepository.AddOrder(ctx, testOrderNumber, "", user.UserID)
+	require.NoError(t, err)
+	accrual := 100.0
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(external.StatusProcessed), &accrual, user.UserID,
+		interactor.pointsExpiresAt(), nil)
+	require.NoError(t, err)
+
+	balance, err := interactor.GetBalance(ctx, user.UserID)
+	require.NoError(t, err)
+	require.Len(t, balance.Expiring, 1)
+	assert.Equal(t, testOrderNumber, balance.Expiring[0].Order)
+	assert.InDelta(t, 100, balance.Expiring[0].Sum, 0.001)
+
+	err = interactor.ExpirePoints(ctx)
+	require.NoError(t, err)
+	balance, err = interactor.GetBalance(ctx, user.UserID)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, balance.Current, 0.001)
+
+	interactor.pointsExpiry = -time.Hour
+	assert.Nil(t, interactor.pointsExpiresAt())
+	expired := time.Now().Add(-time.Minute)
+	err = dataRepository.AdjustBalance(ctx, repository.AdminAction{
+		Amount:  &accrual,
+		UserID:  &user.UserID,
+		Action:  string(models.AdminActionAdjustBalance),
+		AdminID: user.UserID,
+	}, &expired)
+	require.NoError(t, err)
+
+	err = interactor.ExpirePoints(ctx)
+	require.NoError(t, err)
+	balance, err = interactor.GetBalance(ctx, user.UserID)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, balance.Current, 0.001)
+	require.Len(t, balance.Expiring, 1)
+	assert.Equal(t, testOrderNumber, balance.Expiring[0].Order)
+}
+
+func (d *testRepository) Transfer(
+	_ context.Context,
+	_ uuid.UUID,
+	_ string,
+	_ float64,
+	_ float64,
+) error {
+	return nil
+}
+
+func (d *testRepository) GetTransfers(_ context.Context, _ uuid.UUID) ([]repository.Transfer, error) {
+	return nil, repository.ErrNoTransfers
+}
+
+func (d *testRepository) ReverseWithdrawal(
+	_ context.Context,
+	_ string,
+	_ string,
+	_ *float64,
+	_ uuid.UUID,
+	_ string,
+	_ *time.Time,
+) (*repository.Reversal, error) {
+	return nil, repository.ErrNoWithdrawal
+}
+
+func (d *testRepository) AuthorizeHold(_ context.Context, _ repository.Hold) error {
+	return nil
+}
+
+func (d *testRepository) CaptureHold(
+	_ context.Context,
+	_ uuid.UUID,
+	_ uuid.UUID,
+	_ time.Time,
+) (*repository.Hold, error) {
+	return nil, repository.ErrHoldNotFound
+}
+
+func (d *testRepository) VoidHold(
+	_ context.Context,
+	_ uuid.UUID,
+	_ uuid.UUID,
+	_ time.Time,
+) (*repository.Hold, error) {
+	return nil, repository.ErrHoldNotFound
+}
+
+func (d *testRepository) GetHolds(_ context.Context, _ uuid.UUID) ([]repository.Hold, error) {
+	return nil, repository.ErrNoHolds
+}
+
+func (d *testRepository) ExpireHolds(_ context.Context, _ time.Time, _ int) ([]repository.Hold, error) {
+	return nil, nil
+}
+
+func (d *testRepository) GetLoyaltyStatus(
+	_ context.Context,
+	_ uuid.UUID,
+	_ time.Time,
+) (*repository.LoyaltyStatus, error) {
+	return &repository.LoyaltyStatus{}, nil
+}
+
+func (d *testRepository) AddCampaign(_ context.Context, _ repository.Campaign) error {
+	return nil
+}
+
+func (d *testRepository) EndCampaign(_ context.Context, _ uuid.UUID, _ time.Time) (*repository.Campaign, error) {
+	return &repository.Campaign{}, nil
+}
+
+func (d *testRepository) GetCampaigns(_ context.Context) ([]repository.Campaign, error) {
+	return nil, repository.ErrNoCampaigns
+}
+
+func (d *testRepository) GetCampaignBonuses(_ context.Context, _ uuid.UUID) ([]repository.CampaignBonus, error) {
+	return nil, nil
+}
+
+func (d *testRepository) GetReferrals(_ context.Context, _ uuid.UUID) (*repository.Referrals, error) {
+	return &repository.Referrals{}, nil
+}
+
+func (d *testRepository) AddOrders(
+	_ context.Context,
+	orderNumbers []string,
+	_ string,
+	_ uuid.UUID,
+) ([]error, error) {
+	return make([]error, len(orderNumbers)), nil
+}
+
+func (d *testRepository) AddMerchant(_ context.Context, _ repository.Merchant) error {
+	return nil
+}
+
+func (d *testRepository) GetMerchants(_ context.Context) ([]repository.Merchant, error) {
+	return nil, repository.ErrNoMerchants
+}
+
+func (d *testRepository) GetStatement(
+	_ context.Context,
+	_ uuid.UUID,
+	_ *time.Time,
+	_ *time.Time,
+	_ func(entry repository.StatementEntry) error,
+) error {
+	return nil
+}
+
+func TestCreateMerchant(t *testing.T) {
+	ctx := context.Background()
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+	dataRepository := repository.NewMemoryRepository(testLogger.Named("repository"))
+	interactor := &Interactor{
+		dataRepository: dataRepository,
+		logger:         testLogger.Named("interactor"),
+		accrualClients: newTestAccrualClients(testLogger),
+	}
+
+	admin, err := interactor.Registration(ctx, models.AuthRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+
+	prefix := "79"
+	invalidPrefix := "7a"
+
+	tests := []struct {
+		name    string
+		request models.MerchantRequest
+		err     error
+	}{
+		{
+			name: "valid",
+			request: models.MerchantRequest{
+				OrderPrefix:    &prefix,
+				MerchantID:     "acme",
+				Name:           "Acme",
+				AccrualAddress: "http://localhost:8081/",
+				RateLimit:      5,
+			},
+		},
+		{
+			name: "existing",
+			request: models.MerchantRequest{
+				MerchantID:     "acme",
+				Name:           "Acme",
+				AccrualAddress: "http://localhost:8082",
+			},
+			err: repository.ErrMerchantExists,
+		},
+		{
+			name: "existing prefix",
+			request: models.MerchantRequest{
+				OrderPrefix:    &prefix,
+				MerchantID:     "other",
+				Name:           "Other",
+				AccrualAddress: "http://localhost:8082",
+			},
+			err: repository.ErrMerchantExists,
+		},
+		{
+			name: "invalid id",
+			request: models.MerchantRequest{
+				MerchantID:     "Acme Inc",
+				Name:           "Acme",
+				AccrualAddress: "http://localhost:8082",
+			},
+			err: repository.ErrInvalidMerchant,
+		},
+		{
+			name: "empty name",
+			request: models.MerchantRequest{
+				MerchantID:     "other",
+				Name:           " ",
+				AccrualAddress: "http://localhost:8082",
+			},
+			err: repository.ErrInvalidMerchant,
+		},
+		{
+			name: "invalid address",
+			request: models.MerchantRequest{
+				MerchantID:     "other",
+				Name:           "Other",
+				AccrualAddress: "ftp://localhost",
+			},
+			err: repository.ErrInvalidMerchant,
+		},
+		{
+			name: "negative rate limit",
+			request: models.MerchantRequest{
+				MerchantID:     "other",
+				Name:           "Other",
+				AccrualAddress: "http://localhost:8082",
+				RateLimit:      -1,
+			},
+			err: repository.ErrInvalidMerchant,
+		},
+		{
+			name: "invalid prefix",
+			request: models.MerchantRequest{
+				OrderPrefix:    &invalidPrefix,
+				MerchantID:     "other",
+				Name:           "Other",
+				AccrualAddress: "http://localhost:8082",
+			},
+			err: repository.ErrInvalidMerchant,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merchant, err := interactor.CreateMerchant(ctx, admin.UserID, tt.request)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.request.MerchantID, merchant.MerchantID)
+			assert.Equal(t, "http://localhost:8081", merchant.AccrualAddress)
+		})
+	}
+
+	merchants, err := interactor.GetMerchants(ctx, admin.UserID)
+	require.NoError(t, err)
+	assert.Len(t, merchants, 1)
+}
+
+func TestCheckOrderStatuses(t *testing.T) {
+	ctx := context.Background()
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+
+	defaultService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer defaultService.Close()
+	var merchantRequests atomic.Int32
+	merchantService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		merchantRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, err := fmt.Fprintf(w, `{"order":%q,"status":"PROCESSED","accrual":100}`, path.Base(r.URL.Path))
+		assert.NoError(t, err)
+	}))
+	defer merchantService.Close()
+
+	dataRepository := repository.NewMemoryRepository(testLogger.Named("repository"))
+	interactor := &Interactor{
+		dataRepository:       dataRepository,
+		logger:               testLogger.Named("interactor"),
+		statusCheckBatchSize: 10,
+		orderNumbers:         ordernumber.DefaultPolicy(),
+		accrualClients: newAccrualClients(
+			testLogger.Named("accrual"),
+			external.NewAccrualServiceClient(testLogger.Named("accrual"), defaultService.URL, time.Second),
+			0,
+			time.Second,
+		),
+	}
+
+	user, err := interactor.Registration(ctx, models.AuthRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+	prefix := "79"
+	_, err = interactor.CreateMerchant(ctx, user.UserID, models.MerchantRequest{
+		OrderPrefix:    &prefix,
+		MerchantID:     "acme",
+		Name:           "Acme",
+		AccrualAddress: merchantService.URL,
+	})
+	require.NoError(t, err)
+
+	err = interactor.AddOrder(ctx, testOrderNumber, "", user.UserID)
+	require.NoError(t, err)
+	err = interactor.AddOrder(ctx, "79927398713", "", user.UserID)
+	require.NoError(t, err)
+	err = interactor.AddOrder(ctx, "2377225624", "acme", user.UserID)
+	require.NoError(t, err)
+	err = interactor.AddOrder(ctx, "49927398716", "unknown", user.UserID)
+	require.ErrorIs(t, err, repository.ErrMerchantNotFound)
+
+	interactor.checkOrderStatuses(ctx)
+
+	orders, err := interactor.GetOrders(ctx, user.UserID)
+	require.NoError(t, err)
+	statuses := make(map[string]string)
+	for _, order := range orders {
+		statuses[order.Number] = order.Status
+	}
+	assert.Equal(t, map[string]string{
+		testOrderNumber: string(models.StatusNew),
+		"79927398713":   string(models.StatusProcessed),
+		"2377225624":    string(models.StatusProcessed),
+	}, statuses)
+	assert.Equal(t, int32(2), merchantRequests.Load())
+
+	defaultClient, err := interactor.accrualClients.get(ctx, dataRepository, "")
+	require.NoError(t, err)
+	assert.True(t, defaultClient.paused(time.Now()))
+	merchantClient, err := interactor.accrualClients.get(ctx, dataRepository, "acme")
+	require.NoError(t, err)
+	assert.False(t, merchantClient.paused(time.Now()))
+}
+
+func TestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	var unlimited *rateLimiter
+	require.NoError(t, unlimited.wait(ctx))
+	assert.Nil(t, newRateLimiter(0))
+
+	limiter := newRateLimiter(20)
+	start := time.Now()
+	for range 3 {
+		require.NoError(t, limiter.wait(ctx))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	limiter = newRateLimiter(0.001)
+	require.NoError(t, limiter.wait(ctx))
+	assert.ErrorIs(t, limiter.wait(ctx), context.Canceled)
+}
+
+func newTestAccrualClients(testLogger *zap.Logger) *accrualClients {
+	return newAccrualClients(
+		testLogger.Named("accrual"),
+		external.NewAccrualServiceClient(testLogger.Named("accrual"), "", 0),
+		0,
+		0,
+	)
+}
+
+func TestWriteStatement(t *testing.T) {
+	ctx := context.Background()
+	testLogger, err := logger.InitLogger()
+	require.NoError(t, err)
+	dataRepository := repository.NewMemoryRepository(testLogger.Named("repository"))
+	interactor := &Interactor{
+		dataRepository: dataRepository,
+		logger:         testLogger.Named("interactor"),
+		accrualClients: newTestAccrualClients(testLogger),
+		orderNumbers:   ordernumber.DefaultPolicy(),
+	}
+
+	user, err := interactor.Registration(ctx, models.AuthRequest{Login: testLogin, Password: testPassword})
+	require.NoError(t, err)
+	err = dataRepository.AddOrder(ctx, testOrderNumber, "", user.UserID)
+	require.NoError(t, err)
+	accrual := 100.5
+	err = dataRepository.UpdateOrder(ctx, testOrderNumber, string(models.StatusProcessed), &accrual, user.UserID,
+		nil, nil)
+	require.NoError(t, err)
+	err = dataRepository.Withdraw(ctx, "2377225624", 20.25, user.UserID)
+	require.NoError(t, err)
+
+	var output strings.Builder
+	err = interactor.WriteStatement(ctx, user.UserID, models.StatementRequest{Format: models.StatementCSV}, &output)
+	require.NoError(t, err)
+	records, err := csv.NewReader(strings.NewReader(output.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"created_at", "type", "order", "amount", "balance"}, records[0])
+	assert.Equal(t, []string{"accrual", testOrderNumber, "100.5", "100.5"}, records[1][1:])
+	assert.Equal(t, []string{"withdrawal", "2377225624", "-20.25", "80.25"}, records[2][1:])
+	_, err = time.Parse(time.RFC3339, records[1][0])
+	assert.NoError(t, err)
+
+	from := time.Now().Add(-time.Hour)
+	output.Reset()
+	err = interactor.WriteStatement(ctx, user.UserID, models.StatementRequest{
+		From:   &from,
+		Format: models.StatementNDJSON,
+	}, &output)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var entry models.StatementEntryResponse
+	err = json.Unmarshal([]byte(lines[1]), &entry)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatementWithdrawal, entry.Type)
+	assert.Equal(t, "2377225624", entry.Order)
+	assert.InDelta(t, -20.25, entry.Amount, 0.001)
+	assert.InDelta(t, 80.25, entry.Balance, 0.001)
+
+	to := from
+	output.Reset()
+	err = interactor.WriteStatement(ctx, user.UserID, models.StatementRequest{
+		To:     &to,
+		Format: models.StatementNDJSON,
+	}, &output)
+	require.NoError(t, err)
+	assert.Empty(t, output.String())
+
+	err = interactor.WriteStatement(ctx, user.UserID, models.StatementRequest{Format: "xml"}, &output)
+	assert.Error(t, err)
+}
@@ -0,0 +1,313 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/external"
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	merchantsRefreshInterval = time.Minute
+	accrualErrorDelay        = 10 * time.Second
+)
+
+var merchantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// CreateMerchant adds a partner chain with its own accrual service. New
+// orders with its prefix or its ID are checked with that service.
+func (i *Interactor) CreateMerchant(
+	ctx context.Context,
+	adminID uuid.UUID,
+	request models.MerchantRequest,
+) (*models.MerchantResponse, error) {
+	merchant, err := newMerchant(request)
+	if err != nil {
+		return nil, err
+	}
+
+	err = i.recordAdminAction(ctx, repository.AdminAction{
+		AdminID: adminID,
+		Action:  string(models.AdminActionCreateMerchant),
+		Comment: merchant.MerchantID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = i.dataRepository.AddMerchant(ctx, *merchant)
+	if err != nil {
+		return nil, fmt.Errorf("can not add merchant: %w", err)
+	}
+	i.accrualClients.expire()
+
+	return merchantResponse(*merchant), nil
+}
+
+func (i *Interactor) GetMerchants(ctx context.Context, adminID uuid.UUID) ([]models.MerchantResponse, error) {
+	err := i.recordAdminAction(ctx, repository.AdminAction{
+		AdminID: adminID,
+		Action:  string(models.AdminActionViewMerchants),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := i.dataRepository.GetMerchants(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can not get merchants: %w", err)
+	}
+
+	response := make([]models.MerchantResponse, 0, len(data))
+	for _, merchant := range data {
+		response = append(response, *merchantResponse(merchant))
+	}
+
+	return response, nil
+}
+
+func newMerchant(request models.MerchantRequest) (*repository.Merchant, error) {
+	merchant := &repository.Merchant{
+		CreatedAt:      time.Now(),
+		MerchantID:     strings.TrimSpace(request.MerchantID),
+		Name:           strings.TrimSpace(request.Name),
+		AccrualAddress: strings.TrimRight(strings.TrimSpace(request.AccrualAddress), "/"),
+		RateLimit:      request.RateLimit,
+	}
+	if !merchantIDPattern.MatchString(merchant.MerchantID) || merchant.Name == "" {
+		return nil, repository.ErrInvalidMerchant
+	}
+	address, err := url.Parse(merchant.AccrualAddress)
+	if err != nil || (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+		return nil, repository.ErrInvalidMerchant
+	}
+	if request.RateLimit < 0 || math.IsNaN(request.RateLimit) || math.IsInf(request.RateLimit, 0) {
+		return nil, repository.ErrInvalidMerchant
+	}
+	if request.OrderPrefix != nil {
+		prefix := strings.TrimSpace(*request.OrderPrefix)
+		if prefix == "" || strings.Trim(prefix, "0123456789") != "" {
+			return nil, repository.ErrInvalidMerchant
+		}
+		merchant.OrderPrefix = &prefix
+	}
+
+	return merchant, nil
+}
+
+func merchantResponse(merchant repository.Merchant) *models.MerchantResponse {
+	return &models.MerchantResponse{
+		MerchantID:     merchant.MerchantID,
+		Name:           merchant.Name,
+		OrderPrefix:    merchant.OrderPrefix,
+		AccrualAddress: merchant.AccrualAddress,
+		RateLimit:      merchant.RateLimit,
+		CreatedAt:      merchant.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func orderMerchantID(order repository.Order) string {
+	if order.MerchantID == nil {
+		return ""
+	}
+	return *order.MerchantID
+}
+
+// accrualClient is the accrual service of a merchant or, for an empty
+// merchant ID, the one at AccrualSystemAddress. Every service has its own
+// rate limit and is paused on its own after errors.
+type accrualClient struct {
+	pausedUntil time.Time
+	limiter     *rateLimiter
+	client      external.AccrualServiceClient
+	merchantID  string
+	address     string
+	rateLimit   float64
+	m           sync.Mutex
+}
+
+func (c *accrualClient) getData(ctx context.Context, orderNumber string) (*external.AccrualResponse, error) {
+	err := c.limiter.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.GetData(ctx, orderNumber)
+}
+
+func (c *accrualClient) pause(until time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if until.After(c.pausedUntil) {
+		c.pausedUntil = until
+	}
+}
+
+func (c *accrualClient) paused(now time.Time) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return now.Before(c.pausedUntil)
+}
+
+// accrualClients keeps a client per merchant and reloads the merchants at
+// most once a minute, so clients and their limits survive between checks.
+type accrualClients struct {
+	refreshedAt time.Time
+	logger      *zap.Logger
+	clients     map[string]*accrualClient
+	timeout     time.Duration
+	m           sync.Mutex
+}
+
+func newAccrualClients(
+	logger *zap.Logger,
+	defaultClient external.AccrualServiceClient,
+	rateLimit float64,
+	timeout time.Duration,
+) *accrualClients {
+	return &accrualClients{
+		logger: logger,
+		clients: map[string]*accrualClient{
+			"": {
+				limiter:   newRateLimiter(rateLimit),
+				client:    defaultClient,
+				rateLimit: rateLimit,
+			},
+		},
+		timeout: timeout,
+	}
+}
+
+func (c *accrualClients) expire() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.refreshedAt = time.Time{}
+}
+
+// list returns the clients of all merchants, reloading them when they are
+// outdated. The clients are kept when the merchants can not be loaded.
+func (c *accrualClients) list(ctx context.Context, dataRepository repository.Repository) []*accrualClient {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if time.Since(c.refreshedAt) >= merchantsRefreshInterval {
+		err := c.refresh(ctx, dataRepository)
+		if err != nil {
+			c.logger.Error("Can not refresh merchants", zap.Error(err))
+		}
+	}
+
+	clients := make([]*accrualClient, 0, len(c.clients))
+	for _, client := range c.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+func (c *accrualClients) get(
+	ctx context.Context,
+	dataRepository repository.Repository,
+	merchantID string,
+) (*accrualClient, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	client, ok := c.clients[merchantID]
+	if ok {
+		return client, nil
+	}
+
+	err := c.refresh(ctx, dataRepository)
+	if err != nil {
+		return nil, err
+	}
+	client, ok = c.clients[merchantID]
+	if !ok {
+		return nil, repository.ErrMerchantNotFound
+	}
+	return client, nil
+}
+
+func (c *accrualClients) refresh(ctx context.Context, dataRepository repository.Repository) error {
+	merchants, err := dataRepository.GetMerchants(ctx)
+	if err != nil && !errors.Is(err, repository.ErrNoMerchants) {
+		return fmt.Errorf("can not get merchants: %w", err)
+	}
+
+	clients := map[string]*accrualClient{"": c.clients[""]}
+	for _, merchant := range merchants {
+		client, ok := c.clients[merchant.MerchantID]
+		if !ok || client.address != merchant.AccrualAddress || client.rateLimit != merchant.RateLimit {
+			client = &accrualClient{
+				limiter: newRateLimiter(merchant.RateLimit),
+				client: external.NewAccrualServiceClient(
+					c.logger.With(zap.String("merchant_id", merchant.MerchantID)),
+					merchant.AccrualAddress,
+					c.timeout,
+				),
+				merchantID: merchant.MerchantID,
+				address:    merchant.AccrualAddress,
+				rateLimit:  merchant.RateLimit,
+			}
+		}
+		clients[merchant.MerchantID] = client
+	}
+	c.clients = clients
+	c.refreshedAt = time.Now()
+
+	return nil
+}
+
+// rateLimiter spaces requests evenly at the given number per second. A nil
+// limiter does not limit.
+type rateLimiter struct {
+	next     time.Time
+	interval time.Duration
+	m        sync.Mutex
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+	}
+}
+
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.m.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.m.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("can not wait for accrual service rate limit: %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,92 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	referralCodeSize     = 8
+	referralCodeAttempts = 3
+	// referralCodeAlphabet leaves out characters that are easy to confuse.
+	referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+func (i *Interactor) GetReferrals(ctx context.Context, userID uuid.UUID) (*models.ReferralsResponse, error) {
+	data, err := i.dataRepository.GetReferrals(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can not get referrals: %w", err)
+	}
+
+	response := &models.ReferralsResponse{
+		Code: data.Code,
+	}
+	if data.ReferredBy != nil {
+		referral := referralResponse(*data.ReferredBy, data.ReferredBy.ReferrerLogin, data.ReferredBy.RefereeBonus)
+		response.ReferredBy = &referral
+		if referral.Status == models.ReferralRewarded {
+			response.Earned += referral.Bonus
+		}
+	}
+	for _, item := range data.Referrals {
+		referral := referralResponse(item, item.RefereeLogin, item.ReferrerBonus)
+		response.Referrals = append(response.Referrals, referral)
+		if referral.Status == models.ReferralRewarded {
+			response.Earned += referral.Bonus
+		}
+	}
+
+	return response, nil
+}
+
+// referralPolicy returns nil when the user registers without a referral code.
+func (i *Interactor) referralPolicy(code string) *repository.ReferralPolicy {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return nil
+	}
+
+	return &repository.ReferralPolicy{
+		Since:      time.Now().Add(-24 * time.Hour),
+		Code:       code,
+		Bonus:      i.referralBonus,
+		DailyLimit: i.referralDailyLimit,
+		MaxRewards: i.referralMaxRewards,
+	}
+}
+
+func generateReferralCode() (string, error) {
+	data := make([]byte, referralCodeSize)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", fmt.Errorf("can not generate referral code: %w", err)
+	}
+
+	for index, value := range data {
+		data[index] = referralCodeAlphabet[int(value)%len(referralCodeAlphabet)]
+	}
+
+	return string(data), nil
+}
+
+func referralResponse(referral repository.Referral, login string, bonus float64) models.ReferralResponse {
+	response := models.ReferralResponse{
+		Login:     login,
+		Status:    models.ReferralPending,
+		Bonus:     bonus,
+		CreatedAt: referral.CreatedAt.Format(time.RFC3339),
+	}
+	if referral.RewardedAt != nil {
+		response.Status = models.ReferralRewarded
+		response.RewardedAt = referral.RewardedAt.Format(time.RFC3339)
+	}
+
+	return response
+}
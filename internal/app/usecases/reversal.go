@@ -0,0 +1,88 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/google/uuid"
+)
+
+const maxReversalIDLength = 64
+
+// ReverseWithdrawal returns points of a withdrawal to the user and records the
+// reversal in the admin actions. Admins reverse any withdrawal, merchants only
+// the ones of their own orders. Repeating a request with the same reversal ID
+// returns the first result.
+func (i *Interactor) ReverseWithdrawal(
+	ctx context.Context,
+	initiatorID uuid.UUID,
+	orderNumber string,
+	request models.ReversalRequest,
+) (*models.ReversalResponse, error) {
+	if request.ReversalID == "" || len(request.ReversalID) > maxReversalIDLength {
+		return nil, repository.ErrInvalidReversal
+	}
+	if request.Sum != nil && (*request.Sum <= 0 || math.IsNaN(*request.Sum) || math.IsInf(*request.Sum, 0)) {
+		return nil, repository.ErrInvalidSum
+	}
+
+	merchantID, err := i.reversalMerchant(ctx, initiatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	reversal, err := i.dataRepository.ReverseWithdrawal(
+		ctx,
+		request.ReversalID,
+		orderNumber,
+		request.Sum,
+		initiatorID,
+		merchantID,
+		i.pointsExpiresAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("can not reverse withdrawal: %w", err)
+	}
+
+	err = i.recordAdminAction(ctx, repository.AdminAction{
+		AdminID:     initiatorID,
+		UserID:      &reversal.UserID,
+		Action:      string(models.AdminActionReverseWithdrawal),
+		OrderNumber: reversal.Order,
+		Amount:      &reversal.Sum,
+		Comment:     reversal.ReversalID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ReversalResponse{
+		ReversalID: reversal.ReversalID,
+		Order:      reversal.Order,
+		CreatedAt:  reversal.CreatedAt.Format(time.RFC3339),
+		Sum:        reversal.Sum,
+	}, nil
+}
+
+// reversalMerchant returns the merchant whose withdrawals the initiator may
+// reverse, an empty one for admins. Merchant users not linked to a merchant
+// find no withdrawals.
+func (i *Interactor) reversalMerchant(ctx context.Context, initiatorID uuid.UUID) (string, error) {
+	user, err := i.dataRepository.GetUserByID(ctx, initiatorID)
+	if err != nil {
+		return "", fmt.Errorf("can not get user: %w", err)
+	}
+
+	switch {
+	case user.Role == string(models.RoleAdmin):
+		return "", nil
+	case user.Role == string(models.RoleMerchant) && user.MerchantID != nil:
+		return *user.MerchantID, nil
+	default:
+		return "", repository.ErrNoWithdrawal
+	}
+}
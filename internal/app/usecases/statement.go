@@ -0,0 +1,120 @@
+package usecases
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/google/uuid"
+)
+
+var statementHeader = []string{"created_at", "type", "order", "amount", "balance"}
+
+// WriteStatement writes the balance changes of a user from request.From up to
+// request.To to w while they are read from the repository. Output is buffered
+// by a few kilobytes, so errors before the first write to w can still be
+// reported instead of the statement.
+func (i *Interactor) WriteStatement(
+	ctx context.Context,
+	userID uuid.UUID,
+	request models.StatementRequest,
+	w io.Writer,
+) error {
+	writer, err := newStatementWriter(request.Format, w)
+	if err != nil {
+		return err
+	}
+
+	err = i.dataRepository.GetStatement(ctx, userID, request.From, request.To,
+		func(entry repository.StatementEntry) error {
+			return writer.write(models.StatementEntryResponse{
+				CreatedAt: entry.CreatedAt.Format(time.RFC3339),
+				Type:      models.StatementEntryType(entry.Type),
+				Order:     entry.Order,
+				Amount:    entry.Amount,
+				Balance:   entry.Balance,
+			})
+		})
+	if err != nil {
+		return fmt.Errorf("can not get statement: %w", err)
+	}
+
+	return writer.flush()
+}
+
+type statementWriter interface {
+	write(entry models.StatementEntryResponse) error
+	flush() error
+}
+
+func newStatementWriter(format models.StatementFormat, w io.Writer) (statementWriter, error) {
+	switch format {
+	case models.StatementCSV:
+		writer := &csvStatementWriter{writer: csv.NewWriter(w)}
+		err := writer.writer.Write(statementHeader)
+		if err != nil {
+			return nil, fmt.Errorf("can not write statement header: %w", err)
+		}
+		return writer, nil
+	case models.StatementNDJSON:
+		buffer := bufio.NewWriter(w)
+		return &ndjsonStatementWriter{buffer: buffer, encoder: json.NewEncoder(buffer)}, nil
+	default:
+		return nil, fmt.Errorf("unknown statement format %q", format)
+	}
+}
+
+type csvStatementWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvStatementWriter) write(entry models.StatementEntryResponse) error {
+	err := w.writer.Write([]string{
+		entry.CreatedAt,
+		string(entry.Type),
+		entry.Order,
+		strconv.FormatFloat(entry.Amount, 'f', -1, 64),
+		strconv.FormatFloat(entry.Balance, 'f', -1, 64),
+	})
+	if err != nil {
+		return fmt.Errorf("can not write statement entry: %w", err)
+	}
+	return nil
+}
+
+func (w *csvStatementWriter) flush() error {
+	w.writer.Flush()
+	err := w.writer.Error()
+	if err != nil {
+		return fmt.Errorf("can not write statement: %w", err)
+	}
+	return nil
+}
+
+type ndjsonStatementWriter struct {
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (w *ndjsonStatementWriter) write(entry models.StatementEntryResponse) error {
+	err := w.encoder.Encode(entry)
+	if err != nil {
+		return fmt.Errorf("can not write statement entry: %w", err)
+	}
+	return nil
+}
+
+func (w *ndjsonStatementWriter) flush() error {
+	err := w.buffer.Flush()
+	if err != nil {
+		return fmt.Errorf("can not write statement: %w", err)
+	}
+	return nil
+}
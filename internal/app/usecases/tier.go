@@ -0,0 +1,55 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/RexArseny/loyalty_system/internal/app/models"
+	"github.com/RexArseny/loyalty_system/internal/app/repository"
+	"github.com/google/uuid"
+)
+
+// GetLoyaltyTier returns the tier of the points the user accrued in the tier
+// window and the points still missing for the next tier.
+func (i *Interactor) GetLoyaltyTier(ctx context.Context, userID uuid.UUID) (*models.LoyaltyTierResponse, error) {
+	policy := i.tierPolicy()
+	if policy == nil {
+		return nil, repository.ErrNoTiers
+	}
+
+	status, err := i.dataRepository.GetLoyaltyStatus(ctx, userID, policy.Since)
+	if err != nil {
+		return nil, fmt.Errorf("can not get loyalty status: %w", err)
+	}
+
+	index := i.loyaltyTiers.ForAccrual(status.Accrued)
+	tier := i.loyaltyTiers[index]
+	response := &models.LoyaltyTierResponse{
+		Tier:       tier.Name,
+		Multiplier: tier.Multiplier,
+		Accrued:    status.Accrued,
+	}
+	if index+1 < len(i.loyaltyTiers) {
+		next := i.loyaltyTiers[index+1]
+		response.NextTier = next.Name
+		response.NextTierThreshold = next.Threshold
+		response.Remaining = max(next.Threshold-status.Accrued, 0)
+	}
+
+	return response, nil
+}
+
+// tierPolicy returns nil when loyalty tiers are disabled.
+func (i *Interactor) tierPolicy() *repository.TierPolicy {
+	if len(i.loyaltyTiers) == 0 {
+		return nil
+	}
+	policy := &repository.TierPolicy{
+		Tiers: i.loyaltyTiers,
+	}
+	if i.loyaltyTierWindow > 0 {
+		policy.Since = time.Now().Add(-i.loyaltyTierWindow)
+	}
+	return policy
+}